@@ -0,0 +1,223 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/containernetworking/cni/libcni"
+)
+
+const redacted = "<redacted>"
+
+// secretKeyWords are substrings of JSON keys whose values are redacted
+var secretKeyWords = []string{"password", "passwd", "secret", "token", "credential", "key", "cert", "kubeconfig"}
+
+// bundleManifest describes the contents of a support bundle
+type bundleManifest struct {
+	CollectedAt time.Time                  `json:"collectedAt"`
+	ConfDir     string                     `json:"confDir"`
+	CacheDir    string                     `json:"cacheDir"`
+	Plugins     []libcni.PluginDiagnostics `json:"plugins"`
+	Files       []bundleFile               `json:"files"`
+	Errors      []string                   `json:"errors,omitempty"`
+}
+
+type bundleFile struct {
+	Source    string `json:"source"`
+	Name      string `json:"name,omitempty"`
+	Size      int    `json:"size"`
+	Truncated bool   `json:"truncated,omitempty"`
+	Skipped   bool   `json:"skipped,omitempty"`
+}
+
+type bundleWriter struct {
+	tw          *tar.Writer
+	manifest    *bundleManifest
+	maxFileSize int
+	remaining   int
+}
+
+func supportBundle(args []string) error {
+	fs := flag.NewFlagSet(CmdSupportBundle, flag.ExitOnError)
+	out := fs.String("out", "cni-support-bundle.tgz", "path of the bundle to write")
+	confDir := fs.String("confdir", netDir(), "network configuration directory")
+	maxFileSize := fs.Int("max-file-size", 1<<20, "maximum bytes collected from a single file")
+	maxSize := fs.Int("max-size", 16<<20, "maximum bytes collected in total")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cninet, err := newCNIConfig()
+	if err != nil {
+		return err
+	}
+	d, err := cninet.CollectDiagnostics(context.TODO(), *confDir)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(*out, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	bw := &bundleWriter{
+		tw: tar.NewWriter(gz),
+		manifest: &bundleManifest{
+			CollectedAt: d.CollectedAt,
+			ConfDir:     d.ConfDir,
+			CacheDir:    d.CacheDir,
+			Plugins:     d.Plugins,
+			Errors:      d.Errors,
+		},
+		maxFileSize: *maxFileSize,
+		remaining:   *maxSize,
+	}
+
+	for _, file := range d.ConfFiles {
+		if err := bw.add("conf", d.ConfDir, file); err != nil {
+			return err
+		}
+	}
+	for _, file := range d.CacheFiles {
+		if err := bw.add("cache", d.CacheDir, file); err != nil {
+			return err
+		}
+	}
+
+	manifest, err := json.MarshalIndent(bw.manifest, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := bw.write("manifest.json", manifest); err != nil {
+		return err
+	}
+	if err := bw.tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "wrote support bundle to %s\n", *out)
+	return f.Close()
+}
+
+// add redacts a collected file and writes it under prefix, enforcing
+// the per-file and total size limits
+func (bw *bundleWriter) add(prefix, baseDir string, file libcni.DiagnosticFile) error {
+	rel, err := filepath.Rel(baseDir, file.Path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		rel = filepath.Base(file.Path)
+	}
+	entry := bundleFile{
+		Source: file.Path,
+		Name:   filepath.ToSlash(filepath.Join(prefix, rel)),
+	}
+
+	data := redact(file.Data)
+	if len(data) > bw.maxFileSize {
+		data = data[:bw.maxFileSize]
+		entry.Truncated = true
+	}
+	if len(data) > bw.remaining {
+		entry.Name = ""
+		entry.Skipped = true
+		bw.manifest.Files = append(bw.manifest.Files, entry)
+		return nil
+	}
+	entry.Size = len(data)
+	bw.remaining -= len(data)
+	bw.manifest.Files = append(bw.manifest.Files, entry)
+	return bw.write(entry.Name, data)
+}
+
+func (bw *bundleWriter) write(name string, data []byte) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0600,
+		Size:    int64(len(data)),
+		ModTime: bw.manifest.CollectedAt,
+	}
+	if err := bw.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := bw.tw.Write(data)
+	return err
+}
+
+// redact replaces the values of secret-looking keys in JSON data. Data
+// that is not JSON cannot be inspected and is replaced entirely.
+func redact(data []byte) []byte {
+	var obj interface{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return []byte(redacted + "\n")
+	}
+	out := &bytes.Buffer{}
+	enc := json.NewEncoder(out)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "    ")
+	if err := enc.Encode(redactValue(obj)); err != nil {
+		return []byte(redacted + "\n")
+	}
+	return out.Bytes()
+}
+
+func redactValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, child := range val {
+			if isSecretKey(k) {
+				val[k] = redacted
+			} else {
+				val[k] = redactValue(child)
+			}
+		}
+	case []interface{}:
+		for i, child := range val {
+			val[i] = redactValue(child)
+		}
+	case string:
+		// Cached attachments embed the network configuration as base64
+		decoded, err := base64.StdEncoding.DecodeString(val)
+		if err != nil || !json.Valid(decoded) || !strings.HasPrefix(strings.TrimSpace(string(decoded)), "{") {
+			return v
+		}
+		return base64.StdEncoding.EncodeToString(redact(decoded))
+	}
+	return v
+}
+
+func isSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, word := range secretKeyWords {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,241 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/containernetworking/cni/libcni"
+	current "github.com/containernetworking/cni/pkg/types/100"
+)
+
+// fault is a mutation of the container's network state that a correct
+// CHECK implementation should detect
+type fault struct {
+	name string
+	// args returns the "ip" command that injects the fault, or nil if the
+	// fault does not apply to the result
+	args func(result *current.Result, ifName, netns string) ([]string, error)
+}
+
+var faults = []fault{
+	{"delete-address", deleteAddress},
+	{"delete-route", deleteRoute},
+	{"flip-mtu", flipMTU},
+}
+
+// chaos runs ADD, then for each fault injects it into the namespace and
+// checks whether CHECK reports an error. The attachment is recreated
+// between faults so that they do not mask each other.
+func chaos(args []string) error {
+	fs := flag.NewFlagSet(CmdChaos, flag.ExitOnError)
+	confFile := fs.String("conf", "", "network configuration list to test")
+	netnsFlag := fs.String("netns", "", "network namespace to attach to")
+	ifName := fs.String("ifname", "eth0", "container interface name")
+	jsonReport := fs.String("report-json", "", "write a JSON report to this file")
+	junitReport := fs.String("report-junit", "", "write a JUnit XML report to this file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *confFile == "" || *netnsFlag == "" {
+		return fmt.Errorf("--conf and --netns are required")
+	}
+
+	netconf, err := libcni.ConfListFromFile(*confFile)
+	if err != nil {
+		return err
+	}
+	if netconf.DisableCheck {
+		return fmt.Errorf("network %q disables CHECK", netconf.Name)
+	}
+	netns, err := filepath.Abs(*netnsFlag)
+	if err != nil {
+		return err
+	}
+
+	cninet, err := newCNIConfig()
+	if err != nil {
+		return err
+	}
+	rt := &libcni.RuntimeConf{
+		ContainerID: containerIDForNetns(netns),
+		NetNS:       netns,
+		IfName:      *ifName,
+	}
+
+	report := &testReport{
+		Command: CmdChaos,
+		Network: netconf.Name,
+		Started: time.Now(),
+	}
+	err = runFaults(cninet, netconf, rt, report)
+	report.Duration = time.Since(report.Started).Seconds()
+	if *jsonReport != "" {
+		if werr := report.writeJSON(*jsonReport); werr != nil {
+			return fmt.Errorf("failed to write JSON report: %v", werr)
+		}
+	}
+	if *junitReport != "" {
+		if werr := report.writeJUnit(*junitReport); werr != nil {
+			return fmt.Errorf("failed to write JUnit report: %v", werr)
+		}
+	}
+	return err
+}
+
+// runFaults injects each fault in turn, recording the outcomes in report
+func runFaults(cninet *libcni.CNIConfig, netconf *libcni.NetworkConfigList, rt *libcni.RuntimeConf, report *testReport) error {
+	for _, f := range faults {
+		if err := runFault(context.TODO(), cninet, netconf, rt, f, report); err != nil {
+			return err
+		}
+	}
+
+	detected := report.count(OutcomePassed)
+	applied := detected + report.count(OutcomeFailed)
+	fmt.Printf("CHECK detected %d of %d injected faults\n", detected, applied)
+	if detected < applied {
+		return fmt.Errorf("CHECK missed %d of %d faults", applied-detected, applied)
+	}
+	return nil
+}
+
+// runFault adds the attachment, injects f and checks that CHECK detects
+// it. The attachment is deleted again on every path once ADD succeeded.
+func runFault(ctx context.Context, cninet *libcni.CNIConfig, netconf *libcni.NetworkConfigList, rt *libcni.RuntimeConf, f fault, report *testReport) (err error) {
+	start := time.Now()
+	tc := testCaseReport{Name: f.name}
+	record := func(outcome, format string, a ...interface{}) {
+		tc.Outcome = outcome
+		tc.Message = fmt.Sprintf(format, a...)
+		tc.Duration = time.Since(start).Seconds()
+		report.Cases = append(report.Cases, tc)
+	}
+
+	r, err := cninet.AddNetworkList(ctx, netconf, rt)
+	if err != nil {
+		record(OutcomeError, "ADD failed: %v", err)
+		return fmt.Errorf("ADD failed: %v", err)
+	}
+	defer func() {
+		if delErr := cninet.DelNetworkList(ctx, netconf, rt); delErr != nil && err == nil {
+			err = fmt.Errorf("DEL failed: %v", delErr)
+		}
+	}()
+
+	result, err := current.NewResultFromResult(r)
+	if err != nil {
+		record(OutcomeError, "%v", err)
+		return err
+	}
+
+	if err := cninet.CheckNetworkList(ctx, netconf, rt); err != nil {
+		record(OutcomeError, "CHECK failed on an unmodified attachment: %v", err)
+		return fmt.Errorf("CHECK failed on an unmodified attachment: %v", err)
+	}
+
+	ipArgs, err := f.args(result, rt.IfName, rt.NetNS)
+	switch {
+	case err != nil:
+		fmt.Printf("%-16s error: %v\n", f.name, err)
+		record(OutcomeError, "%v", err)
+	case ipArgs == nil:
+		fmt.Printf("%-16s skipped: not applicable to the result\n", f.name)
+		record(OutcomeSkipped, "not applicable to the result")
+	default:
+		if err := nsIP(rt.NetNS, ipArgs...); err != nil {
+			fmt.Printf("%-16s error: %v\n", f.name, err)
+			record(OutcomeError, "%v", err)
+			break
+		}
+		if err := cninet.CheckNetworkList(ctx, netconf, rt); err != nil {
+			fmt.Printf("%-16s detected: %v\n", f.name, err)
+			record(OutcomePassed, "detected: %v", err)
+		} else {
+			fmt.Printf("%-16s MISSED\n", f.name)
+			record(OutcomeFailed, "CHECK did not detect the fault")
+		}
+	}
+	return nil
+}
+
+// nsIP runs the "ip" command inside the network namespace
+func nsIP(netns string, args ...string) error {
+	cmd := exec.Command("nsenter", append([]string{"--net=" + netns, "ip"}, args...)...)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("ip %s: %v: %s", strings.Join(args, " "), err, out)
+	}
+	return nil
+}
+
+// sandboxIPs returns the addresses the result assigns inside the container
+func sandboxIPs(result *current.Result) []*current.IPConfig {
+	var ips []*current.IPConfig
+	for _, ip := range result.IPs {
+		if ip.Interface == nil || *ip.Interface < 0 || *ip.Interface >= len(result.Interfaces) ||
+			result.Interfaces[*ip.Interface].Sandbox != "" {
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
+
+func deleteAddress(result *current.Result, ifName, _ string) ([]string, error) {
+	ips := sandboxIPs(result)
+	if len(ips) == 0 {
+		return nil, nil
+	}
+	return []string{"addr", "del", ips[0].Address.String(), "dev", ifName}, nil
+}
+
+func deleteRoute(result *current.Result, _, _ string) ([]string, error) {
+	if len(result.Routes) == 0 {
+		return nil, nil
+	}
+	route := result.Routes[0]
+	args := []string{"route", "del", route.Dst.String()}
+	if route.GW != nil {
+		args = append(args, "via", route.GW.String())
+	}
+	return args, nil
+}
+
+func flipMTU(_ *current.Result, ifName, netns string) ([]string, error) {
+	out, err := exec.Command("nsenter", "--net="+netns, "ip", "-o", "link", "show", "dev", ifName).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read link %q: %v", ifName, err)
+	}
+	fields := strings.Fields(string(out))
+	for i := 0; i < len(fields)-1; i++ {
+		if fields[i] == "mtu" {
+			mtu, err := strconv.Atoi(fields[i+1])
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse MTU of %q: %v", ifName, err)
+			}
+			return []string{"link", "set", "dev", ifName, "mtu", strconv.Itoa(mtu - 1)}, nil
+		}
+	}
+	return nil, fmt.Errorf("no MTU reported for %q", ifName)
+}
@@ -24,6 +24,7 @@ import (
 	"strings"
 
 	"github.com/containernetworking/cni/libcni"
+	"github.com/containernetworking/cni/pkg/invoke"
 )
 
 const (
@@ -32,12 +33,22 @@ const (
 	EnvCapabilityArgs = "CAP_ARGS"
 	EnvCNIArgs        = "CNI_ARGS"
 	EnvCNIIfname      = "CNI_IFNAME"
+	EnvNodeConfig     = "CNI_NODE_CONFIG"
+	EnvTimings        = "CNITOOL_TIMINGS"
 
 	DefaultNetDir = "/etc/cni/net.d"
 
 	CmdAdd   = "add"
 	CmdCheck = "check"
 	CmdDel   = "del"
+	CmdRepl  = "repl"
+
+	CmdSupportBundle = "support-bundle"
+	CmdChaos         = "chaos"
+	CmdK8sArgs       = "k8s-args"
+	CmdDelAll        = "del-all"
+	CmdExplain       = "explain"
+	CmdCompareNodes  = "compare-nodes"
 )
 
 func parseArgs(args string) ([][2]string, error) {
@@ -56,17 +67,72 @@ func parseArgs(args string) ([][2]string, error) {
 	return result, nil
 }
 
+func netDir() string {
+	netdir := os.Getenv(EnvNetDir)
+	if netdir == "" {
+		netdir = DefaultNetDir
+	}
+	return netdir
+}
+
+// newCNIConfig returns a CNIConfig using the plugin path and node
+// configuration from the environment
+func newCNIConfig() (*libcni.CNIConfig, error) {
+	return newCNIConfigWithExec(nil)
+}
+
+// newCNIConfigWithExec is like newCNIConfig, but executes plugins with
+// exec, or the default Exec if exec is nil
+func newCNIConfigWithExec(exec invoke.Exec) (*libcni.CNIConfig, error) {
+	cninet := libcni.NewCNIConfig(filepath.SplitList(os.Getenv(EnvCNIPath)), exec)
+
+	nodeConfig, err := loadNodeConfig()
+	if err != nil {
+		return nil, err
+	}
+	cninet.NodeConfig = nodeConfig
+	return cninet, nil
+}
+
+func loadNodeConfig() (*libcni.NodeConfig, error) {
+	nodeConfigFile := os.Getenv(EnvNodeConfig)
+	if nodeConfigFile == "" {
+		nodeConfigFile = libcni.DefaultNodeConfigFile
+	}
+	return libcni.LoadNodeConfig(nodeConfigFile)
+}
+
+// containerIDForNetns generates the container ID by hashing the netns path
+func containerIDForNetns(netns string) string {
+	s := sha512.Sum512([]byte(netns))
+	return fmt.Sprintf("cnitool-%x", s[:10])
+}
+
 func main() {
+	// Commands that do not operate on a single attachment
+	if len(os.Args) >= 2 {
+		switch os.Args[1] {
+		case CmdSupportBundle:
+			exit(supportBundle(os.Args[2:]))
+		case CmdChaos:
+			exit(chaos(os.Args[2:]))
+		case CmdK8sArgs:
+			exit(k8sArgs(os.Args[2:]))
+		case CmdDelAll:
+			exit(delAll(os.Args[2:]))
+		case CmdExplain:
+			exit(explain(os.Args[2:]))
+		case CmdCompareNodes:
+			exit(compareNodes(os.Args[2:]))
+		}
+	}
+
 	if len(os.Args) < 4 {
 		usage()
 		return
 	}
 
-	netdir := os.Getenv(EnvNetDir)
-	if netdir == "" {
-		netdir = DefaultNetDir
-	}
-	netconf, err := libcni.LoadConfList(netdir, os.Args[2])
+	netconf, err := libcni.LoadConfList(netDir(), os.Args[2])
 	if err != nil {
 		exit(err)
 	}
@@ -93,17 +159,22 @@ func main() {
 		ifName = "eth0"
 	}
 
-	netns := os.Args[3]
-	netns, err = filepath.Abs(netns)
+	netns, containerID, err := attachmentTarget(os.Args[1], os.Args[3:])
 	if err != nil {
 		exit(err)
 	}
 
-	// Generate the containerid by hashing the netns path
-	s := sha512.Sum512([]byte(netns))
-	containerID := fmt.Sprintf("cnitool-%x", s[:10])
-
-	cninet := libcni.NewCNIConfig(filepath.SplitList(os.Getenv(EnvCNIPath)), nil)
+	// Time plugin executions for add and del when requested
+	var exec invoke.Exec
+	var timed *timedExec
+	if os.Getenv(EnvTimings) != "" && (os.Args[1] == CmdAdd || os.Args[1] == CmdDel) {
+		timed = newTimedExec()
+		exec = timed
+	}
+	cninet, err := newCNIConfigWithExec(exec)
+	if err != nil {
+		exit(err)
+	}
 
 	rt := &libcni.RuntimeConf{
 		ContainerID:    containerID,
@@ -115,16 +186,24 @@ func main() {
 
 	switch os.Args[1] {
 	case CmdAdd:
-		result, err := cninet.AddNetworkList(context.TODO(), netconf, rt)
+		result, warnings, err := cninet.AddNetworkListWithWarnings(context.TODO(), netconf, rt)
+		printWarnings(warnings)
+		printTimings(timed)
 		if result != nil {
 			_ = result.Print()
 		}
 		exit(err)
 	case CmdCheck:
-		err := cninet.CheckNetworkList(context.TODO(), netconf, rt)
+		warnings, err := cninet.CheckNetworkListWithWarnings(context.TODO(), netconf, rt)
+		printWarnings(warnings)
 		exit(err)
 	case CmdDel:
-		exit(cninet.DelNetworkList(context.TODO(), netconf, rt))
+		warnings, err := cninet.DelNetworkListWithWarnings(context.TODO(), netconf, rt)
+		printWarnings(warnings)
+		printTimings(timed)
+		exit(err)
+	case CmdRepl:
+		exit(repl(cninet, netconf, rt))
 	}
 }
 
@@ -132,12 +211,25 @@ func usage() {
 	exe := filepath.Base(os.Args[0])
 
 	fmt.Fprintf(os.Stderr, "%s: Add, check, or remove network interfaces from a network namespace\n", exe)
-	fmt.Fprintf(os.Stderr, "  %s add   <net> <netns>\n", exe)
-	fmt.Fprintf(os.Stderr, "  %s check <net> <netns>\n", exe)
-	fmt.Fprintf(os.Stderr, "  %s del   <net> <netns>\n", exe)
+	fmt.Fprintf(os.Stderr, "  %s add   <net> <netns> | --container <id> [--runtime docker|containerd|crio]\n", exe)
+	fmt.Fprintf(os.Stderr, "  %s check <net> <netns> | --container <id> [--runtime docker|containerd|crio]\n", exe)
+	fmt.Fprintf(os.Stderr, "  %s del   <net> <netns> | --container <id> [--runtime docker|containerd|crio]\n", exe)
+	fmt.Fprintf(os.Stderr, "  %s repl  <net> <netns> | --container <id> [--runtime docker|containerd|crio]\n", exe)
+	fmt.Fprintf(os.Stderr, "  %s support-bundle --out <file.tgz>\n", exe)
+	fmt.Fprintf(os.Stderr, "  %s chaos --conf <file.conflist> --netns <netns> [--report-json <file>] [--report-junit <file>]\n", exe)
+	fmt.Fprintf(os.Stderr, "  %s k8s-args --pod <pod.yaml> [--netns <netns>]\n", exe)
+	fmt.Fprintf(os.Stderr, "  %s del-all [--confdir <dir>] [--cachedir <dir>] [--parallel <n>]\n", exe)
+	fmt.Fprintf(os.Stderr, "  %s explain --conf <file.conflist> [--plugin <n>] [--prev-result <file>]\n", exe)
+	fmt.Fprintf(os.Stderr, "  %s compare-nodes [--remote-cnitool <cmd>] <dir|bundle|ssh:host> <dir|bundle|ssh:host>\n", exe)
 	os.Exit(1)
 }
 
+func printWarnings(warnings []*libcni.PluginWarning) {
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+	}
+}
+
 func exit(err error) {
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s\n", err)
@@ -0,0 +1,357 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/containernetworking/cni/libcni"
+)
+
+// sshPrefix marks a compare-nodes target as a host reached with ssh
+const sshPrefix = "ssh:"
+
+// nodeSnapshot is the CNI setup of a node that compare-nodes compares
+type nodeSnapshot struct {
+	name string
+	// confs maps configuration file names to their contents
+	confs map[string][]byte
+	// plugins maps plugin types to their version information, or is nil
+	// if the target holds configurations only
+	plugins map[string]libcni.PluginDiagnostics
+	// cached maps network names to their number of cached attachments,
+	// or is nil if the target holds configurations only
+	cached map[string]int
+}
+
+// compareNodes prints the differences between the CNI setups of two
+// nodes and fails if there are any
+func compareNodes(args []string) error {
+	fs := flag.NewFlagSet(CmdCompareNodes, flag.ExitOnError)
+	remoteCnitool := fs.String("remote-cnitool", "cnitool", "cnitool command run on ssh targets")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return fmt.Errorf("expected two targets, got %d", fs.NArg())
+	}
+
+	a, err := loadNodeSnapshot(fs.Arg(0), *remoteCnitool)
+	if err != nil {
+		return err
+	}
+	b, err := loadNodeSnapshot(fs.Arg(1), *remoteCnitool)
+	if err != nil {
+		return err
+	}
+
+	lines := diffNodes(a, b)
+	for _, line := range lines {
+		fmt.Println(line)
+	}
+	if len(lines) > 0 {
+		return fmt.Errorf("%s and %s differ", a.name, b.name)
+	}
+	fmt.Printf("%s and %s have the same CNI setup\n", a.name, b.name)
+	return nil
+}
+
+// loadNodeSnapshot reads the CNI setup of a target: "ssh:<host>" collects
+// a support bundle on host, a file is read as a support bundle, a
+// directory with a manifest.json as an extracted support bundle, and any
+// other directory as a network configuration directory
+func loadNodeSnapshot(target, remoteCnitool string) (*nodeSnapshot, error) {
+	if strings.HasPrefix(target, sshPrefix) {
+		host := strings.TrimPrefix(target, sshPrefix)
+		cmd := exec.Command("ssh", host, remoteCnitool, CmdSupportBundle, "--out", "/dev/stdout")
+		stderr := &bytes.Buffer{}
+		cmd.Stderr = stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("failed to collect support bundle from %s: %v: %s", host, err, strings.TrimSpace(stderr.String()))
+		}
+		return readBundle(target, bytes.NewReader(out))
+	}
+
+	fi, err := os.Stat(target)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		f, err := os.Open(target)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return readBundle(target, f)
+	}
+	if _, err := os.Stat(filepath.Join(target, "manifest.json")); err == nil {
+		return readBundleDir(target)
+	}
+	return readConfDir(target)
+}
+
+// readBundle reads a support bundle written by support-bundle
+func readBundle(name string, r io.Reader) (*nodeSnapshot, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read support bundle %s: %v", name, err)
+	}
+	files := map[string][]byte{}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read support bundle %s: %v", name, err)
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read support bundle %s: %v", name, err)
+		}
+		files[hdr.Name] = data
+	}
+	return snapshotFromBundle(name, files)
+}
+
+// readBundleDir reads a support bundle extracted to dir
+func readBundleDir(dir string) (*nodeSnapshot, error) {
+	files := map[string][]byte{}
+	err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = data
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return snapshotFromBundle(dir, files)
+}
+
+func snapshotFromBundle(name string, files map[string][]byte) (*nodeSnapshot, error) {
+	var manifest bundleManifest
+	if err := json.Unmarshal(files["manifest.json"], &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse %s manifest: %v", name, err)
+	}
+	snap := &nodeSnapshot{
+		name:    name,
+		confs:   map[string][]byte{},
+		plugins: map[string]libcni.PluginDiagnostics{},
+		cached:  map[string]int{},
+	}
+	for _, p := range manifest.Plugins {
+		snap.plugins[p.Type] = p
+	}
+	for file, data := range files {
+		switch {
+		case strings.HasPrefix(file, "conf/"):
+			snap.confs[path.Base(file)] = data
+		case strings.HasPrefix(file, "cache/"):
+			var cached struct {
+				NetworkName string `json:"networkName"`
+			}
+			if json.Unmarshal(data, &cached) == nil && cached.NetworkName != "" {
+				snap.cached[cached.NetworkName]++
+			}
+		}
+	}
+	return snap, nil
+}
+
+// readConfDir reads the network configuration files in dir
+func readConfDir(dir string) (*nodeSnapshot, error) {
+	files, err := libcni.ConfFiles(dir, []string{".conf", ".conflist", ".json"})
+	if err != nil {
+		return nil, err
+	}
+	snap := &nodeSnapshot{name: dir, confs: map[string][]byte{}}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		snap.confs[filepath.Base(file)] = data
+	}
+	return snap, nil
+}
+
+// diffNodes returns a line for every difference between a and b
+func diffNodes(a, b *nodeSnapshot) []string {
+	var lines []string
+	for _, name := range unionKeys(a.confs, b.confs) {
+		aData, inA := a.confs[name]
+		bData, inB := b.confs[name]
+		switch {
+		case !inB:
+			lines = append(lines, fmt.Sprintf("conf %s: only on %s", name, a.name))
+		case !inA:
+			lines = append(lines, fmt.Sprintf("conf %s: only on %s", name, b.name))
+		default:
+			lines = append(lines, diffConfFiles(name, aData, bData)...)
+		}
+	}
+
+	if a.plugins != nil && b.plugins != nil {
+		types := map[string]bool{}
+		for t := range a.plugins {
+			types[t] = true
+		}
+		for t := range b.plugins {
+			types[t] = true
+		}
+		for _, t := range sortedSet(types) {
+			aVersions, bVersions := pluginVersions(a.plugins, t), pluginVersions(b.plugins, t)
+			if aVersions != bVersions {
+				lines = append(lines, fmt.Sprintf("plugin %s: %s on %s, %s on %s", t, aVersions, a.name, bVersions, b.name))
+			}
+		}
+	}
+
+	if a.cached != nil && b.cached != nil {
+		networks := map[string]bool{}
+		for n := range a.cached {
+			networks[n] = true
+		}
+		for n := range b.cached {
+			networks[n] = true
+		}
+		for _, n := range sortedSet(networks) {
+			if a.cached[n] != b.cached[n] {
+				lines = append(lines, fmt.Sprintf("cache %s: %d attachments on %s, %d on %s", n, a.cached[n], a.name, b.cached[n], b.name))
+			}
+		}
+	}
+	return lines
+}
+
+// diffConfFiles compares two versions of a configuration file, plugin
+// by plugin if both parse as configuration lists
+func diffConfFiles(name string, aData, bData []byte) []string {
+	if bytes.Equal(aData, bData) {
+		return nil
+	}
+	aList, aErr := confListFromBytes(name, aData)
+	bList, bErr := confListFromBytes(name, bData)
+	if aErr != nil || bErr != nil {
+		return []string{fmt.Sprintf("conf %s: differs", name)}
+	}
+	diff, err := libcni.DiffConfLists(aList, bList)
+	if err != nil {
+		return []string{fmt.Sprintf("conf %s: differs", name)}
+	}
+	if diff.Empty() {
+		return nil
+	}
+
+	lines := []string{fmt.Sprintf("conf %s: differs", name)}
+	for _, c := range diff.Changes {
+		lines = append(lines, "    "+formatFieldChange(c))
+	}
+	for _, p := range diff.Plugins {
+		index := p.OldIndex
+		if index < 0 {
+			index = p.NewIndex
+		}
+		lines = append(lines, fmt.Sprintf("    plugin %s [%d]: %s", p.Type, index, p.Action))
+		for _, c := range p.Changes {
+			lines = append(lines, "        "+formatFieldChange(c))
+		}
+	}
+	return lines
+}
+
+func confListFromBytes(name string, data []byte) (*libcni.NetworkConfigList, error) {
+	if strings.HasSuffix(name, ".conflist") {
+		return libcni.ConfListFromBytes(data)
+	}
+	conf, err := libcni.ConfFromBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	return libcni.ConfListFromConf(conf)
+}
+
+func formatFieldChange(c libcni.FieldChange) string {
+	return fmt.Sprintf("%s: %s -> %s", c.Path, formatJSONValue(c.Old), formatJSONValue(c.New))
+}
+
+func formatJSONValue(v interface{}) string {
+	if v == nil {
+		return "(none)"
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+// pluginVersions summarizes the versions a plugin supports on a node
+func pluginVersions(plugins map[string]libcni.PluginDiagnostics, pluginType string) string {
+	p, ok := plugins[pluginType]
+	switch {
+	case !ok:
+		return "not referenced"
+	case p.Error != "":
+		return fmt.Sprintf("error (%s)", p.Error)
+	default:
+		return "versions " + strings.Join(p.SupportedVersions, ",")
+	}
+}
+
+func unionKeys(a, b map[string][]byte) []string {
+	keys := map[string]bool{}
+	for k := range a {
+		keys[k] = true
+	}
+	for k := range b {
+		keys[k] = true
+	}
+	return sortedSet(keys)
+}
+
+func sortedSet(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,177 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// containerRuntimes maps the runtimes whose containers cnitool can target
+// to the directory holding their per-container state
+var containerRuntimes = map[string]string{
+	"docker":     "/var/lib/docker/containers",
+	"containerd": "/run/containerd/io.containerd.runtime.v2.task",
+	"crio":       "/run/containers/storage/overlay-containers",
+}
+
+// attachmentTarget returns the network namespace and container ID that
+// add, check, del and repl operate on. args is either a netns path or
+// --container <id> --runtime <runtime>, naming a container whose netns is
+// looked up in the runtime's state files.
+func attachmentTarget(cmd string, args []string) (string, string, error) {
+	if len(args) == 1 && !strings.HasPrefix(args[0], "-") {
+		netns, err := filepath.Abs(args[0])
+		if err != nil {
+			return "", "", err
+		}
+		return netns, containerIDForNetns(netns), nil
+	}
+
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	container := fs.String("container", "", "ID, or unique ID prefix, of the container")
+	runtime := fs.String("runtime", "docker", "runtime running the container: docker, containerd or crio")
+	stateDir := fs.String("state-dir", "", "directory of the runtime's container state, if not the default")
+	if err := fs.Parse(args); err != nil {
+		return "", "", err
+	}
+	if *container == "" || fs.NArg() > 0 {
+		return "", "", fmt.Errorf("expected a netns path or --container <id>")
+	}
+	root, ok := containerRuntimes[*runtime]
+	if !ok {
+		return "", "", fmt.Errorf("unknown runtime %q", *runtime)
+	}
+	if *stateDir != "" {
+		root = *stateDir
+	}
+	return containerNetns(*runtime, root, *container)
+}
+
+// containerNetns returns the network namespace and full ID of the
+// container whose ID is or starts with id
+func containerNetns(runtime, root, id string) (string, string, error) {
+	var dirs []string
+	var err error
+	if runtime == "containerd" {
+		// Tasks are grouped by containerd namespace, such as k8s.io
+		dirs, err = filepath.Glob(filepath.Join(root, "*", id+"*"))
+	} else {
+		dirs, err = filepath.Glob(filepath.Join(root, id+"*"))
+	}
+	if err != nil {
+		return "", "", err
+	}
+	switch len(dirs) {
+	case 0:
+		return "", "", fmt.Errorf("no %s container %q in %s", runtime, id, root)
+	case 1:
+	default:
+		return "", "", fmt.Errorf("%s container ID %q is ambiguous: %d containers match", runtime, id, len(dirs))
+	}
+	dir := dirs[0]
+
+	var netns string
+	switch runtime {
+	case "docker":
+		netns, err = dockerNetns(dir)
+	case "containerd":
+		netns, err = bundleNetns(dir, "init.pid")
+	case "crio":
+		netns, err = bundleNetns(filepath.Join(dir, "userdata"), "pidfile")
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("failed to find the netns of %s container %s: %v", runtime, filepath.Base(dir), err)
+	}
+	if _, err := os.Stat(netns); os.IsNotExist(err) {
+		return "", "", fmt.Errorf("%s container %s is not running: %v", runtime, filepath.Base(dir), err)
+	} else if err != nil {
+		return "", "", err
+	}
+	return netns, filepath.Base(dir), nil
+}
+
+// dockerNetns reads the sandbox of a docker container from its
+// config.v2.json, falling back to the netns of its process
+func dockerNetns(dir string) (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, "config.v2.json"))
+	if err != nil {
+		return "", err
+	}
+	var config struct {
+		State struct {
+			Pid int
+		}
+		NetworkSettings struct {
+			SandboxKey string
+		}
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return "", err
+	}
+	if config.NetworkSettings.SandboxKey != "" {
+		return config.NetworkSettings.SandboxKey, nil
+	}
+	return pidNetns(config.State.Pid)
+}
+
+// bundleNetns reads the network namespace of an OCI bundle from its
+// config.json, falling back to the netns of the process in pidFile for
+// containers that created their own namespace
+func bundleNetns(dir, pidFile string) (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, "config.json"))
+	if err != nil {
+		return "", err
+	}
+	var spec struct {
+		Linux struct {
+			Namespaces []struct {
+				Type string `json:"type"`
+				Path string `json:"path"`
+			} `json:"namespaces"`
+		} `json:"linux"`
+	}
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return "", err
+	}
+	for _, ns := range spec.Linux.Namespaces {
+		if ns.Type == "network" && ns.Path != "" {
+			return ns.Path, nil
+		}
+	}
+
+	data, err = ioutil.ReadFile(filepath.Join(dir, pidFile))
+	if err != nil {
+		return "", err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return "", fmt.Errorf("invalid pid in %s: %v", pidFile, err)
+	}
+	return pidNetns(pid)
+}
+
+func pidNetns(pid int) (string, error) {
+	if pid <= 0 {
+		return "", fmt.Errorf("container has no running process")
+	}
+	return fmt.Sprintf("/proc/%d/ns/net", pid), nil
+}
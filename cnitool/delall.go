@@ -0,0 +1,122 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/containernetworking/cni/libcni"
+)
+
+// delAll issues DEL for every cached attachment on the node and prints a
+// summary. It fails if any DEL failed, so that it can gate the
+// decommissioning of a node.
+func delAll(args []string) error {
+	fs := flag.NewFlagSet(CmdDelAll, flag.ExitOnError)
+	confDir := fs.String("confdir", netDir(), "directory of network configurations, used for attachments whose cached configuration is unusable")
+	cacheDir := fs.String("cachedir", libcni.CacheDir, "libcni cache directory")
+	parallel := fs.Int("parallel", 4, "number of DELs to run at once")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *parallel < 1 {
+		return fmt.Errorf("--parallel must be at least 1")
+	}
+
+	cninet, err := newCNIConfigWithCacheDir(*cacheDir)
+	if err != nil {
+		return err
+	}
+	attachments, err := cninet.ListAttachments(nil)
+	if err != nil {
+		return err
+	}
+
+	errs := make([]error, len(attachments))
+	sem := make(chan struct{}, *parallel)
+	var wg sync.WaitGroup
+	for i, att := range attachments {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, att *libcni.Attachment) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			errs[i] = delAttachment(cninet, att, *confDir)
+		}(i, att)
+	}
+	wg.Wait()
+
+	failed := 0
+	for i, att := range attachments {
+		status := "deleted"
+		if errs[i] != nil {
+			status = fmt.Sprintf("FAILED: %v", errs[i])
+			failed++
+		}
+		fmt.Printf("%s %s %s: %s\n", att.NetworkName, att.ContainerID, att.IfName, status)
+	}
+	fmt.Printf("%d attachments, %d deleted, %d failed\n", len(attachments), len(attachments)-failed, failed)
+	if failed > 0 {
+		return fmt.Errorf("failed to delete %d of %d attachments", failed, len(attachments))
+	}
+	return nil
+}
+
+// delAttachment runs DEL for att with the configuration it was added
+// with, or the configuration of the same name in confDir if the cached one
+// cannot be parsed
+func delAttachment(cninet *libcni.CNIConfig, att *libcni.Attachment, confDir string) error {
+	netconf, err := cachedConfList(att.Config)
+	if err != nil {
+		if netconf, err = libcni.LoadConfList(confDir, att.NetworkName); err != nil {
+			return err
+		}
+	}
+	warnings, err := cninet.DelNetworkListWithWarnings(context.TODO(), netconf, att.RuntimeConf)
+	printWarnings(warnings)
+	return err
+}
+
+// cachedConfList parses a cached configuration, which is a list for
+// attachments added with AddNetworkList and a single network otherwise
+func cachedConfList(config []byte) (*libcni.NetworkConfigList, error) {
+	if list, err := libcni.ConfListFromBytes(config); err == nil {
+		return list, nil
+	}
+	conf, err := libcni.ConfFromBytes(config)
+	if err != nil {
+		return nil, err
+	}
+	return libcni.ConfListFromConf(conf)
+}
+
+// newCNIConfigWithCacheDir is newCNIConfig with a non-default cache
+// directory
+func newCNIConfigWithCacheDir(cacheDir string) (*libcni.CNIConfig, error) {
+	cninet := libcni.NewCNIConfigWithCacheDir(filepath.SplitList(os.Getenv(EnvCNIPath)), cacheDir, nil)
+	nodeConfig, err := loadNodeConfig()
+	if err != nil {
+		return nil, err
+	}
+	cninet.NodeConfig = nodeConfig
+	return cninet, nil
+}
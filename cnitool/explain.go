@@ -0,0 +1,105 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/containernetworking/cni/libcni"
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/cni/pkg/types/create"
+	"github.com/containernetworking/cni/pkg/version"
+)
+
+// explain prints the configuration a plugin of a list receives on stdin,
+// and which layer of the configuration set each of its fields
+func explain(args []string) error {
+	fs := flag.NewFlagSet(CmdExplain, flag.ExitOnError)
+	confFile := fs.String("conf", "", "network configuration list")
+	plugin := fs.Int("plugin", 1, "position of the plugin in the list, counted from 1")
+	prevResultFile := fs.String("prev-result", "", "file holding the result of the previous plugins, passed as prevResult")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *confFile == "" {
+		return fmt.Errorf("--conf is required")
+	}
+
+	netconf, err := libcni.ConfListFromFile(*confFile)
+	if err != nil {
+		return err
+	}
+
+	var prevResult types.Result
+	if *prevResultFile != "" {
+		if prevResult, err = readResult(*prevResultFile); err != nil {
+			return err
+		}
+	}
+
+	var capabilityArgs map[string]interface{}
+	if value := os.Getenv(EnvCapabilityArgs); value != "" {
+		if err := json.Unmarshal([]byte(value), &capabilityArgs); err != nil {
+			return err
+		}
+	}
+
+	cninet, err := newCNIConfig()
+	if err != nil {
+		return err
+	}
+	explained, err := cninet.ExplainNetworkList(netconf, *plugin-1, prevResult, &libcni.RuntimeConf{CapabilityArgs: capabilityArgs})
+	if err != nil {
+		return err
+	}
+
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, explained.Bytes, "", "    "); err != nil {
+		return err
+	}
+	fmt.Printf("# plugin %d of %d (type %q) receives:\n%s\n\n", *plugin, len(netconf.Plugins), explained.Type, indented.String())
+
+	fields := make([]string, 0, len(explained.Layers))
+	for field := range explained.Layers {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	fmt.Println("# set by:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, field := range fields {
+		fmt.Fprintf(w, "%s\t%s\n", field, explained.Layers[field])
+	}
+	return w.Flush()
+}
+
+// readResult reads a result of the version it declares
+func readResult(path string) (types.Result, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	resultVersion, err := (&version.ConfigDecoder{}).Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	return create.Create(resultVersion, data)
+}
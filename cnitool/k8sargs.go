@@ -0,0 +1,247 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// pod holds the fields of a Kubernetes pod manifest that the runtime
+// turns into CNI arguments
+type pod struct {
+	Metadata struct {
+		Name        string            `yaml:"name"`
+		Namespace   string            `yaml:"namespace"`
+		UID         string            `yaml:"uid"`
+		Annotations map[string]string `yaml:"annotations"`
+	} `yaml:"metadata"`
+	Spec struct {
+		Containers []struct {
+			Ports []struct {
+				ContainerPort int    `yaml:"containerPort"`
+				HostPort      int    `yaml:"hostPort"`
+				HostIP        string `yaml:"hostIP"`
+				Protocol      string `yaml:"protocol"`
+			} `yaml:"ports"`
+		} `yaml:"containers"`
+		DNSConfig *struct {
+			Nameservers []string `yaml:"nameservers"`
+			Searches    []string `yaml:"searches"`
+			Options     []struct {
+				Name  string  `yaml:"name"`
+				Value *string `yaml:"value"`
+			} `yaml:"options"`
+		} `yaml:"dnsConfig"`
+	} `yaml:"spec"`
+}
+
+type k8sPortMapping struct {
+	HostPort      int    `json:"hostPort"`
+	ContainerPort int    `json:"containerPort"`
+	Protocol      string `json:"protocol"`
+	HostIP        string `json:"hostIP,omitempty"`
+}
+
+type k8sBandwidth struct {
+	IngressRate  int64 `json:"ingressRate,omitempty"`
+	IngressBurst int64 `json:"ingressBurst,omitempty"`
+	EgressRate   int64 `json:"egressRate,omitempty"`
+	EgressBurst  int64 `json:"egressBurst,omitempty"`
+}
+
+type k8sDNS struct {
+	Servers  []string `json:"servers,omitempty"`
+	Searches []string `json:"searches,omitempty"`
+	Options  []string `json:"options,omitempty"`
+}
+
+// k8sArgs prints the CNI_ARGS and CAP_ARGS a Kubernetes runtime would
+// pass for the pod in the given manifest, as shell variable assignments
+func k8sArgs(args []string) error {
+	fs := flag.NewFlagSet(CmdK8sArgs, flag.ExitOnError)
+	podFile := fs.String("pod", "", "pod manifest (YAML or JSON)")
+	netnsFlag := fs.String("netns", "", "network namespace that will be passed to cnitool, to derive the container ID")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *podFile == "" {
+		return fmt.Errorf("--pod is required")
+	}
+
+	data, err := ioutil.ReadFile(*podFile)
+	if err != nil {
+		return err
+	}
+	var p pod
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return fmt.Errorf("failed to parse pod manifest: %v", err)
+	}
+	if p.Metadata.Name == "" {
+		return fmt.Errorf("pod manifest has no name")
+	}
+
+	var containerID string
+	if *netnsFlag != "" {
+		netns, err := filepath.Abs(*netnsFlag)
+		if err != nil {
+			return err
+		}
+		containerID = containerIDForNetns(netns)
+	}
+
+	capArgs, err := podCapabilityArgs(&p)
+	if err != nil {
+		return err
+	}
+	capJSON, err := json.Marshal(capArgs)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("export %s=%s\n", EnvCNIArgs, shellQuote(podCNIArgs(&p, containerID)))
+	fmt.Printf("export %s=%s\n", EnvCapabilityArgs, shellQuote(string(capJSON)))
+	return nil
+}
+
+// podCNIArgs returns the CNI_ARGS the kubelet passes for the pod
+func podCNIArgs(p *pod, containerID string) string {
+	namespace := p.Metadata.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+	args := []string{
+		"IgnoreUnknown=1",
+		"K8S_POD_NAMESPACE=" + namespace,
+		"K8S_POD_NAME=" + p.Metadata.Name,
+	}
+	if containerID != "" {
+		args = append(args, "K8S_POD_INFRA_CONTAINER_ID="+containerID)
+	}
+	if p.Metadata.UID != "" {
+		args = append(args, "K8S_POD_UID="+p.Metadata.UID)
+	}
+	return strings.Join(args, ";")
+}
+
+// podCapabilityArgs returns the capability arguments the runtime derives
+// from the pod's host ports, bandwidth annotations and DNS configuration
+func podCapabilityArgs(p *pod) (map[string]interface{}, error) {
+	capArgs := map[string]interface{}{}
+
+	var portMappings []k8sPortMapping
+	for _, c := range p.Spec.Containers {
+		for _, port := range c.Ports {
+			if port.HostPort <= 0 {
+				continue
+			}
+			protocol := strings.ToLower(port.Protocol)
+			if protocol == "" {
+				protocol = "tcp"
+			}
+			portMappings = append(portMappings, k8sPortMapping{
+				HostPort:      port.HostPort,
+				ContainerPort: port.ContainerPort,
+				Protocol:      protocol,
+				HostIP:        port.HostIP,
+			})
+		}
+	}
+	if len(portMappings) > 0 {
+		capArgs["portMappings"] = portMappings
+	}
+
+	var bw k8sBandwidth
+	for annotation, rate := range map[string]*int64{
+		"kubernetes.io/ingress-bandwidth": &bw.IngressRate,
+		"kubernetes.io/egress-bandwidth":  &bw.EgressRate,
+	} {
+		value, ok := p.Metadata.Annotations[annotation]
+		if !ok {
+			continue
+		}
+		parsed, err := parseQuantity(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s annotation: %v", annotation, err)
+		}
+		*rate = parsed
+	}
+	// The kubelet does not limit bursts
+	if bw.IngressRate > 0 {
+		bw.IngressBurst = math.MaxInt32
+	}
+	if bw.EgressRate > 0 {
+		bw.EgressBurst = math.MaxInt32
+	}
+	if bw.IngressRate > 0 || bw.EgressRate > 0 {
+		capArgs["bandwidth"] = bw
+	}
+
+	if dnsConfig := p.Spec.DNSConfig; dnsConfig != nil {
+		dns := k8sDNS{
+			Servers:  dnsConfig.Nameservers,
+			Searches: dnsConfig.Searches,
+		}
+		for _, opt := range dnsConfig.Options {
+			if opt.Value != nil {
+				dns.Options = append(dns.Options, opt.Name+":"+*opt.Value)
+			} else {
+				dns.Options = append(dns.Options, opt.Name)
+			}
+		}
+		capArgs["dns"] = dns
+	}
+
+	return capArgs, nil
+}
+
+var quantitySuffixes = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"Ki", 1 << 10}, {"Mi", 1 << 20}, {"Gi", 1 << 30}, {"Ti", 1 << 40},
+	{"k", 1e3}, {"M", 1e6}, {"G", 1e9}, {"T", 1e12},
+}
+
+// parseQuantity parses an integer Kubernetes quantity such as "10M"
+func parseQuantity(s string) (int64, error) {
+	multiplier := int64(1)
+	number := s
+	for _, q := range quantitySuffixes {
+		if strings.HasSuffix(s, q.suffix) {
+			multiplier = q.multiplier
+			number = strings.TrimSuffix(s, q.suffix)
+			break
+		}
+	}
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%q is not a supported quantity", s)
+	}
+	return n * multiplier, nil
+}
+
+// shellQuote quotes s for a POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
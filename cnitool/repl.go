@@ -0,0 +1,202 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/containernetworking/cni/libcni"
+	"github.com/containernetworking/cni/pkg/types"
+)
+
+const replPrompt = "cnitool> "
+
+// replSession holds the state that survives between commands of an
+// interactive session: the network configuration being iterated on and
+// the result of the last successful ADD.
+type replSession struct {
+	cninet  *libcni.CNIConfig
+	netconf *libcni.NetworkConfigList
+	rt      *libcni.RuntimeConf
+	result  types.Result
+
+	in  *bufio.Scanner
+	out io.Writer
+}
+
+// repl runs an interactive loop against a single attachment. The network
+// namespace is held open for the lifetime of the session so that it is not
+// torn down underneath the plugins between commands.
+func repl(cninet *libcni.CNIConfig, netconf *libcni.NetworkConfigList, rt *libcni.RuntimeConf) error {
+	ns, err := os.Open(rt.NetNS)
+	if err != nil {
+		return fmt.Errorf("failed to open netns %q: %v", rt.NetNS, err)
+	}
+	defer ns.Close()
+
+	s := &replSession{
+		cninet:  cninet,
+		netconf: netconf,
+		rt:      rt,
+		in:      bufio.NewScanner(os.Stdin),
+		out:     os.Stdout,
+	}
+	return s.run()
+}
+
+func (s *replSession) run() error {
+	for {
+		fmt.Fprint(s.out, replPrompt)
+		if !s.in.Scan() {
+			fmt.Fprintln(s.out)
+			return s.in.Err()
+		}
+
+		fields := strings.Fields(s.in.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		var err error
+		switch fields[0] {
+		case CmdAdd:
+			err = s.add()
+		case CmdCheck:
+			err = s.cninet.CheckNetworkList(context.TODO(), s.netconf, s.rt)
+		case CmdDel:
+			err = s.del()
+		case "show":
+			err = s.show()
+		case "edit-conf":
+			err = s.editConf()
+		case "help":
+			s.help()
+		case "quit", "exit":
+			return nil
+		default:
+			err = fmt.Errorf("unknown command %q, try \"help\"", fields[0])
+		}
+
+		if err != nil {
+			fmt.Fprintf(s.out, "error: %v\n", err)
+		} else if fields[0] == CmdCheck || fields[0] == CmdDel {
+			fmt.Fprintln(s.out, "ok")
+		}
+	}
+}
+
+func (s *replSession) add() error {
+	result, err := s.cninet.AddNetworkList(context.TODO(), s.netconf, s.rt)
+	if err != nil {
+		return err
+	}
+	s.result = result
+	return s.printResult(result)
+}
+
+func (s *replSession) del() error {
+	if err := s.cninet.DelNetworkList(context.TODO(), s.netconf, s.rt); err != nil {
+		return err
+	}
+	s.result = nil
+	return nil
+}
+
+// show prints the current configuration and the cached result, if any
+func (s *replSession) show() error {
+	fmt.Fprintf(s.out, "container: %s\nnetns:     %s\nifname:    %s\n", s.rt.ContainerID, s.rt.NetNS, s.rt.IfName)
+	fmt.Fprintf(s.out, "config:\n%s\n", string(s.netconf.Bytes))
+
+	result, err := s.cninet.GetNetworkListCachedResult(s.netconf, s.rt)
+	if err != nil {
+		return err
+	}
+	if result == nil {
+		result = s.result
+	}
+	if result == nil {
+		fmt.Fprintln(s.out, "result: <none>")
+		return nil
+	}
+	fmt.Fprintln(s.out, "result:")
+	return s.printResult(result)
+}
+
+// editConf opens the configuration in $EDITOR and reloads it on exit.
+// The attachment is left untouched; the new configuration is used by
+// the next command.
+func (s *replSession) editConf() error {
+	f, err := ioutil.TempFile("", "cnitool-*.conflist")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(s.netconf.Bytes); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
+	cmd := exec.Command(editor, f.Name())
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("editor %q failed: %v", editor, err)
+	}
+
+	netconf, err := libcni.ConfListFromFile(f.Name())
+	if err != nil {
+		return fmt.Errorf("keeping previous configuration: %v", err)
+	}
+	if netconf.Name != s.netconf.Name {
+		fmt.Fprintf(s.out, "warning: network renamed from %q to %q; cached state for the old name is not migrated\n", s.netconf.Name, netconf.Name)
+	}
+	s.netconf = netconf
+	fmt.Fprintln(s.out, "configuration reloaded")
+	return nil
+}
+
+func (s *replSession) printResult(result types.Result) error {
+	if err := result.PrintTo(s.out); err != nil {
+		return err
+	}
+	fmt.Fprintln(s.out)
+	return nil
+}
+
+func (s *replSession) help() {
+	fmt.Fprintln(s.out, "commands:")
+	fmt.Fprintln(s.out, "  add        run ADD for the network and print the result")
+	fmt.Fprintln(s.out, "  check      run CHECK for the network")
+	fmt.Fprintln(s.out, "  del        run DEL for the network")
+	fmt.Fprintln(s.out, "  show       print the configuration and cached result")
+	fmt.Fprintln(s.out, "  edit-conf  edit the configuration in $EDITOR")
+	fmt.Fprintln(s.out, "  quit       leave the session")
+}
@@ -0,0 +1,130 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// Outcomes of a single test case in a report
+const (
+	OutcomePassed  = "passed"
+	OutcomeFailed  = "failed"
+	OutcomeSkipped = "skipped"
+	OutcomeError   = "error"
+)
+
+// testReport is the machine-readable result of a cnitool test command
+type testReport struct {
+	Command  string           `json:"command"`
+	Network  string           `json:"network"`
+	Started  time.Time        `json:"started"`
+	Duration float64          `json:"durationSeconds"`
+	Cases    []testCaseReport `json:"cases"`
+}
+
+type testCaseReport struct {
+	Name     string  `json:"name"`
+	Outcome  string  `json:"outcome"`
+	Message  string  `json:"message,omitempty"`
+	Duration float64 `json:"durationSeconds"`
+}
+
+// count returns the number of cases with the given outcome
+func (r *testReport) count(outcome string) int {
+	n := 0
+	for _, c := range r.Cases {
+		if c.Outcome == outcome {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *testReport) writeJSON(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr,omitempty"`
+}
+
+func (r *testReport) writeJUnit(path string) error {
+	suite := junitTestSuite{
+		Name:      fmt.Sprintf("cnitool %s: %s", r.Command, r.Network),
+		Tests:     len(r.Cases),
+		Failures:  r.count(OutcomeFailed),
+		Errors:    r.count(OutcomeError),
+		Skipped:   r.count(OutcomeSkipped),
+		Time:      fmt.Sprintf("%.3f", r.Duration),
+		Timestamp: r.Started.UTC().Format("2006-01-02T15:04:05"),
+	}
+	for _, c := range r.Cases {
+		tc := junitTestCase{
+			Name:      c.Name,
+			ClassName: fmt.Sprintf("%s.%s", r.Command, r.Network),
+			Time:      fmt.Sprintf("%.3f", c.Duration),
+		}
+		msg := &junitMessage{Message: c.Message}
+		switch c.Outcome {
+		case OutcomeFailed:
+			tc.Failure = msg
+		case OutcomeError:
+			tc.Error = msg
+		case OutcomeSkipped:
+			tc.Skipped = msg
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+
+	data, err := xml.MarshalIndent(junitTestSuites{Suites: []junitTestSuite{suite}}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append([]byte(xml.Header), append(data, '\n')...), 0644)
+}
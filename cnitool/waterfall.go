@@ -0,0 +1,138 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/containernetworking/cni/pkg/invoke"
+	"github.com/containernetworking/cni/pkg/version"
+)
+
+// waterfallWidth is the width of the bars of the timing waterfall
+const waterfallWidth = 40
+
+// pluginExec is one execution of a plugin
+type pluginExec struct {
+	plugin     string
+	command    string
+	start      time.Time
+	duration   time.Duration
+	stdinSize  int
+	resultSize int
+	err        error
+}
+
+// timedExec records each plugin execution for the timing waterfall
+type timedExec struct {
+	invoke.Exec
+	execs []pluginExec
+}
+
+// newTimedExec returns a timedExec executing plugins like libcni does by
+// default
+func newTimedExec() *timedExec {
+	return &timedExec{Exec: &invoke.DefaultExec{
+		RawExec:       &invoke.RawExec{Stderr: os.Stderr},
+		PluginDecoder: version.PluginDecoder{},
+	}}
+}
+
+func (e *timedExec) ExecPlugin(ctx context.Context, pluginPath string, stdinData []byte, environ []string) ([]byte, error) {
+	start := time.Now()
+	result, err := e.Exec.ExecPlugin(ctx, pluginPath, stdinData, environ)
+	command := ""
+	for _, kv := range environ {
+		if strings.HasPrefix(kv, "CNI_COMMAND=") {
+			command = strings.TrimPrefix(kv, "CNI_COMMAND=")
+		}
+	}
+	e.execs = append(e.execs, pluginExec{
+		plugin:     strings.TrimSuffix(filepath.Base(pluginPath), ".exe"),
+		command:    command,
+		start:      start,
+		duration:   time.Since(start),
+		stdinSize:  len(stdinData),
+		resultSize: len(result),
+		err:        err,
+	})
+	return result, err
+}
+
+// printTimings prints the timing waterfall of e to stderr, if plugin
+// executions were timed
+func printTimings(e *timedExec) {
+	if e == nil {
+		return
+	}
+	if err := printWaterfall(os.Stderr, e.execs); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to print timings: %v\n", err)
+	}
+}
+
+// printWaterfall prints a table of the plugin executions with a bar
+// showing when each ran relative to the others, so that the plugin
+// responsible for a slow operation stands out
+func printWaterfall(out io.Writer, execs []pluginExec) error {
+	if len(execs) == 0 {
+		return nil
+	}
+	first := execs[0].start
+	end := first
+	for _, e := range execs {
+		if e.start.Add(e.duration).After(end) {
+			end = e.start.Add(e.duration)
+		}
+	}
+	total := end.Sub(first)
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PLUGIN\tCOMMAND\tSTART\tDURATION\tSTDIN\tRESULT\tSTATUS\tTIMELINE")
+	for _, e := range execs {
+		status := "ok"
+		if e.err != nil {
+			status = "failed"
+		}
+		offset := e.start.Sub(first)
+		fmt.Fprintf(w, "%s\t%s\t%v\t%v\t%dB\t%dB\t%s\t%s\n", e.plugin, e.command,
+			offset.Round(time.Millisecond), e.duration.Round(time.Millisecond),
+			e.stdinSize, e.resultSize, status, waterfallBar(offset, e.duration, total))
+	}
+	return w.Flush()
+}
+
+// waterfallBar draws an execution of duration starting at offset on a bar
+// spanning total
+func waterfallBar(offset, duration, total time.Duration) string {
+	lead, length := 0, waterfallWidth
+	if total > 0 {
+		lead = int(int64(waterfallWidth) * int64(offset) / int64(total))
+		length = int(int64(waterfallWidth) * int64(duration) / int64(total))
+	}
+	if length < 1 {
+		length = 1
+	}
+	if lead+length > waterfallWidth {
+		lead = waterfallWidth - length
+	}
+	return "|" + strings.Repeat(" ", lead) + strings.Repeat("#", length) + strings.Repeat(" ", waterfallWidth-lead-length) + "|"
+}
@@ -5,4 +5,5 @@ go 1.14
 require (
 	github.com/onsi/ginkgo v1.13.0
 	github.com/onsi/gomega v1.10.1
+	gopkg.in/yaml.v2 v2.3.0
 )
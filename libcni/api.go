@@ -22,9 +22,11 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/containernetworking/cni/pkg/invoke"
 	"github.com/containernetworking/cni/pkg/types"
+	current "github.com/containernetworking/cni/pkg/types/100"
 	"github.com/containernetworking/cni/pkg/utils"
 	"github.com/containernetworking/cni/pkg/version"
 )
@@ -50,9 +52,23 @@ type RuntimeConf struct {
 	// to plugins as top-level keys in the 'runtimeConfig' dictionary
 	// of the plugin's stdin data.  libcni will ensure that only keys
 	// in this map which match the capabilities of the plugin are passed
-	// to the plugin
+	// to the plugin. If it is empty on CHECK or DEL, the map cached by
+	// ADD is used.
 	CapabilityArgs map[string]interface{}
 
+	// IfNamePrefix, when set and IfName is empty, asks libcni to choose
+	// the interface name on ADD. The first name of the form
+	// <IfNamePrefix><index> that is not used by another cached attachment
+	// of the same container is chosen and stored in IfName, which must
+	// then be passed to subsequent CHECK and DEL operations. The chosen
+	// name is also returned as an interface in the sandbox in results of
+	// version 1.0.0 and later.
+	IfNamePrefix string
+
+	// Labels are arbitrary key/value pairs recorded with the attachment
+	// on ADD. They are not passed to plugins; see ListAttachments.
+	Labels map[string]string
+
 	// DEPRECATED. Will be removed in a future release.
 	CacheDir string
 }
@@ -60,41 +76,128 @@ type RuntimeConf struct {
 type NetworkConfig struct {
 	Network *types.NetConf
 	Bytes   []byte
+	// Optional is set by "optional": true in the plugin's configuration.
+	// When it is part of a list, failures of an optional plugin do not
+	// fail the list; see AddNetworkListWithWarnings.
+	Optional bool
+	// Legacy is set by "legacy": true in the plugin's configuration. It
+	// marks a plugin in a list that may only support an older version of
+	// the specification than the list, such as a 0.2.0 vendor binary. It
+	// is run with the highest version it supports that is not newer than
+	// the list's: its configuration is downgraded, it only receives a
+	// prevResult if that version defines one, its result is upgraded to
+	// the list's version, and CHECK is skipped if that version does not
+	// define it. Each adaptation is reported as a PluginWarning.
+	Legacy bool
 }
 
 type NetworkConfigList struct {
 	Name         string
 	CNIVersion   string
 	DisableCheck bool
-	Plugins      []*NetworkConfig
-	Bytes        []byte
+	// Priority orders lists in the same directory: when several define
+	// the same network, or when the default network is chosen, the one
+	// with the highest priority wins. It defaults to 0; see LoadNetworks.
+	Priority int
+	Plugins  []*NetworkConfig
+	Bytes    []byte
+}
+
+// PluginWarning describes a failure of an optional plugin in a list, or
+// a command that was adapted for a legacy plugin
+type PluginWarning struct {
+	// Type is the type of the plugin, or empty for a warning about the
+	// operation as a whole, such as a StateWriter failure
+	Type    string
+	Command string
+	Err     error
+	// Message describes a warning that is not a failure. It is only set
+	// when Err is nil.
+	Message string
 }
 
+func (w *PluginWarning) String() string {
+	if w.Type == "" {
+		return fmt.Sprintf("%s: %s", w.Command, w.Message)
+	}
+	if w.Err == nil {
+		return fmt.Sprintf("plugin %q %s: %s", w.Type, w.Command, w.Message)
+	}
+	return fmt.Sprintf("optional plugin %q failed %s: %v", w.Type, w.Command, w.Err)
+}
+
+// CNI is the interface runtimes use to manage networks. It is composed of
+// smaller interfaces so that callers can depend on, and fakes can
+// implement, only the part they need.
 type CNI interface {
+	NetworkInvoker
+	CacheReader
+	ConfValidator
+}
+
+// NetworkInvoker runs the ADD, CHECK and DEL commands of networks
+type NetworkInvoker interface {
 	AddNetworkList(ctx context.Context, net *NetworkConfigList, rt *RuntimeConf) (types.Result, error)
 	CheckNetworkList(ctx context.Context, net *NetworkConfigList, rt *RuntimeConf) error
 	DelNetworkList(ctx context.Context, net *NetworkConfigList, rt *RuntimeConf) error
-	GetNetworkListCachedResult(net *NetworkConfigList, rt *RuntimeConf) (types.Result, error)
-	GetNetworkListCachedConfig(net *NetworkConfigList, rt *RuntimeConf) ([]byte, *RuntimeConf, error)
 
 	AddNetwork(ctx context.Context, net *NetworkConfig, rt *RuntimeConf) (types.Result, error)
 	CheckNetwork(ctx context.Context, net *NetworkConfig, rt *RuntimeConf) error
 	DelNetwork(ctx context.Context, net *NetworkConfig, rt *RuntimeConf) error
+}
+
+// CacheReader reads the results and configurations cached by ADD
+type CacheReader interface {
+	GetNetworkListCachedResult(net *NetworkConfigList, rt *RuntimeConf) (types.Result, error)
+	GetNetworkListCachedConfig(net *NetworkConfigList, rt *RuntimeConf) ([]byte, *RuntimeConf, error)
+
 	GetNetworkCachedResult(net *NetworkConfig, rt *RuntimeConf) (types.Result, error)
 	GetNetworkCachedConfig(net *NetworkConfig, rt *RuntimeConf) ([]byte, *RuntimeConf, error)
+}
 
+// ConfValidator checks network configurations against their plugins
+type ConfValidator interface {
 	ValidateNetworkList(ctx context.Context, net *NetworkConfigList) ([]string, error)
 	ValidateNetwork(ctx context.Context, net *NetworkConfig) ([]string, error)
 }
 
+// ConfLoader looks up network configurations by name. It is not part of
+// CNI so that existing implementations of CNI keep compiling.
+type ConfLoader interface {
+	ResolveNetworkList(ctx context.Context, name string) (*NetworkConfigList, error)
+}
+
 type CNIConfig struct {
-	Path     []string
+	Path []string
+
+	// NodeConfig, if set, provides node-wide defaults for the
+	// capability arguments passed to plugins. See LoadNodeConfig().
+	NodeConfig *NodeConfig
+
+	// Signer, if set, signs cached attachment records so that they can
+	// later be checked with VerifyNetworkListCachedResult().
+	Signer CacheSigner
+
+	// Resolver, if set, is used by ResolveNetworkList() to look up
+	// network configurations by name. No other method consults it.
+	Resolver NetworkResolver
+
+	// Policy, if set, restricts which plugin binaries are executed
+	Policy *ExecPolicy
+
+	// StateWriter, if set, receives every attachment record written to
+	// or removed from the cache. An ADD whose record it fails to write
+	// still succeeds, since the attachment is configured and cached;
+	// AddNetworkListWithWarnings reports the failure as a warning.
+	StateWriter StateWriter
+
 	exec     invoke.Exec
 	cacheDir string
 }
 
-// CNIConfig implements the CNI interface
+// CNIConfig implements the CNI and ConfLoader interfaces
 var _ CNI = &CNIConfig{}
+var _ ConfLoader = &CNIConfig{}
 
 // NewCNIConfig returns a new CNIConfig object that will search for plugins
 // in the given paths and use the given exec interface to run those plugins,
@@ -122,8 +225,12 @@ func buildOneConfig(name, cniVersion string, orig *NetworkConfig, prevResult typ
 		"name":       name,
 		"cniVersion": cniVersion,
 	}
-	// Add previous plugin result
+	// Add previous plugin result, without the producers recorded by
+	// attributeResult
 	if prevResult != nil {
+		if res, ok := prevResult.(*current.Result); ok {
+			prevResult = res.WithoutAttribution()
+		}
 		inject["prevResult"] = prevResult
 	}
 
@@ -162,6 +269,16 @@ func injectRuntimeConfig(orig *NetworkConfig, rt *RuntimeConf) (*NetworkConfig,
 	}
 
 	if len(rc) > 0 {
+		// Keep the defaults the config sets for other runtimeConfig keys,
+		// as legacy .conf files promoted to lists often do
+		if rawConfig, err := unmarshalRawConfig(orig.Bytes); err == nil {
+			defaults, _ := rawConfig["runtimeConfig"].(map[string]interface{})
+			for key, value := range defaults {
+				if _, ok := rc[key]; !ok {
+					rc[key] = value
+				}
+			}
+		}
 		orig, err = InjectConf(orig, map[string]interface{}{"runtimeConfig": rc})
 		if err != nil {
 			return nil, err
@@ -190,8 +307,15 @@ type cachedInfo struct {
 	NetworkName    string                 `json:"networkName"`
 	CniArgs        [][2]string            `json:"cniArgs,omitempty"`
 	CapabilityArgs map[string]interface{} `json:"capabilityArgs,omitempty"`
+	Labels         map[string]string      `json:"labels,omitempty"`
 	RawResult      map[string]interface{} `json:"result,omitempty"`
+	Signature      []byte                 `json:"signature,omitempty"`
+	Tombstone      *Tombstone             `json:"tombstone,omitempty"`
 	Result         types.Result           `json:"-"`
+
+	// modTime is when the cache file was last written, as listed by
+	// listCachedInfo
+	modTime time.Time
 }
 
 // getCacheDir returns the cache directory in this order:
@@ -215,7 +339,33 @@ func (c *CNIConfig) getCacheFilePath(netName string, rt *RuntimeConf) (string, e
 	return filepath.Join(c.getCacheDir(rt), "results", fmt.Sprintf("%s-%s-%s", netName, rt.ContainerID, rt.IfName)), nil
 }
 
-func (c *CNIConfig) cacheAdd(result types.Result, config []byte, netName string, rt *RuntimeConf) error {
+// cacheAdd caches the result of a successful ADD. The attachment is
+// configured by then, so a StateWriter failing to mirror the record is
+// returned as a warning rather than failing the ADD.
+func (c *CNIConfig) cacheAdd(ctx context.Context, result types.Result, config []byte, netName string, rt *RuntimeConf) (*PluginWarning, error) {
+	record, err := c.writeCacheFile(result, config, netName, rt, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.writeState(ctx, netName, rt, record); err != nil {
+		return &PluginWarning{Command: "ADD", Message: err.Error()}, nil
+	}
+	return nil, nil
+}
+
+// writeCachedInfo writes the cache entry of an attachment, with a
+// tombstone if tomb is not nil, and passes it to the StateWriter
+func (c *CNIConfig) writeCachedInfo(ctx context.Context, result types.Result, config []byte, netName string, rt *RuntimeConf, tomb *Tombstone) error {
+	record, err := c.writeCacheFile(result, config, netName, rt, tomb)
+	if err != nil {
+		return err
+	}
+	return c.writeState(ctx, netName, rt, record)
+}
+
+// writeCacheFile writes the cache entry of an attachment to the cache
+// directory and returns the record written
+func (c *CNIConfig) writeCacheFile(result types.Result, config []byte, netName string, rt *RuntimeConf, tomb *Tombstone) ([]byte, error) {
 	cached := cachedInfo{
 		Kind:           CNICacheV1,
 		ContainerID:    rt.ContainerID,
@@ -224,34 +374,93 @@ func (c *CNIConfig) cacheAdd(result types.Result, config []byte, netName string,
 		NetworkName:    netName,
 		CniArgs:        rt.Args,
 		CapabilityArgs: rt.CapabilityArgs,
+		Labels:         rt.Labels,
+		Tombstone:      tomb,
 	}
 
 	// We need to get type.Result into cachedInfo as JSON map
 	// Marshal to []byte, then Unmarshal into cached.RawResult
 	data, err := json.Marshal(result)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	err = json.Unmarshal(data, &cached.RawResult)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	if c.Signer != nil {
+		if cached.Signature, err = c.signCachedInfo(&cached); err != nil {
+			return nil, err
+		}
 	}
 
 	newBytes, err := json.Marshal(&cached)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	fname, err := c.getCacheFilePath(netName, rt)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if err := os.MkdirAll(filepath.Dir(fname), 0700); err != nil {
-		return err
+		return nil, err
 	}
 
-	return ioutil.WriteFile(fname, newBytes, 0600)
+	if err := ioutil.WriteFile(fname, newBytes, 0600); err != nil {
+		return nil, err
+	}
+	return newBytes, nil
+}
+
+// writeState passes the cache record of an attachment to the StateWriter
+func (c *CNIConfig) writeState(ctx context.Context, netName string, rt *RuntimeConf, record []byte) error {
+	if c.StateWriter == nil {
+		return nil
+	}
+	state := &AttachmentState{
+		NetworkName: netName,
+		ContainerID: rt.ContainerID,
+		IfName:      rt.IfName,
+		Record:      record,
+	}
+	if err := c.StateWriter.WriteState(ctx, state); err != nil {
+		return fmt.Errorf("failed to write attachment state: %v", err)
+	}
+	return nil
+}
+
+// listCachedInfo returns all valid cached attachment records in the cache
+// directory. Legacy and unreadable cache files are skipped.
+func (c *CNIConfig) listCachedInfo(rt *RuntimeConf) ([]*cachedInfo, error) {
+	dir := filepath.Join(c.getCacheDir(rt), "results")
+	files, err := ioutil.ReadDir(dir)
+	switch {
+	case err == nil: // break
+	case os.IsNotExist(err):
+		return nil, nil
+	default:
+		return nil, err
+	}
+
+	infos := make([]*cachedInfo, 0, len(files))
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			continue
+		}
+		info := &cachedInfo{modTime: f.ModTime()}
+		if err := json.Unmarshal(data, info); err != nil || info.Kind != CNICacheV1 {
+			continue
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
 }
 
 func (c *CNIConfig) cacheDel(netName string, rt *RuntimeConf) error {
@@ -263,6 +472,22 @@ func (c *CNIConfig) cacheDel(netName string, rt *RuntimeConf) error {
 	return os.Remove(fname)
 }
 
+// deleteState tells the StateWriter that an attachment was removed
+func (c *CNIConfig) deleteState(ctx context.Context, netName string, rt *RuntimeConf) error {
+	if c.StateWriter == nil {
+		return nil
+	}
+	state := &AttachmentState{
+		NetworkName: netName,
+		ContainerID: rt.ContainerID,
+		IfName:      rt.IfName,
+	}
+	if err := c.StateWriter.DeleteState(ctx, state); err != nil {
+		return fmt.Errorf("failed to delete network %q attachment state: %v", netName, err)
+	}
+	return nil
+}
+
 func (c *CNIConfig) getCachedConfig(netName string, rt *RuntimeConf) ([]byte, *RuntimeConf, error) {
 	var bytes []byte
 
@@ -289,10 +514,47 @@ func (c *CNIConfig) getCachedConfig(netName string, rt *RuntimeConf) ([]byte, *R
 		newRt.Args = unmarshaled.CniArgs
 	}
 	newRt.CapabilityArgs = unmarshaled.CapabilityArgs
+	newRt.Labels = unmarshaled.Labels
 
 	return unmarshaled.Config, &newRt, nil
 }
 
+// readCachedInfo returns the cache entry of an attachment, or nil if it
+// has none or only a legacy entry
+func (c *CNIConfig) readCachedInfo(netName string, rt *RuntimeConf) (*cachedInfo, error) {
+	fname, err := c.getCacheFilePath(netName, rt)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		// Ignore read errors; the cache entry may not exist on-disk
+		return nil, nil
+	}
+	cached := &cachedInfo{}
+	if err := json.Unmarshal(data, cached); err != nil || cached.Kind != CNICacheV1 {
+		return nil, nil
+	}
+	return cached, nil
+}
+
+// withCachedCapabilityArgs returns rt with the capability arguments cached
+// by ADD if rt has none. Runtimes often lose them, for example after a
+// restart, but plugins such as portmap need the original port mappings to
+// clean up on DEL and to verify on CHECK.
+func (c *CNIConfig) withCachedCapabilityArgs(netName string, rt *RuntimeConf) *RuntimeConf {
+	if len(rt.CapabilityArgs) > 0 {
+		return rt
+	}
+	cached, err := c.readCachedInfo(netName, rt)
+	if err != nil || cached == nil || len(cached.CapabilityArgs) == 0 {
+		return rt
+	}
+	newRt := *rt
+	newRt.CapabilityArgs = cached.CapabilityArgs
+	return &newRt
+}
+
 func (c *CNIConfig) getLegacyCachedResult(netName, cniVersion string, rt *RuntimeConf) (types.Result, error) {
 	fname, err := c.getCacheFilePath(netName, rt)
 	if err != nil {
@@ -323,7 +585,7 @@ func (c *CNIConfig) getLegacyCachedResult(netName, cniVersion string, rt *Runtim
 	// while the container was running.
 	result, err = result.GetAsVersion(cniVersion)
 	if err != nil && resultCniVersion != cniVersion {
-		return nil, fmt.Errorf("failed to convert cached result version %q to config version %q: %v", resultCniVersion, cniVersion, err)
+		return nil, &PrevResultConversionError{Network: netName, FromVersion: resultCniVersion, ToVersion: cniVersion, Err: err}
 	}
 	return result, err
 }
@@ -343,6 +605,10 @@ func (c *CNIConfig) getCachedResult(netName, cniVersion string, rt *RuntimeConf)
 	if err := json.Unmarshal(fdata, &cachedInfo); err != nil || cachedInfo.Kind != CNICacheV1 {
 		return c.getLegacyCachedResult(netName, cniVersion, rt)
 	}
+	if cachedInfo.RawResult == nil {
+		// A tombstone of an interrupted ADD may have no result
+		return nil, nil
+	}
 
 	newBytes, err := json.Marshal(&cachedInfo.RawResult)
 	if err != nil {
@@ -368,7 +634,7 @@ func (c *CNIConfig) getCachedResult(netName, cniVersion string, rt *RuntimeConf)
 	// while the container was running.
 	result, err = result.GetAsVersion(cniVersion)
 	if err != nil && resultCniVersion != cniVersion {
-		return nil, fmt.Errorf("failed to convert cached result version %q to config version %q: %v", resultCniVersion, cniVersion, err)
+		return nil, &PrevResultConversionError{Network: netName, FromVersion: resultCniVersion, ToVersion: cniVersion, Err: err}
 	}
 	return result, err
 }
@@ -399,7 +665,7 @@ func (c *CNIConfig) GetNetworkCachedConfig(net *NetworkConfig, rt *RuntimeConf)
 
 func (c *CNIConfig) addNetwork(ctx context.Context, name, cniVersion string, net *NetworkConfig, prevResult types.Result, rt *RuntimeConf) (types.Result, error) {
 	c.ensureExec()
-	pluginPath, err := c.exec.FindInPath(net.Network.Type, c.Path)
+	pluginPath, err := c.findPlugin(net.Network.Type)
 	if err != nil {
 		return nil, err
 	}
@@ -413,7 +679,7 @@ func (c *CNIConfig) addNetwork(ctx context.Context, name, cniVersion string, net
 		return nil, err
 	}
 
-	newConf, err := buildOneConfig(name, cniVersion, net, prevResult, rt)
+	newConf, err := buildOneConfig(name, cniVersion, net, prevResult, c.withNodeDefaults(rt))
 	if err != nil {
 		return nil, err
 	}
@@ -421,32 +687,103 @@ func (c *CNIConfig) addNetwork(ctx context.Context, name, cniVersion string, net
 	return invoke.ExecPluginWithResult(ctx, pluginPath, newConf.Bytes, c.args("ADD", rt), c.exec)
 }
 
-// AddNetworkList executes a sequence of plugins with the ADD command
+// attributeResult records pluginType as the producer of the interfaces,
+// IPs and routes in result that were not in prevResult. Producers can only
+// be recorded in results of version 1.0.0 and later.
+func attributeResult(result, prevResult types.Result, pluginType string) types.Result {
+	res, ok := result.(*current.Result)
+	if !ok {
+		return result
+	}
+	var prev *current.Result
+	if prevResult != nil {
+		// A prevResult that cannot be converted credits everything to
+		// this plugin
+		prev, _ = current.NewResultFromResult(prevResult)
+	}
+	res.AttributeTo(pluginType, prev)
+	return res
+}
+
+// AddNetworkList executes a sequence of plugins with the ADD command.
+// Failures of optional plugins are ignored; use AddNetworkListWithWarnings
+// to learn about them.
 func (c *CNIConfig) AddNetworkList(ctx context.Context, list *NetworkConfigList, rt *RuntimeConf) (types.Result, error) {
-	var err error
-	var result types.Result
-	for _, net := range list.Plugins {
-		result, err = c.addNetwork(ctx, list.Name, list.CNIVersion, net, result, rt)
+	result, _, err := c.AddNetworkListWithWarnings(ctx, list, rt)
+	return result, err
+}
+
+// AddNetworkListWithWarnings is like AddNetworkList, but also returns the
+// failures of optional plugins. An optional plugin that fails is skipped:
+// the next plugin receives the result of the plugin before it.
+func (c *CNIConfig) AddNetworkListWithWarnings(ctx context.Context, list *NetworkConfigList, rt *RuntimeConf) (result types.Result, warnings []*PluginWarning, err error) {
+	if err := c.checkListPolicy(list); err != nil {
+		return nil, nil, err
+	}
+
+	allocated, err := c.allocateIfName(rt)
+	if err != nil {
+		return nil, nil, err
+	}
+	// An interrupted ADD leaves a half-configured attachment whose
+	// tombstone is cached under the allocated name, so the name stays
+	// reserved until DEL
+	interrupted := false
+	if allocated {
+		defer func() {
+			if err != nil && !interrupted {
+				c.releaseIfName(rt)
+				rt.IfName = ""
+			}
+		}()
+	}
+
+	for i, net := range list.Plugins {
+		var newResult types.Result
+		if net.Legacy {
+			var legacyWarnings []*PluginWarning
+			newResult, legacyWarnings, err = c.addLegacyNetwork(ctx, list.Name, list.CNIVersion, net, result, rt)
+			warnings = append(warnings, legacyWarnings...)
+		} else {
+			newResult, err = c.addNetwork(ctx, list.Name, list.CNIVersion, net, result, rt)
+		}
 		if err != nil {
-			return nil, err
+			if !net.Optional {
+				interrupted = c.cacheInterrupted(ctx, "ADD", i, net, err, result, list.Bytes, list.Name, rt)
+				return nil, nil, err
+			}
+			warnings = append(warnings, &PluginWarning{Type: net.Network.Type, Command: "ADD", Err: err})
+			continue
 		}
+		result = attributeResult(newResult, result, net.Network.Type)
 	}
 
-	if err = c.cacheAdd(result, list.Bytes, list.Name, rt); err != nil {
-		return nil, fmt.Errorf("failed to set network %q cached result: %v", list.Name, err)
+	if allocated {
+		result = resultWithIfName(result, rt)
+	}
+	stateWarning, err := c.cacheAdd(ctx, result, list.Bytes, list.Name, rt)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to set network %q cached result: %v", list.Name, err)
+	}
+	if stateWarning != nil {
+		warnings = append(warnings, stateWarning)
 	}
 
-	return result, nil
+	return result, warnings, nil
 }
 
 func (c *CNIConfig) checkNetwork(ctx context.Context, name, cniVersion string, net *NetworkConfig, prevResult types.Result, rt *RuntimeConf) error {
 	c.ensureExec()
-	pluginPath, err := c.exec.FindInPath(net.Network.Type, c.Path)
+	pluginPath, err := c.findPlugin(net.Network.Type)
 	if err != nil {
 		return err
 	}
 
-	newConf, err := buildOneConfig(name, cniVersion, net, prevResult, rt)
+	prevResult, err = prevResultAs(name, net, prevResult, cniVersion)
+	if err != nil {
+		return err
+	}
+	newConf, err := buildOneConfig(name, cniVersion, net, prevResult, c.withNodeDefaults(rt))
 	if err != nil {
 		return err
 	}
@@ -456,39 +793,137 @@ func (c *CNIConfig) checkNetwork(ctx context.Context, name, cniVersion string, n
 
 // CheckNetworkList executes a sequence of plugins with the CHECK command
 func (c *CNIConfig) CheckNetworkList(ctx context.Context, list *NetworkConfigList, rt *RuntimeConf) error {
+	_, err := c.CheckNetworkListWithWarnings(ctx, list, rt)
+	return err
+}
+
+// CheckNetworkListWithWarnings is like CheckNetworkList, but also returns
+// the commands that were adapted for legacy plugins
+func (c *CNIConfig) CheckNetworkListWithWarnings(ctx context.Context, list *NetworkConfigList, rt *RuntimeConf) ([]*PluginWarning, error) {
+	return c.checkNetworkList(ctx, list, rt, nil, nil)
+}
+
+// CheckNetworkListPartial is like CheckNetworkList, but runs CHECK only
+// for the plugins of the list whose type is in pluginNames, such as
+// "portmap", so that a suspect plugin can be verified across many
+// attachments without running the whole chain. Each plugin still
+// receives the cached result of the whole list as its prevResult. It
+// fails if a name matches no plugin of the list.
+func (c *CNIConfig) CheckNetworkListPartial(ctx context.Context, list *NetworkConfigList, rt *RuntimeConf, pluginNames []string) error {
+	if len(pluginNames) == 0 {
+		return fmt.Errorf("no plugins of network %q to check", list.Name)
+	}
+	only := map[string]bool{}
+	for _, name := range pluginNames {
+		only[name] = true
+	}
+	for name := range only {
+		found := false
+		for _, net := range list.Plugins {
+			if net.Network.Type == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("network %q has no plugin of type %q", list.Name, name)
+		}
+	}
+	_, err := c.checkNetworkList(ctx, list, rt, nil, only)
+	return err
+}
+
+// CheckNetworkListWithVerification is like CheckNetworkList, but reports
+// the outcome for each interface and address of the cached result. A
+// plugin that fails CHECK with a *types.Error carrying a Verification does
+// not fail the whole list; its outcomes are merged into the returned
+// Verification instead. Entries are verified only if every plugin passed.
+// It returns a nil Verification if CHECK is disabled for the list.
+func (c *CNIConfig) CheckNetworkListWithVerification(ctx context.Context, list *NetworkConfigList, rt *RuntimeConf) (*types.Verification, error) {
+	v := &types.Verification{}
+	if _, err := c.checkNetworkList(ctx, list, rt, v, nil); err != nil {
+		return nil, err
+	}
+	if list.DisableCheck {
+		return nil, nil
+	}
+	return v, nil
+}
+
+// checkNetworkList runs CHECK for the plugins of the list, or only those
+// whose type is in only if it is not nil, recording their outcomes in v if
+// it is not nil
+func (c *CNIConfig) checkNetworkList(ctx context.Context, list *NetworkConfigList, rt *RuntimeConf, v *types.Verification, only map[string]bool) ([]*PluginWarning, error) {
 	// CHECK was added in CNI spec version 0.4.0 and higher
 	if gtet, err := version.GreaterThanOrEqualTo(list.CNIVersion, "0.4.0"); err != nil {
-		return err
+		return nil, err
 	} else if !gtet {
-		return fmt.Errorf("configuration version %q does not support the CHECK command", list.CNIVersion)
+		return nil, fmt.Errorf("configuration version %q does not support the CHECK command", list.CNIVersion)
 	}
 
 	if list.DisableCheck {
-		return nil
+		return nil, nil
+	}
+
+	if err := c.checkListPolicy(list); err != nil {
+		return nil, err
 	}
+	rt = c.withCachedCapabilityArgs(list.Name, rt)
 
 	cachedResult, err := c.getCachedResult(list.Name, list.CNIVersion, rt)
 	if err != nil {
-		return fmt.Errorf("failed to get network %q cached result: %v", list.Name, err)
+		return nil, fmt.Errorf("failed to get network %q cached result: %w", list.Name, err)
+	}
+	if v != nil {
+		if err := seedVerification(v, cachedResult); err != nil {
+			return nil, err
+		}
 	}
 
+	var warnings []*PluginWarning
+	allPassed := true
 	for _, net := range list.Plugins {
-		if err := c.checkNetwork(ctx, list.Name, list.CNIVersion, net, cachedResult, rt); err != nil {
-			return err
+		if only != nil && !only[net.Network.Type] {
+			continue
+		}
+		if net.Legacy {
+			var legacyWarnings []*PluginWarning
+			legacyWarnings, err = c.checkLegacyNetwork(ctx, list.Name, list.CNIVersion, net, cachedResult, rt)
+			warnings = append(warnings, legacyWarnings...)
+		} else {
+			err = c.checkNetwork(ctx, list.Name, list.CNIVersion, net, cachedResult, rt)
+		}
+		if err == nil {
+			continue
+		}
+		if report := verificationOf(err); v != nil && report != nil {
+			v.Merge(report)
+			allPassed = false
+			continue
+		}
+		if !net.Optional {
+			return nil, err
 		}
 	}
 
-	return nil
+	if v != nil && allPassed {
+		markVerified(v)
+	}
+	return warnings, nil
 }
 
 func (c *CNIConfig) delNetwork(ctx context.Context, name, cniVersion string, net *NetworkConfig, prevResult types.Result, rt *RuntimeConf) error {
 	c.ensureExec()
-	pluginPath, err := c.exec.FindInPath(net.Network.Type, c.Path)
+	pluginPath, err := c.findPlugin(net.Network.Type)
 	if err != nil {
 		return err
 	}
 
-	newConf, err := buildOneConfig(name, cniVersion, net, prevResult, rt)
+	prevResult, err = prevResultAs(name, net, prevResult, cniVersion)
+	if err != nil {
+		return err
+	}
+	newConf, err := buildOneConfig(name, cniVersion, net, prevResult, c.withNodeDefaults(rt))
 	if err != nil {
 		return err
 	}
@@ -496,39 +931,88 @@ func (c *CNIConfig) delNetwork(ctx context.Context, name, cniVersion string, net
 	return invoke.ExecPluginWithoutResult(ctx, pluginPath, newConf.Bytes, c.args("DEL", rt), c.exec)
 }
 
-// DelNetworkList executes a sequence of plugins with the DEL command
+// DelNetworkList executes a sequence of plugins with the DEL command.
+// Failures of optional plugins are ignored; use DelNetworkListWithWarnings
+// to learn about them.
 func (c *CNIConfig) DelNetworkList(ctx context.Context, list *NetworkConfigList, rt *RuntimeConf) error {
+	_, err := c.DelNetworkListWithWarnings(ctx, list, rt)
+	return err
+}
+
+// DelNetworkListWithWarnings is like DelNetworkList, but also returns the
+// failures of optional plugins
+func (c *CNIConfig) DelNetworkListWithWarnings(ctx context.Context, list *NetworkConfigList, rt *RuntimeConf) ([]*PluginWarning, error) {
 	var cachedResult types.Result
 
+	if err := c.checkListPolicy(list); err != nil {
+		return nil, err
+	}
+	rt = c.withCachedCapabilityArgs(list.Name, rt)
+
 	// Cached result on DEL was added in CNI spec version 0.4.0 and higher
 	if gtet, err := version.GreaterThanOrEqualTo(list.CNIVersion, "0.4.0"); err != nil {
-		return err
+		return nil, err
 	} else if gtet {
 		cachedResult, err = c.getCachedResult(list.Name, list.CNIVersion, rt)
 		if err != nil {
-			return fmt.Errorf("failed to get network %q cached result: %v", list.Name, err)
+			return nil, fmt.Errorf("failed to get network %q cached result: %w", list.Name, err)
 		}
 	}
 
+	var warnings []*PluginWarning
 	for i := len(list.Plugins) - 1; i >= 0; i-- {
 		net := list.Plugins[i]
-		if err := c.delNetwork(ctx, list.Name, list.CNIVersion, net, cachedResult, rt); err != nil {
-			return err
+		var err error
+		if net.Legacy {
+			var legacyWarnings []*PluginWarning
+			legacyWarnings, err = c.delLegacyNetwork(ctx, list.Name, list.CNIVersion, net, cachedResult, rt)
+			warnings = append(warnings, legacyWarnings...)
+		} else {
+			err = c.delNetwork(ctx, list.Name, list.CNIVersion, net, cachedResult, rt)
+		}
+		if err != nil {
+			if !net.Optional {
+				c.cacheInterrupted(ctx, "DEL", i, net, err, cachedResult, list.Bytes, list.Name, rt)
+				return nil, err
+			}
+			warnings = append(warnings, &PluginWarning{Type: net.Network.Type, Command: "DEL", Err: err})
 		}
 	}
 	_ = c.cacheDel(list.Name, rt)
+	c.releaseIfName(rt)
 
-	return nil
+	return warnings, c.deleteState(ctx, list.Name, rt)
 }
 
 // AddNetwork executes the plugin with the ADD command
-func (c *CNIConfig) AddNetwork(ctx context.Context, net *NetworkConfig, rt *RuntimeConf) (types.Result, error) {
-	result, err := c.addNetwork(ctx, net.Network.Name, net.Network.CNIVersion, net, nil, rt)
+func (c *CNIConfig) AddNetwork(ctx context.Context, net *NetworkConfig, rt *RuntimeConf) (result types.Result, err error) {
+	allocated, err := c.allocateIfName(rt)
+	if err != nil {
+		return nil, err
+	}
+	// An interrupted ADD leaves a half-configured attachment whose
+	// tombstone is cached under the allocated name, so the name stays
+	// reserved until DEL
+	interrupted := false
+	if allocated {
+		defer func() {
+			if err != nil && !interrupted {
+				c.releaseIfName(rt)
+				rt.IfName = ""
+			}
+		}()
+	}
+
+	result, err = c.addNetwork(ctx, net.Network.Name, net.Network.CNIVersion, net, nil, rt)
 	if err != nil {
+		interrupted = c.cacheInterrupted(ctx, "ADD", 0, net, err, nil, net.Bytes, net.Network.Name, rt)
 		return nil, err
 	}
 
-	if err = c.cacheAdd(result, net.Bytes, net.Network.Name, rt); err != nil {
+	if allocated {
+		result = resultWithIfName(result, rt)
+	}
+	if _, err = c.cacheAdd(ctx, result, net.Bytes, net.Network.Name, rt); err != nil {
 		return nil, fmt.Errorf("failed to set network %q cached result: %v", net.Network.Name, err)
 	}
 
@@ -543,10 +1027,11 @@ func (c *CNIConfig) CheckNetwork(ctx context.Context, net *NetworkConfig, rt *Ru
 	} else if !gtet {
 		return fmt.Errorf("configuration version %q does not support the CHECK command", net.Network.CNIVersion)
 	}
+	rt = c.withCachedCapabilityArgs(net.Network.Name, rt)
 
 	cachedResult, err := c.getCachedResult(net.Network.Name, net.Network.CNIVersion, rt)
 	if err != nil {
-		return fmt.Errorf("failed to get network %q cached result: %v", net.Network.Name, err)
+		return fmt.Errorf("failed to get network %q cached result: %w", net.Network.Name, err)
 	}
 	return c.checkNetwork(ctx, net.Network.Name, net.Network.CNIVersion, net, cachedResult, rt)
 }
@@ -554,6 +1039,7 @@ func (c *CNIConfig) CheckNetwork(ctx context.Context, net *NetworkConfig, rt *Ru
 // DelNetwork executes the plugin with the DEL command
 func (c *CNIConfig) DelNetwork(ctx context.Context, net *NetworkConfig, rt *RuntimeConf) error {
 	var cachedResult types.Result
+	rt = c.withCachedCapabilityArgs(net.Network.Name, rt)
 
 	// Cached result on DEL was added in CNI spec version 0.4.0 and higher
 	if gtet, err := version.GreaterThanOrEqualTo(net.Network.CNIVersion, "0.4.0"); err != nil {
@@ -561,15 +1047,17 @@ func (c *CNIConfig) DelNetwork(ctx context.Context, net *NetworkConfig, rt *Runt
 	} else if gtet {
 		cachedResult, err = c.getCachedResult(net.Network.Name, net.Network.CNIVersion, rt)
 		if err != nil {
-			return fmt.Errorf("failed to get network %q cached result: %v", net.Network.Name, err)
+			return fmt.Errorf("failed to get network %q cached result: %w", net.Network.Name, err)
 		}
 	}
 
 	if err := c.delNetwork(ctx, net.Network.Name, net.Network.CNIVersion, net, cachedResult, rt); err != nil {
+		c.cacheInterrupted(ctx, "DEL", 0, net, err, cachedResult, net.Bytes, net.Network.Name, rt)
 		return err
 	}
 	_ = c.cacheDel(net.Network.Name, rt)
-	return nil
+	c.releaseIfName(rt)
+	return c.deleteState(ctx, net.Network.Name, rt)
 }
 
 // ValidateNetworkList checks that a configuration is reasonably valid.
@@ -585,7 +1073,11 @@ func (c *CNIConfig) ValidateNetworkList(ctx context.Context, list *NetworkConfig
 
 	errs := []error{}
 	for _, net := range list.Plugins {
-		if err := c.validatePlugin(ctx, net.Network.Type, version); err != nil {
+		if net.Legacy {
+			if _, err := c.legacyVersion(ctx, net, version); err != nil {
+				errs = append(errs, err)
+			}
+		} else if err := c.validatePlugin(ctx, net.Network.Type, version); err != nil {
 			errs = append(errs, err)
 		}
 		for c, enabled := range net.Network.Capabilities {
@@ -628,7 +1120,7 @@ func (c *CNIConfig) ValidateNetwork(ctx context.Context, net *NetworkConfig) ([]
 // validatePlugin checks that an individual plugin's configuration is sane
 func (c *CNIConfig) validatePlugin(ctx context.Context, pluginName, expectedVersion string) error {
 	c.ensureExec()
-	pluginPath, err := c.exec.FindInPath(pluginName, c.Path)
+	pluginPath, err := c.findPlugin(pluginName)
 	if err != nil {
 		return err
 	}
@@ -652,7 +1144,7 @@ func (c *CNIConfig) validatePlugin(ctx context.Context, pluginName, expectedVers
 // the given plugin.
 func (c *CNIConfig) GetVersionInfo(ctx context.Context, pluginType string) (version.PluginInfo, error) {
 	c.ensureExec()
-	pluginPath, err := c.exec.FindInPath(pluginType, c.Path)
+	pluginPath, err := c.findPlugin(pluginType)
 	if err != nil {
 		return nil, err
 	}
@@ -17,7 +17,9 @@ package libcni_test
 import (
 	"bytes"
 	"context"
+	"crypto/ed25519"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net"
@@ -273,6 +275,56 @@ var _ = Describe("Invoking plugins", func() {
 			Expect(ok).Should(BeFalse())
 		})
 
+		Context("when a node configuration is set", func() {
+			BeforeEach(func() {
+				var err error
+				cniConfig.NodeConfig, err = libcni.NodeConfigFromBytes([]byte(`{
+					"somethingElse": ["node-default"],
+					"mtu": 1450
+				}`))
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("passes node defaults for advertised capabilities the runtime did not set", func() {
+				delete(runtimeConfig.CapabilityArgs, "somethingElse")
+				_, err := cniConfig.AddNetwork(ctx, netConfig, runtimeConfig)
+				Expect(err).NotTo(HaveOccurred())
+
+				debug, err = noop_debug.ReadDebug(debugFilePath)
+				Expect(err).NotTo(HaveOccurred())
+				conf := make(map[string]interface{})
+				Expect(json.Unmarshal(debug.CmdArgs.StdinData, &conf)).To(Succeed())
+
+				rc := conf["runtimeConfig"].(map[string]interface{})
+				Expect(rc).To(HaveKeyWithValue("somethingElse", []interface{}{"node-default"}))
+				// mtu is not advertised by the plugin
+				Expect(rc).NotTo(HaveKey("mtu"))
+			})
+
+			It("prefers capability arguments from the runtime", func() {
+				_, err := cniConfig.AddNetwork(ctx, netConfig, runtimeConfig)
+				Expect(err).NotTo(HaveOccurred())
+
+				debug, err = noop_debug.ReadDebug(debugFilePath)
+				Expect(err).NotTo(HaveOccurred())
+				conf := make(map[string]interface{})
+				Expect(json.Unmarshal(debug.CmdArgs.StdinData, &conf)).To(Succeed())
+
+				rc := conf["runtimeConfig"].(map[string]interface{})
+				Expect(rc).To(HaveKeyWithValue("somethingElse", []interface{}{"foobar", "baz"}))
+			})
+
+			It("does not cache node defaults as runtime capability arguments", func() {
+				delete(runtimeConfig.CapabilityArgs, "somethingElse")
+				_, err := cniConfig.AddNetwork(ctx, netConfig, runtimeConfig)
+				Expect(err).NotTo(HaveOccurred())
+
+				_, cachedRt, err := cniConfig.GetNetworkCachedConfig(netConfig, runtimeConfig)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(cachedRt.CapabilityArgs).NotTo(HaveKey("somethingElse"))
+			})
+		})
+
 		It("outputs correct capabilities for validate", func() {
 			caps, err := cniConfig.ValidateNetwork(ctx, netConfig)
 			Expect(err).NotTo(HaveOccurred())
@@ -964,6 +1016,7 @@ var _ = Describe("Invoking plugins", func() {
 								IP:   net.ParseIP("10.1.2.3"),
 								Mask: net.IPv4Mask(255, 255, 255, 0),
 							},
+							Plugin: "noop",
 						},
 					},
 					// DNS injected by last plugin
@@ -1461,6 +1514,127 @@ var _ = Describe("Invoking plugins", func() {
 				Expect(err).To(MatchError("[plugin noop does not support config version \"broken\" plugin noop does not support config version \"broken\" plugin noop does not support config version \"broken\"]"))
 			})
 		})
+		Describe("with an optional plugin", func() {
+			BeforeEach(func() {
+				plugins[2].debug.ReportError = "plugin error: banana"
+				Expect(plugins[2].debug.WriteDebug(plugins[2].debugFilePath)).To(Succeed())
+				netConfigList.Plugins[2].Optional = true
+			})
+
+			It("returns the result of the other plugins and a warning on ADD", func() {
+				r, warnings, err := cniConfig.AddNetworkListWithWarnings(ctx, netConfigList, runtimeConfig)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(warnings).To(HaveLen(1))
+				Expect(warnings[0].Type).To(Equal("noop"))
+				Expect(warnings[0].Command).To(Equal("ADD"))
+				Expect(warnings[0].Err).To(MatchError("plugin error: banana"))
+				Expect(warnings[0].String()).To(Equal(`optional plugin "noop" failed ADD: plugin error: banana`))
+
+				result, err := current.GetResult(r)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.IPs).To(HaveLen(1))
+				Expect(result.DNS.Nameservers).To(BeEmpty())
+
+				cached, err := cniConfig.GetNetworkListCachedResult(netConfigList, runtimeConfig)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(cached).To(Equal(r))
+			})
+
+			It("ignores the failure in AddNetworkList, CheckNetworkList and DelNetworkList", func() {
+				_, err := cniConfig.AddNetworkList(ctx, netConfigList, runtimeConfig)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(cniConfig.CheckNetworkList(ctx, netConfigList, runtimeConfig)).To(Succeed())
+				Expect(cniConfig.DelNetworkList(ctx, netConfigList, runtimeConfig)).To(Succeed())
+			})
+
+			It("returns a warning on DEL", func() {
+				warnings, err := cniConfig.DelNetworkListWithWarnings(ctx, netConfigList, runtimeConfig)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(warnings).To(HaveLen(1))
+				Expect(warnings[0].Command).To(Equal("DEL"))
+
+				// the other plugins still ran
+				debug, err := noop_debug.ReadDebug(plugins[0].debugFilePath)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(debug.Command).To(Equal("DEL"))
+			})
+
+			It("still fails when a required plugin fails", func() {
+				netConfigList.Plugins[2].Optional = false
+				_, warnings, err := cniConfig.AddNetworkListWithWarnings(ctx, netConfigList, runtimeConfig)
+				Expect(err).To(MatchError("plugin error: banana"))
+				Expect(warnings).To(BeEmpty())
+			})
+		})
+
+		Describe("with a state writer", func() {
+			It("receives the cached record on ADD and its removal on DEL", func() {
+				writer := &fakeStateWriter{}
+				cniConfig.StateWriter = writer
+
+				_, err := cniConfig.AddNetworkList(ctx, netConfigList, runtimeConfig)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(writer.written()).To(Equal([]string{runtimeConfig.ContainerID}))
+
+				Expect(cniConfig.DelNetworkList(ctx, netConfigList, runtimeConfig)).To(Succeed())
+				Expect(writer.deletes).To(Equal([]string{runtimeConfig.ContainerID}))
+			})
+
+			It("reports a state that cannot be written as a warning", func() {
+				cniConfig.StateWriter = &fakeStateWriter{failures: 1}
+				result, warnings, err := cniConfig.AddNetworkListWithWarnings(ctx, netConfigList, runtimeConfig)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result).NotTo(BeNil())
+				Expect(warnings).To(HaveLen(1))
+				Expect(warnings[0].String()).To(Equal("ADD: failed to write attachment state: store unavailable"))
+
+				cached, err := cniConfig.GetNetworkListCachedResult(netConfigList, runtimeConfig)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(cached).NotTo(BeNil())
+			})
+		})
+
+		Describe("with an execution policy", func() {
+			It("runs plugins from an allowed directory", func() {
+				cniConfig.Policy = &libcni.ExecPolicy{AllowedDirs: []string{cniBinPath}}
+				_, err := cniConfig.AddNetworkList(ctx, netConfigList, runtimeConfig)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("refuses the whole list before running any plugin", func() {
+				otherDir, err := ioutil.TempDir("", "cni-allowed")
+				Expect(err).NotTo(HaveOccurred())
+				defer os.RemoveAll(otherDir)
+				cniConfig.Policy = &libcni.ExecPolicy{AllowedDirs: []string{otherDir}}
+
+				_, err = cniConfig.AddNetworkList(ctx, netConfigList, runtimeConfig)
+				Expect(err).To(BeAssignableToTypeOf(&libcni.PolicyError{}))
+				Expect(err.(*libcni.PolicyError).Type).To(Equal("noop"))
+
+				for _, p := range plugins {
+					debug, err := noop_debug.ReadDebug(p.debugFilePath)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(debug.Command).To(BeEmpty())
+				}
+
+				Expect(cniConfig.CheckNetworkList(ctx, netConfigList, runtimeConfig)).To(BeAssignableToTypeOf(&libcni.PolicyError{}))
+				Expect(cniConfig.DelNetworkList(ctx, netConfigList, runtimeConfig)).To(BeAssignableToTypeOf(&libcni.PolicyError{}))
+				_, err = cniConfig.ValidateNetworkList(ctx, netConfigList)
+				Expect(err).To(HaveOccurred())
+			})
+
+			It("refuses a symlink to a binary outside the allowed directories", func() {
+				linkDir, err := ioutil.TempDir("", "cni-links")
+				Expect(err).NotTo(HaveOccurred())
+				defer os.RemoveAll(linkDir)
+				Expect(os.Symlink(pluginPaths["noop"], filepath.Join(linkDir, "noop"))).To(Succeed())
+
+				cniConfig.Path = []string{linkDir}
+				cniConfig.Policy = &libcni.ExecPolicy{AllowedDirs: []string{linkDir}}
+				_, err = cniConfig.AddNetworkList(ctx, netConfigList, runtimeConfig)
+				Expect(err).To(MatchError(fmt.Sprintf("plugin type \"noop\" resolves to %s, which is outside the allowed plugin directories", filepath.Join(linkDir, "noop"))))
+			})
+		})
 	})
 
 	Describe("Invoking a sleep plugin", func() {
@@ -1773,6 +1947,206 @@ var _ = Describe("Invoking plugins", func() {
 			Expect(foundCABytes).To(MatchJSON(expectedCABytes))
 		})
 
+		Context("when the interface name is chosen from a prefix", func() {
+			BeforeEach(func() {
+				runtimeConfig.IfName = ""
+				runtimeConfig.IfNamePrefix = "net"
+			})
+
+			It("picks the first name not used by the container", func() {
+				_, err := cniConfig.AddNetwork(ctx, netConfig, runtimeConfig)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(runtimeConfig.IfName).To(Equal("net0"))
+
+				debug, err := noop_debug.ReadDebug(debugFilePath)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(debug.CmdArgs.IfName).To(Equal("net0"))
+
+				secondRt := *runtimeConfig
+				secondRt.IfName = ""
+				_, err = cniConfig.AddNetwork(ctx, netConfig, &secondRt)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(secondRt.IfName).To(Equal("net1"))
+
+				otherRt := *runtimeConfig
+				otherRt.ContainerID = "other-container-id"
+				otherRt.IfName = ""
+				_, err = cniConfig.AddNetwork(ctx, netConfig, &otherRt)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(otherRt.IfName).To(Equal("net0"))
+			})
+
+			It("returns the chosen name in the result", func() {
+				r, err := cniConfig.AddNetwork(ctx, netConfig, runtimeConfig)
+				Expect(err).NotTo(HaveOccurred())
+				result, err := current.GetResult(r)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Interfaces).To(ContainElement(&current.Interface{Name: "net0", Sandbox: runtimeConfig.NetNS}))
+
+				cached, err := cniConfig.GetNetworkCachedResult(netConfig, runtimeConfig)
+				Expect(err).NotTo(HaveOccurred())
+				cachedResult, err := current.GetResult(cached)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(cachedResult.Interfaces).To(ContainElement(&current.Interface{Name: "net0", Sandbox: runtimeConfig.NetNS}))
+			})
+
+			It("makes the name available again after DEL", func() {
+				_, err := cniConfig.AddNetwork(ctx, netConfig, runtimeConfig)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(cniConfig.DelNetwork(ctx, netConfig, runtimeConfig)).To(Succeed())
+
+				secondRt := *runtimeConfig
+				secondRt.IfName = ""
+				_, err = cniConfig.AddNetwork(ctx, netConfig, &secondRt)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(secondRt.IfName).To(Equal("net0"))
+			})
+
+			It("releases the name when ADD fails", func() {
+				debug.ReportError = "plugin error: banana"
+				Expect(debug.WriteDebug(debugFilePath)).To(Succeed())
+
+				_, err := cniConfig.AddNetwork(ctx, netConfig, runtimeConfig)
+				Expect(err).To(HaveOccurred())
+				Expect(runtimeConfig.IfName).To(BeEmpty())
+
+				_, err = os.Stat(filepath.Join(cacheDirPath, "ifnames", containerID+"-net0"))
+				Expect(os.IsNotExist(err)).To(BeTrue())
+			})
+
+			It("returns an error when the prefix is too long", func() {
+				runtimeConfig.IfNamePrefix = "aaaaaaaaaaaaaaaa"
+				_, err := cniConfig.AddNetwork(ctx, netConfig, runtimeConfig)
+				Expect(err).To(MatchError("interface name is too long; interface name should be less than 16 characters"))
+			})
+		})
+
+		Context("when the attachment is labelled", func() {
+			BeforeEach(func() {
+				runtimeConfig.Labels = map[string]string{"runtime": "crio", "namespace": "default"}
+			})
+
+			It("records the labels and lists attachments by label", func() {
+				_, err := cniConfig.AddNetwork(ctx, netConfig, runtimeConfig)
+				Expect(err).NotTo(HaveOccurred())
+
+				otherRt := *runtimeConfig
+				otherRt.ContainerID = "other-container-id"
+				otherRt.Labels = map[string]string{"runtime": "crio", "namespace": "kube-system"}
+				_, err = cniConfig.AddNetwork(ctx, netConfig, &otherRt)
+				Expect(err).NotTo(HaveOccurred())
+
+				_, cachedRt, err := cniConfig.GetNetworkCachedConfig(netConfig, runtimeConfig)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(cachedRt.Labels).To(Equal(runtimeConfig.Labels))
+
+				all, err := cniConfig.ListAttachments(map[string]string{"runtime": "crio"})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(all).To(HaveLen(2))
+				Expect(all[0].ContainerID).To(Equal("other-container-id"))
+				Expect(all[1].ContainerID).To(Equal(containerID))
+
+				matched, err := cniConfig.ListAttachments(map[string]string{"namespace": "kube-system"})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(matched).To(HaveLen(1))
+				Expect(matched[0].NetworkName).To(Equal(netConfig.Network.Name))
+				Expect(matched[0].IfName).To(Equal(otherRt.IfName))
+				Expect(matched[0].RuntimeConf.Labels).To(Equal(otherRt.Labels))
+
+				Expect(cniConfig.DelNetwork(ctx, netConfig, matched[0].RuntimeConf)).To(Succeed())
+				remaining, err := cniConfig.ListAttachments(nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(remaining).To(HaveLen(1))
+				Expect(remaining[0].ContainerID).To(Equal(containerID))
+			})
+
+			It("returns nothing when no attachment matches", func() {
+				_, err := cniConfig.AddNetwork(ctx, netConfig, runtimeConfig)
+				Expect(err).NotTo(HaveOccurred())
+
+				matched, err := cniConfig.ListAttachments(map[string]string{"runtime": "containerd"})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(matched).To(BeEmpty())
+			})
+		})
+
+		Context("when cached results are signed", func() {
+			var cacheFile string
+
+			BeforeEach(func() {
+				cniConfig.Signer = libcni.NewHMACSigner([]byte("node-key"))
+				cacheFile = filepath.Join(cacheDirPath, "results", netName+"-"+containerID+"-"+firstIfname)
+			})
+
+			It("verifies an untouched record", func() {
+				_, err := cniConfig.AddNetwork(ctx, netConfig, runtimeConfig)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(cniConfig.VerifyNetworkCachedResult(netConfig, runtimeConfig)).To(Succeed())
+
+				result, err := cniConfig.GetNetworkCachedResult(netConfig, runtimeConfig)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result).NotTo(BeNil())
+			})
+
+			It("verifies a record with typed capability args", func() {
+				type portMapping struct {
+					HostPort      int `json:"hostPort"`
+					ContainerPort int `json:"containerPort"`
+				}
+				runtimeConfig.CapabilityArgs = map[string]interface{}{
+					"portMappings": []portMapping{{HostPort: 8080, ContainerPort: 80}},
+					"bandwidth":    map[string]int64{"ingressRate": 1<<53 + 1},
+				}
+				_, err := cniConfig.AddNetwork(ctx, netConfig, runtimeConfig)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(cniConfig.VerifyNetworkCachedResult(netConfig, runtimeConfig)).To(Succeed())
+			})
+
+			It("rejects a modified record", func() {
+				_, err := cniConfig.AddNetwork(ctx, netConfig, runtimeConfig)
+				Expect(err).NotTo(HaveOccurred())
+
+				data, err := ioutil.ReadFile(cacheFile)
+				Expect(err).NotTo(HaveOccurred())
+				data = bytes.Replace(data, []byte(firstIP), []byte(secondIP), 1)
+				Expect(ioutil.WriteFile(cacheFile, data, 0600)).To(Succeed())
+
+				err = cniConfig.VerifyNetworkCachedResult(netConfig, runtimeConfig)
+				Expect(err).To(MatchError(`cached network "cachetest" failed verification: signature mismatch`))
+			})
+
+			It("rejects a record signed with another key", func() {
+				_, err := cniConfig.AddNetwork(ctx, netConfig, runtimeConfig)
+				Expect(err).NotTo(HaveOccurred())
+
+				cniConfig.Signer = libcni.NewHMACSigner([]byte("other-key"))
+				Expect(cniConfig.VerifyNetworkCachedResult(netConfig, runtimeConfig)).To(HaveOccurred())
+			})
+
+			It("rejects an unsigned record", func() {
+				cniConfig.Signer = nil
+				_, err := cniConfig.AddNetwork(ctx, netConfig, runtimeConfig)
+				Expect(err).NotTo(HaveOccurred())
+
+				cniConfig.Signer = libcni.NewHMACSigner([]byte("node-key"))
+				err = cniConfig.VerifyNetworkCachedResult(netConfig, runtimeConfig)
+				Expect(err).To(MatchError(`cached network "cachetest" is not signed`))
+			})
+
+			It("supports ed25519 keys", func() {
+				_, priv, err := ed25519.GenerateKey(nil)
+				Expect(err).NotTo(HaveOccurred())
+				cniConfig.Signer = libcni.NewEd25519Signer(priv)
+
+				_, err = cniConfig.AddNetwork(ctx, netConfig, runtimeConfig)
+				Expect(err).NotTo(HaveOccurred())
+
+				verifier := &libcni.Ed25519Signer{PublicKey: priv.Public().(ed25519.PublicKey)}
+				cniConfig.Signer = verifier
+				Expect(cniConfig.VerifyNetworkCachedResult(netConfig, runtimeConfig)).To(Succeed())
+			})
+		})
+
 		Context("when the RuntimeConf is incomplete", func() {
 			var (
 				testRt          *libcni.RuntimeConf
@@ -1867,3 +2241,139 @@ var _ = Describe("Invoking plugins", func() {
 
 	})
 })
+
+var _ = Describe("CheckNetworkListPartial", func() {
+	var (
+		cacheDir  string
+		exec      *fakeLegacyExec
+		cniConfig *libcni.CNIConfig
+		list      *libcni.NetworkConfigList
+		rt        *libcni.RuntimeConf
+	)
+
+	BeforeEach(func() {
+		var err error
+		cacheDir, err = ioutil.TempDir("", "cni-partial")
+		Expect(err).NotTo(HaveOccurred())
+
+		result := `{"cniVersion": "1.0.0", "ips": [{"address": "10.1.2.3/24"}]}`
+		exec = &fakeLegacyExec{
+			versions: map[string][]string{
+				"bridge":  {"1.0.0"},
+				"portmap": {"1.0.0"},
+				"tuning":  {"1.0.0"},
+			},
+			results: map[string]string{
+				"bridge":  result,
+				"portmap": result,
+				"tuning":  result,
+			},
+		}
+		cniConfig = libcni.NewCNIConfigWithCacheDir(nil, cacheDir, exec)
+		list, err = libcni.ConfListFromBytes([]byte(`{
+			"name": "partial-list",
+			"cniVersion": "1.0.0",
+			"plugins": [{"type": "bridge"}, {"type": "portmap"}, {"type": "tuning"}]
+		}`))
+		Expect(err).NotTo(HaveOccurred())
+		rt = &libcni.RuntimeConf{
+			ContainerID: "some-container-id",
+			NetNS:       "/some/netns",
+			IfName:      "eth0",
+		}
+		_, err = cniConfig.AddNetworkList(context.TODO(), list, rt)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(cacheDir)).To(Succeed())
+	})
+
+	It("runs CHECK only for the named plugins, with the cached result", func() {
+		Expect(cniConfig.CheckNetworkListPartial(context.TODO(), list, rt, []string{"portmap"})).To(Succeed())
+
+		Expect(exec.callsFor("bridge", "CHECK")).To(BeEmpty())
+		Expect(exec.callsFor("tuning", "CHECK")).To(BeEmpty())
+		checks := exec.callsFor("portmap", "CHECK")
+		Expect(checks).To(HaveLen(1))
+		Expect(fmt.Sprint(checks[0].Stdin["prevResult"])).To(ContainSubstring("10.1.2.3/24"))
+	})
+
+	It("fails when a named plugin fails CHECK", func() {
+		exec.checkErrors = map[string]error{"portmap": errors.New("missing iptables rule")}
+		err := cniConfig.CheckNetworkListPartial(context.TODO(), list, rt, []string{"portmap", "tuning"})
+		Expect(err).To(MatchError("missing iptables rule"))
+	})
+
+	It("fails for names that match no plugin of the list", func() {
+		err := cniConfig.CheckNetworkListPartial(context.TODO(), list, rt, []string{"bandwidth"})
+		Expect(err).To(MatchError(`network "partial-list" has no plugin of type "bandwidth"`))
+		Expect(cniConfig.CheckNetworkListPartial(context.TODO(), list, rt, nil)).To(HaveOccurred())
+		Expect(exec.callsFor("portmap", "CHECK")).To(BeEmpty())
+	})
+})
+
+var _ = Describe("replaying cached capability arguments", func() {
+	var (
+		cacheDir  string
+		exec      *fakeLegacyExec
+		cniConfig *libcni.CNIConfig
+		list      *libcni.NetworkConfigList
+		rt        *libcni.RuntimeConf
+	)
+
+	portMappings := []interface{}{map[string]interface{}{"hostPort": float64(8080), "containerPort": float64(80), "protocol": "tcp"}}
+
+	BeforeEach(func() {
+		var err error
+		cacheDir, err = ioutil.TempDir("", "cni-capargs")
+		Expect(err).NotTo(HaveOccurred())
+
+		result := `{"cniVersion": "1.0.0", "ips": [{"address": "10.1.2.3/24"}]}`
+		exec = &fakeLegacyExec{
+			versions: map[string][]string{"bridge": {"1.0.0"}, "portmap": {"1.0.0"}},
+			results:  map[string]string{"bridge": result, "portmap": result},
+		}
+		cniConfig = libcni.NewCNIConfigWithCacheDir(nil, cacheDir, exec)
+		list, err = libcni.ConfListFromBytes([]byte(`{
+			"name": "capargs-list",
+			"cniVersion": "1.0.0",
+			"plugins": [{"type": "bridge"}, {"type": "portmap", "capabilities": {"portMappings": true}}]
+		}`))
+		Expect(err).NotTo(HaveOccurred())
+		rt = &libcni.RuntimeConf{
+			ContainerID:    "some-container-id",
+			NetNS:          "/some/netns",
+			IfName:         "eth0",
+			CapabilityArgs: map[string]interface{}{"portMappings": portMappings},
+		}
+		_, err = cniConfig.AddNetworkList(context.TODO(), list, rt)
+		Expect(err).NotTo(HaveOccurred())
+		rt.CapabilityArgs = nil
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(cacheDir)).To(Succeed())
+	})
+
+	runtimeConfig := func(call legacyExecCall) interface{} {
+		rc, _ := call.Stdin["runtimeConfig"].(map[string]interface{})
+		return rc["portMappings"]
+	}
+
+	It("supplies the cached capability arguments on CHECK and DEL when the runtime passes none", func() {
+		Expect(cniConfig.CheckNetworkList(context.TODO(), list, rt)).To(Succeed())
+		Expect(runtimeConfig(exec.callsFor("portmap", "CHECK")[0])).To(Equal(portMappings))
+
+		Expect(cniConfig.DelNetworkList(context.TODO(), list, rt)).To(Succeed())
+		Expect(runtimeConfig(exec.callsFor("portmap", "DEL")[0])).To(Equal(portMappings))
+		Expect(rt.CapabilityArgs).To(BeNil())
+	})
+
+	It("prefers the capability arguments the runtime passes", func() {
+		otherMappings := []interface{}{map[string]interface{}{"hostPort": float64(9090), "containerPort": float64(90), "protocol": "udp"}}
+		rt.CapabilityArgs = map[string]interface{}{"portMappings": otherMappings}
+		Expect(cniConfig.DelNetworkList(context.TODO(), list, rt)).To(Succeed())
+		Expect(runtimeConfig(exec.callsFor("portmap", "DEL")[0])).To(Equal(otherMappings))
+	})
+})
@@ -0,0 +1,193 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/containernetworking/cni/pkg/types"
+)
+
+// CheckRequest is a CHECK of one attachment, as passed to CheckBatch
+type CheckRequest struct {
+	List *NetworkConfigList
+	Rt   *RuntimeConf
+}
+
+// CheckScheduler wraps a CNI to pace CHECK operations, so that a runtime
+// checking hundreds of attachments at once does not starve new ADDs of
+// CPU and plugin locks. CHECKs are started at no more than the configured
+// rate, at most MaxConcurrent run at a time, and none start while an ADD
+// made through the scheduler is in progress. All other operations are
+// passed through unchanged.
+type CheckScheduler struct {
+	CNI
+
+	// MaxConcurrent limits how many CHECKs run at a time; 0 means no limit
+	MaxConcurrent int
+
+	interval time.Duration
+	slots    chan struct{}
+
+	mu       sync.Mutex
+	next     time.Time
+	adds     int
+	addsDone chan struct{}
+}
+
+var _ CNI = &CheckScheduler{}
+
+// NewCheckScheduler returns a CheckScheduler that starts at most
+// opsPerSecond CHECKs per second on cni. A rate of zero or less means no
+// rate limit; CHECKs are then only held back by ADDs and MaxConcurrent.
+func NewCheckScheduler(cni CNI, opsPerSecond float64) *CheckScheduler {
+	s := &CheckScheduler{CNI: cni}
+	if opsPerSecond > 0 {
+		s.interval = time.Duration(float64(time.Second) / opsPerSecond)
+	}
+	return s
+}
+
+// AddNetworkList adds the network list, holding back CHECKs until it
+// returns
+func (s *CheckScheduler) AddNetworkList(ctx context.Context, list *NetworkConfigList, rt *RuntimeConf) (types.Result, error) {
+	defer s.beginAdd()()
+	return s.CNI.AddNetworkList(ctx, list, rt)
+}
+
+// AddNetwork adds the network, holding back CHECKs until it returns
+func (s *CheckScheduler) AddNetwork(ctx context.Context, net *NetworkConfig, rt *RuntimeConf) (types.Result, error) {
+	defer s.beginAdd()()
+	return s.CNI.AddNetwork(ctx, net, rt)
+}
+
+// CheckNetworkList waits for its turn and checks the network list. It
+// returns ctx's error if ctx is done while waiting.
+func (s *CheckScheduler) CheckNetworkList(ctx context.Context, list *NetworkConfigList, rt *RuntimeConf) error {
+	release, err := s.wait(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return s.CNI.CheckNetworkList(ctx, list, rt)
+}
+
+// CheckNetwork waits for its turn and checks the network. It returns
+// ctx's error if ctx is done while waiting.
+func (s *CheckScheduler) CheckNetwork(ctx context.Context, net *NetworkConfig, rt *RuntimeConf) error {
+	release, err := s.wait(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return s.CNI.CheckNetwork(ctx, net, rt)
+}
+
+// CheckBatch checks all requests, paced like CheckNetworkList, and returns
+// their errors in the order of the requests
+func (s *CheckScheduler) CheckBatch(ctx context.Context, reqs []CheckRequest) []error {
+	errs := make([]error, len(reqs))
+	var wg sync.WaitGroup
+	for i := range reqs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = s.CheckNetworkList(ctx, reqs[i].List, reqs[i].Rt)
+		}(i)
+	}
+	wg.Wait()
+	return errs
+}
+
+// beginAdd records an ADD in progress and returns a function that
+// records its end
+func (s *CheckScheduler) beginAdd() func() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.adds == 0 {
+		s.addsDone = make(chan struct{})
+	}
+	s.adds++
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.adds--
+		if s.adds == 0 {
+			close(s.addsDone)
+		}
+	}
+}
+
+// wait blocks until no ADD is in progress, the rate allows another CHECK
+// and a concurrency slot is free, and returns a function that releases
+// the slot
+func (s *CheckScheduler) wait(ctx context.Context) (func(), error) {
+	if err := s.waitForAdds(ctx); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	now := time.Now()
+	if s.next.Before(now) {
+		s.next = now
+	}
+	delay := s.next.Sub(now)
+	s.next = s.next.Add(s.interval)
+	if s.slots == nil && s.MaxConcurrent > 0 {
+		s.slots = make(chan struct{}, s.MaxConcurrent)
+	}
+	slots := s.slots
+	s.mu.Unlock()
+
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	if slots == nil {
+		return func() {}, nil
+	}
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (s *CheckScheduler) waitForAdds(ctx context.Context) error {
+	for {
+		s.mu.Lock()
+		if s.adds == 0 {
+			s.mu.Unlock()
+			return nil
+		}
+		done := s.addsDone
+		s.mu.Unlock()
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/containernetworking/cni/libcni"
+	"github.com/containernetworking/cni/pkg/types"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type fakeCheckCNI struct {
+	libcni.CNI
+
+	addRelease chan struct{}
+
+	sync.Mutex
+	checked []string
+	active  int
+	maxSeen int
+}
+
+func (f *fakeCheckCNI) AddNetworkList(_ context.Context, _ *libcni.NetworkConfigList, _ *libcni.RuntimeConf) (types.Result, error) {
+	<-f.addRelease
+	return nil, nil
+}
+
+func (f *fakeCheckCNI) CheckNetworkList(_ context.Context, _ *libcni.NetworkConfigList, rt *libcni.RuntimeConf) error {
+	f.Lock()
+	f.checked = append(f.checked, rt.ContainerID)
+	f.active++
+	if f.active > f.maxSeen {
+		f.maxSeen = f.active
+	}
+	f.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+
+	f.Lock()
+	f.active--
+	f.Unlock()
+	if rt.ContainerID == "bad" {
+		return errors.New("check failed")
+	}
+	return nil
+}
+
+func (f *fakeCheckCNI) checkCount() int {
+	f.Lock()
+	defer f.Unlock()
+	return len(f.checked)
+}
+
+var _ = Describe("CheckScheduler", func() {
+	var (
+		fake      *fakeCheckCNI
+		scheduler *libcni.CheckScheduler
+	)
+
+	BeforeEach(func() {
+		fake = &fakeCheckCNI{addRelease: make(chan struct{})}
+		scheduler = libcni.NewCheckScheduler(fake, 200)
+	})
+
+	requests := func(ids ...string) []libcni.CheckRequest {
+		reqs := make([]libcni.CheckRequest, len(ids))
+		for i, id := range ids {
+			reqs[i] = libcni.CheckRequest{List: &libcni.NetworkConfigList{}, Rt: &libcni.RuntimeConf{ContainerID: id}}
+		}
+		return reqs
+	}
+
+	It("returns the error of each request in order", func() {
+		errs := scheduler.CheckBatch(context.Background(), requests("a", "bad", "c"))
+		Expect(errs).To(HaveLen(3))
+		Expect(errs[0]).NotTo(HaveOccurred())
+		Expect(errs[1]).To(MatchError("check failed"))
+		Expect(errs[2]).NotTo(HaveOccurred())
+	})
+
+	It("paces CHECKs to the configured rate", func() {
+		start := time.Now()
+		scheduler.CheckBatch(context.Background(), requests("a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k"))
+		// 11 CHECKs at 200 per second start over at least 50ms
+		Expect(time.Since(start)).To(BeNumerically(">=", 50*time.Millisecond))
+		Expect(fake.checkCount()).To(Equal(11))
+	})
+
+	It("does not pace CHECKs when the rate is zero", func() {
+		scheduler = libcni.NewCheckScheduler(fake, 0)
+		start := time.Now()
+		scheduler.CheckBatch(context.Background(), requests("a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k"))
+		Expect(time.Since(start)).To(BeNumerically("<", 50*time.Millisecond))
+		Expect(fake.checkCount()).To(Equal(11))
+	})
+
+	It("limits the number of concurrent CHECKs", func() {
+		scheduler = libcni.NewCheckScheduler(fake, 10000)
+		scheduler.MaxConcurrent = 2
+		scheduler.CheckBatch(context.Background(), requests("a", "b", "c", "d", "e", "f"))
+		Expect(fake.maxSeen).To(Equal(2))
+	})
+
+	It("holds back CHECKs while an ADD is in progress", func() {
+		added := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			_, _ = scheduler.AddNetworkList(context.Background(), &libcni.NetworkConfigList{}, &libcni.RuntimeConf{})
+			close(added)
+		}()
+		// Wait for the ADD to be registered
+		Eventually(func() error {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+			defer cancel()
+			return scheduler.CheckNetworkList(ctx, &libcni.NetworkConfigList{}, &libcni.RuntimeConf{ContainerID: "probe"})
+		}).Should(MatchError(context.DeadlineExceeded))
+
+		checked := make(chan error, 1)
+		go func() {
+			checked <- scheduler.CheckNetworkList(context.Background(), &libcni.NetworkConfigList{}, &libcni.RuntimeConf{ContainerID: "a"})
+		}()
+		Consistently(checked, 50*time.Millisecond).ShouldNot(Receive())
+
+		close(fake.addRelease)
+		Eventually(added).Should(BeClosed())
+		Eventually(checked).Should(Receive(BeNil()))
+	})
+})
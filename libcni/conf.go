@@ -15,12 +15,14 @@
 package libcni
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 )
 
 type NotFoundError struct {
@@ -48,6 +50,26 @@ func ConfFromBytes(bytes []byte) (*NetworkConfig, error) {
 	if conf.Network.Type == "" {
 		return nil, fmt.Errorf("error parsing configuration: missing 'type'")
 	}
+
+	var flags struct {
+		Optional interface{} `json:"optional"`
+		Legacy   interface{} `json:"legacy"`
+	}
+	if err := json.Unmarshal(bytes, &flags); err != nil {
+		return nil, fmt.Errorf("error parsing configuration: %s", err)
+	}
+	if flags.Optional != nil {
+		var ok bool
+		if conf.Optional, ok = flags.Optional.(bool); !ok {
+			return nil, fmt.Errorf("error parsing configuration: invalid optional type %T", flags.Optional)
+		}
+	}
+	if flags.Legacy != nil {
+		var ok bool
+		if conf.Legacy, ok = flags.Legacy.(bool); !ok {
+			return nil, fmt.Errorf("error parsing configuration: invalid legacy type %T", flags.Legacy)
+		}
+	}
 	return conf, nil
 }
 
@@ -60,8 +82,8 @@ func ConfFromFile(filename string) (*NetworkConfig, error) {
 }
 
 func ConfListFromBytes(bytes []byte) (*NetworkConfigList, error) {
-	rawList := make(map[string]interface{})
-	if err := json.Unmarshal(bytes, &rawList); err != nil {
+	rawList, err := unmarshalRawConfig(bytes)
+	if err != nil {
 		return nil, fmt.Errorf("error parsing configuration list: %s", err)
 	}
 
@@ -91,9 +113,23 @@ func ConfListFromBytes(bytes []byte) (*NetworkConfigList, error) {
 		}
 	}
 
+	priority := 0
+	if rawPriority, ok := rawList["priority"]; ok {
+		n, ok := rawPriority.(json.Number)
+		if !ok {
+			return nil, fmt.Errorf("error parsing configuration list: invalid priority type %T", rawPriority)
+		}
+		p, err := strconv.ParseInt(n.String(), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing configuration list: priority %s is not an integer", n)
+		}
+		priority = int(p)
+	}
+
 	list := &NetworkConfigList{
 		Name:         name,
 		DisableCheck: disableCheck,
+		Priority:     priority,
 		CNIVersion:   cniVersion,
 		Bytes:        bytes,
 	}
@@ -189,15 +225,20 @@ func LoadConfList(dir, name string) (*NetworkConfigList, error) {
 	}
 	sort.Strings(files)
 
+	// Of several lists with the name, the first with the highest priority wins
+	var found *NetworkConfigList
 	for _, confFile := range files {
 		conf, err := ConfListFromFile(confFile)
 		if err != nil {
 			return nil, err
 		}
-		if conf.Name == name {
-			return conf, nil
+		if conf.Name == name && (found == nil || conf.Priority > found.Priority) {
+			found = conf
 		}
 	}
+	if found != nil {
+		return found, nil
+	}
 
 	// Try and load a network configuration file (instead of list)
 	// from the same name, then upconvert.
@@ -215,8 +256,7 @@ func LoadConfList(dir, name string) (*NetworkConfigList, error) {
 }
 
 func InjectConf(original *NetworkConfig, newValues map[string]interface{}) (*NetworkConfig, error) {
-	config := make(map[string]interface{})
-	err := json.Unmarshal(original.Bytes, &config)
+	config, err := unmarshalRawConfig(original.Bytes)
 	if err != nil {
 		return nil, fmt.Errorf("unmarshal existing network bytes: %s", err)
 	}
@@ -242,15 +282,19 @@ func InjectConf(original *NetworkConfig, newValues map[string]interface{}) (*Net
 }
 
 // ConfListFromConf "upconverts" a network config in to a NetworkConfigList,
-// with the single network as the only entry in the list.
+// with the single network as the only entry in the list. Every field of
+// the original config, such as args, runtimeConfig defaults and
+// capabilities, is kept in the plugin, and numbers keep their precision.
+// The disableCheck and priority fields, which only have meaning for lists,
+// are also applied to the list.
 func ConfListFromConf(original *NetworkConfig) (*NetworkConfigList, error) {
 	// Re-deserialize the config's json, then make a raw map configlist.
 	// This may seem a bit strange, but it's to make the Bytes fields
 	// actually make sense. Otherwise, the generated json is littered with
 	// golang default values.
 
-	rawConfig := make(map[string]interface{})
-	if err := json.Unmarshal(original.Bytes, &rawConfig); err != nil {
+	rawConfig, err := unmarshalRawConfig(original.Bytes)
+	if err != nil {
 		return nil, err
 	}
 
@@ -259,6 +303,11 @@ func ConfListFromConf(original *NetworkConfig) (*NetworkConfigList, error) {
 		"cniVersion": original.Network.CNIVersion,
 		"plugins":    []interface{}{rawConfig},
 	}
+	for _, key := range []string{"disableCheck", "priority"} {
+		if value, ok := rawConfig[key]; ok {
+			rawConfigList[key] = value
+		}
+	}
 
 	b, err := json.Marshal(rawConfigList)
 	if err != nil {
@@ -266,3 +315,19 @@ func ConfListFromConf(original *NetworkConfig) (*NetworkConfigList, error) {
 	}
 	return ConfListFromBytes(b)
 }
+
+// unmarshalRawConfig decodes a config into a map, keeping numbers as
+// json.Number so that re-encoding it does not round large integers
+func unmarshalRawConfig(data []byte) (map[string]interface{}, error) {
+	rawConfig := make(map[string]interface{})
+	if !json.Valid(data) {
+		// Report syntax errors the way json.Unmarshal does
+		return nil, json.Unmarshal(data, &rawConfig)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&rawConfig); err != nil {
+		return nil, err
+	}
+	return rawConfig, nil
+}
@@ -15,6 +15,8 @@
 package libcni_test
 
 import (
+	"context"
+	"encoding/json"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -22,6 +24,7 @@ import (
 	"github.com/containernetworking/cni/libcni"
 	"github.com/containernetworking/cni/pkg/types"
 	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
 )
 
@@ -186,6 +189,36 @@ var _ = Describe("Loading configuration from disk", func() {
 				Expect(err).To(MatchError(`error parsing configuration: missing 'type'`))
 			})
 		})
+
+		Context("when the config sets 'optional'", func() {
+			It("marks the plugin optional", func() {
+				conf, err := libcni.ConfFromBytes([]byte(`{ "name": "some-plugin", "type": "metrics", "optional": true }`))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(conf.Optional).To(BeTrue())
+
+				conf, err = libcni.ConfFromBytes([]byte(`{ "name": "some-plugin", "type": "metrics" }`))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(conf.Optional).To(BeFalse())
+			})
+
+			It("returns an error when it is not a boolean", func() {
+				_, err := libcni.ConfFromBytes([]byte(`{ "name": "some-plugin", "type": "metrics", "optional": "yes" }`))
+				Expect(err).To(MatchError(`error parsing configuration: invalid optional type string`))
+			})
+		})
+
+		Context("when the config sets 'legacy'", func() {
+			It("marks the plugin legacy", func() {
+				conf, err := libcni.ConfFromBytes([]byte(`{ "name": "some-plugin", "type": "vendor", "legacy": true }`))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(conf.Legacy).To(BeTrue())
+			})
+
+			It("returns an error when it is not a boolean", func() {
+				_, err := libcni.ConfFromBytes([]byte(`{ "name": "some-plugin", "type": "vendor", "legacy": 1 }`))
+				Expect(err).To(MatchError(`error parsing configuration: invalid legacy type float64`))
+			})
+		})
 	})
 
 	Describe("LoadConfList", func() {
@@ -476,4 +509,199 @@ var _ = Describe("ConfListFromConf", func() {
 		Expect(ncl2).To(Equal(ncl))
 	})
 
+	DescribeTable("promoting legacy .conf files without losing fields",
+		func(config string) {
+			dir, err := ioutil.TempDir("", "cni-legacy-conf")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(dir)
+			Expect(ioutil.WriteFile(filepath.Join(dir, "10-legacy.conf"), []byte(config), 0600)).To(Succeed())
+
+			list, err := libcni.LoadConfList(dir, "legacy")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(list.Name).To(Equal("legacy"))
+			Expect(list.Plugins).To(HaveLen(1))
+			Expect(string(list.Plugins[0].Bytes)).To(MatchJSON(config))
+
+			reloaded, err := libcni.ConfListFromBytes(list.Bytes)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(reloaded.Plugins[0].Bytes)).To(MatchJSON(config))
+		},
+		Entry("bridge with host-local IPAM", `{
+			"cniVersion": "0.3.1",
+			"name": "legacy",
+			"type": "bridge",
+			"bridge": "cni0",
+			"isGateway": true,
+			"ipMasq": true,
+			"ipam": {
+				"type": "host-local",
+				"ranges": [[{"subnet": "10.22.0.0/16", "gateway": "10.22.0.1"}]],
+				"routes": [{"dst": "0.0.0.0/0"}]
+			}
+		}`),
+		Entry("macvlan with the dhcp daemon", `{
+			"name": "legacy",
+			"type": "macvlan",
+			"master": "eth0",
+			"ipam": {"type": "dhcp"}
+		}`),
+		Entry("flannel delegating to bridge", `{
+			"cniVersion": "0.2.0",
+			"name": "legacy",
+			"type": "flannel",
+			"delegate": {"isDefaultGateway": true, "hairpinMode": true}
+		}`),
+		Entry("args for the plugin and its IPAM", `{
+			"cniVersion": "0.4.0",
+			"name": "legacy",
+			"type": "calico",
+			"mtu": 1440,
+			"etcd_endpoints": "http://127.0.0.1:2379",
+			"args": {"cni": {"labels": ["app=web"]}, "mesos": {"network_info": {"name": "legacy"}}},
+			"ipam": {"type": "calico-ipam", "assign_ipv4": "true"}
+		}`),
+		Entry("capabilities with runtimeConfig defaults", `{
+			"cniVersion": "0.4.0",
+			"name": "legacy",
+			"type": "portmap",
+			"snat": true,
+			"capabilities": {"portMappings": true, "bandwidth": true},
+			"runtimeConfig": {"bandwidth": {"ingressRate": 18446744073709551615, "ingressBurst": 1048576}}
+		}`),
+		Entry("windows overlay with policies", `{
+			"cniVersion": "0.2.0",
+			"name": "legacy",
+			"type": "win-overlay",
+			"dns": {"nameservers": ["10.96.0.10"], "search": ["svc.cluster.local"]},
+			"policies": [{"name": "EndpointPolicy", "value": {"Type": "OutBoundNAT", "ExceptionList": ["10.96.0.0/12"]}}]
+		}`),
+	)
+
+	It("applies disableCheck to the promoted list", func() {
+		conf, err := libcni.ConfFromBytes([]byte(`{"name": "legacy", "cniVersion": "0.4.0", "type": "bridge", "disableCheck": true}`))
+		Expect(err).NotTo(HaveOccurred())
+		list, err := libcni.ConfListFromConf(conf)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(list.DisableCheck).To(BeTrue())
+	})
+
+	It("keeps the precision of large numbers", func() {
+		conf, err := libcni.ConfFromBytes([]byte(`{"name": "legacy", "type": "bandwidth", "ingressRate": 18446744073709551615}`))
+		Expect(err).NotTo(HaveOccurred())
+		list, err := libcni.ConfListFromConf(conf)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(list.Plugins[0].Bytes)).To(ContainSubstring(`"ingressRate":18446744073709551615`))
+	})
+
+	It("keeps runtimeConfig defaults that capability args do not set", func() {
+		conf, err := libcni.ConfFromBytes([]byte(`{
+			"name": "legacy",
+			"cniVersion": "1.0.0",
+			"type": "portmap",
+			"capabilities": {"portMappings": true, "bandwidth": true},
+			"runtimeConfig": {"bandwidth": {"ingressRate": 1000}, "portMappings": []}
+		}`))
+		Expect(err).NotTo(HaveOccurred())
+		list, err := libcni.ConfListFromConf(conf)
+		Expect(err).NotTo(HaveOccurred())
+
+		exec := &fakeLegacyExec{
+			versions: map[string][]string{"portmap": {"1.0.0"}},
+			results:  map[string]string{"portmap": `{"cniVersion": "1.0.0"}`},
+		}
+		cacheDir, err := ioutil.TempDir("", "cni-legacy-conf")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(cacheDir)
+		cniConfig := libcni.NewCNIConfigWithCacheDir(nil, cacheDir, exec)
+		_, err = cniConfig.AddNetworkList(context.TODO(), list, &libcni.RuntimeConf{
+			ContainerID:    "some-container-id",
+			NetNS:          "/some/netns",
+			IfName:         "eth0",
+			CapabilityArgs: map[string]interface{}{"portMappings": []interface{}{map[string]interface{}{"hostPort": 8080}}},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		adds := exec.callsFor("portmap", "ADD")
+		Expect(adds).To(HaveLen(1))
+		runtimeConfig, err := json.Marshal(adds[0].Stdin["runtimeConfig"])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(runtimeConfig)).To(MatchJSON(`{"bandwidth": {"ingressRate": 1000}, "portMappings": [{"hostPort": 8080}]}`))
+	})
+})
+
+var _ = Describe("network priority", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "cni-priority")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	writeConf := func(file, conf string) {
+		Expect(ioutil.WriteFile(filepath.Join(dir, file), []byte(conf), 0600)).To(Succeed())
+	}
+	names := func(lists []*libcni.NetworkConfigList) []string {
+		var result []string
+		for _, l := range lists {
+			result = append(result, l.Name)
+		}
+		return result
+	}
+
+	It("orders networks by priority, then by file name", func() {
+		writeConf("10-a.conflist", `{"name": "a", "cniVersion": "1.0.0", "plugins": [{"type": "bridge"}]}`)
+		writeConf("20-b.conf", `{"name": "b", "cniVersion": "1.0.0", "type": "bridge", "priority": 10}`)
+		writeConf("05-c.conflist", `{"name": "c", "cniVersion": "1.0.0", "priority": -1, "plugins": [{"type": "bridge"}]}`)
+		writeConf("30-d.json", `{"name": "d", "cniVersion": "1.0.0", "type": "bridge"}`)
+
+		networks, err := libcni.LoadNetworks(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names(networks)).To(Equal([]string{"b", "a", "d", "c"}))
+		Expect(networks[0].Priority).To(Equal(10))
+
+		def, err := libcni.DefaultNetwork(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(def.Name).To(Equal("b"))
+	})
+
+	It("picks the highest priority list of several with the same name", func() {
+		writeConf("10-net.conflist", `{"name": "net", "cniVersion": "1.0.0", "plugins": [{"type": "bridge"}]}`)
+		writeConf("20-net.conflist", `{"name": "net", "cniVersion": "1.0.0", "priority": 5, "plugins": [{"type": "ptp"}]}`)
+		writeConf("30-net.conflist", `{"name": "net", "cniVersion": "1.0.0", "priority": 5, "plugins": [{"type": "macvlan"}]}`)
+		writeConf("00-net.conf", `{"name": "net", "cniVersion": "1.0.0", "type": "ipvlan", "priority": 100}`)
+
+		list, err := libcni.LoadConfList(dir, "net")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(list.Plugins[0].Network.Type).To(Equal("ptp"))
+
+		networks, err := libcni.LoadNetworks(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(networks).To(HaveLen(1))
+		Expect(networks[0].Plugins[0].Network.Type).To(Equal("ptp"))
+	})
+
+	It("keeps the priority of a .conf promoted to a list", func() {
+		conf, err := libcni.ConfFromBytes([]byte(`{"name": "net", "cniVersion": "1.0.0", "type": "bridge", "priority": 3}`))
+		Expect(err).NotTo(HaveOccurred())
+		list, err := libcni.ConfListFromConf(conf)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(list.Priority).To(Equal(3))
+	})
+
+	It("rejects a priority that is not an integer", func() {
+		_, err := libcni.ConfListFromBytes([]byte(`{"name": "net", "priority": 1.5, "plugins": [{"type": "bridge"}]}`))
+		Expect(err).To(MatchError("error parsing configuration list: priority 1.5 is not an integer"))
+		_, err = libcni.ConfListFromBytes([]byte(`{"name": "net", "priority": "high", "plugins": [{"type": "bridge"}]}`))
+		Expect(err).To(MatchError("error parsing configuration list: invalid priority type string"))
+	})
+
+	It("reports a directory without networks", func() {
+		_, err := libcni.DefaultNetwork(dir)
+		Expect(err).To(Equal(libcni.NoConfigsFoundError{Dir: dir}))
+	})
 })
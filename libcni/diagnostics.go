@@ -0,0 +1,147 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// DiagnosticFile is a file collected for troubleshooting
+type DiagnosticFile struct {
+	Path string `json:"path"`
+	Data []byte `json:"-"`
+}
+
+// PluginDiagnostics describes a plugin referenced by a network configuration
+type PluginDiagnostics struct {
+	Type              string   `json:"type"`
+	Path              string   `json:"path,omitempty"`
+	SupportedVersions []string `json:"supportedVersions,omitempty"`
+	Error             string   `json:"error,omitempty"`
+}
+
+// Diagnostics is a snapshot of the CNI state of a node: the network
+// configuration files, the cached attachments, and the plugins the
+// configurations reference.
+type Diagnostics struct {
+	CollectedAt time.Time           `json:"collectedAt"`
+	ConfDir     string              `json:"confDir"`
+	CacheDir    string              `json:"cacheDir"`
+	ConfFiles   []DiagnosticFile    `json:"confFiles"`
+	CacheFiles  []DiagnosticFile    `json:"cacheFiles"`
+	Plugins     []PluginDiagnostics `json:"plugins"`
+	// Errors lists problems encountered while collecting; collection
+	// continues past them so that as much state as possible is captured.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// CollectDiagnostics gathers the network configuration files in confDir,
+// the contents of the cache directory, and version information for every
+// plugin referenced by a configuration. File contents are returned
+// verbatim; callers that export the diagnostics are responsible for
+// redacting sensitive values.
+func (c *CNIConfig) CollectDiagnostics(ctx context.Context, confDir string) (*Diagnostics, error) {
+	d := &Diagnostics{
+		CollectedAt: time.Now(),
+		ConfDir:     confDir,
+		CacheDir:    c.getCacheDir(&RuntimeConf{}),
+	}
+
+	files, err := ConfFiles(confDir, []string{".conf", ".conflist", ".json"})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	types := map[string]bool{}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			d.Errors = append(d.Errors, err.Error())
+			continue
+		}
+		d.ConfFiles = append(d.ConfFiles, DiagnosticFile{Path: file, Data: data})
+
+		var list *NetworkConfigList
+		if filepath.Ext(file) == ".conflist" {
+			list, err = ConfListFromBytes(data)
+		} else {
+			var conf *NetworkConfig
+			if conf, err = ConfFromBytes(data); err == nil {
+				list = &NetworkConfigList{Plugins: []*NetworkConfig{conf}}
+			}
+		}
+		if err != nil {
+			d.Errors = append(d.Errors, fmt.Sprintf("%s: %v", file, err))
+			continue
+		}
+		for _, plugin := range list.Plugins {
+			types[plugin.Network.Type] = true
+		}
+	}
+
+	err = filepath.Walk(d.CacheDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if !os.IsNotExist(err) {
+				d.Errors = append(d.Errors, err.Error())
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			d.Errors = append(d.Errors, err.Error())
+			return nil
+		}
+		d.CacheFiles = append(d.CacheFiles, DiagnosticFile{Path: path, Data: data})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sortedTypes := make([]string, 0, len(types))
+	for t := range types {
+		sortedTypes = append(sortedTypes, t)
+	}
+	sort.Strings(sortedTypes)
+
+	c.ensureExec()
+	for _, t := range sortedTypes {
+		pd := PluginDiagnostics{Type: t}
+		pd.Path, err = c.findPlugin(t)
+		if err == nil {
+			vi, verr := c.GetVersionInfo(ctx, t)
+			if verr == nil {
+				pd.SupportedVersions = vi.SupportedVersions()
+			}
+			err = verr
+		}
+		if err != nil {
+			pd.Error = err.Error()
+		}
+		d.Plugins = append(d.Plugins, pd)
+	}
+
+	return d, nil
+}
@@ -0,0 +1,79 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/containernetworking/cni/libcni"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CollectDiagnostics", func() {
+	var (
+		confDir   string
+		cacheDir  string
+		cniConfig *libcni.CNIConfig
+	)
+
+	BeforeEach(func() {
+		var err error
+		confDir, err = ioutil.TempDir("", "diag-conf")
+		Expect(err).NotTo(HaveOccurred())
+		cacheDir, err = ioutil.TempDir("", "diag-cache")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(ioutil.WriteFile(filepath.Join(confDir, "10-list.conflist"), []byte(`{
+			"name": "list", "cniVersion": "1.0.0",
+			"plugins": [{"type": "noop"}, {"type": "does-not-exist"}]
+		}`), 0600)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(confDir, "20-broken.conf"), []byte(`{"name": "broken"}`), 0600)).To(Succeed())
+
+		Expect(os.MkdirAll(filepath.Join(cacheDir, "results"), 0700)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(cacheDir, "results", "list-id-eth0"), []byte(`{"kind": "cniCacheV1"}`), 0600)).To(Succeed())
+
+		cniConfig = libcni.NewCNIConfigWithCacheDir([]string{filepath.Dir(pluginPaths["noop"])}, cacheDir, nil)
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(confDir)).To(Succeed())
+		Expect(os.RemoveAll(cacheDir)).To(Succeed())
+	})
+
+	It("collects configuration, cache and plugin information", func() {
+		d, err := cniConfig.CollectDiagnostics(context.TODO(), confDir)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(d.ConfDir).To(Equal(confDir))
+		Expect(d.CacheDir).To(Equal(cacheDir))
+		Expect(d.ConfFiles).To(HaveLen(2))
+		Expect(d.ConfFiles[0].Path).To(Equal(filepath.Join(confDir, "10-list.conflist")))
+		Expect(d.CacheFiles).To(HaveLen(1))
+		Expect(string(d.CacheFiles[0].Data)).To(Equal(`{"kind": "cniCacheV1"}`))
+
+		Expect(d.Plugins).To(HaveLen(2))
+		Expect(d.Plugins[0].Type).To(Equal("does-not-exist"))
+		Expect(d.Plugins[0].Error).To(ContainSubstring("failed to find plugin"))
+		Expect(d.Plugins[1].Type).To(Equal("noop"))
+		Expect(d.Plugins[1].Path).To(Equal(pluginPaths["noop"]))
+		Expect(d.Plugins[1].SupportedVersions).To(ContainElement("1.0.0"))
+
+		Expect(d.Errors).To(ConsistOf(ContainSubstring("20-broken.conf: error parsing configuration: missing 'type'")))
+	})
+})
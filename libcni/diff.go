@@ -0,0 +1,178 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Actions reported in a PluginDiff
+const (
+	PluginAdded   = "added"
+	PluginRemoved = "removed"
+	PluginChanged = "changed"
+)
+
+// FieldChange is a difference in a single JSON value. Old is nil for
+// added fields and New is nil for removed fields.
+type FieldChange struct {
+	// Path locates the value, e.g. "$.ipam.ranges[0][0].subnet"
+	Path string      `json:"path"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// PluginDiff describes how a plugin of a configuration list changed
+type PluginDiff struct {
+	Type string `json:"type"`
+	// OldIndex and NewIndex are the plugin's position in each list, or
+	// -1 if the plugin is absent from that list
+	OldIndex int           `json:"oldIndex"`
+	NewIndex int           `json:"newIndex"`
+	Action   string        `json:"action"`
+	Changes  []FieldChange `json:"changes,omitempty"`
+}
+
+// ConfListDiff is the difference between two versions of a network
+// configuration list
+type ConfListDiff struct {
+	// Changes lists differences in the list's own fields, such as
+	// its name or cniVersion
+	Changes []FieldChange `json:"changes,omitempty"`
+	// Plugins lists the plugins that were added, removed or changed.
+	// Unchanged plugins are omitted.
+	Plugins []PluginDiff `json:"plugins,omitempty"`
+}
+
+// Empty returns true if the two lists are equivalent
+func (d *ConfListDiff) Empty() bool {
+	return len(d.Changes) == 0 && len(d.Plugins) == 0
+}
+
+// DiffConfLists compares two versions of a network configuration list.
+// Plugins are matched by type: the n-th plugin of a given type in the old
+// list is compared to the n-th plugin of that type in the new list, so
+// reordering plugins is not reported as a change to their contents.
+func DiffConfLists(oldList, newList *NetworkConfigList) (*ConfListDiff, error) {
+	oldTop, err := unmarshalDiffable(oldList.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing old configuration list: %v", err)
+	}
+	newTop, err := unmarshalDiffable(newList.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing new configuration list: %v", err)
+	}
+	delete(oldTop, "plugins")
+	delete(newTop, "plugins")
+
+	diff := &ConfListDiff{}
+	diffValues("$", oldTop, newTop, &diff.Changes)
+
+	// Match the n-th occurrence of each type in both lists
+	oldByType := map[string][]int{}
+	for i, p := range oldList.Plugins {
+		oldByType[p.Network.Type] = append(oldByType[p.Network.Type], i)
+	}
+	matched := map[int]bool{}
+	seen := map[string]int{}
+	for newIdx, p := range newList.Plugins {
+		t := p.Network.Type
+		n := seen[t]
+		seen[t]++
+		if n >= len(oldByType[t]) {
+			diff.Plugins = append(diff.Plugins, PluginDiff{Type: t, OldIndex: -1, NewIndex: newIdx, Action: PluginAdded})
+			continue
+		}
+		oldIdx := oldByType[t][n]
+		matched[oldIdx] = true
+
+		oldConf, err := unmarshalDiffable(oldList.Plugins[oldIdx].Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing old plugin %d: %v", oldIdx, err)
+		}
+		newConf, err := unmarshalDiffable(p.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing new plugin %d: %v", newIdx, err)
+		}
+		var changes []FieldChange
+		diffValues("$", oldConf, newConf, &changes)
+		if len(changes) > 0 {
+			diff.Plugins = append(diff.Plugins, PluginDiff{Type: t, OldIndex: oldIdx, NewIndex: newIdx, Action: PluginChanged, Changes: changes})
+		}
+	}
+	for oldIdx, p := range oldList.Plugins {
+		if !matched[oldIdx] {
+			diff.Plugins = append(diff.Plugins, PluginDiff{Type: p.Network.Type, OldIndex: oldIdx, NewIndex: -1, Action: PluginRemoved})
+		}
+	}
+
+	return diff, nil
+}
+
+func unmarshalDiffable(data []byte) (map[string]interface{}, error) {
+	obj := map[string]interface{}{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// diffValues appends the differences between two decoded JSON values
+func diffValues(path string, oldVal, newVal interface{}, changes *[]FieldChange) {
+	switch o := oldVal.(type) {
+	case map[string]interface{}:
+		n, ok := newVal.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(o)+len(n))
+		for k := range o {
+			keys = append(keys, k)
+		}
+		for k := range n {
+			if _, ok := o[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			diffValues(path+"."+k, o[k], n[k], changes)
+		}
+		return
+	case []interface{}:
+		n, ok := newVal.([]interface{})
+		if !ok {
+			break
+		}
+		for i := 0; i < len(o) || i < len(n); i++ {
+			var ov, nv interface{}
+			if i < len(o) {
+				ov = o[i]
+			}
+			if i < len(n) {
+				nv = n[i]
+			}
+			diffValues(fmt.Sprintf("%s[%d]", path, i), ov, nv, changes)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(oldVal, newVal) {
+		*changes = append(*changes, FieldChange{Path: path, Old: oldVal, New: newVal})
+	}
+}
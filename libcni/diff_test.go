@@ -0,0 +1,111 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni_test
+
+import (
+	"github.com/containernetworking/cni/libcni"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DiffConfLists", func() {
+	var oldList *libcni.NetworkConfigList
+
+	parse := func(conf string) *libcni.NetworkConfigList {
+		list, err := libcni.ConfListFromBytes([]byte(conf))
+		Expect(err).NotTo(HaveOccurred())
+		return list
+	}
+
+	BeforeEach(func() {
+		oldList = parse(`{
+			"name": "some-list",
+			"cniVersion": "1.0.0",
+			"plugins": [
+				{"type": "bridge", "mtu": 1500, "ipam": {"type": "host-local", "ranges": [[{"subnet": "10.1.0.0/16"}]]}},
+				{"type": "portmap", "capabilities": {"portMappings": true}}
+			]
+		}`)
+	})
+
+	It("reports no differences for equivalent lists", func() {
+		diff, err := libcni.DiffConfLists(oldList, parse(`{
+			"cniVersion": "1.0.0",
+			"name": "some-list",
+			"plugins": [
+				{"mtu": 1500, "type": "bridge", "ipam": {"ranges": [[{"subnet": "10.1.0.0/16"}]], "type": "host-local"}},
+				{"type": "portmap", "capabilities": {"portMappings": true}}
+			]
+		}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(diff.Empty()).To(BeTrue())
+	})
+
+	It("reports changed fields with their JSON paths", func() {
+		diff, err := libcni.DiffConfLists(oldList, parse(`{
+			"name": "some-list",
+			"cniVersion": "1.0.0",
+			"plugins": [
+				{"type": "bridge", "ipam": {"type": "host-local", "ranges": [[{"subnet": "10.2.0.0/16"}]]}, "hairpinMode": true},
+				{"type": "portmap", "capabilities": {"portMappings": true}}
+			]
+		}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(diff.Changes).To(BeEmpty())
+		Expect(diff.Plugins).To(Equal([]libcni.PluginDiff{{
+			Type:     "bridge",
+			OldIndex: 0,
+			NewIndex: 0,
+			Action:   libcni.PluginChanged,
+			Changes: []libcni.FieldChange{
+				{Path: "$.hairpinMode", New: true},
+				{Path: "$.ipam.ranges[0][0].subnet", Old: "10.1.0.0/16", New: "10.2.0.0/16"},
+				{Path: "$.mtu", Old: float64(1500)},
+			},
+		}}))
+	})
+
+	It("reports added and removed plugins", func() {
+		diff, err := libcni.DiffConfLists(oldList, parse(`{
+			"name": "some-list",
+			"cniVersion": "1.0.0",
+			"plugins": [
+				{"type": "tuning"},
+				{"type": "bridge", "mtu": 1500, "ipam": {"type": "host-local", "ranges": [[{"subnet": "10.1.0.0/16"}]]}}
+			]
+		}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(diff.Plugins).To(Equal([]libcni.PluginDiff{
+			{Type: "tuning", OldIndex: -1, NewIndex: 0, Action: libcni.PluginAdded},
+			{Type: "portmap", OldIndex: 1, NewIndex: -1, Action: libcni.PluginRemoved},
+		}))
+	})
+
+	It("reports changes to the list's own fields", func() {
+		newList := parse(`{
+			"name": "some-list",
+			"cniVersion": "1.0.0",
+			"disableCheck": true,
+			"plugins": [
+				{"type": "bridge", "mtu": 1500, "ipam": {"type": "host-local", "ranges": [[{"subnet": "10.1.0.0/16"}]]}},
+				{"type": "portmap", "capabilities": {"portMappings": true}}
+			]
+		}`)
+		diff, err := libcni.DiffConfLists(oldList, newList)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(diff.Changes).To(Equal([]libcni.FieldChange{{Path: "$.disableCheck", New: true}}))
+		Expect(diff.Plugins).To(BeEmpty())
+	})
+})
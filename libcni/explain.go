@@ -0,0 +1,121 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/containernetworking/cni/pkg/types"
+)
+
+// The layers that contribute to the configuration a plugin receives
+const (
+	// ConfigLayerPlugin is the plugin's entry in the list
+	ConfigLayerPlugin = "plugin"
+	// ConfigLayerList is the list, which sets the name and cniVersion of
+	// every plugin
+	ConfigLayerList = "list"
+	// ConfigLayerPrevResult is the result of the previous plugins
+	ConfigLayerPrevResult = "prevResult"
+	// ConfigLayerRuntime is the capability arguments of the runtime
+	ConfigLayerRuntime = "runtime"
+	// ConfigLayerNode is the node configuration's default capability
+	// arguments
+	ConfigLayerNode = "node"
+)
+
+// ExplainedConfig is the configuration a plugin of a list receives on
+// stdin, with the layer that contributed each field
+type ExplainedConfig struct {
+	// Index is the position of the plugin in the list, from 0
+	Index int
+	Type  string
+	// Bytes is exactly what the plugin receives on stdin
+	Bytes []byte
+	// Layers maps each top-level field, and each field of runtimeConfig
+	// as "runtimeConfig.<name>", to the ConfigLayer that set it
+	Layers map[string]string
+}
+
+// ExplainNetworkList returns the configuration the plugin at index in the
+// list receives, given the result of the previous plugins and the runtime
+// arguments. Either may be nil. The configuration is built exactly as for
+// ADD, including the node configuration's defaults.
+func (c *CNIConfig) ExplainNetworkList(list *NetworkConfigList, index int, prevResult types.Result, rt *RuntimeConf) (*ExplainedConfig, error) {
+	if index < 0 || index >= len(list.Plugins) {
+		return nil, fmt.Errorf("network %q has no plugin %d", list.Name, index)
+	}
+	if rt == nil {
+		rt = &RuntimeConf{}
+	}
+	if prevResult != nil {
+		converted, err := prevResult.GetAsVersion(list.CNIVersion)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert prevResult to version %q: %v", list.CNIVersion, err)
+		}
+		prevResult = converted
+	}
+
+	net := list.Plugins[index]
+	built, err := buildOneConfig(list.Name, list.CNIVersion, net, prevResult, c.withNodeDefaults(rt))
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(built.Bytes, &fields); err != nil {
+		return nil, err
+	}
+	layers := make(map[string]string, len(fields))
+	for field := range fields {
+		switch field {
+		case "name", "cniVersion":
+			layers[field] = ConfigLayerList
+		case "prevResult":
+			if prevResult != nil {
+				layers[field] = ConfigLayerPrevResult
+			} else {
+				layers[field] = ConfigLayerPlugin
+			}
+		case "runtimeConfig":
+			rc, _ := fields[field].(map[string]interface{})
+			injected := false
+			for name := range rc {
+				if _, ok := rt.CapabilityArgs[name]; ok {
+					layers["runtimeConfig."+name] = ConfigLayerRuntime
+					injected = true
+				} else if c.NodeConfig != nil && c.NodeConfig.Args[name] != nil {
+					layers["runtimeConfig."+name] = ConfigLayerNode
+					injected = true
+				}
+			}
+			// runtimeConfig is replaced as a whole when anything is
+			// injected, so otherwise it is the plugin's own
+			if !injected {
+				layers[field] = ConfigLayerPlugin
+			}
+		default:
+			layers[field] = ConfigLayerPlugin
+		}
+	}
+
+	return &ExplainedConfig{
+		Index:  index,
+		Type:   net.Network.Type,
+		Bytes:  built.Bytes,
+		Layers: layers,
+	}, nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni_test
+
+import (
+	"github.com/containernetworking/cni/libcni"
+	current "github.com/containernetworking/cni/pkg/types/100"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("explaining plugin configurations", func() {
+	var (
+		cniConfig *libcni.CNIConfig
+		list      *libcni.NetworkConfigList
+	)
+
+	BeforeEach(func() {
+		var err error
+		cniConfig = libcni.NewCNIConfig(nil, nil)
+		cniConfig.NodeConfig, err = libcni.NodeConfigFromBytes([]byte(`{"mtu": 9000}`))
+		Expect(err).NotTo(HaveOccurred())
+		list, err = libcni.ConfListFromBytes([]byte(`{
+			"name": "explained",
+			"cniVersion": "1.0.0",
+			"plugins": [
+				{"type": "bridge", "bridge": "cni0"},
+				{"type": "portmap", "name": "ignored", "capabilities": {"portMappings": true, "mtu": true}}
+			]
+		}`))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("annotates each field with the layer that set it", func() {
+		prevResult := &current.Result{CNIVersion: "1.0.0"}
+		rt := &libcni.RuntimeConf{CapabilityArgs: map[string]interface{}{
+			"portMappings": []interface{}{map[string]interface{}{"hostPort": 8080}},
+		}}
+		explained, err := cniConfig.ExplainNetworkList(list, 1, prevResult, rt)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(explained.Type).To(Equal("portmap"))
+		Expect(explained.Bytes).To(MatchJSON(`{
+			"type": "portmap",
+			"name": "explained",
+			"cniVersion": "1.0.0",
+			"capabilities": {"portMappings": true, "mtu": true},
+			"prevResult": {"cniVersion": "1.0.0", "dns": {}},
+			"runtimeConfig": {"portMappings": [{"hostPort": 8080}], "mtu": 9000}
+		}`))
+		Expect(explained.Layers).To(Equal(map[string]string{
+			"type":                       libcni.ConfigLayerPlugin,
+			"capabilities":               libcni.ConfigLayerPlugin,
+			"name":                       libcni.ConfigLayerList,
+			"cniVersion":                 libcni.ConfigLayerList,
+			"prevResult":                 libcni.ConfigLayerPrevResult,
+			"runtimeConfig.portMappings": libcni.ConfigLayerRuntime,
+			"runtimeConfig.mtu":          libcni.ConfigLayerNode,
+		}))
+	})
+
+	It("explains plugins without prevResult or runtime arguments", func() {
+		explained, err := cniConfig.ExplainNetworkList(list, 0, nil, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(explained.Layers).To(HaveKeyWithValue("bridge", libcni.ConfigLayerPlugin))
+		Expect(explained.Layers).NotTo(HaveKey("prevResult"))
+	})
+
+	It("rejects an index outside the list", func() {
+		_, err := cniConfig.ExplainNetworkList(list, 2, nil, nil)
+		Expect(err).To(MatchError(`network "explained" has no plugin 2`))
+	})
+})
@@ -0,0 +1,152 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// GCAttachment identifies an attachment that the runtime still uses
+type GCAttachment struct {
+	ContainerID string
+	IfName      string
+}
+
+// GCArgs holds the arguments to GCNetworkList
+type GCArgs struct {
+	// ValidAttachments are the attachments of the network that must be
+	// kept. Every other cached attachment is a candidate for collection.
+	ValidAttachments []GCAttachment
+	// MinAge protects recent attachments: an attachment whose cache entry
+	// was written less than MinAge ago is never marked or collected, so a
+	// GC pass cannot race with an ADD the runtime has not yet recorded.
+	MinAge time.Duration
+}
+
+// GCNetworkList collects the cached attachments of the list that are not
+// in args.ValidAttachments. Collection takes two passes: the first pass
+// marks a stale attachment in the cache, and a later pass deletes it with
+// DEL if it is still stale. An attachment that becomes valid again, or is
+// added again, is unmarked. GCNetworkList continues past attachments that
+// fail to be deleted and returns their errors together.
+func (c *CNIConfig) GCNetworkList(ctx context.Context, list *NetworkConfigList, args *GCArgs) error {
+	if args == nil {
+		args = &GCArgs{}
+	}
+	valid := make(map[GCAttachment]bool, len(args.ValidAttachments))
+	for _, a := range args.ValidAttachments {
+		valid[a] = true
+	}
+
+	cached, err := c.listCachedInfo(&RuntimeConf{})
+	if err != nil {
+		return fmt.Errorf("failed to list cached attachments: %v", err)
+	}
+
+	now := time.Now()
+	seen := map[string]bool{}
+	errs := []error{}
+	for _, info := range cached {
+		rt := &RuntimeConf{
+			ContainerID:    info.ContainerID,
+			IfName:         info.IfName,
+			Args:           info.CniArgs,
+			CapabilityArgs: info.CapabilityArgs,
+			Labels:         info.Labels,
+		}
+		// Keep the marks of other networks' attachments for their own
+		// GC passes
+		mark, err := c.gcMarkPath(info.NetworkName, rt)
+		if err != nil {
+			continue
+		}
+		seen[mark] = true
+		if info.NetworkName != list.Name {
+			continue
+		}
+
+		if valid[GCAttachment{ContainerID: info.ContainerID, IfName: info.IfName}] || now.Sub(info.modTime) < args.MinAge {
+			_ = os.Remove(mark)
+			continue
+		}
+
+		// Only attachments marked by an earlier pass, and not added
+		// again since, are collected
+		if markTime, ok := gcMarkTime(mark); !ok || markTime.Before(info.modTime) {
+			if err := writeGCMark(mark); err != nil {
+				errs = append(errs, fmt.Errorf("failed to mark attachment %s/%s: %v", info.ContainerID, info.IfName, err))
+			}
+			continue
+		}
+		if err := c.DelNetworkList(ctx, list, rt); err != nil {
+			errs = append(errs, fmt.Errorf("failed to collect attachment %s/%s: %v", info.ContainerID, info.IfName, err))
+			continue
+		}
+		_ = os.Remove(mark)
+	}
+
+	c.pruneGCMarks(seen)
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%v", errs)
+	}
+	return nil
+}
+
+// gcMarkPath returns the path of the file marking the attachment as stale
+func (c *CNIConfig) gcMarkPath(netName string, rt *RuntimeConf) (string, error) {
+	fname, err := c.getCacheFilePath(netName, rt)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(c.getCacheDir(rt), "gc", filepath.Base(fname)), nil
+}
+
+// gcMarkTime returns when the attachment was marked, if it was
+func gcMarkTime(mark string) (time.Time, bool) {
+	fi, err := os.Stat(mark)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return fi.ModTime(), true
+}
+
+func writeGCMark(mark string) error {
+	if err := os.MkdirAll(filepath.Dir(mark), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(mark, nil, 0600)
+}
+
+// pruneGCMarks removes the marks of attachments that are no longer cached,
+// such as those deleted by the runtime since the last pass
+func (c *CNIConfig) pruneGCMarks(keep map[string]bool) {
+	dir := filepath.Join(c.getCacheDir(&RuntimeConf{}), "gc")
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, f := range files {
+		mark := filepath.Join(dir, f.Name())
+		if !keep[mark] {
+			_ = os.Remove(mark)
+		}
+	}
+}
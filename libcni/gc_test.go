@@ -0,0 +1,149 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/containernetworking/cni/libcni"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("garbage collection", func() {
+	var (
+		cacheDir  string
+		exec      *fakeLegacyExec
+		cniConfig *libcni.CNIConfig
+		list      *libcni.NetworkConfigList
+		ctx       context.Context
+		valid     []libcni.GCAttachment
+	)
+
+	containers := func() []string {
+		attachments, err := cniConfig.ListAttachments(nil)
+		Expect(err).NotTo(HaveOccurred())
+		ids := []string{}
+		for _, a := range attachments {
+			ids = append(ids, a.ContainerID)
+		}
+		return ids
+	}
+
+	ageCacheEntry := func(containerID string, age time.Duration) {
+		path := filepath.Join(cacheDir, "results", "gc-list-"+containerID+"-eth0")
+		then := time.Now().Add(-age)
+		Expect(os.Chtimes(path, then, then)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		cacheDir, err = ioutil.TempDir("", "cni-gc")
+		Expect(err).NotTo(HaveOccurred())
+
+		exec = &fakeLegacyExec{
+			versions: map[string][]string{"bridge": {"1.0.0"}},
+			results:  map[string]string{"bridge": `{"cniVersion": "1.0.0"}`},
+		}
+		cniConfig = libcni.NewCNIConfigWithCacheDir(nil, cacheDir, exec)
+		list, err = libcni.ConfListFromBytes([]byte(`{
+			"name": "gc-list",
+			"cniVersion": "1.0.0",
+			"plugins": [{"type": "bridge"}]
+		}`))
+		Expect(err).NotTo(HaveOccurred())
+		ctx = context.TODO()
+
+		for _, id := range []string{"live-container", "stale-container"} {
+			_, err = cniConfig.AddNetworkList(ctx, list, &libcni.RuntimeConf{ContainerID: id, NetNS: "/some/netns", IfName: "eth0"})
+			Expect(err).NotTo(HaveOccurred())
+		}
+		valid = []libcni.GCAttachment{{ContainerID: "live-container", IfName: "eth0"}}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(cacheDir)).To(Succeed())
+	})
+
+	It("deletes a stale attachment on the pass after it was marked", func() {
+		Expect(cniConfig.GCNetworkList(ctx, list, &libcni.GCArgs{ValidAttachments: valid})).To(Succeed())
+		Expect(exec.callsFor("bridge", "DEL")).To(BeEmpty())
+		Expect(containers()).To(Equal([]string{"live-container", "stale-container"}))
+
+		Expect(cniConfig.GCNetworkList(ctx, list, &libcni.GCArgs{ValidAttachments: valid})).To(Succeed())
+		Expect(exec.callsFor("bridge", "DEL")).To(HaveLen(1))
+		Expect(containers()).To(Equal([]string{"live-container"}))
+
+		marks, err := ioutil.ReadDir(filepath.Join(cacheDir, "gc"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(marks).To(BeEmpty())
+	})
+
+	It("keeps the marks of other networks when collecting one network", func() {
+		other, err := libcni.ConfListFromBytes([]byte(`{
+			"name": "gc-other",
+			"cniVersion": "1.0.0",
+			"plugins": [{"type": "bridge"}]
+		}`))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = cniConfig.AddNetworkList(ctx, other, &libcni.RuntimeConf{ContainerID: "other-stale-container", NetNS: "/some/netns", IfName: "eth0"})
+		Expect(err).NotTo(HaveOccurred())
+
+		// A runtime collecting each network in turn
+		for i := 0; i < 2; i++ {
+			Expect(cniConfig.GCNetworkList(ctx, list, &libcni.GCArgs{ValidAttachments: valid})).To(Succeed())
+			Expect(cniConfig.GCNetworkList(ctx, other, &libcni.GCArgs{})).To(Succeed())
+		}
+		Expect(exec.callsFor("bridge", "DEL")).To(HaveLen(2))
+		Expect(containers()).To(Equal([]string{"live-container"}))
+	})
+
+	It("does not collect attachments younger than the minimum age", func() {
+		args := &libcni.GCArgs{ValidAttachments: valid, MinAge: time.Hour}
+		Expect(cniConfig.GCNetworkList(ctx, list, args)).To(Succeed())
+		Expect(cniConfig.GCNetworkList(ctx, list, args)).To(Succeed())
+		Expect(exec.callsFor("bridge", "DEL")).To(BeEmpty())
+
+		ageCacheEntry("stale-container", 2*time.Hour)
+		Expect(cniConfig.GCNetworkList(ctx, list, args)).To(Succeed())
+		Expect(cniConfig.GCNetworkList(ctx, list, args)).To(Succeed())
+		Expect(containers()).To(Equal([]string{"live-container"}))
+	})
+
+	It("unmarks an attachment that becomes valid again", func() {
+		Expect(cniConfig.GCNetworkList(ctx, list, &libcni.GCArgs{ValidAttachments: valid})).To(Succeed())
+		all := append(valid, libcni.GCAttachment{ContainerID: "stale-container", IfName: "eth0"})
+		Expect(cniConfig.GCNetworkList(ctx, list, &libcni.GCArgs{ValidAttachments: all})).To(Succeed())
+		Expect(cniConfig.GCNetworkList(ctx, list, &libcni.GCArgs{ValidAttachments: valid})).To(Succeed())
+		Expect(exec.callsFor("bridge", "DEL")).To(BeEmpty())
+	})
+
+	It("does not collect an attachment added again after it was marked", func() {
+		Expect(cniConfig.GCNetworkList(ctx, list, &libcni.GCArgs{ValidAttachments: valid})).To(Succeed())
+		mark := filepath.Join(cacheDir, "gc", "gc-list-stale-container-eth0")
+		then := time.Now().Add(-time.Minute)
+		Expect(os.Chtimes(mark, then, then)).To(Succeed())
+
+		_, err := cniConfig.AddNetworkList(ctx, list, &libcni.RuntimeConf{ContainerID: "stale-container", NetNS: "/some/netns", IfName: "eth0"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cniConfig.GCNetworkList(ctx, list, &libcni.GCArgs{ValidAttachments: valid})).To(Succeed())
+		Expect(exec.callsFor("bridge", "DEL")).To(BeEmpty())
+	})
+})
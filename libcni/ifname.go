@@ -0,0 +1,107 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/containernetworking/cni/pkg/types"
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/cni/pkg/utils"
+)
+
+// maxIfNameIndex bounds the search for a free interface name
+const maxIfNameIndex = 4096
+
+func (c *CNIConfig) getIfNameReservationPath(rt *RuntimeConf, ifName string) string {
+	return filepath.Join(c.getCacheDir(rt), "ifnames", fmt.Sprintf("%s-%s", rt.ContainerID, ifName))
+}
+
+// allocateIfName chooses an interface name for rt when the runtime asked
+// libcni to do so via IfNamePrefix. Names used by cached attachments of
+// the same container are skipped, and the chosen name is reserved with an
+// exclusively-created file so that concurrent ADDs for the same container
+// cannot pick the same name. It returns true if a name was allocated.
+func (c *CNIConfig) allocateIfName(rt *RuntimeConf) (bool, error) {
+	if rt.IfName != "" || rt.IfNamePrefix == "" {
+		return false, nil
+	}
+	if err := utils.ValidateContainerID(rt.ContainerID); err != nil {
+		return false, err
+	}
+
+	cached, err := c.listCachedInfo(rt)
+	if err != nil {
+		return false, fmt.Errorf("failed to list cached attachments: %v", err)
+	}
+	used := make(map[string]bool)
+	for _, info := range cached {
+		if info.ContainerID == rt.ContainerID {
+			used[info.IfName] = true
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.getIfNameReservationPath(rt, rt.IfNamePrefix)), 0700); err != nil {
+		return false, err
+	}
+	for i := 0; i < maxIfNameIndex; i++ {
+		name := fmt.Sprintf("%s%d", rt.IfNamePrefix, i)
+		if used[name] {
+			continue
+		}
+		if err := utils.ValidateInterfaceName(name); err != nil {
+			return false, err
+		}
+		f, err := os.OpenFile(c.getIfNameReservationPath(rt, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if os.IsExist(err) {
+			continue
+		} else if err != nil {
+			return false, err
+		}
+		_ = f.Close()
+		rt.IfName = name
+		return true, nil
+	}
+	return false, fmt.Errorf("no free interface name with prefix %q for container %q", rt.IfNamePrefix, rt.ContainerID)
+}
+
+// resultWithIfName returns result with an interface for the name
+// allocated in rt.IfName, so that callers learn the chosen name from the
+// result too. An interface of that name in rt's namespace is added if the
+// plugins did not report one. Interfaces can only be added to results of
+// version 1.0.0 and later.
+func resultWithIfName(result types.Result, rt *RuntimeConf) types.Result {
+	res, ok := result.(*current.Result)
+	if !ok {
+		return result
+	}
+	for _, intf := range res.Interfaces {
+		if intf.Name == rt.IfName && intf.Sandbox != "" {
+			return res
+		}
+	}
+	res.Interfaces = append(res.Interfaces, &current.Interface{Name: rt.IfName, Sandbox: rt.NetNS})
+	return res
+}
+
+// releaseIfName drops the reservation for rt's interface name, if any
+func (c *CNIConfig) releaseIfName(rt *RuntimeConf) {
+	if rt.IfName == "" || rt.ContainerID == "" {
+		return
+	}
+	_ = os.Remove(c.getIfNameReservationPath(rt, rt.IfName))
+}
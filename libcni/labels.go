@@ -0,0 +1,86 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Attachment describes a cached attachment of a container to a network
+type Attachment struct {
+	NetworkName string
+	ContainerID string
+	IfName      string
+	// Config is the network configuration the attachment was added with
+	Config []byte
+	// RuntimeConf holds the arguments the attachment was added with,
+	// including its Labels. It can be passed to CHECK and DEL.
+	RuntimeConf *RuntimeConf
+}
+
+// matchLabels returns true if labels has every key of selector with the
+// same value. An empty selector matches everything.
+func matchLabels(labels, selector map[string]string) bool {
+	for k, v := range selector {
+		if val, ok := labels[k]; !ok || val != v {
+			return false
+		}
+	}
+	return true
+}
+
+// ListAttachments returns the cached attachments whose labels match every
+// key and value of selector, sorted by network name, container ID and
+// interface name. A nil or empty selector returns every cached attachment.
+// This allows runtimes to find, for example, all attachments it created
+// for a given namespace before deleting them.
+func (c *CNIConfig) ListAttachments(selector map[string]string) ([]*Attachment, error) {
+	cached, err := c.listCachedInfo(&RuntimeConf{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cached attachments: %v", err)
+	}
+
+	attachments := []*Attachment{}
+	for _, info := range cached {
+		if !matchLabels(info.Labels, selector) {
+			continue
+		}
+		attachments = append(attachments, &Attachment{
+			NetworkName: info.NetworkName,
+			ContainerID: info.ContainerID,
+			IfName:      info.IfName,
+			Config:      info.Config,
+			RuntimeConf: &RuntimeConf{
+				ContainerID:    info.ContainerID,
+				IfName:         info.IfName,
+				Args:           info.CniArgs,
+				CapabilityArgs: info.CapabilityArgs,
+				Labels:         info.Labels,
+			},
+		})
+	}
+	sort.Slice(attachments, func(i, j int) bool {
+		a, b := attachments[i], attachments[j]
+		if a.NetworkName != b.NetworkName {
+			return a.NetworkName < b.NetworkName
+		}
+		if a.ContainerID != b.ContainerID {
+			return a.ContainerID < b.ContainerID
+		}
+		return a.IfName < b.IfName
+	})
+	return attachments, nil
+}
@@ -0,0 +1,144 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/cni/pkg/version"
+)
+
+// legacyVersion returns the highest version supported by the plugin that
+// is not newer than cniVersion
+func (c *CNIConfig) legacyVersion(ctx context.Context, net *NetworkConfig, cniVersion string) (string, error) {
+	vi, err := c.GetVersionInfo(ctx, net.Network.Type)
+	if err != nil {
+		return "", err
+	}
+	best := ""
+	for _, v := range vi.SupportedVersions() {
+		if ok, err := version.GreaterThanOrEqualTo(cniVersion, v); err != nil || !ok {
+			continue
+		}
+		if best == "" {
+			best = v
+		} else if newer, err := version.GreaterThanOrEqualTo(v, best); err == nil && newer {
+			best = v
+		}
+	}
+	if best == "" {
+		return "", fmt.Errorf("legacy plugin %q supports no version up to %q", net.Network.Type, cniVersion)
+	}
+	return best, nil
+}
+
+// legacyPrevResult converts prevResult to legacyVers, or drops it if
+// legacyVers is older than minVersion, the version that introduced
+// prevResult for the command
+func legacyPrevResult(prevResult types.Result, legacyVers, minVersion string) (types.Result, bool, error) {
+	if prevResult == nil {
+		return nil, false, nil
+	}
+	if ok, err := version.GreaterThanOrEqualTo(legacyVers, minVersion); err != nil {
+		return nil, false, err
+	} else if !ok {
+		return nil, true, nil
+	}
+	prev, err := prevResult.GetAsVersion(legacyVers)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to convert prevResult to version %q: %v", legacyVers, err)
+	}
+	return prev, false, nil
+}
+
+func legacyWarning(net *NetworkConfig, cmd, format string, a ...interface{}) *PluginWarning {
+	return &PluginWarning{Type: net.Network.Type, Command: cmd, Message: fmt.Sprintf(format, a...)}
+}
+
+// addLegacyNetwork runs ADD for a legacy plugin and returns its result as
+// cniVersion
+func (c *CNIConfig) addLegacyNetwork(ctx context.Context, name, cniVersion string, net *NetworkConfig, prevResult types.Result, rt *RuntimeConf) (types.Result, []*PluginWarning, error) {
+	legacyVers, err := c.legacyVersion(ctx, net, cniVersion)
+	if err != nil {
+		return nil, nil, err
+	}
+	if legacyVers == cniVersion {
+		result, err := c.addNetwork(ctx, name, cniVersion, net, prevResult, rt)
+		return result, nil, err
+	}
+
+	warnings := []*PluginWarning{legacyWarning(net, "ADD", "run with version %s instead of %s", legacyVers, cniVersion)}
+	prev, dropped, err := legacyPrevResult(prevResult, legacyVers, "0.3.0")
+	if err != nil {
+		return nil, nil, err
+	}
+	if dropped {
+		warnings = append(warnings, legacyWarning(net, "ADD", "prevResult not passed to version %s", legacyVers))
+	}
+	result, err := c.addNetwork(ctx, name, legacyVers, net, prev, rt)
+	if err != nil {
+		return nil, nil, err
+	}
+	upgraded, err := result.GetAsVersion(cniVersion)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to convert legacy plugin %q result to version %q: %v", net.Network.Type, cniVersion, err)
+	}
+	return upgraded, warnings, nil
+}
+
+// checkLegacyNetwork runs CHECK for a legacy plugin, or skips it if the
+// plugin's version does not define CHECK
+func (c *CNIConfig) checkLegacyNetwork(ctx context.Context, name, cniVersion string, net *NetworkConfig, prevResult types.Result, rt *RuntimeConf) ([]*PluginWarning, error) {
+	legacyVers, err := c.legacyVersion(ctx, net, cniVersion)
+	if err != nil {
+		return nil, err
+	}
+	if legacyVers == cniVersion {
+		return nil, c.checkNetwork(ctx, name, cniVersion, net, prevResult, rt)
+	}
+	if ok, err := version.GreaterThanOrEqualTo(legacyVers, "0.4.0"); err != nil {
+		return nil, err
+	} else if !ok {
+		return []*PluginWarning{legacyWarning(net, "CHECK", "skipped: version %s does not support CHECK", legacyVers)}, nil
+	}
+
+	prev, _, err := legacyPrevResult(prevResult, legacyVers, "0.4.0")
+	if err != nil {
+		return nil, err
+	}
+	warnings := []*PluginWarning{legacyWarning(net, "CHECK", "run with version %s instead of %s", legacyVers, cniVersion)}
+	return warnings, c.checkNetwork(ctx, name, legacyVers, net, prev, rt)
+}
+
+// delLegacyNetwork runs DEL for a legacy plugin
+func (c *CNIConfig) delLegacyNetwork(ctx context.Context, name, cniVersion string, net *NetworkConfig, prevResult types.Result, rt *RuntimeConf) ([]*PluginWarning, error) {
+	legacyVers, err := c.legacyVersion(ctx, net, cniVersion)
+	if err != nil {
+		return nil, err
+	}
+	if legacyVers == cniVersion {
+		return nil, c.delNetwork(ctx, name, cniVersion, net, prevResult, rt)
+	}
+
+	// DEL only receives the cached result since 0.4.0
+	prev, _, err := legacyPrevResult(prevResult, legacyVers, "0.4.0")
+	if err != nil {
+		return nil, err
+	}
+	warnings := []*PluginWarning{legacyWarning(net, "DEL", "run with version %s instead of %s", legacyVers, cniVersion)}
+	return warnings, c.delNetwork(ctx, name, legacyVers, net, prev, rt)
+}
@@ -0,0 +1,218 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/containernetworking/cni/libcni"
+	"github.com/containernetworking/cni/pkg/version"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type legacyExecCall struct {
+	Plugin  string
+	Command string
+	Stdin   map[string]interface{}
+}
+
+// fakeLegacyExec runs plugins that support the versions in versions and
+// print the results in results on ADD. Plugins fail CHECK with the
+// errors in checkErrors.
+type fakeLegacyExec struct {
+	versions    map[string][]string
+	results     map[string]string
+	checkErrors map[string]error
+	calls       []legacyExecCall
+}
+
+func (e *fakeLegacyExec) ExecPlugin(_ context.Context, pluginPath string, stdinData []byte, environ []string) ([]byte, error) {
+	plugin := filepath.Base(pluginPath)
+	var command string
+	for _, env := range environ {
+		if strings.HasPrefix(env, "CNI_COMMAND=") {
+			command = strings.TrimPrefix(env, "CNI_COMMAND=")
+		}
+	}
+	if command == "VERSION" {
+		return json.Marshal(map[string]interface{}{
+			"cniVersion":        "0.4.0",
+			"supportedVersions": e.versions[plugin],
+		})
+	}
+
+	stdin := map[string]interface{}{}
+	if err := json.Unmarshal(stdinData, &stdin); err != nil {
+		return nil, err
+	}
+	e.calls = append(e.calls, legacyExecCall{Plugin: plugin, Command: command, Stdin: stdin})
+	if command == "ADD" {
+		return []byte(e.results[plugin]), nil
+	}
+	if command == "CHECK" && e.checkErrors[plugin] != nil {
+		return nil, e.checkErrors[plugin]
+	}
+	return nil, nil
+}
+
+func (e *fakeLegacyExec) FindInPath(plugin string, _ []string) (string, error) {
+	return "/fake/" + plugin, nil
+}
+
+func (e *fakeLegacyExec) Decode(jsonBytes []byte) (version.PluginInfo, error) {
+	return (&version.PluginDecoder{}).Decode(jsonBytes)
+}
+
+func (e *fakeLegacyExec) callsFor(plugin, command string) []legacyExecCall {
+	var calls []legacyExecCall
+	for _, c := range e.calls {
+		if c.Plugin == plugin && c.Command == command {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+var _ = Describe("legacy plugins in a list", func() {
+	var (
+		cacheDir  string
+		exec      *fakeLegacyExec
+		cniConfig *libcni.CNIConfig
+		list      *libcni.NetworkConfigList
+		rt        *libcni.RuntimeConf
+		ctx       context.Context
+	)
+
+	BeforeEach(func() {
+		var err error
+		cacheDir, err = ioutil.TempDir("", "cni-legacy")
+		Expect(err).NotTo(HaveOccurred())
+
+		exec = &fakeLegacyExec{
+			versions: map[string][]string{
+				"vendor": {"0.1.0", "0.2.0"},
+				"tuning": {"0.3.1", "0.4.0", "1.0.0"},
+			},
+			results: map[string]string{
+				"vendor": `{"cniVersion": "0.2.0", "ip4": {"ip": "10.1.2.3/24"}}`,
+				"tuning": `{"cniVersion": "1.0.0", "ips": [{"address": "10.1.2.3/24"}]}`,
+			},
+		}
+		cniConfig = libcni.NewCNIConfigWithCacheDir(nil, cacheDir, exec)
+		list, err = libcni.ConfListFromBytes([]byte(`{
+			"name": "legacy-list",
+			"cniVersion": "1.0.0",
+			"plugins": [
+				{"type": "vendor", "legacy": true},
+				{"type": "tuning"}
+			]
+		}`))
+		Expect(err).NotTo(HaveOccurred())
+		rt = &libcni.RuntimeConf{
+			ContainerID: "some-container-id",
+			NetNS:       "/some/netns",
+			IfName:      "eth0",
+		}
+		ctx = context.TODO()
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(cacheDir)).To(Succeed())
+	})
+
+	It("downgrades the legacy plugin's configuration and upgrades its result on ADD", func() {
+		_, warnings, err := cniConfig.AddNetworkListWithWarnings(ctx, list, rt)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(warnings).To(HaveLen(1))
+		Expect(warnings[0].Err).To(BeNil())
+		Expect(warnings[0].String()).To(Equal(`plugin "vendor" ADD: run with version 0.2.0 instead of 1.0.0`))
+
+		vendorAdds := exec.callsFor("vendor", "ADD")
+		Expect(vendorAdds).To(HaveLen(1))
+		Expect(vendorAdds[0].Stdin).To(HaveKeyWithValue("cniVersion", "0.2.0"))
+		Expect(vendorAdds[0].Stdin).NotTo(HaveKey("prevResult"))
+
+		tuningAdds := exec.callsFor("tuning", "ADD")
+		Expect(tuningAdds).To(HaveLen(1))
+		Expect(tuningAdds[0].Stdin).To(HaveKeyWithValue("cniVersion", "1.0.0"))
+		prevResult, ok := tuningAdds[0].Stdin["prevResult"].(map[string]interface{})
+		Expect(ok).To(BeTrue())
+		Expect(prevResult).To(HaveKeyWithValue("cniVersion", "1.0.0"))
+		Expect(fmt.Sprint(prevResult["ips"])).To(ContainSubstring("10.1.2.3/24"))
+	})
+
+	It("warns when a legacy plugin cannot receive the prevResult", func() {
+		list.Plugins[0], list.Plugins[1] = list.Plugins[1], list.Plugins[0]
+		_, warnings, err := cniConfig.AddNetworkListWithWarnings(ctx, list, rt)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(warnings).To(HaveLen(2))
+		Expect(warnings[1].Message).To(Equal("prevResult not passed to version 0.2.0"))
+	})
+
+	It("skips CHECK for a legacy plugin whose version does not define it", func() {
+		_, err := cniConfig.AddNetworkList(ctx, list, rt)
+		Expect(err).NotTo(HaveOccurred())
+
+		warnings, err := cniConfig.CheckNetworkListWithWarnings(ctx, list, rt)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(warnings).To(HaveLen(1))
+		Expect(warnings[0].Command).To(Equal("CHECK"))
+		Expect(warnings[0].Message).To(Equal("skipped: version 0.2.0 does not support CHECK"))
+		Expect(exec.callsFor("vendor", "CHECK")).To(BeEmpty())
+		Expect(exec.callsFor("tuning", "CHECK")).To(HaveLen(1))
+	})
+
+	It("runs DEL for a legacy plugin without the cached result", func() {
+		_, err := cniConfig.AddNetworkList(ctx, list, rt)
+		Expect(err).NotTo(HaveOccurred())
+
+		warnings, err := cniConfig.DelNetworkListWithWarnings(ctx, list, rt)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(warnings).To(HaveLen(1))
+		Expect(warnings[0].Command).To(Equal("DEL"))
+
+		vendorDels := exec.callsFor("vendor", "DEL")
+		Expect(vendorDels).To(HaveLen(1))
+		Expect(vendorDels[0].Stdin).To(HaveKeyWithValue("cniVersion", "0.2.0"))
+		Expect(vendorDels[0].Stdin).NotTo(HaveKey("prevResult"))
+		Expect(exec.callsFor("tuning", "DEL")[0].Stdin).To(HaveKey("prevResult"))
+	})
+
+	It("runs a legacy plugin that supports the list's version unchanged", func() {
+		exec.versions["vendor"] = []string{"0.2.0", "1.0.0"}
+		exec.results["vendor"] = exec.results["tuning"]
+		_, warnings, err := cniConfig.AddNetworkListWithWarnings(ctx, list, rt)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(warnings).To(BeEmpty())
+		Expect(exec.callsFor("vendor", "ADD")[0].Stdin).To(HaveKeyWithValue("cniVersion", "1.0.0"))
+	})
+
+	It("validates a legacy plugin against the versions it supports", func() {
+		_, err := cniConfig.ValidateNetworkList(ctx, list)
+		Expect(err).NotTo(HaveOccurred())
+
+		exec.versions["vendor"] = []string{"1.1.0"}
+		_, err = cniConfig.ValidateNetworkList(ctx, list)
+		Expect(err).To(MatchError(`[legacy plugin "vendor" supports no version up to "1.0.0"]`))
+	})
+})
@@ -0,0 +1,116 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// DefaultNodeConfigFile is the conventional location of the per-node
+// runtime configuration file
+const DefaultNodeConfigFile = "/etc/cni/runtime.json"
+
+// Well-known keys of the per-node runtime configuration
+const (
+	NodeConfigMTU          = "mtu"
+	NodeConfigIPFamilies   = "ipFamilies"
+	NodeConfigFeatureGates = "featureGates"
+)
+
+// NodeConfig holds node-wide settings written by the cluster administrator,
+// for example:
+//
+//	{
+//	  "mtu": 1450,
+//	  "ipFamilies": ["ipv4", "ipv6"],
+//	  "featureGates": {"someFeature": true}
+//	}
+//
+// Every top-level key is a default capability argument: it is passed in the
+// "runtimeConfig" dictionary to plugins that advertise the capability of the
+// same name, unless the runtime supplies its own value for that capability
+// in RuntimeConf.CapabilityArgs.
+type NodeConfig struct {
+	MTU          int
+	IPFamilies   []string
+	FeatureGates map[string]bool
+
+	// Args holds every key of the file, including ones unknown to libcni
+	Args map[string]interface{}
+}
+
+// NodeConfigFromBytes parses and validates a per-node runtime configuration
+func NodeConfigFromBytes(bytes []byte) (*NodeConfig, error) {
+	var known struct {
+		MTU          int             `json:"mtu"`
+		IPFamilies   []string        `json:"ipFamilies"`
+		FeatureGates map[string]bool `json:"featureGates"`
+	}
+	if err := json.Unmarshal(bytes, &known); err != nil {
+		return nil, fmt.Errorf("error parsing node configuration: %v", err)
+	}
+	if known.MTU < 0 {
+		return nil, fmt.Errorf("error parsing node configuration: invalid mtu %d", known.MTU)
+	}
+	for _, family := range known.IPFamilies {
+		if family != "ipv4" && family != "ipv6" {
+			return nil, fmt.Errorf("error parsing node configuration: invalid IP family %q", family)
+		}
+	}
+
+	nc := &NodeConfig{
+		MTU:          known.MTU,
+		IPFamilies:   known.IPFamilies,
+		FeatureGates: known.FeatureGates,
+	}
+	if err := json.Unmarshal(bytes, &nc.Args); err != nil {
+		return nil, fmt.Errorf("error parsing node configuration: %v", err)
+	}
+	return nc, nil
+}
+
+// LoadNodeConfig reads the per-node runtime configuration from filename.
+// A missing file is not an error and returns a nil NodeConfig.
+func LoadNodeConfig(filename string) (*NodeConfig, error) {
+	bytes, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading %s: %s", filename, err)
+	}
+	return NodeConfigFromBytes(bytes)
+}
+
+// withNodeDefaults returns a copy of rt whose CapabilityArgs are filled in
+// from the node configuration where the runtime did not provide a value
+func (c *CNIConfig) withNodeDefaults(rt *RuntimeConf) *RuntimeConf {
+	if c.NodeConfig == nil || len(c.NodeConfig.Args) == 0 {
+		return rt
+	}
+
+	newRt := *rt
+	newRt.CapabilityArgs = make(map[string]interface{}, len(rt.CapabilityArgs)+len(c.NodeConfig.Args))
+	for k, v := range c.NodeConfig.Args {
+		newRt.CapabilityArgs[k] = v
+	}
+	for k, v := range rt.CapabilityArgs {
+		newRt.CapabilityArgs[k] = v
+	}
+	return &newRt
+}
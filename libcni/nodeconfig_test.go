@@ -0,0 +1,88 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/containernetworking/cni/libcni"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Node configuration", func() {
+	Describe("NodeConfigFromBytes", func() {
+		It("parses the well-known keys and keeps unknown ones", func() {
+			nc, err := libcni.NodeConfigFromBytes([]byte(`{
+				"mtu": 1450,
+				"ipFamilies": ["ipv4", "ipv6"],
+				"featureGates": {"someFeature": true},
+				"vendorKnob": "x"
+			}`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(nc.MTU).To(Equal(1450))
+			Expect(nc.IPFamilies).To(Equal([]string{"ipv4", "ipv6"}))
+			Expect(nc.FeatureGates).To(Equal(map[string]bool{"someFeature": true}))
+			Expect(nc.Args).To(HaveKeyWithValue("vendorKnob", "x"))
+			Expect(nc.Args).To(HaveKey(libcni.NodeConfigMTU))
+		})
+
+		It("rejects an invalid IP family", func() {
+			_, err := libcni.NodeConfigFromBytes([]byte(`{"ipFamilies": ["ipv5"]}`))
+			Expect(err).To(MatchError(`error parsing node configuration: invalid IP family "ipv5"`))
+		})
+
+		It("rejects a negative MTU", func() {
+			_, err := libcni.NodeConfigFromBytes([]byte(`{"mtu": -1}`))
+			Expect(err).To(MatchError("error parsing node configuration: invalid mtu -1"))
+		})
+
+		It("rejects malformed JSON", func() {
+			_, err := libcni.NodeConfigFromBytes([]byte(`{"mtu": `))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("LoadNodeConfig", func() {
+		var configDir string
+
+		BeforeEach(func() {
+			var err error
+			configDir, err = ioutil.TempDir("", "node-conf")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(configDir)).To(Succeed())
+		})
+
+		It("loads the file", func() {
+			path := filepath.Join(configDir, "runtime.json")
+			Expect(ioutil.WriteFile(path, []byte(`{"mtu": 9000}`), 0600)).To(Succeed())
+
+			nc, err := libcni.LoadNodeConfig(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(nc.MTU).To(Equal(9000))
+		})
+
+		It("returns nil when the file does not exist", func() {
+			nc, err := libcni.LoadNodeConfig(filepath.Join(configDir, "runtime.json"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(nc).To(BeNil())
+		})
+	})
+})
@@ -0,0 +1,94 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// ExecPolicy restricts which plugin binaries libcni executes. It is meant
+// for locked-down environments where plugins may only be installed into
+// directories under strict change control.
+type ExecPolicy struct {
+	// AllowedDirs are the directories plugins may be executed from.
+	// Plugins are resolved through symlinks before being checked, so a
+	// link in an allowed directory to a binary elsewhere is refused.
+	AllowedDirs []string
+}
+
+// PolicyError is returned when a configuration references a plugin that
+// the ExecPolicy does not allow
+type PolicyError struct {
+	Type string
+	Path string
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("plugin type %q resolves to %s, which is outside the allowed plugin directories", e.Type, e.Path)
+}
+
+// allows returns true if the binary at path is in an allowed directory
+func (p *ExecPolicy) allows(path string) (bool, error) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return false, err
+	}
+	dir := filepath.Dir(resolved)
+	for _, allowed := range p.AllowedDirs {
+		allowedResolved, err := filepath.EvalSymlinks(allowed)
+		if err != nil {
+			continue
+		}
+		if dir == filepath.Clean(allowedResolved) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// findPlugin locates the binary for a plugin type, enforcing the policy
+func (c *CNIConfig) findPlugin(pluginType string) (string, error) {
+	c.ensureExec()
+	pluginPath, err := c.exec.FindInPath(pluginType, c.Path)
+	if err != nil {
+		return "", err
+	}
+	if c.Policy == nil {
+		return pluginPath, nil
+	}
+	ok, err := c.Policy.allows(pluginPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to check plugin type %q against the execution policy: %v", pluginType, err)
+	}
+	if !ok {
+		return "", &PolicyError{Type: pluginType, Path: pluginPath}
+	}
+	return pluginPath, nil
+}
+
+// checkListPolicy ensures every plugin of a list is allowed before any of
+// them runs, so that a list is never partially executed
+func (c *CNIConfig) checkListPolicy(list *NetworkConfigList) error {
+	if c.Policy == nil {
+		return nil
+	}
+	for _, net := range list.Plugins {
+		if _, err := c.findPlugin(net.Network.Type); err != nil {
+			return err
+		}
+	}
+	return nil
+}
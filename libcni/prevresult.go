@@ -0,0 +1,77 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni
+
+import (
+	"fmt"
+
+	"github.com/containernetworking/cni/pkg/types"
+)
+
+// PrevResultConversionError is returned when a network's cached result
+// cannot be converted to the version a plugin is run with, typically
+// because the configuration's version was lowered while the container was
+// running. CHECK and DEL are not run rather than passing the plugin a
+// prevResult in a format it does not understand.
+type PrevResultConversionError struct {
+	// Network is the name of the network
+	Network string
+	// Type is the type of the plugin, if the conversion was for one
+	Type string
+	// FromVersion is the version of the cached result
+	FromVersion string
+	// ToVersion is the version the plugin is run with
+	ToVersion string
+	// Err is the error converting the result
+	Err error
+}
+
+func (e *PrevResultConversionError) Error() string {
+	plugin := ""
+	if e.Type != "" {
+		plugin = fmt.Sprintf(" for plugin %q", e.Type)
+	}
+	return fmt.Sprintf("cannot convert cached result of network %q from version %q to %q%s: %v", e.Network, e.FromVersion, e.ToVersion, plugin, e.Err)
+}
+
+func (e *PrevResultConversionError) Unwrap() error {
+	return e.Err
+}
+
+// TypedError returns the error as a types.Error with the code
+// types.ErrIncompatibleCNIVersion
+func (e *PrevResultConversionError) TypedError() *types.Error {
+	return types.NewError(types.ErrIncompatibleCNIVersion, e.Error(), "restore the configuration version the container was added with")
+}
+
+// prevResultAs returns prevResult in cniVersion, the version the plugin of
+// net is run with, so that it never receives a prevResult in another
+// version than its configuration
+func prevResultAs(name string, net *NetworkConfig, prevResult types.Result, cniVersion string) (types.Result, error) {
+	if prevResult == nil || prevResult.Version() == cniVersion {
+		return prevResult, nil
+	}
+	converted, err := prevResult.GetAsVersion(cniVersion)
+	if err != nil {
+		return nil, &PrevResultConversionError{
+			Network:     name,
+			Type:        net.Network.Type,
+			FromVersion: prevResult.Version(),
+			ToVersion:   cniVersion,
+			Err:         err,
+		}
+	}
+	return converted, nil
+}
@@ -0,0 +1,104 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+
+	"github.com/containernetworking/cni/libcni"
+	"github.com/containernetworking/cni/pkg/types"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("cached prevResult versions", func() {
+	var (
+		cacheDir  string
+		exec      *fakeLegacyExec
+		cniConfig *libcni.CNIConfig
+		rt        *libcni.RuntimeConf
+		ctx       context.Context
+	)
+
+	listWithVersion := func(cniVersion string) *libcni.NetworkConfigList {
+		list, err := libcni.ConfListFromBytes([]byte(`{
+			"name": "versioned-list",
+			"cniVersion": "` + cniVersion + `",
+			"plugins": [{"type": "tuning"}]
+		}`))
+		Expect(err).NotTo(HaveOccurred())
+		return list
+	}
+
+	BeforeEach(func() {
+		var err error
+		cacheDir, err = ioutil.TempDir("", "cni-prevresult")
+		Expect(err).NotTo(HaveOccurred())
+
+		exec = &fakeLegacyExec{
+			versions: map[string][]string{"tuning": {"0.4.0", "1.0.0"}},
+			results: map[string]string{
+				"tuning": `{"cniVersion": "1.0.0", "ips": [{"address": "10.1.2.3/24"}]}`,
+			},
+		}
+		cniConfig = libcni.NewCNIConfigWithCacheDir(nil, cacheDir, exec)
+		rt = &libcni.RuntimeConf{
+			ContainerID: "some-container-id",
+			NetNS:       "/some/netns",
+			IfName:      "eth0",
+		}
+		ctx = context.TODO()
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(cacheDir)).To(Succeed())
+	})
+
+	It("passes the cached result in the version the plugin is run with", func() {
+		_, err := cniConfig.AddNetworkList(ctx, listWithVersion("1.0.0"), rt)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(cniConfig.CheckNetworkList(ctx, listWithVersion("0.4.0"), rt)).To(Succeed())
+		checks := exec.callsFor("tuning", "CHECK")
+		Expect(checks).To(HaveLen(1))
+		Expect(checks[0].Stdin).To(HaveKeyWithValue("cniVersion", "0.4.0"))
+		Expect(checks[0].Stdin["prevResult"]).To(HaveKeyWithValue("cniVersion", "0.4.0"))
+	})
+
+	It("fails with a typed error when the cached result cannot be converted", func() {
+		exec.results["tuning"] = `{"cniVersion": "1.0.0", "routes": [{"dst": "0.0.0.0/0", "table": 100}]}`
+		_, err := cniConfig.AddNetworkList(ctx, listWithVersion("1.0.0"), rt)
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, run := range []func(context.Context, *libcni.NetworkConfigList, *libcni.RuntimeConf) error{
+			cniConfig.CheckNetworkList,
+			cniConfig.DelNetworkList,
+		} {
+			err = run(ctx, listWithVersion("0.4.0"), rt)
+			var convErr *libcni.PrevResultConversionError
+			Expect(errors.As(err, &convErr)).To(BeTrue())
+			Expect(convErr.Network).To(Equal("versioned-list"))
+			Expect(convErr.FromVersion).To(Equal("1.0.0"))
+			Expect(convErr.ToVersion).To(Equal("0.4.0"))
+			Expect(convErr.TypedError().Code).To(Equal(uint(types.ErrIncompatibleCNIVersion)))
+		}
+		Expect(exec.callsFor("tuning", "CHECK")).To(BeEmpty())
+		Expect(exec.callsFor("tuning", "DEL")).To(BeEmpty())
+	})
+})
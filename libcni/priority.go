@@ -0,0 +1,104 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni
+
+import (
+	"path/filepath"
+	"sort"
+)
+
+// LoadNetworks loads every network configured in dir, in the order a
+// runtime should prefer them: by descending Priority, then by file name.
+// Networks configured by .conf and .json files are converted to lists.
+// When several files configure the same network, the one LoadConfList
+// would return is kept: a .conflist over a single configuration, then the
+// highest priority, then the first file name.
+func LoadNetworks(dir string) ([]*NetworkConfigList, error) {
+	type network struct {
+		file string
+		list *NetworkConfigList
+	}
+	var networks []*network
+	byName := map[string]*network{}
+
+	lists, err := ConfFiles(dir, []string{".conflist"})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(lists)
+	for _, file := range lists {
+		list, err := ConfListFromFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if n, ok := byName[list.Name]; ok {
+			if list.Priority > n.list.Priority {
+				n.file, n.list = file, list
+			}
+			continue
+		}
+		n := &network{file: file, list: list}
+		byName[list.Name] = n
+		networks = append(networks, n)
+	}
+
+	confs, err := ConfFiles(dir, []string{".conf", ".json"})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(confs)
+	for _, file := range confs {
+		conf, err := ConfFromFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := byName[conf.Network.Name]; ok {
+			continue
+		}
+		list, err := ConfListFromConf(conf)
+		if err != nil {
+			return nil, err
+		}
+		n := &network{file: file, list: list}
+		byName[list.Name] = n
+		networks = append(networks, n)
+	}
+
+	sort.SliceStable(networks, func(i, j int) bool {
+		if networks[i].list.Priority != networks[j].list.Priority {
+			return networks[i].list.Priority > networks[j].list.Priority
+		}
+		return filepath.Base(networks[i].file) < filepath.Base(networks[j].file)
+	})
+	result := make([]*NetworkConfigList, 0, len(networks))
+	for _, n := range networks {
+		result = append(result, n.list)
+	}
+	return result, nil
+}
+
+// DefaultNetwork returns the network a runtime should attach containers
+// to when no network is requested: the first of LoadNetworks(dir). It
+// returns a NoConfigsFoundError if dir configures no network.
+func DefaultNetwork(dir string) (*NetworkConfigList, error) {
+	networks, err := LoadNetworks(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(networks) == 0 {
+		return nil, NoConfigsFoundError{Dir: dir}
+	}
+	return networks[0], nil
+}
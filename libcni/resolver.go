@@ -0,0 +1,73 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni
+
+import (
+	"context"
+	"fmt"
+)
+
+// NetworkResolver maps a network name to its configuration, such as one
+// served by an API server rather than read from a directory on disk.
+// CNIConfig consults it only in ResolveNetworkList(); LoadConfList() and
+// the other loading functions always read from disk.
+//
+// Resolvers should return a NotFoundError when the name is unknown.
+type NetworkResolver interface {
+	ResolveNetwork(ctx context.Context, name string) (*NetworkConfigList, error)
+}
+
+// DirResolver resolves networks from the configuration files in a
+// directory, like LoadConfList()
+type DirResolver struct {
+	Dir string
+}
+
+var _ NetworkResolver = &DirResolver{}
+
+// NewDirResolver returns a NetworkResolver that reads configuration files
+// from dir
+func NewDirResolver(dir string) *DirResolver {
+	return &DirResolver{Dir: dir}
+}
+
+func (r *DirResolver) ResolveNetwork(_ context.Context, name string) (*NetworkConfigList, error) {
+	return LoadConfList(r.Dir, name)
+}
+
+// NetworkResolverFunc adapts an ordinary function to a NetworkResolver
+type NetworkResolverFunc func(ctx context.Context, name string) (*NetworkConfigList, error)
+
+var _ NetworkResolver = NetworkResolverFunc(nil)
+
+func (f NetworkResolverFunc) ResolveNetwork(ctx context.Context, name string) (*NetworkConfigList, error) {
+	return f(ctx, name)
+}
+
+// ResolveNetworkList returns the configuration of the named network from
+// the CNIConfig's Resolver.
+func (c *CNIConfig) ResolveNetworkList(ctx context.Context, name string) (*NetworkConfigList, error) {
+	if c.Resolver == nil {
+		return nil, fmt.Errorf("no network resolver configured")
+	}
+	list, err := c.Resolver.ResolveNetwork(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		return nil, fmt.Errorf("network resolver returned no configuration for %q", name)
+	}
+	return list, nil
+}
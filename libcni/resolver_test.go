@@ -0,0 +1,101 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/containernetworking/cni/libcni"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Network resolution", func() {
+	var (
+		cniConfig *libcni.CNIConfig
+		ctx       context.Context
+	)
+
+	BeforeEach(func() {
+		cniConfig = libcni.NewCNIConfig(nil, nil)
+		ctx = context.TODO()
+	})
+
+	It("returns an error when no resolver is configured", func() {
+		_, err := cniConfig.ResolveNetworkList(ctx, "some-net")
+		Expect(err).To(MatchError("no network resolver configured"))
+	})
+
+	Context("with a directory resolver", func() {
+		var configDir string
+
+		BeforeEach(func() {
+			var err error
+			configDir, err = ioutil.TempDir("", "plugin-conf")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ioutil.WriteFile(filepath.Join(configDir, "50-some.conflist"), []byte(`{
+				"name": "some-list",
+				"cniVersion": "1.0.0",
+				"plugins": [{"type": "host-local"}]
+			}`), 0600)).To(Succeed())
+			cniConfig.Resolver = libcni.NewDirResolver(configDir)
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(configDir)).To(Succeed())
+		})
+
+		It("finds the network by name", func() {
+			list, err := cniConfig.ResolveNetworkList(ctx, "some-list")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(list.Name).To(Equal("some-list"))
+			Expect(list.Plugins).To(HaveLen(1))
+		})
+
+		It("returns a NotFoundError for unknown networks", func() {
+			_, err := cniConfig.ResolveNetworkList(ctx, "other-list")
+			Expect(err).To(BeAssignableToTypeOf(libcni.NotFoundError{}))
+		})
+	})
+
+	Context("with a callback resolver", func() {
+		It("serves configurations that are not on disk", func() {
+			cniConfig.Resolver = libcni.NetworkResolverFunc(func(_ context.Context, name string) (*libcni.NetworkConfigList, error) {
+				return libcni.ConfListFromBytes([]byte(`{
+					"name": "` + name + `",
+					"cniVersion": "1.0.0",
+					"plugins": [{"type": "bridge"}]
+				}`))
+			})
+
+			list, err := cniConfig.ResolveNetworkList(ctx, "dynamic")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(list.Name).To(Equal("dynamic"))
+			Expect(list.Plugins[0].Network.Type).To(Equal("bridge"))
+		})
+
+		It("rejects a nil configuration", func() {
+			cniConfig.Resolver = libcni.NetworkResolverFunc(func(context.Context, string) (*libcni.NetworkConfigList, error) {
+				return nil, nil
+			})
+
+			_, err := cniConfig.ResolveNetworkList(ctx, "dynamic")
+			Expect(err).To(MatchError(`network resolver returned no configuration for "dynamic"`))
+		})
+	})
+})
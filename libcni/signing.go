@@ -0,0 +1,172 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// CacheSigner signs and verifies cached attachment records
+type CacheSigner interface {
+	Sign(data []byte) ([]byte, error)
+	Verify(data, signature []byte) error
+}
+
+// HMACSigner signs cache records with HMAC-SHA256 using a shared node key
+type HMACSigner struct {
+	Key []byte
+}
+
+// NewHMACSigner returns a CacheSigner using HMAC-SHA256 with the given key
+func NewHMACSigner(key []byte) *HMACSigner {
+	return &HMACSigner{Key: key}
+}
+
+func (s *HMACSigner) Sign(data []byte) ([]byte, error) {
+	if len(s.Key) == 0 {
+		return nil, fmt.Errorf("HMAC signing key is empty")
+	}
+	mac := hmac.New(sha256.New, s.Key)
+	mac.Write(data)
+	return mac.Sum(nil), nil
+}
+
+func (s *HMACSigner) Verify(data, signature []byte) error {
+	expected, err := s.Sign(data)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(expected, signature) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+// Ed25519Signer signs cache records with an ed25519 node key. A signer
+// with only PublicKey set can verify records but not sign them, which
+// allows auditing a node without access to its private key.
+type Ed25519Signer struct {
+	PrivateKey ed25519.PrivateKey
+	PublicKey  ed25519.PublicKey
+}
+
+// NewEd25519Signer returns a CacheSigner using the given private key
+func NewEd25519Signer(key ed25519.PrivateKey) *Ed25519Signer {
+	return &Ed25519Signer{
+		PrivateKey: key,
+		PublicKey:  key.Public().(ed25519.PublicKey),
+	}
+}
+
+func (s *Ed25519Signer) Sign(data []byte) ([]byte, error) {
+	if len(s.PrivateKey) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("ed25519 private key is not set")
+	}
+	return ed25519.Sign(s.PrivateKey, data), nil
+}
+
+func (s *Ed25519Signer) Verify(data, signature []byte) error {
+	if len(s.PublicKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("ed25519 public key is not set")
+	}
+	if !ed25519.Verify(s.PublicKey, data, signature) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+// signedCachedInfo returns the bytes covered by the signature of a
+// cached record: the record itself, serialized without its signature.
+// The record is normalized through a JSON round trip first, so that
+// typed capability args, such as structs or large integers, give the same
+// bytes as the maps and floats they are read back as.
+func signedCachedInfo(cached *cachedInfo) ([]byte, error) {
+	unsigned := *cached
+	unsigned.Signature = nil
+	data, err := json.Marshal(&unsigned)
+	if err != nil {
+		return nil, err
+	}
+	normalized := cachedInfo{}
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return nil, err
+	}
+	return json.Marshal(&normalized)
+}
+
+func (c *CNIConfig) signCachedInfo(cached *cachedInfo) ([]byte, error) {
+	data, err := signedCachedInfo(cached)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := c.Signer.Sign(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign cached result: %v", err)
+	}
+	return sig, nil
+}
+
+func (c *CNIConfig) verifyCachedResult(netName string, rt *RuntimeConf) error {
+	if c.Signer == nil {
+		return fmt.Errorf("no signer configured to verify cached network %q", netName)
+	}
+
+	fname, err := c.getCacheFilePath(netName, rt)
+	if err != nil {
+		return err
+	}
+	fdata, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return fmt.Errorf("failed to read cached network %q: %v", netName, err)
+	}
+
+	cached := cachedInfo{}
+	if err := json.Unmarshal(fdata, &cached); err != nil {
+		return fmt.Errorf("failed to unmarshal cached network %q: %v", netName, err)
+	}
+	if cached.Kind != CNICacheV1 {
+		return fmt.Errorf("cached network %q has wrong kind: %v", netName, cached.Kind)
+	}
+	if len(cached.Signature) == 0 {
+		return fmt.Errorf("cached network %q is not signed", netName)
+	}
+
+	data, err := signedCachedInfo(&cached)
+	if err != nil {
+		return err
+	}
+	if err := c.Signer.Verify(data, cached.Signature); err != nil {
+		return fmt.Errorf("cached network %q failed verification: %v", netName, err)
+	}
+	return nil
+}
+
+// VerifyNetworkListCachedResult checks the signature of the record cached
+// by a previous AddNetworkList() operation. It returns an error if the
+// record is missing, unsigned, or was modified after it was written.
+func (c *CNIConfig) VerifyNetworkListCachedResult(list *NetworkConfigList, rt *RuntimeConf) error {
+	return c.verifyCachedResult(list.Name, rt)
+}
+
+// VerifyNetworkCachedResult checks the signature of the record cached
+// by a previous AddNetwork() operation.
+func (c *CNIConfig) VerifyNetworkCachedResult(net *NetworkConfig, rt *RuntimeConf) error {
+	return c.verifyCachedResult(net.Network.Name, rt)
+}
@@ -0,0 +1,132 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// AttachmentState identifies an attachment and carries its cached record
+type AttachmentState struct {
+	NetworkName string
+	ContainerID string
+	IfName      string
+	// Record is the JSON cache record as written to the cache directory.
+	// It is empty when the attachment is deleted.
+	Record []byte
+}
+
+// StateWriter receives a copy of every attachment record libcni caches,
+// so that attachment state can be kept in a central store such as etcd
+// or the Kubernetes API in addition to the node's cache directory.
+type StateWriter interface {
+	// WriteState is called after an attachment's record is cached
+	WriteState(ctx context.Context, state *AttachmentState) error
+	// DeleteState is called after an attachment's record is removed
+	DeleteState(ctx context.Context, state *AttachmentState) error
+}
+
+type stateOp struct {
+	delete bool
+	state  *AttachmentState
+}
+
+// StateReplicator is a StateWriter that forwards state to another
+// StateWriter from a background worker, retrying failed writes. Writes are
+// queued in order; when the queue is full, WriteState and DeleteState block
+// until there is room or their context is done, so that a slow store
+// pushes back on the caller instead of growing memory without bound.
+type StateReplicator struct {
+	// MaxAttempts is the number of times a write is tried before it is
+	// given up and reported to OnError
+	MaxAttempts int
+	// Backoff is the delay before the first retry; it doubles on each
+	// subsequent retry
+	Backoff time.Duration
+	// OnError, if set, is called with writes that failed on every attempt
+	OnError func(state *AttachmentState, err error)
+
+	writer StateWriter
+	queue  chan stateOp
+}
+
+var _ StateWriter = &StateReplicator{}
+
+// NewStateReplicator returns a StateReplicator that queues up to queueSize
+// writes for writer. Run must be called for writes to be forwarded.
+func NewStateReplicator(writer StateWriter, queueSize int) *StateReplicator {
+	return &StateReplicator{
+		MaxAttempts: 5,
+		Backoff:     100 * time.Millisecond,
+		writer:      writer,
+		queue:       make(chan stateOp, queueSize),
+	}
+}
+
+// WriteState queues state to be written
+func (r *StateReplicator) WriteState(ctx context.Context, state *AttachmentState) error {
+	return r.enqueue(ctx, stateOp{state: state})
+}
+
+// DeleteState queues state to be deleted
+func (r *StateReplicator) DeleteState(ctx context.Context, state *AttachmentState) error {
+	return r.enqueue(ctx, stateOp{delete: true, state: state})
+}
+
+func (r *StateReplicator) enqueue(ctx context.Context, op stateOp) error {
+	select {
+	case r.queue <- op:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("state replication queue is full: %v", ctx.Err())
+	}
+}
+
+// Run forwards queued writes until ctx is done
+func (r *StateReplicator) Run(ctx context.Context) {
+	for {
+		select {
+		case op := <-r.queue:
+			if err := r.forward(ctx, op); err != nil && r.OnError != nil {
+				r.OnError(op.state, err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (r *StateReplicator) forward(ctx context.Context, op stateOp) error {
+	backoff := r.Backoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		if op.delete {
+			err = r.writer.DeleteState(ctx, op.state)
+		} else {
+			err = r.writer.WriteState(ctx, op.state)
+		}
+		if err == nil || attempt >= r.MaxAttempts {
+			return err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return err
+		}
+		backoff *= 2
+	}
+}
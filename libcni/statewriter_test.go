@@ -0,0 +1,114 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/containernetworking/cni/libcni"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type fakeStateWriter struct {
+	sync.Mutex
+	failures int
+	writes   []string
+	deletes  []string
+}
+
+func (f *fakeStateWriter) WriteState(_ context.Context, state *libcni.AttachmentState) error {
+	f.Lock()
+	defer f.Unlock()
+	if f.failures > 0 {
+		f.failures--
+		return errors.New("store unavailable")
+	}
+	f.writes = append(f.writes, state.ContainerID)
+	return nil
+}
+
+func (f *fakeStateWriter) DeleteState(_ context.Context, state *libcni.AttachmentState) error {
+	f.Lock()
+	defer f.Unlock()
+	f.deletes = append(f.deletes, state.ContainerID)
+	return nil
+}
+
+func (f *fakeStateWriter) written() []string {
+	f.Lock()
+	defer f.Unlock()
+	return append([]string(nil), f.writes...)
+}
+
+var _ = Describe("StateReplicator", func() {
+	var (
+		writer     *fakeStateWriter
+		replicator *libcni.StateReplicator
+		ctx        context.Context
+		cancel     context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		writer = &fakeStateWriter{}
+		replicator = libcni.NewStateReplicator(writer, 1)
+		replicator.Backoff = time.Millisecond
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("forwards writes in order", func() {
+		go replicator.Run(ctx)
+		Expect(replicator.WriteState(ctx, &libcni.AttachmentState{ContainerID: "a"})).To(Succeed())
+		Expect(replicator.WriteState(ctx, &libcni.AttachmentState{ContainerID: "b"})).To(Succeed())
+		Eventually(writer.written).Should(Equal([]string{"a", "b"}))
+	})
+
+	It("retries failed writes", func() {
+		writer.failures = 2
+		go replicator.Run(ctx)
+		Expect(replicator.WriteState(ctx, &libcni.AttachmentState{ContainerID: "a"})).To(Succeed())
+		Eventually(writer.written).Should(Equal([]string{"a"}))
+	})
+
+	It("reports writes that fail on every attempt", func() {
+		writer.failures = 10
+		replicator.MaxAttempts = 3
+		failed := make(chan error, 1)
+		replicator.OnError = func(state *libcni.AttachmentState, err error) {
+			failed <- err
+		}
+		go replicator.Run(ctx)
+		Expect(replicator.WriteState(ctx, &libcni.AttachmentState{ContainerID: "a"})).To(Succeed())
+		Eventually(failed).Should(Receive(MatchError("store unavailable")))
+		Expect(writer.failures).To(Equal(7))
+	})
+
+	It("blocks when the queue is full", func() {
+		Expect(replicator.WriteState(ctx, &libcni.AttachmentState{ContainerID: "a"})).To(Succeed())
+
+		timeoutCtx, timeoutCancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer timeoutCancel()
+		err := replicator.DeleteState(timeoutCtx, &libcni.AttachmentState{ContainerID: "a"})
+		Expect(err).To(MatchError("state replication queue is full: context deadline exceeded"))
+	})
+})
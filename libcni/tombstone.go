@@ -0,0 +1,109 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/containernetworking/cni/pkg/types"
+)
+
+// Tombstone records an operation on an attachment that timed out or was
+// cancelled while a plugin was running. The attachment may be
+// half-configured: the plugins before the interrupted one ran, and the
+// interrupted plugin may have made some of its changes.
+//
+// The tombstone is kept in the attachment's cache entry, together with
+// the result of the plugins that completed, so that a later DEL receives
+// that result and GCNetworkList collects the attachment if the runtime no
+// longer uses it. A successful ADD or DEL of the attachment removes it.
+// An interface name allocated for an interrupted ADD with
+// RuntimeConf.IfNamePrefix is left in RuntimeConf.IfName and stays
+// reserved until DEL, so that the tombstone can be found under it.
+type Tombstone struct {
+	// Command is the interrupted command, ADD or DEL
+	Command string `json:"command"`
+	// PluginIndex is the index in the list of the plugin that was running
+	PluginIndex int `json:"pluginIndex"`
+	// Plugin is the type of the plugin that was running
+	Plugin string `json:"plugin"`
+	// Time is when the plugin was interrupted
+	Time time.Time `json:"time"`
+	// Error is the error the plugin failed with
+	Error string `json:"error,omitempty"`
+}
+
+func (t *Tombstone) String() string {
+	return fmt.Sprintf("%s interrupted in plugin %d (%s) at %s: %s", t.Command, t.PluginIndex, t.Plugin, t.Time.Format(time.RFC3339), t.Error)
+}
+
+// cacheInterrupted writes a tombstone to the attachment's cache entry if
+// the plugin at index failed because ctx timed out or was cancelled.
+// Other failures leave the cache unchanged. The tombstone of a DEL keeps
+// the configuration, labels and arguments recorded by ADD, so that the
+// half-deleted attachment is still found by them. The tombstone is
+// best-effort: failing to write it does not hide the plugin's error. It
+// returns true if the plugin was interrupted.
+func (c *CNIConfig) cacheInterrupted(ctx context.Context, command string, index int, net *NetworkConfig, err error, result types.Result, config []byte, netName string, rt *RuntimeConf) bool {
+	if ctx.Err() == nil {
+		return false
+	}
+	tomb := &Tombstone{
+		Command:     command,
+		PluginIndex: index,
+		Plugin:      net.Network.Type,
+		Time:        time.Now().UTC(),
+		Error:       err.Error(),
+	}
+	if command == "DEL" {
+		if cached, _ := c.readCachedInfo(netName, rt); cached != nil {
+			addRt := *rt
+			addRt.Args = cached.CniArgs
+			addRt.Labels = cached.Labels
+			if len(cached.CapabilityArgs) > 0 {
+				addRt.CapabilityArgs = cached.CapabilityArgs
+			}
+			rt = &addRt
+			config = cached.Config
+		}
+	}
+	// The context is done, so the StateWriter is given a fresh one
+	_ = c.writeCachedInfo(context.Background(), result, config, netName, rt, tomb)
+	return true
+}
+
+func (c *CNIConfig) getTombstone(netName string, rt *RuntimeConf) (*Tombstone, error) {
+	cached, err := c.readCachedInfo(netName, rt)
+	if err != nil || cached == nil {
+		return nil, err
+	}
+	return cached.Tombstone, nil
+}
+
+// GetNetworkListTombstone returns the tombstone left by an interrupted
+// AddNetworkList() or DelNetworkList() of a network list, or nil if the
+// last operation on the attachment was not interrupted
+func (c *CNIConfig) GetNetworkListTombstone(list *NetworkConfigList, rt *RuntimeConf) (*Tombstone, error) {
+	return c.getTombstone(list.Name, rt)
+}
+
+// GetNetworkTombstone returns the tombstone left by an interrupted
+// AddNetwork() or DelNetwork() of a network, or nil if the last operation
+// on the attachment was not interrupted
+func (c *CNIConfig) GetNetworkTombstone(net *NetworkConfig, rt *RuntimeConf) (*Tombstone, error) {
+	return c.getTombstone(net.Network.Name, rt)
+}
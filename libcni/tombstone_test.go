@@ -0,0 +1,204 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/containernetworking/cni/libcni"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// interruptingExec cancels the context of the calls to the plugin
+// interrupted, failing them as a killed plugin would
+type interruptingExec struct {
+	*fakeLegacyExec
+	interrupted string
+	cancel      context.CancelFunc
+}
+
+func (e *interruptingExec) ExecPlugin(ctx context.Context, pluginPath string, stdinData []byte, environ []string) ([]byte, error) {
+	if filepath.Base(pluginPath) == e.interrupted {
+		e.cancel()
+		return nil, errors.New("signal: killed")
+	}
+	return e.fakeLegacyExec.ExecPlugin(ctx, pluginPath, stdinData, environ)
+}
+
+var _ = Describe("tombstones of interrupted operations", func() {
+	var (
+		cacheDir  string
+		exec      *interruptingExec
+		cniConfig *libcni.CNIConfig
+		list      *libcni.NetworkConfigList
+		rt        *libcni.RuntimeConf
+		ctx       context.Context
+	)
+
+	BeforeEach(func() {
+		var err error
+		cacheDir, err = ioutil.TempDir("", "cni-tombstone")
+		Expect(err).NotTo(HaveOccurred())
+
+		exec = &interruptingExec{fakeLegacyExec: &fakeLegacyExec{
+			versions: map[string][]string{
+				"bridge":  {"1.0.0"},
+				"portmap": {"1.0.0"},
+			},
+			results: map[string]string{
+				"bridge":  `{"cniVersion": "1.0.0", "ips": [{"address": "10.1.2.3/24"}]}`,
+				"portmap": `{"cniVersion": "1.0.0", "ips": [{"address": "10.1.2.3/24"}]}`,
+			},
+		}}
+		ctx, exec.cancel = context.WithCancel(context.TODO())
+		cniConfig = libcni.NewCNIConfigWithCacheDir(nil, cacheDir, exec)
+		list, err = libcni.ConfListFromBytes([]byte(`{
+			"name": "tombstone-list",
+			"cniVersion": "1.0.0",
+			"plugins": [{"type": "bridge"}, {"type": "portmap"}]
+		}`))
+		Expect(err).NotTo(HaveOccurred())
+		rt = &libcni.RuntimeConf{
+			ContainerID: "some-container-id",
+			NetNS:       "/some/netns",
+			IfName:      "eth0",
+		}
+	})
+
+	AfterEach(func() {
+		exec.cancel()
+		Expect(os.RemoveAll(cacheDir)).To(Succeed())
+	})
+
+	It("records the plugin an interrupted ADD was running", func() {
+		exec.interrupted = "portmap"
+		_, err := cniConfig.AddNetworkList(ctx, list, rt)
+		Expect(err).To(MatchError("signal: killed"))
+
+		tomb, err := cniConfig.GetNetworkListTombstone(list, rt)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tomb).NotTo(BeNil())
+		Expect(tomb.Command).To(Equal("ADD"))
+		Expect(tomb.PluginIndex).To(Equal(1))
+		Expect(tomb.Plugin).To(Equal("portmap"))
+		Expect(tomb.Error).To(Equal("signal: killed"))
+		Expect(tomb.Time).NotTo(BeZero())
+
+		// The result of the plugins that completed is kept for DEL
+		result, err := cniConfig.GetNetworkListCachedResult(list, rt)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).NotTo(BeNil())
+	})
+
+	It("removes the tombstone once the attachment is deleted", func() {
+		exec.interrupted = "bridge"
+		_, err := cniConfig.AddNetworkList(ctx, list, rt)
+		Expect(err).To(HaveOccurred())
+		result, err := cniConfig.GetNetworkListCachedResult(list, rt)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(BeNil())
+
+		exec.interrupted = ""
+		Expect(cniConfig.DelNetworkList(context.TODO(), list, rt)).To(Succeed())
+		tomb, err := cniConfig.GetNetworkListTombstone(list, rt)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tomb).To(BeNil())
+	})
+
+	It("records an interrupted DEL, keeping the cached result", func() {
+		_, err := cniConfig.AddNetworkList(ctx, list, rt)
+		Expect(err).NotTo(HaveOccurred())
+
+		exec.interrupted = "bridge"
+		Expect(cniConfig.DelNetworkList(ctx, list, rt)).NotTo(Succeed())
+		tomb, err := cniConfig.GetNetworkListTombstone(list, rt)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tomb.Command).To(Equal("DEL"))
+		Expect(tomb.PluginIndex).To(Equal(0))
+		result, err := cniConfig.GetNetworkListCachedResult(list, rt)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).NotTo(BeNil())
+	})
+
+	It("keeps the configuration, labels and arguments of ADD when DEL is interrupted", func() {
+		rt.Labels = map[string]string{"app": "web"}
+		rt.Args = [][2]string{{"K8S_POD_NAME", "web-0"}}
+		_, err := cniConfig.AddNetworkList(ctx, list, rt)
+		Expect(err).NotTo(HaveOccurred())
+
+		delList, err := libcni.ConfListFromBytes([]byte(`{
+			"name": "tombstone-list",
+			"cniVersion": "1.0.0",
+			"plugins": [{"type": "bridge", "mtu": 1400}, {"type": "portmap"}]
+		}`))
+		Expect(err).NotTo(HaveOccurred())
+		delRt := &libcni.RuntimeConf{ContainerID: rt.ContainerID, NetNS: rt.NetNS, IfName: rt.IfName}
+		exec.interrupted = "bridge"
+		Expect(cniConfig.DelNetworkList(ctx, delList, delRt)).NotTo(Succeed())
+
+		config, cachedRt, err := cniConfig.GetNetworkListCachedConfig(list, delRt)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config).To(Equal(list.Bytes))
+		Expect(cachedRt.Labels).To(Equal(rt.Labels))
+		Expect(cachedRt.Args).To(Equal(rt.Args))
+		matched, err := cniConfig.ListAttachments(map[string]string{"app": "web"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(matched).To(HaveLen(1))
+	})
+
+	It("keeps an allocated interface name reserved when ADD is interrupted", func() {
+		rt.IfName = ""
+		rt.IfNamePrefix = "net"
+		exec.interrupted = "portmap"
+		_, err := cniConfig.AddNetworkList(ctx, list, rt)
+		Expect(err).To(HaveOccurred())
+		Expect(rt.IfName).To(Equal("net0"))
+
+		tomb, err := cniConfig.GetNetworkListTombstone(list, rt)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tomb).NotTo(BeNil())
+
+		// Another attachment of the container gets a different name
+		exec.interrupted = ""
+		other := &libcni.RuntimeConf{ContainerID: rt.ContainerID, NetNS: rt.NetNS, IfNamePrefix: "net"}
+		_, err = cniConfig.AddNetworkList(context.TODO(), list, other)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(other.IfName).To(Equal("net1"))
+	})
+
+	It("releases an allocated interface name when ADD fails cleanly", func() {
+		rt.IfName = ""
+		rt.IfNamePrefix = "net"
+		exec.results["portmap"] = "not json"
+		_, err := cniConfig.AddNetworkList(ctx, list, rt)
+		Expect(err).To(HaveOccurred())
+		Expect(rt.IfName).To(BeEmpty())
+	})
+
+	It("does not record failures that are not interruptions", func() {
+		exec.results["portmap"] = "not json"
+		_, err := cniConfig.AddNetworkList(ctx, list, rt)
+		Expect(err).To(HaveOccurred())
+		tomb, err := cniConfig.GetNetworkListTombstone(list, rt)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tomb).To(BeNil())
+	})
+})
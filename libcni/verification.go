@@ -0,0 +1,67 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/containernetworking/cni/pkg/types"
+	current "github.com/containernetworking/cni/pkg/types/100"
+)
+
+// seedVerification adds the interfaces and addresses of the cached result
+// to v, all with an unknown status
+func seedVerification(v *types.Verification, cachedResult types.Result) error {
+	if cachedResult == nil {
+		return nil
+	}
+	result, err := current.NewResultFromResult(cachedResult)
+	if err != nil {
+		return fmt.Errorf("failed to convert cached result: %v", err)
+	}
+	for _, iface := range result.Interfaces {
+		v.SetInterface(iface.Name, iface.Sandbox, types.VerificationUnknown, "")
+	}
+	for _, ip := range result.IPs {
+		v.SetIP(ip.Address.String(), types.VerificationUnknown, "")
+	}
+	return nil
+}
+
+// markVerified marks the entries of v that no plugin reported on as
+// verified
+func markVerified(v *types.Verification) {
+	for _, iface := range v.Interfaces {
+		if iface.Status == types.VerificationUnknown {
+			iface.Status = types.VerificationVerified
+		}
+	}
+	for _, ip := range v.IPs {
+		if ip.Status == types.VerificationUnknown {
+			ip.Status = types.VerificationVerified
+		}
+	}
+}
+
+// verificationOf returns the Verification a plugin failed CHECK with, if
+// any
+func verificationOf(err error) *types.Verification {
+	var typedErr *types.Error
+	if errors.As(err, &typedErr) {
+		return typedErr.Verification
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+
+	"github.com/containernetworking/cni/libcni"
+	"github.com/containernetworking/cni/pkg/types"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CHECK with verification", func() {
+	var (
+		cacheDir  string
+		exec      *fakeLegacyExec
+		cniConfig *libcni.CNIConfig
+		list      *libcni.NetworkConfigList
+		rt        *libcni.RuntimeConf
+		ctx       context.Context
+	)
+
+	BeforeEach(func() {
+		var err error
+		cacheDir, err = ioutil.TempDir("", "cni-verification")
+		Expect(err).NotTo(HaveOccurred())
+
+		exec = &fakeLegacyExec{
+			versions: map[string][]string{
+				"bridge": {"1.0.0"},
+				"tuning": {"1.0.0"},
+			},
+			results: map[string]string{
+				"bridge": `{"cniVersion": "1.0.0", "interfaces": [{"name": "eth0", "sandbox": "/some/netns"}], "ips": [{"address": "10.1.2.3/24", "interface": 0}]}`,
+				"tuning": `{"cniVersion": "1.0.0", "interfaces": [{"name": "eth0", "sandbox": "/some/netns"}], "ips": [{"address": "10.1.2.3/24", "interface": 0}]}`,
+			},
+			checkErrors: map[string]error{},
+		}
+		cniConfig = libcni.NewCNIConfigWithCacheDir(nil, cacheDir, exec)
+		list, err = libcni.ConfListFromBytes([]byte(`{
+			"name": "verified-list",
+			"cniVersion": "1.0.0",
+			"plugins": [{"type": "bridge"}, {"type": "tuning"}]
+		}`))
+		Expect(err).NotTo(HaveOccurred())
+		rt = &libcni.RuntimeConf{
+			ContainerID: "some-container-id",
+			NetNS:       "/some/netns",
+			IfName:      "eth0",
+		}
+		ctx = context.TODO()
+
+		_, err = cniConfig.AddNetworkList(ctx, list, rt)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(cacheDir)).To(Succeed())
+	})
+
+	It("verifies every entry of the cached result when all plugins pass", func() {
+		v, err := cniConfig.CheckNetworkListWithVerification(ctx, list, rt)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(v.Status()).To(Equal(types.VerificationVerified))
+		Expect(v.Interfaces).To(HaveLen(1))
+		Expect(v.IPs).To(HaveLen(1))
+		Expect(v.IPs[0].Address).To(Equal("10.1.2.3/24"))
+	})
+
+	It("merges the outcomes a failing plugin reports", func() {
+		checkErr := types.NewError(types.ErrInternal, "eth0 drifted", "")
+		checkErr.Verification = &types.Verification{
+			Interfaces: []*types.InterfaceVerification{{Name: "eth0", Sandbox: "/some/netns", Status: types.VerificationDrifted, Message: "MTU changed"}},
+		}
+		exec.checkErrors["bridge"] = checkErr
+
+		v, err := cniConfig.CheckNetworkListWithVerification(ctx, list, rt)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(v.Status()).To(Equal(types.VerificationDrifted))
+		Expect(v.Interfaces[0].Message).To(Equal("MTU changed"))
+		Expect(v.IPs[0].Status).To(Equal(types.VerificationUnknown))
+		Expect(exec.callsFor("tuning", "CHECK")).To(HaveLen(1))
+
+		Expect(cniConfig.CheckNetworkList(ctx, list, rt)).To(MatchError("eth0 drifted"))
+	})
+
+	It("fails on errors without a verification", func() {
+		exec.checkErrors["bridge"] = errors.New("boom")
+		_, err := cniConfig.CheckNetworkListWithVerification(ctx, list, rt)
+		Expect(err).To(MatchError("boom"))
+	})
+
+	It("returns no verification when CHECK is disabled", func() {
+		list.DisableCheck = true
+		v, err := cniConfig.CheckNetworkListWithVerification(ctx, list, rt)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(v).To(BeNil())
+	})
+})
@@ -0,0 +1,157 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package invoke
+
+import (
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"syscall"
+)
+
+// ArchMismatchError is returned when a plugin binary could not be executed
+// because it was built for a different architecture than the host.
+type ArchMismatchError struct {
+	// Path is the path of the plugin binary
+	Path string
+	// BinaryArch is the architecture of the binary, in GOARCH notation
+	BinaryArch string
+	// HostArch is the architecture of the host, in GOARCH notation
+	HostArch string
+	// Err is the original exec error
+	Err error
+}
+
+func (e *ArchMismatchError) Error() string {
+	return fmt.Sprintf("plugin %s is built for %s but the host is %s: %v", e.Path, e.BinaryArch, e.HostArch, e.Err)
+}
+
+func (e *ArchMismatchError) Unwrap() error {
+	return e.Err
+}
+
+// isExecFormatError returns true if err indicates the kernel refused to
+// run the binary because of its format
+func isExecFormatError(err error) bool {
+	return errors.Is(err, syscall.ENOEXEC) ||
+		strings.Contains(err.Error(), "exec format error") ||
+		strings.Contains(err.Error(), "not a valid Win32 application")
+}
+
+// checkArch inspects the plugin binary after an exec format error and
+// returns an ArchMismatchError if it was built for another architecture.
+// It returns nil if the binary's architecture could not be determined
+// or matches the host.
+func checkArch(pluginPath string, execErr error) error {
+	if !isExecFormatError(execErr) {
+		return nil
+	}
+	arch, err := binaryArch(pluginPath)
+	if err != nil || arch == runtime.GOARCH {
+		return nil
+	}
+	return &ArchMismatchError{
+		Path:       pluginPath,
+		BinaryArch: arch,
+		HostArch:   runtime.GOARCH,
+		Err:        execErr,
+	}
+}
+
+// binaryArch reads the executable header of the file at path and returns
+// the architecture it was built for, in GOARCH notation
+func binaryArch(path string) (string, error) {
+	if f, err := elf.Open(path); err == nil {
+		defer f.Close()
+		return elfArch(f), nil
+	}
+	if f, err := pe.Open(path); err == nil {
+		defer f.Close()
+		return peArch(f.Machine), nil
+	}
+	if f, err := macho.Open(path); err == nil {
+		defer f.Close()
+		return machoArch(f.Cpu), nil
+	}
+	return "", fmt.Errorf("unrecognized executable format")
+}
+
+func elfArch(f *elf.File) string {
+	le := f.ByteOrder == binary.LittleEndian
+	is64 := f.Class == elf.ELFCLASS64
+	switch f.Machine {
+	case elf.EM_X86_64:
+		return "amd64"
+	case elf.EM_386:
+		return "386"
+	case elf.EM_ARM:
+		return "arm"
+	case elf.EM_AARCH64:
+		return "arm64"
+	case elf.EM_S390:
+		return "s390x"
+	case elf.EM_PPC64:
+		if le {
+			return "ppc64le"
+		}
+		return "ppc64"
+	case elf.EM_MIPS:
+		switch {
+		case is64 && le:
+			return "mips64le"
+		case is64:
+			return "mips64"
+		case le:
+			return "mipsle"
+		}
+		return "mips"
+	case elf.EM_RISCV:
+		return "riscv64"
+	}
+	return strings.ToLower(strings.TrimPrefix(f.Machine.String(), "EM_"))
+}
+
+func peArch(machine uint16) string {
+	switch machine {
+	case pe.IMAGE_FILE_MACHINE_AMD64:
+		return "amd64"
+	case pe.IMAGE_FILE_MACHINE_I386:
+		return "386"
+	case pe.IMAGE_FILE_MACHINE_ARMNT:
+		return "arm"
+	case pe.IMAGE_FILE_MACHINE_ARM64:
+		return "arm64"
+	}
+	return fmt.Sprintf("pe-machine-%#x", machine)
+}
+
+func machoArch(cpu macho.Cpu) string {
+	switch cpu {
+	case macho.CpuAmd64:
+		return "amd64"
+	case macho.Cpu386:
+		return "386"
+	case macho.CpuArm:
+		return "arm"
+	case macho.CpuArm64:
+		return "arm64"
+	}
+	return strings.ToLower(cpu.String())
+}
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 )
 
 type CNIArgs interface {
@@ -47,7 +48,11 @@ type Args struct {
 	PluginArgs    [][2]string
 	PluginArgsStr string
 	IfName        string
-	Path          string
+	// IfNames, if set, lists the interfaces of an attachment of several
+	// interfaces and is passed in CNI_IFNAMES. Its first name should be
+	// IfName.
+	IfNames []string
+	Path    string
 }
 
 // Args implements the CNIArgs interface
@@ -70,6 +75,9 @@ func (args *Args) AsEnv() []string {
 		"CNI_IFNAME="+args.IfName,
 		"CNI_PATH="+args.Path,
 	)
+	if len(args.IfNames) > 0 {
+		env = append(env, "CNI_IFNAMES="+strings.Join(args.IfNames, ","))
+	}
 	return dedupEnv(env)
 }
 
@@ -91,6 +99,16 @@ var _ CNIArgs = &DelegateArgs{}
 
 type DelegateArgs struct {
 	Command string
+	// Depth, if non-zero, is passed to the delegated plugin in
+	// CNI_DELEGATION_DEPTH
+	Depth int
+	// TraceParent, if set, is passed to the delegated plugin in
+	// TraceParentEnv and OTelTraceParentEnv
+	TraceParent string
+	// Timeout, if non-zero, is passed to the delegated plugin in
+	// TimeoutEnv. The delegate helpers set it to the time left before
+	// the deadline of their context; see DelegateContext.
+	Timeout time.Duration
 }
 
 func (d *DelegateArgs) AsEnv() []string {
@@ -101,6 +119,15 @@ func (d *DelegateArgs) AsEnv() []string {
 	env = append(env,
 		"CNI_COMMAND="+d.Command,
 	)
+	if d.Depth > 0 {
+		env = append(env, fmt.Sprintf("%s=%d", DelegationDepthEnv, d.Depth))
+	}
+	if d.TraceParent != "" {
+		env = append(env, TraceParentEnv+"="+d.TraceParent, OTelTraceParentEnv+"="+d.TraceParent)
+	}
+	if d.Timeout > 0 {
+		env = append(env, TimeoutEnv+"="+formatTimeout(d.Timeout))
+	}
 	return dedupEnv(env)
 }
 
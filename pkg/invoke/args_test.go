@@ -15,7 +15,9 @@
 package invoke_test
 
 import (
+	"context"
 	"os"
+	"time"
 
 	"github.com/containernetworking/cni/pkg/invoke"
 
@@ -68,6 +70,17 @@ var _ = Describe("CNIArgs AsEnv", func() {
 			Expect(inStringSlice("CNI_PATH=testpath", cniEnvs)).To(Equal(false))
 		})
 
+		It("appends the interface names when set", func() {
+			args := invoke.Args{
+				Command: "ADD",
+				IfName:  "net1",
+				IfNames: []string{"net1", "net1rep"},
+			}
+
+			cniEnvs := args.AsEnv()
+			Expect(inStringSlice("CNI_IFNAMES=net1,net1rep", cniEnvs)).To(Equal(true))
+		})
+
 		AfterEach(func() {
 			os.Unsetenv("CNI_COMMAND")
 			os.Unsetenv("CNI_IFNAME")
@@ -114,6 +127,40 @@ var _ = Describe("CNIArgs AsEnv", func() {
 			Expect(inStringSlice("CNI_COMMAND=ADD", cniEnvs)).To(Equal(true))
 		})
 
+		It("appends the delegation depth when set", func() {
+			delegateArgs := invoke.DelegateArgs{
+				Command: "ADD",
+				Depth:   3,
+			}
+
+			cniEnvs := delegateArgs.AsEnv()
+			Expect(inStringSlice("CNI_DELEGATION_DEPTH=3", cniEnvs)).To(Equal(true))
+		})
+
+		It("appends the timeout when set", func() {
+			delegateArgs := invoke.DelegateArgs{
+				Command: "ADD",
+				Timeout: 2500*time.Millisecond + time.Microsecond,
+			}
+
+			cniEnvs := delegateArgs.AsEnv()
+			Expect(inStringSlice("CNI_TIMEOUT=2.5s", cniEnvs)).To(Equal(true))
+		})
+
+		It("appends the traceparent when set", func() {
+			traceparent := "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+			delegateArgs := invoke.DelegateArgs{
+				Command:     "ADD",
+				TraceParent: traceparent,
+			}
+
+			cniEnvs := delegateArgs.AsEnv()
+			Expect(inStringSlice("CNI_TRACEPARENT="+traceparent, cniEnvs)).To(Equal(true))
+			Expect(inStringSlice("TRACEPARENT="+traceparent, cniEnvs)).To(Equal(true))
+			Expect(invoke.TraceParentFromContext(invoke.ContextWithTraceParent(context.TODO(), traceparent))).To(Equal(traceparent))
+			Expect(invoke.TraceParentFromContext(context.TODO())).To(BeEmpty())
+		})
+
 		AfterEach(func() {
 			os.Unsetenv("CNI_COMMAND")
 		})
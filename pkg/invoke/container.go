@@ -0,0 +1,113 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package invoke
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/containernetworking/cni/pkg/version"
+)
+
+// DefaultContainerPluginDir is the directory of the plugins inside the
+// helper container image unless ContainerExec.PluginDir is set
+const DefaultContainerPluginDir = "/opt/cni/bin"
+
+// ContainerExecFunc runs argv in a container of image, such as with
+// "runc exec" or a container runtime's API, with stdin and the environment
+// environ, copying the command's output to stdout and stderr. It returns
+// an error if the command could not be run or exited with a non-zero
+// status. The container must share the host's network, PID and mount
+// namespaces, or at least see the network namespace paths passed in
+// CNI_NETNS, for the plugin to configure them.
+type ContainerExecFunc func(ctx context.Context, image string, argv []string, stdin []byte, environ []string, stdout, stderr io.Writer) error
+
+// ContainerExec is an Exec that runs plugins inside a helper container
+// image, so that plugins can be shipped as images rather than host
+// binaries. Plugin paths are paths inside the image.
+type ContainerExec struct {
+	// Image is the helper container image holding the plugins
+	Image string
+	// PluginDir is the directory of the plugins in the image. It is passed
+	// to the plugins as CNI_PATH, so that they can delegate to each other.
+	PluginDir string
+	// Plugins, if set, lists the plugin types the image provides; others
+	// are not found
+	Plugins []string
+	// Exec runs a command in a container of Image
+	Exec ContainerExecFunc
+
+	version.PluginDecoder
+}
+
+var _ Exec = &ContainerExec{}
+
+// NewContainerExec returns a ContainerExec that runs the plugins in
+// DefaultContainerPluginDir of image with exec
+func NewContainerExec(image string, exec ContainerExecFunc) *ContainerExec {
+	return &ContainerExec{Image: image, Exec: exec}
+}
+
+func (e *ContainerExec) pluginDir() string {
+	if e.PluginDir != "" {
+		return e.PluginDir
+	}
+	return DefaultContainerPluginDir
+}
+
+// ExecPlugin runs the plugin at pluginPath in the image. Only the CNI_*
+// variables of environ are passed, as the rest of the host's environment,
+// such as PATH, does not apply inside the container.
+func (e *ContainerExec) ExecPlugin(ctx context.Context, pluginPath string, stdinData []byte, environ []string) ([]byte, error) {
+	var env []string
+	for _, kv := range environ {
+		if strings.HasPrefix(kv, "CNI_") || strings.HasPrefix(kv, OTelTraceParentEnv+"=") {
+			env = append(env, kv)
+		}
+	}
+	env = dedupEnv(append(env, "CNI_PATH="+e.pluginDir()))
+
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	if err := e.Exec(ctx, e.Image, []string{pluginPath}, stdinData, env, stdout, stderr); err != nil {
+		return nil, (&RawExec{}).pluginErr(err, stdout.Bytes(), stderr.Bytes())
+	}
+	return stdout.Bytes(), nil
+}
+
+// FindInPath returns the path of the plugin in the image's PluginDir. The
+// host paths passed in paths do not apply and are ignored.
+func (e *ContainerExec) FindInPath(plugin string, _ []string) (string, error) {
+	if plugin == "" {
+		return "", fmt.Errorf("no plugin name provided")
+	}
+	if strings.ContainsAny(plugin, "/\\") {
+		return "", fmt.Errorf("invalid plugin name: %s", plugin)
+	}
+	if len(e.Plugins) > 0 {
+		found := false
+		for _, p := range e.Plugins {
+			found = found || p == plugin
+		}
+		if !found {
+			return "", fmt.Errorf("failed to find plugin %q in image %s", plugin, e.Image)
+		}
+	}
+	return path.Join(e.pluginDir(), plugin), nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package invoke_test
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/containernetworking/cni/pkg/invoke"
+	"github.com/containernetworking/cni/pkg/types"
+	current "github.com/containernetworking/cni/pkg/types/100"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type containerExecCall struct {
+	Image   string
+	Argv    []string
+	Stdin   []byte
+	Environ []string
+}
+
+var _ = Describe("ContainerExec", func() {
+	var (
+		calls  []containerExecCall
+		stdout string
+		stderr string
+		err    error
+		exec   *invoke.ContainerExec
+	)
+
+	BeforeEach(func() {
+		calls = nil
+		stdout = `{"cniVersion": "1.0.0", "ips": [{"address": "10.1.2.3/24"}]}`
+		stderr = ""
+		err = nil
+		exec = invoke.NewContainerExec("example.com/cni-plugins:v1", func(_ context.Context, image string, argv []string, stdin []byte, environ []string, out, errOut io.Writer) error {
+			calls = append(calls, containerExecCall{image, argv, stdin, environ})
+			_, _ = io.WriteString(out, stdout)
+			_, _ = io.WriteString(errOut, stderr)
+			return err
+		})
+	})
+
+	It("runs the plugin from the image with the CNI environment", func() {
+		pluginPath, e := exec.FindInPath("bridge", []string{"/host/cni/bin"})
+		Expect(e).NotTo(HaveOccurred())
+		Expect(pluginPath).To(Equal("/opt/cni/bin/bridge"))
+
+		netconf := []byte(`{"name": "net", "type": "bridge", "cniVersion": "1.0.0"}`)
+		args := &invoke.Args{Command: "ADD", ContainerID: "some-container-id", NetNS: "/var/run/netns/test", IfName: "eth0", Path: "/host/cni/bin"}
+		result, e := invoke.ExecPluginWithResult(context.TODO(), pluginPath, netconf, args, exec)
+		Expect(e).NotTo(HaveOccurred())
+		Expect(result.(*current.Result).IPs[0].Address.String()).To(Equal("10.1.2.3/24"))
+
+		Expect(calls).To(HaveLen(1))
+		Expect(calls[0].Image).To(Equal("example.com/cni-plugins:v1"))
+		Expect(calls[0].Argv).To(Equal([]string{"/opt/cni/bin/bridge"}))
+		Expect(calls[0].Stdin).To(Equal(netconf))
+		Expect(calls[0].Environ).To(ContainElements(
+			"CNI_COMMAND=ADD",
+			"CNI_CONTAINERID=some-container-id",
+			"CNI_NETNS=/var/run/netns/test",
+			"CNI_IFNAME=eth0",
+			"CNI_PATH=/opt/cni/bin",
+		))
+		for _, kv := range calls[0].Environ {
+			Expect(kv).To(HavePrefix("CNI_"))
+		}
+	})
+
+	It("reports the error the plugin printed", func() {
+		stdout = `{"code": 11, "msg": "busy"}`
+		err = errors.New("exit status 1")
+		_, e := exec.ExecPlugin(context.TODO(), "/opt/cni/bin/bridge", nil, nil)
+		Expect(e).To(Equal(&types.Error{Code: 11, Msg: "busy"}))
+
+		stdout = ""
+		stderr = "no such image"
+		_, e = exec.ExecPlugin(context.TODO(), "/opt/cni/bin/bridge", nil, nil)
+		Expect(e).To(MatchError(`netplugin failed: "no such image"`))
+	})
+
+	It("only finds the plugins the image provides", func() {
+		exec.Plugins = []string{"bridge"}
+		exec.PluginDir = "/usr/libexec/cni"
+		pluginPath, e := exec.FindInPath("bridge", nil)
+		Expect(e).NotTo(HaveOccurred())
+		Expect(pluginPath).To(Equal("/usr/libexec/cni/bridge"))
+
+		_, e = exec.FindInPath("ptp", nil)
+		Expect(e).To(MatchError(`failed to find plugin "ptp" in image example.com/cni-plugins:v1`))
+		_, e = exec.FindInPath("../bridge", nil)
+		Expect(e).To(MatchError("invalid plugin name: ../bridge"))
+	})
+})
@@ -0,0 +1,128 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package invoke
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/containernetworking/cni/pkg/types"
+)
+
+// DefaultDaemonProbeTimeout bounds how long ProbeDaemonSocket waits for
+// the daemon to accept a connection
+const DefaultDaemonProbeTimeout = 2 * time.Second
+
+// DaemonUnavailableError is returned when the daemon a plugin depends on,
+// such as the DHCP daemon, does not accept connections on its socket.
+type DaemonUnavailableError struct {
+	// Plugin is the type of the plugin, if known
+	Plugin string
+	// Socket is the path of the daemon's socket
+	Socket string
+	// Err is the error connecting to the socket
+	Err error
+}
+
+func (e *DaemonUnavailableError) Error() string {
+	plugin := ""
+	if e.Plugin != "" {
+		plugin = fmt.Sprintf(" for plugin %s", e.Plugin)
+	}
+	return fmt.Sprintf("daemon%s is unavailable at %s: %v", plugin, e.Socket, e.Err)
+}
+
+func (e *DaemonUnavailableError) Unwrap() error {
+	return e.Err
+}
+
+// TypedError returns the error as a types.Error with the code
+// types.ErrTryAgainLater, telling the runtime that the command may
+// succeed once the daemon is running
+func (e *DaemonUnavailableError) TypedError() *types.Error {
+	return types.NewError(types.ErrTryAgainLater, e.Error(), "check that the daemon is running and listening on "+e.Socket+", then retry")
+}
+
+// ProbeDaemonSocket checks that a daemon accepts connections on the unix
+// socket at path, returning a DaemonUnavailableError if it does not
+// within timeout. A timeout of zero means DefaultDaemonProbeTimeout.
+func ProbeDaemonSocket(ctx context.Context, path string, timeout time.Duration) error {
+	if err := probeDaemonSocket(ctx, path, timeout); err != nil {
+		return err
+	}
+	return nil
+}
+
+func probeDaemonSocket(ctx context.Context, path string, timeout time.Duration) *DaemonUnavailableError {
+	if timeout <= 0 {
+		timeout = DefaultDaemonProbeTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	conn, err := (&net.Dialer{}).DialContext(ctx, "unix", path)
+	if err != nil {
+		return &DaemonUnavailableError{Socket: path, Err: err}
+	}
+	_ = conn.Close()
+	return nil
+}
+
+// DaemonProbeExec is an Exec that probes the socket of the daemon a
+// plugin depends on before executing the plugin, so that an unavailable
+// daemon is reported as a DaemonUnavailableError instead of the plugin
+// timing out. VERSION commands do not need the daemon and are not probed.
+type DaemonProbeExec struct {
+	Exec
+	// Sockets maps plugin types, the names of their binaries, to the
+	// socket of the daemon they depend on. Other plugins are executed
+	// without a probe.
+	Sockets map[string]string
+	// Timeout bounds each probe; see ProbeDaemonSocket
+	Timeout time.Duration
+}
+
+// NewDaemonProbeExec returns a DaemonProbeExec that executes plugins with
+// exec, or the default Exec if exec is nil
+func NewDaemonProbeExec(exec Exec, sockets map[string]string) *DaemonProbeExec {
+	if exec == nil {
+		exec = defaultExec
+	}
+	return &DaemonProbeExec{Exec: exec, Sockets: sockets}
+}
+
+func (e *DaemonProbeExec) ExecPlugin(ctx context.Context, pluginPath string, stdinData []byte, environ []string) ([]byte, error) {
+	plugin := strings.TrimSuffix(filepath.Base(pluginPath), ".exe")
+	if socket, ok := e.Sockets[plugin]; ok && envCommand(environ) != "VERSION" {
+		if err := probeDaemonSocket(ctx, socket, e.Timeout); err != nil {
+			err.Plugin = plugin
+			return nil, err
+		}
+	}
+	return e.Exec.ExecPlugin(ctx, pluginPath, stdinData, environ)
+}
+
+// envCommand returns the CNI_COMMAND set in environ
+func envCommand(environ []string) string {
+	for _, kv := range environ {
+		if strings.HasPrefix(kv, "CNI_COMMAND=") {
+			return strings.TrimPrefix(kv, "CNI_COMMAND=")
+		}
+	}
+	return ""
+}
@@ -0,0 +1,111 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package invoke_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/containernetworking/cni/pkg/invoke"
+	"github.com/containernetworking/cni/pkg/invoke/fakes"
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/cni/pkg/version"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type fakeDaemonExec struct {
+	fakes.RawExec
+	version.PluginDecoder
+}
+
+var _ = Describe("daemon socket probes", func() {
+	var (
+		dir      string
+		socket   string
+		listener net.Listener
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "cni-daemon")
+		Expect(err).NotTo(HaveOccurred())
+		socket = filepath.Join(dir, "dhcp.sock")
+		listener, err = net.Listen("unix", socket)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		listener.Close()
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	It("succeeds when the daemon accepts connections", func() {
+		Expect(invoke.ProbeDaemonSocket(context.TODO(), socket, 0)).To(Succeed())
+	})
+
+	It("returns a DaemonUnavailableError when nothing listens on the socket", func() {
+		listener.Close()
+		err := invoke.ProbeDaemonSocket(context.TODO(), socket, 0)
+		var daemonErr *invoke.DaemonUnavailableError
+		Expect(errors.As(err, &daemonErr)).To(BeTrue())
+		Expect(daemonErr.Socket).To(Equal(socket))
+
+		typed := daemonErr.TypedError()
+		Expect(typed.Code).To(Equal(types.ErrTryAgainLater))
+		Expect(typed.Details).To(ContainSubstring("then retry"))
+	})
+
+	Describe("DaemonProbeExec", func() {
+		var (
+			fake *fakeDaemonExec
+			exec *invoke.DaemonProbeExec
+		)
+
+		BeforeEach(func() {
+			fake = &fakeDaemonExec{}
+			fake.ExecPluginCall.Returns.ResultBytes = []byte("{}")
+			exec = invoke.NewDaemonProbeExec(fake, map[string]string{"dhcp": socket})
+		})
+
+		It("executes the plugin when its daemon is available", func() {
+			out, err := exec.ExecPlugin(context.TODO(), "/opt/cni/bin/dhcp", nil, []string{"CNI_COMMAND=ADD"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(out).To(Equal([]byte("{}")))
+			Expect(fake.ExecPluginCall.Received.PluginPath).To(Equal("/opt/cni/bin/dhcp"))
+		})
+
+		It("does not execute the plugin when its daemon is unavailable", func() {
+			listener.Close()
+			_, err := exec.ExecPlugin(context.TODO(), "/opt/cni/bin/dhcp", nil, []string{"CNI_COMMAND=ADD"})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(HavePrefix("daemon for plugin dhcp is unavailable at " + socket))
+			Expect(fake.ExecPluginCall.Received.PluginPath).To(BeEmpty())
+		})
+
+		It("does not probe for VERSION or for other plugins", func() {
+			listener.Close()
+			_, err := exec.ExecPlugin(context.TODO(), "/opt/cni/bin/dhcp", nil, []string{"CNI_COMMAND=VERSION"})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = exec.ExecPlugin(context.TODO(), "/opt/cni/bin/bridge", nil, []string{"CNI_COMMAND=ADD"})
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+})
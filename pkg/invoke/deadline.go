@@ -0,0 +1,72 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package invoke
+
+import (
+	"context"
+	"time"
+)
+
+// TimeoutEnv is the variable through which the delegate helpers pass the
+// time left before the delegating plugin's deadline to the delegated
+// plugin, so that it gives up before the runtime does. skel reads it as
+// the plugin's timeout.
+const TimeoutEnv = "CNI_TIMEOUT"
+
+// DefaultDelegateReserve is the time DelegateContext keeps for the
+// delegating plugin when it is passed a reserve of zero
+const DefaultDelegateReserve = time.Second
+
+// DelegateContext returns a context for delegating to a plugin, such as
+// an IPAM plugin, whose deadline is reserve earlier than the deadline of
+// ctx. The delegating plugin keeps that time to clean up and report the
+// error when the delegated plugin times out. At most half of the time left
+// is reserved, so that short deadlines still leave time to delegate. If ctx
+// has no deadline, the returned context has none either.
+func DelegateContext(ctx context.Context, reserve time.Duration) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return context.WithCancel(ctx)
+	}
+	if reserve <= 0 {
+		reserve = DefaultDelegateReserve
+	}
+	if left := time.Until(deadline); reserve > left/2 {
+		reserve = left / 2
+	}
+	return context.WithDeadline(ctx, deadline.Add(-reserve))
+}
+
+// delegateTimeout returns the time left before the deadline of ctx, or
+// zero if it has none
+func delegateTimeout(ctx context.Context) (time.Duration, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, nil
+	}
+	left := time.Until(deadline)
+	if left <= 0 {
+		return 0, context.DeadlineExceeded
+	}
+	return left, nil
+}
+
+// formatTimeout formats d for TimeoutEnv, in whole milliseconds
+func formatTimeout(d time.Duration) string {
+	if d < time.Millisecond {
+		d = time.Millisecond
+	}
+	return d.Truncate(time.Millisecond).String()
+}
@@ -16,12 +16,41 @@ package invoke
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 
 	"github.com/containernetworking/cni/pkg/types"
 )
 
+// DelegationDepthEnv is the environment variable through which the
+// delegate helpers pass the current delegation depth to the delegated
+// plugin.
+const DelegationDepthEnv = "CNI_DELEGATION_DEPTH"
+
+// MaxDelegationDepth is the deepest chain of delegations allowed. A
+// delegation that would exceed it fails instead of executing the plugin,
+// which stops meta-plugins that delegate to each other from looping.
+var MaxDelegationDepth = 16
+
+// delegationDepth returns the depth a delegated plugin would run at
+func delegationDepth() (int, error) {
+	depth := 0
+	if env := os.Getenv(DelegationDepthEnv); env != "" {
+		var err error
+		depth, err = strconv.Atoi(env)
+		if err != nil || depth < 0 {
+			return 0, fmt.Errorf("invalid %s %q", DelegationDepthEnv, env)
+		}
+	}
+	depth++
+	if depth > MaxDelegationDepth {
+		return 0, fmt.Errorf("delegation depth %d exceeds the maximum of %d", depth, MaxDelegationDepth)
+	}
+	return depth, nil
+}
+
 func delegateCommon(delegatePlugin string, exec Exec) (string, Exec, error) {
 	if exec == nil {
 		exec = defaultExec
@@ -39,42 +68,65 @@ func delegateCommon(delegatePlugin string, exec Exec) (string, Exec, error) {
 // DelegateAdd calls the given delegate plugin with the CNI ADD action and
 // JSON configuration
 func DelegateAdd(ctx context.Context, delegatePlugin string, netconf []byte, exec Exec) (types.Result, error) {
+	args, err := delegateArgs(ctx, "ADD")
+	if err != nil {
+		return nil, err
+	}
 	pluginPath, realExec, err := delegateCommon(delegatePlugin, exec)
 	if err != nil {
 		return nil, err
 	}
 
 	// DelegateAdd will override the original "CNI_COMMAND" env from process with ADD
-	return ExecPluginWithResult(ctx, pluginPath, netconf, delegateArgs("ADD"), realExec)
+	return ExecPluginWithResult(ctx, pluginPath, netconf, args, realExec)
 }
 
 // DelegateCheck calls the given delegate plugin with the CNI CHECK action and
 // JSON configuration
 func DelegateCheck(ctx context.Context, delegatePlugin string, netconf []byte, exec Exec) error {
+	args, err := delegateArgs(ctx, "CHECK")
+	if err != nil {
+		return err
+	}
 	pluginPath, realExec, err := delegateCommon(delegatePlugin, exec)
 	if err != nil {
 		return err
 	}
 
 	// DelegateCheck will override the original CNI_COMMAND env from process with CHECK
-	return ExecPluginWithoutResult(ctx, pluginPath, netconf, delegateArgs("CHECK"), realExec)
+	return ExecPluginWithoutResult(ctx, pluginPath, netconf, args, realExec)
 }
 
 // DelegateDel calls the given delegate plugin with the CNI DEL action and
 // JSON configuration
 func DelegateDel(ctx context.Context, delegatePlugin string, netconf []byte, exec Exec) error {
+	args, err := delegateArgs(ctx, "DEL")
+	if err != nil {
+		return err
+	}
 	pluginPath, realExec, err := delegateCommon(delegatePlugin, exec)
 	if err != nil {
 		return err
 	}
 
 	// DelegateDel will override the original CNI_COMMAND env from process with DEL
-	return ExecPluginWithoutResult(ctx, pluginPath, netconf, delegateArgs("DEL"), realExec)
+	return ExecPluginWithoutResult(ctx, pluginPath, netconf, args, realExec)
 }
 
 // return CNIArgs used by delegation
-func delegateArgs(action string) *DelegateArgs {
-	return &DelegateArgs{
-		Command: action,
+func delegateArgs(ctx context.Context, action string) (*DelegateArgs, error) {
+	depth, err := delegationDepth()
+	if err != nil {
+		return nil, types.NewError(types.ErrInternal, fmt.Sprintf("refusing to delegate %s: %v", action, err), "")
 	}
+	timeout, err := delegateTimeout(ctx)
+	if err != nil {
+		return nil, types.NewError(types.ErrTimeout, fmt.Sprintf("refusing to delegate %s: %v", action, err), "")
+	}
+	return &DelegateArgs{
+		Command:     action,
+		Depth:       depth,
+		TraceParent: TraceParentFromContext(ctx),
+		Timeout:     timeout,
+	}, nil
 }
@@ -15,14 +15,20 @@
 package invoke_test
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/containernetworking/cni/pkg/invoke"
+	"github.com/containernetworking/cni/pkg/types"
 	current "github.com/containernetworking/cni/pkg/types/100"
 	"github.com/containernetworking/cni/plugins/test/noop/debug"
 
@@ -43,6 +49,7 @@ var _ = Describe("Delegate", func() {
 	BeforeEach(func() {
 		netConf, _ = json.Marshal(map[string]string{
 			"name":       "delegate-test",
+			"type":       "noop",
 			"cniVersion": current.ImplementedSpecVersion,
 		})
 
@@ -79,7 +86,7 @@ var _ = Describe("Delegate", func() {
 	AfterEach(func() {
 		os.RemoveAll(debugFileName)
 
-		for _, k := range []string{"CNI_COMMAND", "CNI_ARGS", "CNI_PATH", "CNI_NETNS", "CNI_IFNAME"} {
+		for _, k := range []string{"CNI_COMMAND", "CNI_ARGS", "CNI_PATH", "CNI_NETNS", "CNI_IFNAME", invoke.DelegationDepthEnv} {
 			os.Unsetenv(k)
 		}
 	})
@@ -132,6 +139,138 @@ var _ = Describe("Delegate", func() {
 		})
 	})
 
+	Context("when delegation is nested", func() {
+		BeforeEach(func() {
+			os.Setenv("CNI_COMMAND", "ADD")
+		})
+
+		It("succeeds below the maximum depth", func() {
+			os.Setenv(invoke.DelegationDepthEnv, strconv.Itoa(invoke.MaxDelegationDepth-1))
+			_, err := invoke.DelegateAdd(ctx, pluginName, netConf, nil)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("refuses to exceed the maximum depth", func() {
+			os.Setenv(invoke.DelegationDepthEnv, strconv.Itoa(invoke.MaxDelegationDepth))
+			_, err := invoke.DelegateAdd(ctx, pluginName, netConf, nil)
+			Expect(err).To(MatchError(fmt.Sprintf("refusing to delegate ADD: delegation depth %d exceeds the maximum of %d", invoke.MaxDelegationDepth+1, invoke.MaxDelegationDepth)))
+
+			err = invoke.DelegateDel(ctx, pluginName, netConf, nil)
+			Expect(err).To(HaveOccurred())
+
+			// the plugin must not have been executed
+			pluginInvocation, err := debug.ReadDebug(debugFileName)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pluginInvocation.Command).To(BeEmpty())
+		})
+
+		It("rejects an invalid depth", func() {
+			os.Setenv(invoke.DelegationDepthEnv, "banana")
+			_, err := invoke.DelegateAdd(ctx, pluginName, netConf, nil)
+			Expect(err).To(MatchError(`refusing to delegate ADD: invalid CNI_DELEGATION_DEPTH "banana"`))
+		})
+	})
+
+	Context("when the context has a deadline", func() {
+		It("refuses to delegate once it has passed", func() {
+			expired, cancel := context.WithDeadline(ctx, time.Now().Add(-time.Second))
+			defer cancel()
+			_, err := invoke.DelegateAdd(expired, pluginName, netConf, nil)
+			Expect(err).To(Equal(types.NewError(types.ErrTimeout, "refusing to delegate ADD: context deadline exceeded", "")))
+
+			// the plugin must not have been executed
+			pluginInvocation, err := debug.ReadDebug(debugFileName)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pluginInvocation.Command).To(BeEmpty())
+		})
+	})
+
+	Describe("DelegateContext", func() {
+		It("reserves time before the deadline for the delegating plugin", func() {
+			deadline := time.Now().Add(10 * time.Second)
+			parent, cancel := context.WithDeadline(ctx, deadline)
+			defer cancel()
+
+			delegateCtx, cancelDelegate := invoke.DelegateContext(parent, 2*time.Second)
+			defer cancelDelegate()
+			delegateDeadline, ok := delegateCtx.Deadline()
+			Expect(ok).To(BeTrue())
+			Expect(delegateDeadline).To(Equal(deadline.Add(-2 * time.Second)))
+		})
+
+		It("reserves at most half of the time left", func() {
+			parent, cancel := context.WithTimeout(ctx, 2*time.Second)
+			defer cancel()
+
+			delegateCtx, cancelDelegate := invoke.DelegateContext(parent, 0)
+			defer cancelDelegate()
+			delegateDeadline, _ := delegateCtx.Deadline()
+			Expect(time.Until(delegateDeadline)).To(BeNumerically("~", time.Second, 100*time.Millisecond))
+		})
+
+		It("sets no deadline when the context has none", func() {
+			delegateCtx, cancelDelegate := invoke.DelegateContext(ctx, time.Second)
+			defer cancelDelegate()
+			_, ok := delegateCtx.Deadline()
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	Describe("DelegateAddPassthrough", func() {
+		var stdout *bytes.Buffer
+
+		BeforeEach(func() {
+			stdout = &bytes.Buffer{}
+		})
+
+		It("writes the delegate's result", func() {
+			Expect(invoke.DelegateAddPassthrough(ctx, pluginName, netConf, nil, stdout)).To(Succeed())
+			Expect(stdout.String()).To(MatchJSON(debugBehavior.ReportResult))
+		})
+
+		It("streams results too large to hold", func() {
+			search := make([]string, 10000)
+			for i := range search {
+				search[i] = fmt.Sprintf("domain-%d.example.com", i)
+			}
+			expectedResult.DNS.Search = search
+			resultBytes, err := json.Marshal(expectedResult)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(len(resultBytes)).To(BeNumerically(">", 64<<10))
+			debugBehavior.ReportResult = string(resultBytes)
+			Expect(debugBehavior.WriteDebug(debugFileName)).To(Succeed())
+
+			Expect(invoke.DelegateAddPassthrough(ctx, pluginName, netConf, nil, stdout)).To(Succeed())
+			Expect(stdout.String()).To(Equal(string(resultBytes)))
+		})
+
+		It("writes nothing when the delegate fails", func() {
+			debugBehavior.ReportError = "banana"
+			Expect(debugBehavior.WriteDebug(debugFileName)).To(Succeed())
+
+			err := invoke.DelegateAddPassthrough(ctx, pluginName, netConf, nil, stdout)
+			Expect(err).To(MatchError("banana"))
+			Expect(stdout.Len()).To(BeZero())
+		})
+
+		It("writes nothing when a result does not match the configuration's version", func() {
+			debugBehavior.ReportResult = `{"cniVersion": "0.4.0", "ips": []}`
+			Expect(debugBehavior.WriteDebug(debugFileName)).To(Succeed())
+
+			err := invoke.DelegateAddPassthrough(ctx, pluginName, netConf, nil, stdout)
+			Expect(err).To(MatchError(`delegate plugin noop printed an invalid result: cniVersion "0.4.0" does not match the configuration's "1.0.0"`))
+			Expect(stdout.Len()).To(BeZero())
+		})
+
+		It("fails when a streamed result is not a single object", func() {
+			debugBehavior.ReportResult = `{"cniVersion": "1.0.0", "dns": {"search": ["` + strings.Repeat("a", 70<<10) + `"]}} {}`
+			Expect(debugBehavior.WriteDebug(debugFileName)).To(Succeed())
+
+			err := invoke.DelegateAddPassthrough(ctx, pluginName, netConf, nil, stdout)
+			Expect(err).To(MatchError("delegate plugin noop printed an invalid result: unexpected data after the result"))
+		})
+	})
+
 	Describe("DelegateCheck", func() {
 		BeforeEach(func() {
 			os.Setenv("CNI_COMMAND", "CHECK")
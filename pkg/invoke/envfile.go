@@ -0,0 +1,94 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package invoke
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// EnvFileEnv names the file holding CNI_* variables that were too large
+// to pass in the environment, as a JSON object of names to values. Plugins
+// built with pkg/skel read it transparently.
+const EnvFileEnv = "CNI_ENV_FILE"
+
+// maxEnvValueSize is the size above which a CNI_* variable is moved to the
+// environment file. Linux rejects single strings larger than 128KiB.
+const maxEnvValueSize = 64 * 1024
+
+// spillEnv moves CNI_* variables out of environ into a temporary file
+// referenced by EnvFileEnv when they are larger than maxEnvValueSize or
+// the environment is larger than maxEnvSize. Larger variables are moved
+// first. It returns the environment to use and a function that removes
+// the file.
+func spillEnv(environ []string) ([]string, func(), error) {
+	noop := func() {}
+
+	total := 0
+	var candidates []string
+	for _, kv := range environ {
+		total += len(kv) + 1
+		if strings.HasPrefix(kv, "CNI_") && strings.Contains(kv, "=") {
+			candidates = append(candidates, kv)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return len(candidates[i]) > len(candidates[j])
+	})
+
+	spilled := map[string]string{}
+	for _, kv := range candidates {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts[1]) <= maxEnvValueSize && total <= maxEnvSize {
+			break
+		}
+		spilled[parts[0]] = parts[1]
+		total -= len(kv) + 1
+	}
+	if len(spilled) == 0 {
+		return environ, noop, nil
+	}
+
+	data, err := json.Marshal(spilled)
+	if err != nil {
+		return nil, noop, err
+	}
+	f, err := ioutil.TempFile("", "cni-env-")
+	if err != nil {
+		return nil, noop, err
+	}
+	remove := func() { os.Remove(f.Name()) }
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		remove()
+		return nil, noop, err
+	}
+	if err := f.Close(); err != nil {
+		remove()
+		return nil, noop, err
+	}
+
+	env := make([]string, 0, len(environ)-len(spilled)+1)
+	for _, kv := range environ {
+		if _, ok := spilled[strings.SplitN(kv, "=", 2)[0]]; !ok {
+			env = append(env, kv)
+		}
+	}
+	env = append(env, EnvFileEnv+"="+f.Name())
+	return env, remove, nil
+}
@@ -18,3 +18,8 @@ package invoke
 
 // Valid file extensions for plugin executables.
 var ExecutableFileExtensions = []string{""}
+
+// maxEnvSize is the size of the environment above which CNI_* variables
+// are passed in a file. The environment shares ARG_MAX, commonly 2MiB,
+// with the command line.
+const maxEnvSize = 1024 * 1024
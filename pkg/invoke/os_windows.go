@@ -16,3 +16,8 @@ package invoke
 
 // Valid file extensions for plugin executables.
 var ExecutableFileExtensions = []string{".exe", ""}
+
+// maxEnvSize is the size of the environment above which CNI_* variables
+// are passed in a file. Windows limits the environment block to 32767
+// characters.
+const maxEnvSize = 30 * 1024
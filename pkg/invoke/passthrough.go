@@ -0,0 +1,274 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package invoke
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/containernetworking/cni/pkg/version"
+)
+
+// passthroughHoldback is how much of a delegate's result
+// DelegateAddPassthrough holds in memory before it starts streaming it
+const passthroughHoldback = 64 << 10
+
+// maxDiagnosticOutput is how much of a plugin's output ExecPluginTo keeps
+// to build the error if the plugin fails
+const maxDiagnosticOutput = 64 << 10
+
+// StreamingExec is implemented by an Exec that can write a plugin's stdout
+// to a writer as the plugin produces it, instead of returning it. RawExec
+// and DefaultExec implement it.
+type StreamingExec interface {
+	ExecPluginTo(ctx context.Context, pluginPath string, stdinData []byte, environ []string, stdout io.Writer) error
+}
+
+var _ StreamingExec = &RawExec{}
+var _ StreamingExec = &DefaultExec{}
+
+// DelegateAddPassthrough is like DelegateAdd, but writes the delegate's
+// result to stdout, usually os.Stdout, instead of returning it. It is for
+// plugins that print the delegate's result unmodified, and avoids holding
+// large results in memory twice. The result must be a single JSON object
+// with the cniVersion of netconf.
+//
+// Results up to 64 KiB are validated before anything is written, so a
+// failed delegate writes nothing. Larger results are streamed and
+// validated as the delegate writes them when exec implements
+// StreamingExec; if the delegate then fails or the result proves invalid,
+// part of it has already been written and the caller must fail the
+// command with the returned error.
+func DelegateAddPassthrough(ctx context.Context, delegatePlugin string, netconf []byte, exec Exec, stdout io.Writer) error {
+	args, err := delegateArgs(ctx, "ADD")
+	if err != nil {
+		return err
+	}
+	pluginPath, realExec, err := delegateCommon(delegatePlugin, exec)
+	if err != nil {
+		return err
+	}
+	confVersion, err := (&version.ConfigDecoder{}).Decode(netconf)
+	if err != nil {
+		return err
+	}
+
+	w := &passthroughWriter{w: stdout, plugin: delegatePlugin, validator: newResultValidator(delegatePlugin, confVersion)}
+	if streamingExec, ok := realExec.(StreamingExec); ok {
+		err = streamingExec.ExecPluginTo(ctx, pluginPath, netconf, args.AsEnv(), w)
+	} else {
+		var out []byte
+		if out, err = realExec.ExecPlugin(ctx, pluginPath, netconf, args.AsEnv()); err == nil {
+			_, err = w.Write(out)
+		}
+	}
+	return w.finish(err)
+}
+
+// headWriter keeps the first limit bytes written to it
+type headWriter struct {
+	buf   bytes.Buffer
+	limit int
+}
+
+func (h *headWriter) Write(b []byte) (int, error) {
+	if room := h.limit - h.buf.Len(); room > 0 {
+		if len(b) < room {
+			room = len(b)
+		}
+		h.buf.Write(b[:room])
+	}
+	return len(b), nil
+}
+
+// passthroughWriter holds a delegate's result until it exceeds
+// passthroughHoldback, then validates and writes it as it arrives
+type passthroughWriter struct {
+	w         io.Writer
+	plugin    string
+	validator *resultValidator
+	held      bytes.Buffer
+	streaming bool
+	// err is the first failure to validate or write the result
+	err error
+}
+
+func (p *passthroughWriter) Write(b []byte) (int, error) {
+	if p.err != nil {
+		return 0, p.err
+	}
+	if !p.streaming {
+		p.held.Write(b)
+		if p.held.Len() <= passthroughHoldback {
+			return len(b), nil
+		}
+		p.streaming = true
+		err := p.forward(p.held.Bytes())
+		p.held = bytes.Buffer{}
+		return len(b), err
+	}
+	return len(b), p.forward(b)
+}
+
+func (p *passthroughWriter) forward(b []byte) error {
+	if _, err := p.validator.Write(b); err != nil {
+		p.err = err
+		return err
+	}
+	if _, err := p.w.Write(b); err != nil {
+		p.err = fmt.Errorf("failed to write result of delegate plugin %s: %v", p.plugin, err)
+		return p.err
+	}
+	return nil
+}
+
+// finish completes the passthrough after the delegate exited with
+// execErr, writing a held result only if it is valid
+func (p *passthroughWriter) finish(execErr error) error {
+	if p.err != nil {
+		p.validator.Abort(p.err)
+		return p.err
+	}
+	if execErr != nil {
+		p.validator.Abort(execErr)
+		return execErr
+	}
+	if !p.streaming {
+		if _, err := p.validator.Write(p.held.Bytes()); err != nil {
+			return err
+		}
+	}
+	if err := p.validator.Close(); err != nil {
+		return err
+	}
+	if !p.streaming {
+		if _, err := p.held.WriteTo(p.w); err != nil {
+			return fmt.Errorf("failed to write result of delegate plugin %s: %v", p.plugin, err)
+		}
+	}
+	return nil
+}
+
+// resultValidator checks, as it is written, that a result is a single
+// JSON object with the expected cniVersion, without holding it in memory
+type resultValidator struct {
+	pw     *io.PipeWriter
+	done   chan error
+	closed bool
+	err    error
+}
+
+func newResultValidator(plugin, cniVersion string) *resultValidator {
+	pr, pw := io.Pipe()
+	v := &resultValidator{pw: pw, done: make(chan error, 1)}
+	go func() {
+		err := validateResult(json.NewDecoder(pr), cniVersion)
+		if err != nil {
+			err = fmt.Errorf("delegate plugin %s printed an invalid result: %v", plugin, err)
+		}
+		// Unblock writes that follow an invalid result
+		pr.CloseWithError(err)
+		v.done <- err
+	}()
+	return v
+}
+
+// Write returns the validation error once the result proves invalid
+func (v *resultValidator) Write(b []byte) (int, error) {
+	n, err := v.pw.Write(b)
+	if err != nil {
+		return n, v.Close()
+	}
+	return n, nil
+}
+
+// Close ends the result and returns the validation error, if any
+func (v *resultValidator) Close() error {
+	if !v.closed {
+		v.closed = true
+		_ = v.pw.Close()
+		v.err = <-v.done
+	}
+	return v.err
+}
+
+// Abort stops validating a result that will not be completed
+func (v *resultValidator) Abort(err error) {
+	_ = v.pw.CloseWithError(err)
+	_ = v.Close()
+}
+
+func validateResult(dec *json.Decoder, cniVersion string) error {
+	tok, err := dec.Token()
+	if err == io.EOF {
+		return fmt.Errorf("no result")
+	} else if err != nil {
+		return err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return fmt.Errorf("not a JSON object")
+	}
+	resultVersion := ""
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if key == "cniVersion" {
+			if err := dec.Decode(&resultVersion); err != nil {
+				return fmt.Errorf("invalid cniVersion: %v", err)
+			}
+			continue
+		}
+		if err := skipValue(dec); err != nil {
+			return err
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return fmt.Errorf("unexpected data after the result")
+	}
+	if resultVersion != cniVersion {
+		return fmt.Errorf("cniVersion %q does not match the configuration's %q", resultVersion, cniVersion)
+	}
+	return nil
+}
+
+// skipValue reads the next value from dec token by token, so that large
+// values are not held in memory
+func skipValue(dec *json.Decoder) error {
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if delim, ok := tok.(json.Delim); ok {
+			if delim == '{' || delim == '[' {
+				depth++
+			} else {
+				depth--
+			}
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
@@ -29,10 +29,49 @@ import (
 
 type RawExec struct {
 	Stderr io.Writer
+
+	// Seccomp, if set, is applied to plugin processes. Only Linux is
+	// supported; executing a plugin fails on other platforms.
+	Seccomp *SeccompProfile
+
+	// WedgeInterval, if set along with OnWedged, is how long a plugin may
+	// run without writing output, using CPU or making read and write
+	// syscalls before it is reported as appearing wedged. CPU and syscall
+	// activity is read from /proc and is only watched on Linux.
+	WedgeInterval time.Duration
+
+	// OnWedged is called from another goroutine when the plugin at
+	// pluginPath, running as pid, has been idle for idle. The plugin is
+	// not stopped; it still runs until it exits or the context expires.
+	OnWedged func(pluginPath string, pid int, idle time.Duration)
 }
 
 func (e *RawExec) ExecPlugin(ctx context.Context, pluginPath string, stdinData []byte, environ []string) ([]byte, error) {
 	stdout := &bytes.Buffer{}
+	if err := e.execPlugin(ctx, pluginPath, stdinData, environ, stdout, stdout.Bytes); err != nil {
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
+
+// ExecPluginTo is like ExecPlugin, but writes the plugin's stdout to
+// stdout as the plugin produces it. If the plugin fails, the error is
+// built from the first bytes of its output, which have also been written
+// to stdout.
+func (e *RawExec) ExecPluginTo(ctx context.Context, pluginPath string, stdinData []byte, environ []string, stdout io.Writer) error {
+	head := &headWriter{limit: maxDiagnosticOutput}
+	return e.execPlugin(ctx, pluginPath, stdinData, environ, io.MultiWriter(head, stdout), head.buf.Bytes)
+}
+
+// execPlugin runs the plugin with its stdout written to stdout. written
+// returns the output the plugin wrote, for building the error if it fails.
+func (e *RawExec) execPlugin(ctx context.Context, pluginPath string, stdinData []byte, environ []string, stdout io.Writer, written func() []byte) error {
+	environ, removeEnvFile, err := spillEnv(environ)
+	if err != nil {
+		return fmt.Errorf("failed to write environment file: %v", err)
+	}
+	defer removeEnvFile()
+
 	stderr := &bytes.Buffer{}
 	c := exec.CommandContext(ctx, pluginPath)
 	c.Env = environ
@@ -40,9 +79,15 @@ func (e *RawExec) ExecPlugin(ctx context.Context, pluginPath string, stdinData [
 	c.Stdout = stdout
 	c.Stderr = stderr
 
+	var output uint64
+	if e.watchingWedged() {
+		c.Stdout = activityWriter{w: stdout, n: &output}
+		c.Stderr = activityWriter{w: stderr, n: &output}
+	}
+
 	// Retry the command on "text file busy" errors
 	for i := 0; i <= 5; i++ {
-		err := c.Run()
+		err := e.run(c, pluginPath, &output)
 
 		// Command succeeded
 		if err == nil {
@@ -56,8 +101,14 @@ func (e *RawExec) ExecPlugin(ctx context.Context, pluginPath string, stdinData [
 			continue
 		}
 
+		// Plugins built for another architecture are a common and confusing
+		// failure, so report them explicitly
+		if archErr := checkArch(pluginPath, err); archErr != nil {
+			return archErr
+		}
+
 		// All other errors except than the busy text file
-		return nil, e.pluginErr(err, stdout.Bytes(), stderr.Bytes())
+		return e.pluginErr(err, written(), stderr.Bytes())
 	}
 
 	// Copy stderr to caller's buffer in case plugin printed to both
@@ -66,7 +117,29 @@ func (e *RawExec) ExecPlugin(ctx context.Context, pluginPath string, stdinData [
 	if e.Stderr != nil && stderr.Len() > 0 {
 		_, _ = stderr.WriteTo(e.Stderr)
 	}
-	return stdout.Bytes(), nil
+	return nil
+}
+
+func (e *RawExec) run(c *exec.Cmd, pluginPath string, output *uint64) error {
+	if e.Seccomp == nil && !e.watchingWedged() {
+		return c.Run()
+	}
+	start := c.Start
+	if e.Seccomp != nil {
+		start = func() error { return startWithSeccomp(e.Seccomp, c.Start) }
+	}
+	if err := start(); err != nil {
+		return err
+	}
+	if e.watchingWedged() {
+		stop := e.watchWedged(pluginPath, c.Process.Pid, output)
+		defer stop()
+	}
+	return c.Wait()
+}
+
+func (e *RawExec) watchingWedged() bool {
+	return e.WedgeInterval > 0 && e.OnWedged != nil
 }
 
 func (e *RawExec) pluginErr(err error, stdout, stderr []byte) error {
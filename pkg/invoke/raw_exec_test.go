@@ -17,8 +17,13 @@ package invoke_test
 import (
 	"bytes"
 	"context"
+	"debug/elf"
+	"encoding/binary"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 
 	"github.com/containernetworking/cni/pkg/invoke"
 
@@ -60,7 +65,7 @@ var _ = Describe("RawExec", func() {
 			"CNI_PATH=/some/bin/path",
 			"CNI_IFNAME=some-eth0",
 		}
-		stdin = []byte(`{"name": "raw-exec-test", "some":"stdin-json", "cniVersion": "0.3.1"}`)
+		stdin = []byte(`{"name": "raw-exec-test", "type": "noop", "some":"stdin-json", "cniVersion": "0.3.1"}`)
 		execer = &invoke.RawExec{}
 		ctx = context.TODO()
 	})
@@ -129,6 +134,27 @@ var _ = Describe("RawExec", func() {
 		})
 	})
 
+	Context("when CNI_ARGS is too large for the environment", func() {
+		It("passes it to the plugin in a file", func() {
+			largeArgs := "DEBUG=" + debugFileName + ";LARGE=" + strings.Repeat("x", 256*1024)
+			environ[2] = "CNI_ARGS=" + largeArgs
+			envFiles := func() []string {
+				files, err := filepath.Glob(filepath.Join(os.TempDir(), "cni-env-*"))
+				Expect(err).NotTo(HaveOccurred())
+				return files
+			}
+			before := envFiles()
+
+			_, err := execer.ExecPlugin(ctx, pathToPlugin, stdin, environ)
+			Expect(err).NotTo(HaveOccurred())
+
+			debug, err := noop_debug.ReadDebug(debugFileName)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(debug.CmdArgs.Args).To(Equal(largeArgs))
+			Expect(envFiles()).To(Equal(before))
+		})
+	})
+
 	Context("when the plugin errors with no output on stdout or stderr", func() {
 		It("returns the exec error message", func() {
 			debug.ExitWithCode = 1
@@ -141,6 +167,71 @@ var _ = Describe("RawExec", func() {
 		})
 	})
 
+	Context("when the plugin binary is built for another architecture", func() {
+		var fakeBinary string
+
+		BeforeEach(func() {
+			if runtime.GOOS != "linux" {
+				Skip("ELF binaries can only be checked on Linux")
+			}
+
+			// A bare ELF header for SPARC v9, which the kernel refuses to run
+			header := make([]byte, 64)
+			copy(header, []byte{0x7f, 'E', 'L', 'F', 2, 1, 1})
+			binary.LittleEndian.PutUint16(header[16:], uint16(elf.ET_EXEC))
+			binary.LittleEndian.PutUint16(header[18:], uint16(elf.EM_SPARCV9))
+			binary.LittleEndian.PutUint32(header[20:], 1)
+			binary.LittleEndian.PutUint16(header[52:], 64)
+
+			f, err := ioutil.TempFile("", "cni_wrong_arch")
+			Expect(err).NotTo(HaveOccurred())
+			_, err = f.Write(header)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(f.Close()).To(Succeed())
+			Expect(os.Chmod(f.Name(), 0700)).To(Succeed())
+			fakeBinary = f.Name()
+		})
+
+		AfterEach(func() {
+			if fakeBinary != "" {
+				Expect(os.Remove(fakeBinary)).To(Succeed())
+			}
+		})
+
+		It("returns an error naming both architectures", func() {
+			_, err := execer.ExecPlugin(ctx, fakeBinary, stdin, environ)
+			Expect(err).To(HaveOccurred())
+
+			archErr, ok := err.(*invoke.ArchMismatchError)
+			Expect(ok).To(BeTrue(), "unexpected error %v", err)
+			Expect(archErr.Path).To(Equal(fakeBinary))
+			Expect(archErr.BinaryArch).To(Equal("sparcv9"))
+			Expect(archErr.HostArch).To(Equal(runtime.GOARCH))
+			Expect(err.Error()).To(ContainSubstring("is built for sparcv9 but the host is " + runtime.GOARCH))
+		})
+	})
+
+	Context("when a seccomp profile is set", func() {
+		BeforeEach(func() {
+			if runtime.GOOS != "linux" {
+				Skip("seccomp is only supported on Linux")
+			}
+			execer.Seccomp = invoke.StrictSeccompProfile
+		})
+
+		It("runs the plugin under the filter", func() {
+			stdout, err := execer.ExecPlugin(ctx, "/bin/sh", []byte("while read -r l; do case $l in Seccomp:*) echo $l;; esac; done < /proc/self/status"), environ)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strings.TrimSpace(string(stdout))).To(Equal("Seccomp: 2"))
+		})
+
+		It("rejects unknown system calls", func() {
+			execer.Seccomp = &invoke.SeccompProfile{DeniedSyscalls: []string{"not_a_syscall"}}
+			_, err := execer.ExecPlugin(ctx, pathToPlugin, stdin, environ)
+			Expect(err).To(MatchError(ContainSubstring(`unknown system call "not_a_syscall" in seccomp profile`)))
+		})
+	})
+
 	Context("when the system is unable to execute the plugin", func() {
 		It("returns the error", func() {
 			_, err := execer.ExecPlugin(ctx, "/tmp/some/invalid/plugin/path", stdin, environ)
@@ -0,0 +1,55 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package invoke
+
+// SeccompProfile is a seccomp filter applied to plugin processes on Linux.
+// System calls listed in DeniedSyscalls fail with EPERM; all others are
+// allowed. System calls made using a different ABI than the host's native
+// one are denied as well.
+type SeccompProfile struct {
+	DeniedSyscalls []string
+}
+
+// PermissiveSeccompProfile denies system calls that no network plugin
+// has a reason to make, such as loading kernel modules or rebooting.
+var PermissiveSeccompProfile = &SeccompProfile{
+	DeniedSyscalls: []string{
+		"acct",
+		"clock_settime",
+		"delete_module",
+		"init_module",
+		"kexec_load",
+		"pivot_root",
+		"reboot",
+		"settimeofday",
+		"swapoff",
+		"swapon",
+	},
+}
+
+// StrictSeccompProfile additionally denies debugging, key management and
+// filesystem mounting. Plugins that mount filesystems will not work
+// under it.
+var StrictSeccompProfile = &SeccompProfile{
+	DeniedSyscalls: append([]string{
+		"add_key",
+		"keyctl",
+		"mount",
+		"perf_event_open",
+		"ptrace",
+		"request_key",
+		"umount2",
+	}, PermissiveSeccompProfile.DeniedSyscalls...),
+}
@@ -0,0 +1,136 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package invoke
+
+import (
+	"fmt"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	prSetSeccomp      = 22
+	prSetNoNewPrivs   = 38
+	seccompModeFilter = 2
+
+	seccompRetErrno = 0x00050000
+	seccompRetAllow = 0x7fff0000
+
+	// offsets into struct seccomp_data
+	seccompDataNR   = 0
+	seccompDataArch = 4
+
+	// system call numbers at or above this are the x32 ABI on amd64
+	x32SyscallBit = 0x40000000
+)
+
+// auditArches are the AUDIT_ARCH_* values of the supported architectures
+var auditArches = map[string]uint32{
+	"386":      0x40000003,
+	"amd64":    0xc000003e,
+	"arm":      0x40000028,
+	"arm64":    0xc00000b7,
+	"mips64le": 0xc0000008,
+	"ppc64le":  0xc0000015,
+	"s390x":    0x80000016,
+}
+
+// compile translates the profile into a BPF program for this architecture
+func (p *SeccompProfile) compile() ([]syscall.SockFilter, error) {
+	arch, ok := auditArches[runtime.GOARCH]
+	if !ok {
+		return nil, fmt.Errorf("seccomp profiles are not supported on %s", runtime.GOARCH)
+	}
+
+	deny := syscall.SockFilter{Code: syscall.BPF_RET | syscall.BPF_K, K: seccompRetErrno | uint32(syscall.EPERM)}
+	prog := []syscall.SockFilter{
+		{Code: syscall.BPF_LD | syscall.BPF_W | syscall.BPF_ABS, K: seccompDataArch},
+		{Code: syscall.BPF_JMP | syscall.BPF_JEQ | syscall.BPF_K, Jt: 1, K: arch},
+		deny,
+		{Code: syscall.BPF_LD | syscall.BPF_W | syscall.BPF_ABS, K: seccompDataNR},
+	}
+	if runtime.GOARCH == "amd64" {
+		prog = append(prog,
+			syscall.SockFilter{Code: syscall.BPF_JMP | syscall.BPF_JGE | syscall.BPF_K, Jf: 1, K: x32SyscallBit},
+			deny,
+		)
+	}
+	for _, name := range p.DeniedSyscalls {
+		nr, ok := syscallNumbers[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown system call %q in seccomp profile", name)
+		}
+		prog = append(prog,
+			syscall.SockFilter{Code: syscall.BPF_JMP | syscall.BPF_JEQ | syscall.BPF_K, Jf: 1, K: uint32(nr)},
+			deny,
+		)
+	}
+	prog = append(prog, syscall.SockFilter{Code: syscall.BPF_RET | syscall.BPF_K, K: seccompRetAllow})
+	return prog, nil
+}
+
+// startWithSeccomp calls start on an OS thread with the profile's filter
+// installed. Seccomp filters are inherited by child processes, so a
+// process forked by start runs under the filter, while the rest of this
+// process is unaffected.
+func startWithSeccomp(p *SeccompProfile, start func() error) error {
+	prog, err := p.compile()
+	if err != nil {
+		return err
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		// The thread is never unlocked, so the runtime terminates it when
+		// this goroutine exits instead of reusing it with the filter.
+		runtime.LockOSThread()
+
+		if _, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0, 0, 0, 0); errno != 0 {
+			errCh <- fmt.Errorf("failed to set no_new_privs: %v", errno)
+			return
+		}
+		fprog := syscall.SockFprog{
+			Len:    uint16(len(prog)),
+			Filter: &prog[0],
+		}
+		if _, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, prSetSeccomp, seccompModeFilter, uintptr(unsafe.Pointer(&fprog)), 0, 0, 0); errno != 0 {
+			errCh <- fmt.Errorf("failed to install seccomp filter: %v", errno)
+			return
+		}
+		errCh <- start()
+	}()
+	return <-errCh
+}
+
+var syscallNumbers = map[string]uintptr{
+	"acct":            syscall.SYS_ACCT,
+	"add_key":         syscall.SYS_ADD_KEY,
+	"clock_settime":   syscall.SYS_CLOCK_SETTIME,
+	"delete_module":   syscall.SYS_DELETE_MODULE,
+	"init_module":     syscall.SYS_INIT_MODULE,
+	"kexec_load":      syscall.SYS_KEXEC_LOAD,
+	"keyctl":          syscall.SYS_KEYCTL,
+	"mount":           syscall.SYS_MOUNT,
+	"perf_event_open": syscall.SYS_PERF_EVENT_OPEN,
+	"pivot_root":      syscall.SYS_PIVOT_ROOT,
+	"ptrace":          syscall.SYS_PTRACE,
+	"reboot":          syscall.SYS_REBOOT,
+	"request_key":     syscall.SYS_REQUEST_KEY,
+	"settimeofday":    syscall.SYS_SETTIMEOFDAY,
+	"swapoff":         syscall.SYS_SWAPOFF,
+	"swapon":          syscall.SYS_SWAPON,
+	"umount2":         syscall.SYS_UMOUNT2,
+}
@@ -0,0 +1,43 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package invoke
+
+import "context"
+
+// TraceParentEnv is the variable through which the delegate helpers pass
+// the W3C traceparent of the delegating plugin's span to the delegated
+// plugin, so that its span joins the same trace
+const TraceParentEnv = "CNI_TRACEPARENT"
+
+// OTelTraceParentEnv is the variable OpenTelemetry's environment carrier
+// reads the traceparent from. The delegate helpers set it as well, for
+// delegated plugins instrumented without skel.
+const OTelTraceParentEnv = "TRACEPARENT"
+
+type traceParentKey struct{}
+
+// ContextWithTraceParent returns a copy of ctx carrying traceparent, such
+// as "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01". Plugins
+// delegated to with the returned context receive it in TraceParentEnv and
+// OTelTraceParentEnv.
+func ContextWithTraceParent(ctx context.Context, traceparent string) context.Context {
+	return context.WithValue(ctx, traceParentKey{}, traceparent)
+}
+
+// TraceParentFromContext returns the traceparent carried by ctx, or ""
+func TraceParentFromContext(ctx context.Context) string {
+	traceparent, _ := ctx.Value(traceParentKey{}).(string)
+	return traceparent
+}
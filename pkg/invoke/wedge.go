@@ -0,0 +1,87 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package invoke
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// minWedgePoll is the shortest interval at which a running plugin is
+// sampled for activity
+const minWedgePoll = 10 * time.Millisecond
+
+// activityWriter counts the bytes a plugin writes so that output counts
+// as activity when watching for wedged plugins
+type activityWriter struct {
+	w io.Writer
+	n *uint64
+}
+
+func (a activityWriter) Write(p []byte) (int, error) {
+	atomic.AddUint64(a.n, uint64(len(p)))
+	return a.w.Write(p)
+}
+
+// watchWedged samples the activity of the plugin with the given pid until
+// the returned function is called. When neither its output nor, where
+// the platform reports it, its CPU time and syscall counts change for
+// e.WedgeInterval, e.OnWedged is called. It is called again only after
+// the plugin shows activity and then stalls once more.
+func (e *RawExec) watchWedged(pluginPath string, pid int, output *uint64) func() {
+	done := make(chan struct{})
+	finished := make(chan struct{})
+
+	poll := e.WedgeInterval / 4
+	if poll < minWedgePoll {
+		poll = minWedgePoll
+	}
+	sample := func() uint64 {
+		return atomic.LoadUint64(output) + procActivity(pid)
+	}
+
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(poll)
+		defer ticker.Stop()
+
+		last := sample()
+		lastChange := time.Now()
+		reported := false
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				if current := sample(); current != last {
+					last = current
+					lastChange = now
+					reported = false
+					continue
+				}
+				if idle := now.Sub(lastChange); !reported && idle >= e.WedgeInterval {
+					reported = true
+					e.OnWedged(pluginPath, pid, idle)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-finished
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package invoke
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// procActivity returns a counter that grows while the process is using
+// CPU or making read and write syscalls, read from /proc. Counters that
+// cannot be read contribute nothing.
+func procActivity(pid int) uint64 {
+	var total uint64
+
+	// Fields after the parenthesised command name, which may itself
+	// contain spaces; utime and stime are fields 14 and 15
+	if stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid)); err == nil {
+		if i := bytes.LastIndexByte(stat, ')'); i >= 0 {
+			fields := strings.Fields(string(stat[i+1:]))
+			if len(fields) > 12 {
+				for _, f := range fields[11:13] {
+					n, _ := strconv.ParseUint(f, 10, 64)
+					total += n
+				}
+			}
+		}
+	}
+
+	if io, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/io", pid)); err == nil {
+		for _, line := range strings.Split(string(io), "\n") {
+			if strings.HasPrefix(line, "syscr:") || strings.HasPrefix(line, "syscw:") {
+				n, _ := strconv.ParseUint(strings.TrimSpace(line[len("syscr:"):]), 10, 64)
+				total += n
+			}
+		}
+	}
+
+	return total
+}
@@ -0,0 +1,114 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package invoke_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/containernetworking/cni/pkg/invoke"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type wedgedCall struct {
+	pluginPath string
+	pid        int
+	idle       time.Duration
+}
+
+var _ = Describe("watching for wedged plugins", func() {
+	var (
+		dir    string
+		mu     sync.Mutex
+		calls  []wedgedCall
+		execer *invoke.RawExec
+	)
+
+	writePlugin := func(script string) string {
+		path := filepath.Join(dir, "plugin")
+		Expect(ioutil.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0755)).To(Succeed())
+		return path
+	}
+
+	recorded := func() []wedgedCall {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]wedgedCall(nil), calls...)
+	}
+
+	BeforeEach(func() {
+		if runtime.GOOS == "windows" {
+			Skip("plugins are shell scripts")
+		}
+		var err error
+		dir, err = ioutil.TempDir("", "cni-wedge")
+		Expect(err).NotTo(HaveOccurred())
+
+		calls = nil
+		execer = &invoke.RawExec{
+			WedgeInterval: 100 * time.Millisecond,
+			OnWedged: func(pluginPath string, pid int, idle time.Duration) {
+				mu.Lock()
+				defer mu.Unlock()
+				calls = append(calls, wedgedCall{pluginPath, pid, idle})
+			},
+		}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	It("reports a plugin that stalls before the context expires", func() {
+		plugin := writePlugin("exec sleep 1")
+		ctx, cancel := context.WithTimeout(context.TODO(), 500*time.Millisecond)
+		defer cancel()
+
+		_, err := execer.ExecPlugin(ctx, plugin, nil, nil)
+		Expect(err).To(HaveOccurred())
+
+		reported := recorded()
+		Expect(reported).To(HaveLen(1))
+		Expect(reported[0].pluginPath).To(Equal(plugin))
+		Expect(reported[0].pid).To(BeNumerically(">", 0))
+		Expect(reported[0].idle).To(BeNumerically(">=", 100*time.Millisecond))
+	})
+
+	It("does not report a plugin that keeps writing output", func() {
+		execer.WedgeInterval = 300 * time.Millisecond
+		plugin := writePlugin(`for i in 1 2 3 4 5; do echo "$i" >&2; sleep 0.1; done; echo '{}'`)
+
+		out, err := execer.ExecPlugin(context.TODO(), plugin, nil, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(out)).To(Equal("{}\n"))
+		Expect(recorded()).To(BeEmpty())
+	})
+
+	It("does not watch the plugin without a hook", func() {
+		execer.OnWedged = nil
+		plugin := writePlugin("echo '{}'")
+
+		out, err := execer.ExecPlugin(context.TODO(), plugin, nil, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(out)).To(Equal("{}\n"))
+	})
+})
@@ -0,0 +1,105 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/cni/pkg/utils"
+	"github.com/containernetworking/cni/pkg/version"
+)
+
+// ParseConfig unmarshals the network configuration in args.StdinData into
+// conf, which must be a pointer to the plugin's configuration struct,
+// after validating it as the dispatcher does, so that a missing cniVersion
+// means 0.1.0. Errors are returned as *types.Error naming the offending
+// field in Details.
+func ParseConfig(args *CmdArgs, conf interface{}) error {
+	if e := validateConfig(args.StdinData, true); e != nil {
+		return e
+	}
+	if err := json.Unmarshal(args.StdinData, conf); err != nil {
+		return decodingError(err)
+	}
+	return nil
+}
+
+// validateConfig checks the fields of the network configuration that the
+// specification defines before any callback runs, so that plugins can
+// rely on them being present and well formed. Errors name the offending
+// field in Details. A missing cniVersion is allowed, since it means 0.1.0.
+// The cniVersion is only parsed if parseVersion is set; plugins with a
+// custom ConfVersionDecoder accept versions of their own.
+func validateConfig(jsonBytes []byte, parseVersion bool) *types.Error {
+	var conf struct {
+		types.NetConf
+		IPAM          *types.IPAM            `json:"ipam,omitempty"`
+		RuntimeConfig map[string]interface{} `json:"runtimeConfig,omitempty"`
+		Args          map[string]interface{} `json:"args,omitempty"`
+	}
+	if err := json.Unmarshal(jsonBytes, &conf); err != nil {
+		return decodingError(err)
+	}
+
+	if conf.Name == "" {
+		return types.NewError(types.ErrInvalidNetworkConfig, "missing network name", `field "name"`)
+	}
+	if err := utils.ValidateNetworkName(conf.Name); err != nil {
+		return err
+	}
+	if conf.Type == "" {
+		return types.NewError(types.ErrInvalidNetworkConfig, "missing plugin type", `field "type"`)
+	}
+	if conf.CNIVersion != "" && parseVersion {
+		if _, _, _, err := version.ParseVersion(conf.CNIVersion); err != nil {
+			return types.NewError(types.ErrInvalidNetworkConfig, fmt.Sprintf("invalid cniVersion %q", conf.CNIVersion), fmt.Sprintf(`field "cniVersion": %v`, err))
+		}
+	}
+	if conf.IPAM != nil && conf.IPAM.Type == "" {
+		return types.NewError(types.ErrInvalidNetworkConfig, "missing IPAM plugin type", `field "ipam.type"`)
+	}
+	return nil
+}
+
+// decodePrevResult returns the prevResult of the configuration converted
+// to a Result of the configuration's version, or nil if there is none
+func decodePrevResult(stdinData []byte) (types.Result, *types.Error) {
+	var conf types.NetConf
+	if err := json.Unmarshal(stdinData, &conf); err != nil {
+		return nil, decodingError(err)
+	}
+	if err := version.ParsePrevResult(&conf); err != nil {
+		return nil, types.NewError(types.ErrDecodingFailure, "failed to decode prevResult", err.Error())
+	}
+	return conf.PrevResult, nil
+}
+
+func decodingError(err error) *types.Error {
+	const msg = "failed to decode network configuration"
+	switch e := err.(type) {
+	case *json.UnmarshalTypeError:
+		field := e.Field
+		if field == "" {
+			field = "(root)"
+		}
+		return types.NewError(types.ErrDecodingFailure, msg, fmt.Sprintf("field %q: cannot use %s as %s", field, e.Value, e.Type))
+	case *json.SyntaxError:
+		return types.NewError(types.ErrDecodingFailure, msg, fmt.Sprintf("invalid JSON at offset %d: %v", e.Offset, e))
+	default:
+		return types.NewError(types.ErrDecodingFailure, msg, err.Error())
+	}
+}
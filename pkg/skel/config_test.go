@@ -0,0 +1,99 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"github.com/containernetworking/cni/pkg/types"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+type testPluginConf struct {
+	types.NetConf
+	MTU    int    `json:"mtu"`
+	Bridge string `json:"bridge"`
+}
+
+var _ = Describe("ParseConfig", func() {
+	It("decodes a valid configuration", func() {
+		args := &CmdArgs{StdinData: []byte(`{"cniVersion": "1.0.0", "name": "mynet", "type": "bridge", "mtu": 1400, "bridge": "cni0"}`)}
+		var conf testPluginConf
+		Expect(ParseConfig(args, &conf)).To(Succeed())
+		Expect(conf.CNIVersion).To(Equal("1.0.0"))
+		Expect(conf.Name).To(Equal("mynet"))
+		Expect(conf.MTU).To(Equal(1400))
+		Expect(conf.Bridge).To(Equal("cni0"))
+	})
+
+	It("accepts a configuration without a cniVersion, as the dispatcher does", func() {
+		config := []byte(`{"name": "mynet", "type": "bridge"}`)
+		Expect(validateConfig(config, true)).To(BeNil())
+		var conf testPluginConf
+		Expect(ParseConfig(&CmdArgs{StdinData: config}, &conf)).To(Succeed())
+		Expect(conf.Name).To(Equal("mynet"))
+	})
+
+	DescribeTable("rejects invalid configurations",
+		func(config string, expected *types.Error) {
+			var conf testPluginConf
+			err := ParseConfig(&CmdArgs{StdinData: []byte(config)}, &conf)
+			Expect(err).To(Equal(expected))
+		},
+		Entry("invalid cniVersion", `{"cniVersion": "one", "name": "mynet", "type": "bridge"}`,
+			types.NewError(types.ErrInvalidNetworkConfig, `invalid cniVersion "one"`, `field "cniVersion": failed to convert major version part "one": strconv.Atoi: parsing "one": invalid syntax`)),
+		Entry("missing name", `{"cniVersion": "1.0.0", "type": "bridge"}`,
+			types.NewError(types.ErrInvalidNetworkConfig, "missing network name", `field "name"`)),
+		Entry("missing type", `{"cniVersion": "1.0.0", "name": "mynet"}`,
+			types.NewError(types.ErrInvalidNetworkConfig, "missing plugin type", `field "type"`)),
+		Entry("field of the wrong type", `{"cniVersion": "1.0.0", "name": "mynet", "type": "bridge", "mtu": "1400"}`,
+			types.NewError(types.ErrDecodingFailure, "failed to decode network configuration", `field "mtu": cannot use string as int`)),
+		Entry("malformed JSON", `{"cniVersion": "1.0.0",`,
+			types.NewError(types.ErrDecodingFailure, "failed to decode network configuration", "invalid JSON at offset 23: unexpected end of JSON input")),
+	)
+})
+
+var _ = Describe("validateConfig", func() {
+	It("accepts a configuration with the required fields", func() {
+		Expect(validateConfig([]byte(`{"cniVersion": "1.0.0", "name": "mynet", "type": "bridge", "ipam": {"type": "host-local"}}`), true)).To(BeNil())
+	})
+
+	It("infers version 0.1.0 without a cniVersion", func() {
+		Expect(validateConfig([]byte(`{"name": "mynet", "type": "bridge"}`), true)).To(BeNil())
+	})
+
+	DescribeTable("rejects invalid configurations",
+		func(config string, expected *types.Error) {
+			Expect(validateConfig([]byte(config), true)).To(Equal(expected))
+		},
+		Entry("missing name", `{"cniVersion": "1.0.0", "type": "bridge"}`,
+			types.NewError(types.ErrInvalidNetworkConfig, "missing network name", `field "name"`)),
+		Entry("invalid characters in name", `{"cniVersion": "1.0.0", "name": "my net", "type": "bridge"}`,
+			types.NewError(types.ErrInvalidNetworkConfig, "invalid characters found in network name", "my net")),
+		Entry("missing type", `{"cniVersion": "1.0.0", "name": "mynet"}`,
+			types.NewError(types.ErrInvalidNetworkConfig, "missing plugin type", `field "type"`)),
+		Entry("invalid cniVersion", `{"cniVersion": "1.x", "name": "mynet", "type": "bridge"}`,
+			types.NewError(types.ErrInvalidNetworkConfig, `invalid cniVersion "1.x"`, `field "cniVersion": failed to convert minor version part "x": strconv.Atoi: parsing "x": invalid syntax`)),
+		Entry("IPAM without a type", `{"cniVersion": "1.0.0", "name": "mynet", "type": "bridge", "ipam": {"subnet": "10.0.0.0/24"}}`,
+			types.NewError(types.ErrInvalidNetworkConfig, "missing IPAM plugin type", `field "ipam.type"`)),
+		Entry("capabilities that are not booleans", `{"cniVersion": "1.0.0", "name": "mynet", "type": "bridge", "capabilities": {"portMappings": "yes"}}`,
+			types.NewError(types.ErrDecodingFailure, "failed to decode network configuration", `field "capabilities.portMappings": cannot use string as bool`)),
+		Entry("runtimeConfig that is not an object", `{"cniVersion": "1.0.0", "name": "mynet", "type": "bridge", "runtimeConfig": []}`,
+			types.NewError(types.ErrDecodingFailure, "failed to decode network configuration", `field "runtimeConfig": cannot use array as map[string]interface {}`)),
+		Entry("malformed JSON", `{"name": "mynet",`,
+			types.NewError(types.ErrDecodingFailure, "failed to decode network configuration", "invalid JSON at offset 17: unexpected end of JSON input")),
+	)
+})
@@ -0,0 +1,69 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"strings"
+
+	"github.com/containernetworking/cni/pkg/types"
+)
+
+// DefaultCorrelationIDKeys are the CNI_ARGS keys the correlation ID of an
+// invocation is read from, in order of preference, unless
+// WithCorrelationIDKeys is used. K8S_POD_UID ties invocations to the pod
+// lifecycle events of Kubernetes.
+var DefaultCorrelationIDKeys = []string{"CNI_CORRELATION_ID", "K8S_POD_UID"}
+
+// WithCorrelationIDKeys reads the correlation ID from the first of keys
+// set in CNI_ARGS instead of DefaultCorrelationIDKeys
+func WithCorrelationIDKeys(keys ...string) Option {
+	return func(t *dispatcher) {
+		t.correlationKeys = keys
+	}
+}
+
+// correlationID returns the correlation ID in the parsed CNI_ARGS, or ""
+func (t *dispatcher) correlationID(parsedArgs map[string]string) string {
+	keys := t.correlationKeys
+	if keys == nil {
+		keys = DefaultCorrelationIDKeys
+	}
+	for _, key := range keys {
+		if id := parsedArgs[key]; id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+// withCorrelationID returns a copy of err whose Details end with the
+// correlation ID, so that operators can match the error to the logs of
+// the invocation
+func withCorrelationID(err *types.Error, id string) *types.Error {
+	if id == "" {
+		return err
+	}
+	note := "correlation ID: " + id
+	if strings.Contains(err.Details, note) {
+		return err
+	}
+	withID := *err
+	if withID.Details == "" {
+		withID.Details = note
+	} else {
+		withID.Details += "; " + note
+	}
+	return &withID
+}
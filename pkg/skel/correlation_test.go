@@ -0,0 +1,90 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/cni/pkg/version"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("correlation IDs", func() {
+	var environment map[string]string
+
+	dispatch := func() *dispatcher {
+		return &dispatcher{
+			Getenv: func(key string) string { return environment[key] },
+			Stdin:  strings.NewReader(`{"cniVersion": "1.0.0", "name": "mynet", "type": "test"}`),
+			Stdout: &bytes.Buffer{},
+			Stderr: &bytes.Buffer{},
+		}
+	}
+
+	BeforeEach(func() {
+		environment = map[string]string{
+			"CNI_COMMAND":     "ADD",
+			"CNI_CONTAINERID": "some-container-id",
+			"CNI_NETNS":       "/some/netns",
+			"CNI_IFNAME":      "eth0",
+			"CNI_PATH":        "/opt/cni/bin",
+			"CNI_ARGS":        "K8S_POD_NAME=web;K8S_POD_UID=1234-abcd",
+		}
+	})
+
+	It("reads the pod UID from CNI_ARGS", func() {
+		cmdAdd := &fakeCmd{}
+		Expect(dispatch().pluginMain(cmdAdd.Func, nil, nil, version.All, "")).To(BeNil())
+		Expect(cmdAdd.Received.CmdArgs.CorrelationID).To(Equal("1234-abcd"))
+	})
+
+	It("prefers the dedicated key", func() {
+		environment["CNI_ARGS"] += ";CNI_CORRELATION_ID=req-42"
+		cmdAdd := &fakeCmd{}
+		Expect(dispatch().pluginMain(cmdAdd.Func, nil, nil, version.All, "")).To(BeNil())
+		Expect(cmdAdd.Received.CmdArgs.CorrelationID).To(Equal("req-42"))
+	})
+
+	It("reads custom keys", func() {
+		environment["CNI_ARGS"] = "REQUEST_ID=r-1"
+		cmdAdd := &fakeCmd{}
+		t := dispatch()
+		WithCorrelationIDKeys("REQUEST_ID")(t)
+		Expect(t.pluginMain(cmdAdd.Func, nil, nil, version.All, "")).To(BeNil())
+		Expect(cmdAdd.Received.CmdArgs.CorrelationID).To(Equal("r-1"))
+	})
+
+	It("includes the correlation ID in the details of errors", func() {
+		failing := func(*CmdArgs) error { return types.NewError(types.ErrTryAgainLater, "busy", "retry later") }
+		err := dispatch().pluginMain(failing, nil, nil, version.All, "")
+		Expect(err).To(Equal(types.NewError(types.ErrTryAgainLater, "busy", "retry later; correlation ID: 1234-abcd")))
+
+		failing = func(*CmdArgs) error { return errors.New("boom") }
+		err = dispatch().pluginMain(failing, nil, nil, version.All, "")
+		Expect(err.Details).To(Equal("correlation ID: 1234-abcd"))
+	})
+
+	It("leaves errors unchanged without a correlation ID", func() {
+		environment["CNI_ARGS"] = ""
+		failing := func(*CmdArgs) error { return types.NewError(types.ErrTryAgainLater, "busy", "") }
+		err := dispatch().pluginMain(failing, nil, nil, version.All, "")
+		Expect(err).To(Equal(types.NewError(types.ErrTryAgainLater, "busy", "")))
+	})
+})
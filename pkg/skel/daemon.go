@@ -0,0 +1,161 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/containernetworking/cni/pkg/version"
+)
+
+// DaemonRequest is a plugin invocation sent to a daemon started with
+// ServeDaemon: the environment and stdin the plugin would have been
+// executed with.
+type DaemonRequest struct {
+	Env   []string `json:"env"`
+	Stdin []byte   `json:"stdin,omitempty"`
+}
+
+// DaemonResponse is what the plugin would have written to stdout and
+// stderr, and the code it would have exited with
+type DaemonResponse struct {
+	Stdout   []byte `json:"stdout,omitempty"`
+	Stderr   []byte `json:"stderr,omitempty"`
+	ExitCode int    `json:"exitCode"`
+}
+
+// ServeDaemon serves plugin invocations on l until ctx is done, so that
+// the plugin can run as a long-lived process instead of being executed for
+// every command. Each connection carries one JSON DaemonRequest and
+// receives one DaemonResponse; see CallDaemon.
+//
+// Requests are handled one at a time, because callbacks print their
+// results to os.Stdout, which ServeDaemon redirects for each request.
+// Callbacks must not rely on process-wide state such as os.Getenv.
+func ServeDaemon(ctx context.Context, l net.Listener, funcs CmdFuncs, versionInfo version.PluginInfo, opts ...Option) error {
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+
+	var mu sync.Mutex
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			var req DaemonRequest
+			if err := json.NewDecoder(conn).Decode(&req); err != nil {
+				return
+			}
+			mu.Lock()
+			resp, err := runCaptured(&req, funcs, versionInfo, opts)
+			mu.Unlock()
+			if err != nil {
+				resp = &DaemonResponse{Stderr: []byte(err.Error()), ExitCode: ExitCodeFailure}
+			}
+			_ = json.NewEncoder(conn).Encode(resp)
+		}()
+	}
+}
+
+// runCaptured dispatches req, capturing what the plugin prints
+func runCaptured(req *DaemonRequest, funcs CmdFuncs, versionInfo version.PluginInfo, opts []Option) (*DaemonResponse, error) {
+	env := make(map[string]string, len(req.Env))
+	for _, kv := range req.Env {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) == 2 {
+			env[parts[0]] = parts[1]
+		}
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to capture stdout: %v", err)
+	}
+	defer r.Close()
+	stdout := &bytes.Buffer{}
+	copied := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(stdout, r)
+		copied <- err
+	}()
+
+	savedStdout := os.Stdout
+	os.Stdout = w
+	stderr := &bytes.Buffer{}
+	opts = append([]Option{
+		WithEnv(env),
+		WithStreams(bytes.NewReader(req.Stdin), w, stderr),
+	}, opts...)
+	e := PluginMainFuncsWithError(funcs, versionInfo, "", opts...)
+	os.Stdout = savedStdout
+
+	if e != nil {
+		// Print the error as PluginMain does
+		data, err := json.MarshalIndent(e, "", "    ")
+		if err != nil {
+			w.Close()
+			return nil, err
+		}
+		_, _ = w.Write(data)
+	}
+	w.Close()
+	if err := <-copied; err != nil {
+		return nil, fmt.Errorf("failed to capture stdout: %v", err)
+	}
+
+	return &DaemonResponse{
+		Stdout:   stdout.Bytes(),
+		Stderr:   stderr.Bytes(),
+		ExitCode: ExitCode(e),
+	}, nil
+}
+
+// CallDaemon sends a plugin invocation to the daemon listening on
+// socketPath and returns its response
+func CallDaemon(ctx context.Context, socketPath string, req *DaemonRequest) (*DaemonResponse, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", socketPath)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, fmt.Errorf("failed to send request: %v", err)
+	}
+	var resp DaemonResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+	return &resp, nil
+}
@@ -0,0 +1,120 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/cni/pkg/version"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ServeDaemon", func() {
+	var (
+		socketDir  string
+		socketPath string
+		cancel     context.CancelFunc
+		served     chan error
+		env        []string
+		stdin      = []byte(`{"cniVersion": "1.0.0", "name": "mynet", "type": "test"}`)
+	)
+
+	BeforeEach(func() {
+		var err error
+		socketDir, err = ioutil.TempDir("", "skel-daemon")
+		Expect(err).NotTo(HaveOccurred())
+		socketPath = filepath.Join(socketDir, "plugin.sock")
+		l, err := net.Listen("unix", socketPath)
+		Expect(err).NotTo(HaveOccurred())
+
+		funcs := CmdFuncs{
+			Add: func(args *CmdArgs) error {
+				fmt.Printf(`{"cniVersion": "1.0.0", "interfaces": [{"name": %q}]}`, args.IfName)
+				return nil
+			},
+			Del: func(args *CmdArgs) error {
+				return types.NewError(types.ErrTryAgainLater, "busy", "")
+			},
+		}
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		served = make(chan error, 1)
+		go func() {
+			served <- ServeDaemon(ctx, l, funcs, version.PluginSupports("1.0.0"))
+		}()
+
+		env = []string{
+			"CNI_COMMAND=ADD",
+			"CNI_CONTAINERID=some-container-id",
+			"CNI_NETNS=/some/netns/path",
+			"CNI_IFNAME=eth7",
+			"CNI_PATH=/some/cni/path",
+		}
+	})
+
+	AfterEach(func() {
+		cancel()
+		Eventually(served).Should(Receive(BeNil()))
+		Expect(os.RemoveAll(socketDir)).To(Succeed())
+	})
+
+	It("returns what the plugin prints", func() {
+		resp, err := CallDaemon(context.Background(), socketPath, &DaemonRequest{Env: env, Stdin: stdin})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.ExitCode).To(Equal(ExitCodeSuccess))
+		Expect(resp.Stdout).To(MatchJSON(`{"cniVersion": "1.0.0", "interfaces": [{"name": "eth7"}]}`))
+	})
+
+	It("returns errors as PluginMain would", func() {
+		env[0] = "CNI_COMMAND=DEL"
+		resp, err := CallDaemon(context.Background(), socketPath, &DaemonRequest{Env: env, Stdin: stdin})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.ExitCode).To(Equal(ExitCodeTryAgainLater))
+		Expect(resp.Stdout).To(MatchJSON(`{"code": 11, "msg": "busy"}`))
+	})
+
+	It("only uses the request's environment", func() {
+		resp, err := CallDaemon(context.Background(), socketPath, &DaemonRequest{Env: env[1:], Stdin: stdin})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.ExitCode).To(Equal(ExitCodeInvalidEnvironmentVariables))
+	})
+
+	It("serves many requests", func() {
+		done := make(chan int, 5)
+		for i := 0; i < 5; i++ {
+			go func(i int) {
+				defer GinkgoRecover()
+				reqEnv := append([]string{}, env...)
+				reqEnv[3] = fmt.Sprintf("CNI_IFNAME=eth%d", i)
+				resp, err := CallDaemon(context.Background(), socketPath, &DaemonRequest{Env: reqEnv, Stdin: stdin})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.Stdout).To(MatchJSON(fmt.Sprintf(`{"cniVersion": "1.0.0", "interfaces": [{"name": "eth%d"}]}`, i)))
+				done <- i
+			}(i)
+		}
+		for i := 0; i < 5; i++ {
+			Eventually(done).Should(Receive())
+		}
+	})
+})
@@ -0,0 +1,138 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// debugDirVar names the optional variable holding the directory to write
+// debug captures to; see WithDebugCapture
+const debugDirVar = "CNI_DEBUG_DIR"
+
+// DebugCapture is the raw input of one invocation, as written by
+// WithDebugCapture
+type DebugCapture struct {
+	// Time is when the plugin was invoked
+	Time time.Time `json:"time"`
+	// Command is CNI_COMMAND, which may be empty or invalid
+	Command string `json:"command"`
+	// Env is the environment the plugin was invoked with, as NAME=value
+	Env []string `json:"env"`
+	// Stdin is the data read from stdin. It is empty for VERSION, without
+	// a command and when the configuration is read from CNI_NETCONF_PATH.
+	Stdin string `json:"stdin"`
+}
+
+// WithDebugCapture makes the dispatcher write the environment and stdin
+// of each invocation, before they are checked, to a file in dir named
+// <plugin name>-<command>-<timestamp>.json, so that invocations by a
+// misbehaving runtime can be examined and replayed; see ReadDebugCapture.
+// Setting CNI_DEBUG_DIR enables it for a single invocation. Captures hold
+// the whole environment and configuration, which may include secrets, so
+// they are only readable by the plugin's user. Failures to write them are
+// logged to stderr and do not fail the command.
+func WithDebugCapture(dir string) Option {
+	return func(t *dispatcher) {
+		t.debugDir = dir
+	}
+}
+
+// ReadDebugCapture reads a capture written by WithDebugCapture
+func ReadDebugCapture(path string) (*DebugCapture, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	capture := &DebugCapture{}
+	if err := json.Unmarshal(data, capture); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %v", path, err)
+	}
+	return capture, nil
+}
+
+// captureDebug writes a debug capture of the invocation if enabled. Stdin
+// is read in full and replaced by a reader of the same data, so the
+// command reads it as if it had not been captured.
+func (t *dispatcher) captureDebug() {
+	dir := t.debugDir
+	if env := t.Getenv(debugDirVar); env != "" {
+		dir = env
+	}
+	if dir == "" {
+		return
+	}
+
+	capture := &DebugCapture{
+		Time:    time.Now().UTC(),
+		Command: t.Getenv("CNI_COMMAND"),
+	}
+	if t.Environ != nil {
+		capture.Env = t.Environ()
+	} else {
+		for _, name := range knownEnvVars {
+			if v := t.Getenv(name); v != "" {
+				capture.Env = append(capture.Env, name+"="+v)
+			}
+		}
+	}
+	if capture.Command != "" && capture.Command != "VERSION" && t.Getenv(netconfPathVar) == "" {
+		data, _, err := t.readStdinLimited()
+		// Leave anything beyond the limit for the size check
+		t.Stdin = io.MultiReader(bytes.NewReader(data), t.Stdin)
+		if err != nil {
+			_, _ = fmt.Fprintf(t.Stderr, "failed to capture stdin: %v\n", err)
+		}
+		capture.Stdin = string(data)
+	}
+
+	if err := writeDebugCapture(dir, pluginName(t.Getenv, os.Args[0]), capture); err != nil {
+		_, _ = fmt.Fprintf(t.Stderr, "failed to write debug capture: %v\n", err)
+	}
+}
+
+func writeDebugCapture(dir, plugin string, capture *DebugCapture) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(capture, "", "  ")
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s-%d.json", fileNamePart(plugin), fileNamePart(capture.Command), capture.Time.UnixNano())
+	return ioutil.WriteFile(filepath.Join(dir, name), data, 0600)
+}
+
+// fileNamePart replaces the characters of s that may not be safe in a file
+// name, since the command and plugin name come from the environment
+func fileNamePart(s string) string {
+	if s == "" {
+		return "NONE"
+	}
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || r == '.' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, s)
+}
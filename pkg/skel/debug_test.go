@@ -0,0 +1,112 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/cni/pkg/version"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("debug capture", func() {
+	const stdin = `{"name": "skel-test", "type": "test", "cniVersion": "1.0.0"}`
+
+	var (
+		dir         string
+		environment map[string]string
+		dispatch    *dispatcher
+	)
+
+	captures := func() []*DebugCapture {
+		paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+		Expect(err).NotTo(HaveOccurred())
+		var result []*DebugCapture
+		for _, path := range paths {
+			info, err := os.Stat(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+			capture, err := ReadDebugCapture(path)
+			Expect(err).NotTo(HaveOccurred())
+			result = append(result, capture)
+		}
+		return result
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "cni-debug")
+		Expect(err).NotTo(HaveOccurred())
+
+		environment = map[string]string{
+			"CNI_COMMAND":     "ADD",
+			"CNI_CONTAINERID": "some-container-id",
+			"CNI_NETNS":       "/some/netns/path",
+			"CNI_IFNAME":      "eth0",
+			"CNI_PATH":        "/some/cni/path",
+		}
+		dispatch = &dispatcher{
+			Getenv: func(key string) string { return environment[key] },
+			Stdin:  strings.NewReader(stdin),
+			Stdout: &bytes.Buffer{},
+			Stderr: &bytes.Buffer{},
+		}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	It("writes the environment and stdin and still passes stdin to the command", func() {
+		WithDebugCapture(dir)(dispatch)
+		cmdAdd := &fakeCmd{}
+		err := dispatch.pluginMain(cmdAdd.Func, nil, nil, version.PluginSupports("1.0.0"), "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(cmdAdd.Received.CmdArgs.StdinData)).To(Equal(stdin))
+
+		written := captures()
+		Expect(written).To(HaveLen(1))
+		Expect(written[0].Command).To(Equal("ADD"))
+		Expect(written[0].Env).To(ContainElement("CNI_CONTAINERID=some-container-id"))
+		Expect(written[0].Stdin).To(Equal(stdin))
+		Expect(written[0].Time.IsZero()).To(BeFalse())
+	})
+
+	It("is enabled by CNI_DEBUG_DIR and captures invocations that fail", func() {
+		environment[debugDirVar] = dir
+		delete(environment, "CNI_CONTAINERID")
+		err := dispatch.pluginMain((&fakeCmd{}).Func, nil, nil, version.PluginSupports("1.0.0"), "")
+		Expect(err).NotTo(BeNil())
+		Expect(err.Code).To(Equal(uint(types.ErrInvalidEnvironmentVariables)))
+
+		written := captures()
+		Expect(written).To(HaveLen(1))
+		Expect(written[0].Env).NotTo(ContainElement(HavePrefix("CNI_CONTAINERID=")))
+		Expect(written[0].Stdin).To(Equal(stdin))
+	})
+
+	It("writes nothing unless enabled", func() {
+		err := dispatch.pluginMain((&fakeCmd{}).Func, nil, nil, version.PluginSupports("1.0.0"), "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(captures()).To(BeEmpty())
+	})
+})
@@ -0,0 +1,96 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/cni/pkg/version"
+)
+
+// Dispatcher runs the dispatch logic of PluginMain, so that runtimes and
+// test frameworks can invoke plugin callbacks in-process with their own
+// environment and streams. Unlike PluginMain it does not handle signals;
+// cancel the context passed to Run instead.
+type Dispatcher struct {
+	// Getenv looks up the CNI_* variables. If nil, the process environment
+	// is used.
+	Getenv func(string) string
+	// Environ lists the environment so that all CNI_* variables can be
+	// captured in CmdArgs.Env. If nil, only the variables defined by the
+	// specification are captured, unless Getenv is also nil.
+	Environ func() []string
+
+	// Stdin, Stdout and Stderr default to the streams of the process
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// Args are the command-line arguments, without the program name,
+	// checked for --version and --help when CNI_COMMAND is not set
+	Args []string
+
+	// ConfigDecoder reads the version of the network configuration
+	ConfigDecoder version.ConfigDecoder
+	// VersionReconciler checks that the plugin supports that version
+	VersionReconciler version.Reconciler
+
+	// Options customize the dispatcher as they do for PluginMain
+	Options []Option
+}
+
+// Run dispatches the command set in CNI_COMMAND to the callbacks in funcs
+// and returns the error the plugin would print, as PluginMainFuncsWithError
+// does.
+func (d *Dispatcher) Run(ctx context.Context, funcs CmdFuncs, versionInfo version.PluginInfo, about string) *types.Error {
+	t := d.dispatcher()
+	for _, opt := range append(funcsOptions(funcs), d.Options...) {
+		opt(t)
+	}
+	return t.pluginMainContext(ctx, withoutContext(funcs.Add), withoutContext(funcs.Check), withoutContext(funcs.Del), versionInfo, about)
+}
+
+func (d *Dispatcher) dispatcher() *dispatcher {
+	t := &dispatcher{
+		Getenv:             d.Getenv,
+		Environ:            d.Environ,
+		Stdin:              d.Stdin,
+		Stdout:             d.Stdout,
+		Stderr:             d.Stderr,
+		Args:               d.Args,
+		ConfVersionDecoder: d.ConfigDecoder,
+		VersionReconciler:  d.VersionReconciler,
+		windows:            isWindows,
+	}
+	if t.Getenv == nil {
+		t.Getenv = os.Getenv
+		if t.Environ == nil {
+			t.Environ = os.Environ
+		}
+	}
+	if t.Stdin == nil {
+		t.Stdin = os.Stdin
+	}
+	if t.Stdout == nil {
+		t.Stdout = os.Stdout
+	}
+	if t.Stderr == nil {
+		t.Stderr = os.Stderr
+	}
+	return t
+}
@@ -0,0 +1,87 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/containernetworking/cni/pkg/types"
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/cni/pkg/version"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Dispatcher", func() {
+	var (
+		environment map[string]string
+		stdout      *bytes.Buffer
+		d           *Dispatcher
+	)
+
+	BeforeEach(func() {
+		environment = map[string]string{
+			"CNI_COMMAND":     "ADD",
+			"CNI_CONTAINERID": "some-container-id",
+			"CNI_NETNS":       "/some/netns/path",
+			"CNI_IFNAME":      "eth0",
+			"CNI_PATH":        "/some/cni/path",
+		}
+		stdout = &bytes.Buffer{}
+		d = &Dispatcher{
+			Getenv: func(key string) string { return environment[key] },
+			Stdin:  strings.NewReader(`{"name": "skel-test", "type": "test", "cniVersion": "1.0.0"}`),
+			Stdout: stdout,
+			Stderr: &bytes.Buffer{},
+		}
+	})
+
+	It("dispatches to the callbacks with its environment and streams", func() {
+		cmdAdd := &fakeCmd{}
+		err := d.Run(context.TODO(), CmdFuncs{Add: cmdAdd.Func}, version.PluginSupports("1.0.0"), "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cmdAdd.CallCount).To(Equal(1))
+		Expect(cmdAdd.Received.CmdArgs.ContainerID).To(Equal("some-container-id"))
+		Expect(cmdAdd.Received.CmdArgs.StdinData).To(MatchJSON(`{"name": "skel-test", "type": "test", "cniVersion": "1.0.0"}`))
+	})
+
+	It("prints results returned by AddResult to Stdout", func() {
+		addResult := func(*CmdArgs) (types.Result, error) {
+			return &current.Result{CNIVersion: "1.0.0"}, nil
+		}
+		err := d.Run(context.TODO(), CmdFuncs{AddResult: addResult}, version.PluginSupports("1.0.0"), "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stdout.String()).To(ContainSubstring(`"cniVersion": "1.0.0"`))
+	})
+
+	It("applies its options", func() {
+		d.Options = []Option{WithOnError(func(_ string, e *types.Error) *types.Error {
+			return types.NewError(types.ErrTryAgainLater, e.Msg, "")
+		})}
+		cmdAdd := &fakeCmd{}
+		cmdAdd.Returns.Error = errors.New("busy")
+		err := d.Run(context.TODO(), CmdFuncs{Add: cmdAdd.Func}, version.PluginSupports("1.0.0"), "")
+		Expect(err).To(Equal(types.NewError(types.ErrTryAgainLater, "busy", "")))
+	})
+
+	It("rejects configuration versions the plugin does not support", func() {
+		err := d.Run(context.TODO(), CmdFuncs{Add: (&fakeCmd{}).Func}, version.PluginSupports("0.4.0"), "")
+		Expect(err.Code).To(Equal(types.ErrIncompatibleCNIVersion))
+	})
+})
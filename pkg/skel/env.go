@@ -0,0 +1,119 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/containernetworking/cni/pkg/types"
+)
+
+// cniEnvPrefix is the prefix of the environment variables captured in
+// an Environment
+const cniEnvPrefix = "CNI_"
+
+// knownEnvVars are the variables defined by the CNI specification and the
+// optional ones the dispatcher reads
+var knownEnvVars = []string{"CNI_COMMAND", "CNI_CONTAINERID", "CNI_NETNS", "CNI_IFNAME", "CNI_ARGS", "CNI_PATH", "CNI_TIMEOUT", "CNI_DRYRUN", "CNI_PLUGIN_NAME", "CNI_ENV_FILE", "CNI_NETNS_FD", "CNI_TRACEPARENT", "CNI_OUTPUT", "CNI_OUTPUT_MODE", "CNI_NETCONF_PATH", "CNI_DEBUG_DIR", "CNI_IFNAMES"}
+
+// Environment is an immutable snapshot of the CNI_* environment variables
+// a plugin was invoked with. It is taken once, before any callback runs, so
+// callbacks see consistent values even if the process environment changes.
+type Environment struct {
+	vars map[string]string
+}
+
+// NewEnvironment returns an Environment holding a copy of vars. It is
+// mostly useful to construct CmdArgs in tests.
+func NewEnvironment(vars map[string]string) Environment {
+	env := Environment{vars: make(map[string]string, len(vars))}
+	for k, v := range vars {
+		env.vars[k] = v
+	}
+	return env
+}
+
+// Get returns the value of the variable, or "" if it was not set
+func (e Environment) Get(name string) string {
+	return e.vars[name]
+}
+
+// Lookup returns the value of the variable and whether it was set
+func (e Environment) Lookup(name string) (string, bool) {
+	v, ok := e.vars[name]
+	return v, ok
+}
+
+// Names returns the names of all captured variables, sorted
+func (e Environment) Names() []string {
+	names := make([]string, 0, len(e.vars))
+	for k := range e.vars {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// envFileVar names the file holding CNI_* variables that the runtime
+// moved out of the environment because they were too large; see
+// invoke.EnvFileEnv
+const envFileVar = "CNI_ENV_FILE"
+
+// snapshotEnv captures the CNI_* variables. When the dispatcher can list
+// the environment all of them are captured, otherwise only the variables
+// defined by the specification are. On Windows, names are matched
+// regardless of case and captured in upper case. Variables in the file named by
+// CNI_ENV_FILE are captured as if they had been set in the environment.
+func (t *dispatcher) snapshotEnv() (Environment, *types.Error) {
+	env := Environment{vars: map[string]string{}}
+	if t.Environ != nil {
+		for _, kv := range t.Environ() {
+			parts := strings.SplitN(kv, "=", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			if name := envName(parts[0], t.windows); strings.HasPrefix(name, cniEnvPrefix) {
+				env.vars[name] = parts[1]
+			}
+		}
+	} else {
+		for _, name := range knownEnvVars {
+			if v := t.Getenv(name); v != "" {
+				env.vars[name] = v
+			}
+		}
+	}
+
+	if path := env.vars[envFileVar]; path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return env, types.NewError(types.ErrIOFailure, fmt.Sprintf("failed to read %s: %v", envFileVar, err), "")
+		}
+		var vars map[string]string
+		if err := json.Unmarshal(data, &vars); err != nil {
+			return env, types.NewError(types.ErrDecodingFailure, fmt.Sprintf("failed to decode %s: %v", envFileVar, err), "")
+		}
+		for k, v := range vars {
+			if name := envName(k, t.windows); strings.HasPrefix(name, cniEnvPrefix) {
+				env.vars[name] = v
+			}
+		}
+	}
+	return env, nil
+}
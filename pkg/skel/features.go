@@ -0,0 +1,76 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"context"
+	"sort"
+
+	"github.com/containernetworking/cni/pkg/version"
+)
+
+// WithFeatureManifest makes VERSION report, along with the supported
+// versions, the runtime capabilities the plugin supports, such as
+// "portMappings" or "bandwidth", and the verbs it implements. The verbs
+// are derived from the registered callbacks. Runtimes read them with
+// version.PluginFeatures.
+func WithFeatureManifest(capabilities ...string) Option {
+	return func(t *dispatcher) {
+		t.featureManifest = true
+		t.capabilities = capabilities
+	}
+}
+
+// versionInfo returns what VERSION reports
+func (t *dispatcher) versionInfo(versionInfo version.PluginInfo, cmdAdd, cmdCheck, cmdDel func(context.Context, *CmdArgs) error) version.PluginInfo {
+	if t.featureManifest {
+		versionInfo = version.PluginSupportsFeatures(versionInfo, t.capabilities, t.verbs(cmdAdd, cmdCheck, cmdDel))
+	}
+	if t.requirements != nil {
+		versionInfo = version.PluginWithRequirements(versionInfo, *t.requirements)
+	}
+	return versionInfo
+}
+
+// verbs returns the commands the dispatcher can run, standard ones first
+func (t *dispatcher) verbs(cmdAdd, cmdCheck, cmdDel func(context.Context, *CmdArgs) error) []string {
+	verbs := []string{}
+	if cmdAdd != nil || t.addResult != nil {
+		verbs = append(verbs, "ADD")
+	}
+	if cmdCheck != nil {
+		verbs = append(verbs, "CHECK")
+	}
+	if cmdDel != nil {
+		verbs = append(verbs, "DEL")
+	}
+	if t.statusFunc() != nil {
+		verbs = append(verbs, "STATUS")
+	}
+	verbs = append(verbs, "VERSION")
+
+	custom := []string{}
+	for verb, cmd := range t.customCmds {
+		switch verb {
+		case "ADD", "CHECK", "DEL", "STATUS", "VERSION":
+			continue
+		}
+		if cmd != nil {
+			custom = append(custom, verb)
+		}
+	}
+	sort.Strings(custom)
+	return append(verbs, custom...)
+}
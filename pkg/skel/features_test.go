@@ -0,0 +1,70 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"bytes"
+
+	"github.com/containernetworking/cni/pkg/version"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("feature manifest", func() {
+	var (
+		stdout   *bytes.Buffer
+		dispatch *dispatcher
+	)
+
+	BeforeEach(func() {
+		stdout = &bytes.Buffer{}
+		dispatch = &dispatcher{
+			Getenv: func(key string) string {
+				if key == "CNI_COMMAND" {
+					return "VERSION"
+				}
+				return ""
+			},
+			Stdin:  &bytes.Buffer{},
+			Stdout: stdout,
+			Stderr: &bytes.Buffer{},
+		}
+	})
+
+	It("reports capabilities and the verbs with callbacks in VERSION", func() {
+		WithFeatureManifest("portMappings", "bandwidth")(dispatch)
+		WithStatus(func(*CmdArgs) error { return nil })(dispatch)
+		WithCommand("VENDOR-RESYNC", func(*CmdArgs) error { return nil })(dispatch)
+		WithCommand("ADD", func(*CmdArgs) error { return nil })(dispatch)
+		cmd := &fakeCmd{}
+
+		err := dispatch.pluginMain(cmd.Func, nil, cmd.Func, version.PluginSupports("1.0.0", "1.1.0"), "")
+		Expect(err).NotTo(HaveOccurred())
+
+		info, decodeErr := (&version.PluginDecoder{}).Decode(stdout.Bytes())
+		Expect(decodeErr).NotTo(HaveOccurred())
+		Expect(info.SupportedVersions()).To(Equal([]string{"1.0.0", "1.1.0"}))
+		features := info.(version.PluginFeatures)
+		Expect(features.Capabilities()).To(Equal([]string{"portMappings", "bandwidth"}))
+		Expect(features.Verbs()).To(Equal([]string{"ADD", "DEL", "STATUS", "VERSION", "VENDOR-RESYNC"}))
+	})
+
+	It("reports only the versions without the option", func() {
+		err := dispatch.pluginMain(nil, nil, nil, version.PluginSupports("1.0.0"), "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stdout.String()).NotTo(ContainSubstring("verbs"))
+	})
+})
@@ -0,0 +1,133 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileLogger is a Logger that appends one JSON object per line to a file.
+// Many invocations of a plugin may run at once during parallel pod
+// creation, so every line is written with a single write to a file opened
+// with O_APPEND, and lines from different processes never interleave.
+//
+// When MaxSize is set and a line would grow the file beyond it, the file
+// is renamed to <path>.1, replacing any earlier one, and a new file is
+// started. Rotation is done under the same lock file as WithMetrics, so
+// only one invocation rotates the file.
+//
+// Failures to write are ignored, so that logging never fails a command.
+type FileLogger struct {
+	Path string
+	// MaxSize is the size in bytes at which the file is rotated. Zero
+	// disables rotation.
+	MaxSize int64
+
+	mu sync.Mutex
+}
+
+// NewFileLogger returns a FileLogger that writes to path, rotating it
+// when it reaches maxSize bytes. Pass it to WithLogger, and use it from
+// the callbacks, to have the dispatcher and the plugin log to the same
+// file.
+func NewFileLogger(path string, maxSize int64) *FileLogger {
+	return &FileLogger{Path: path, MaxSize: maxSize}
+}
+
+func (l *FileLogger) Info(msg string, keysAndValues ...interface{}) {
+	l.log("info", nil, msg, keysAndValues)
+}
+
+func (l *FileLogger) Error(err error, msg string, keysAndValues ...interface{}) {
+	l.log("error", err, msg, keysAndValues)
+}
+
+func (l *FileLogger) log(level string, err error, msg string, keysAndValues []interface{}) {
+	entry := map[string]interface{}{}
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		value := keysAndValues[i+1]
+		if e, ok := value.(error); ok {
+			value = e.Error()
+		}
+		entry[fmt.Sprint(keysAndValues[i])] = value
+	}
+	entry["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+	entry["level"] = level
+	entry["pid"] = os.Getpid()
+	entry["msg"] = msg
+	if err != nil {
+		entry["error"] = err.Error()
+	}
+	line, jerr := json.Marshal(entry)
+	if jerr != nil {
+		return
+	}
+	_ = l.write(append(line, '\n'))
+}
+
+// write appends line to the file, rotating the file first if needed
+func (l *FileLogger) write(line []byte) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(l.Path), 0755); err != nil {
+		return err
+	}
+	if l.MaxSize > 0 && l.needsRotation(len(line)) {
+		if err := l.rotate(len(line)); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(l.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(line)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// needsRotation returns true if appending n bytes would grow the file
+// beyond MaxSize. A file that is empty is never rotated, so that lines
+// larger than MaxSize are still written.
+func (l *FileLogger) needsRotation(n int) bool {
+	info, err := os.Stat(l.Path)
+	if err != nil {
+		return false
+	}
+	return info.Size() > 0 && info.Size()+int64(n) > l.MaxSize
+}
+
+// rotate moves the file aside while holding the lock, unless another
+// invocation has already done so
+func (l *FileLogger) rotate(n int) error {
+	unlock, err := lockFile(l.Path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if !l.needsRotation(n) {
+		return nil
+	}
+	return os.Rename(l.Path, l.Path+".1")
+}
@@ -0,0 +1,110 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func readLogLines(path string) []map[string]interface{} {
+	data, err := ioutil.ReadFile(path)
+	Expect(err).NotTo(HaveOccurred())
+	var entries []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		entry := map[string]interface{}{}
+		Expect(json.Unmarshal([]byte(line), &entry)).To(Succeed(), "line %q", line)
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+var _ = Describe("FileLogger", func() {
+	var (
+		dir  string
+		path string
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "skel-filelogger")
+		Expect(err).NotTo(HaveOccurred())
+		path = filepath.Join(dir, "logs", "plugin.log")
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	It("writes one JSON object per line", func() {
+		logger := NewFileLogger(path, 0)
+		logger.Info("dispatching command", "command", "ADD", "containerID", "some-container-id")
+		logger.Error(errors.New("boom"), "command failed", "command", "ADD", "code", 7)
+
+		entries := readLogLines(path)
+		Expect(entries).To(HaveLen(2))
+		Expect(entries[0]).To(HaveKeyWithValue("level", "info"))
+		Expect(entries[0]).To(HaveKeyWithValue("msg", "dispatching command"))
+		Expect(entries[0]).To(HaveKeyWithValue("containerID", "some-container-id"))
+		Expect(entries[0]).To(HaveKey("time"))
+		Expect(entries[0]).To(HaveKeyWithValue("pid", float64(os.Getpid())))
+		Expect(entries[1]).To(HaveKeyWithValue("level", "error"))
+		Expect(entries[1]).To(HaveKeyWithValue("error", "boom"))
+		Expect(entries[1]).To(HaveKeyWithValue("code", float64(7)))
+	})
+
+	It("does not interleave lines written concurrently", func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			// Separate loggers stand in for separate plugin processes
+			logger := NewFileLogger(path, 0)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 50; j++ {
+					logger.Info("message", "payload", strings.Repeat("x", 1000))
+				}
+			}()
+		}
+		wg.Wait()
+		Expect(readLogLines(path)).To(HaveLen(400))
+	})
+
+	It("rotates the file when it reaches the maximum size", func() {
+		logger := NewFileLogger(path, 300)
+		for i := 0; i < 5; i++ {
+			logger.Info("message", "payload", strings.Repeat("x", 100))
+		}
+
+		info, err := os.Stat(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Size()).To(BeNumerically("<=", 300))
+		Expect(readLogLines(path + ".1")).NotTo(BeEmpty())
+	})
+
+	It("writes lines larger than the maximum size", func() {
+		logger := NewFileLogger(path, 10)
+		logger.Info("message", "payload", strings.Repeat("x", 100))
+		Expect(readLogLines(path)).To(HaveLen(1))
+	})
+})
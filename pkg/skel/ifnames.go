@@ -0,0 +1,59 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/cni/pkg/utils"
+)
+
+// ifNamesVar names the optional variable holding a comma-separated list of
+// interface names, for plugins that create several interfaces in a single
+// attachment, such as an SR-IOV VF and its representor. The first name is
+// the primary interface and must match CNI_IFNAME, so that plugins and
+// runtimes that do not know the extension keep working.
+const ifNamesVar = "CNI_IFNAMES"
+
+// parseIfNames returns the interface names of the attachment: the names
+// in CNI_IFNAMES if it is set, otherwise just ifName
+func parseIfNames(ifName, ifNames string) ([]string, *types.Error) {
+	if ifNames == "" {
+		if ifName == "" {
+			return nil, nil
+		}
+		return []string{ifName}, nil
+	}
+
+	var names []string
+	seen := map[string]bool{}
+	for _, name := range strings.Split(ifNames, ",") {
+		name = strings.TrimSpace(name)
+		if err := validateEnvValue(ifNamesVar, name, utils.ValidateInterfaceName); err != nil {
+			return nil, err
+		}
+		if name == "" || seen[name] {
+			return nil, types.NewError(types.ErrInvalidEnvironmentVariables, fmt.Sprintf("invalid %s %q: names must be unique and non-empty", ifNamesVar, ifNames), "")
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	if ifName != "" && names[0] != ifName {
+		return nil, types.NewError(types.ErrInvalidEnvironmentVariables, fmt.Sprintf("invalid %s %q: the first name must be CNI_IFNAME %q", ifNamesVar, ifNames, ifName), "")
+	}
+	return names, nil
+}
@@ -0,0 +1,91 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/cni/pkg/version"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("multiple interface names", func() {
+	var (
+		environment map[string]string
+		cmdAdd      *fakeCmd
+		dispatch    *dispatcher
+	)
+
+	BeforeEach(func() {
+		environment = map[string]string{
+			"CNI_COMMAND":     "ADD",
+			"CNI_CONTAINERID": "some-container-id",
+			"CNI_NETNS":       "/some/netns/path",
+			"CNI_IFNAME":      "net1",
+			"CNI_IFNAMES":     "net1, net1rep",
+			"CNI_PATH":        "/some/cni/path",
+		}
+		cmdAdd = &fakeCmd{}
+		dispatch = &dispatcher{
+			Getenv: func(key string) string { return environment[key] },
+			Stdin:  strings.NewReader(`{"name": "skel-test", "type": "test", "cniVersion": "1.0.0"}`),
+			Stdout: &bytes.Buffer{},
+			Stderr: &bytes.Buffer{},
+		}
+	})
+
+	run := func() *types.Error {
+		return dispatch.pluginMain(cmdAdd.Func, nil, nil, version.PluginSupports("1.0.0"), "")
+	}
+
+	It("parses CNI_IFNAMES into CmdArgs.IfNames", func() {
+		Expect(run()).To(BeNil())
+		Expect(cmdAdd.Received.CmdArgs.IfName).To(Equal("net1"))
+		Expect(cmdAdd.Received.CmdArgs.IfNames).To(Equal([]string{"net1", "net1rep"}))
+	})
+
+	It("holds just CNI_IFNAME without CNI_IFNAMES", func() {
+		delete(environment, "CNI_IFNAMES")
+		Expect(run()).To(BeNil())
+		Expect(cmdAdd.Received.CmdArgs.IfNames).To(Equal([]string{"net1"}))
+	})
+
+	It("requires the first name to be CNI_IFNAME", func() {
+		environment["CNI_IFNAMES"] = "net1rep,net1"
+		Expect(run()).To(Equal(types.NewError(types.ErrInvalidEnvironmentVariables, `invalid CNI_IFNAMES "net1rep,net1": the first name must be CNI_IFNAME "net1"`, "")))
+		Expect(cmdAdd.CallCount).To(Equal(0))
+	})
+
+	It("rejects invalid, empty and duplicate names", func() {
+		environment["CNI_IFNAMES"] = "net1,net1"
+		Expect(run().Msg).To(Equal(`invalid CNI_IFNAMES "net1,net1": names must be unique and non-empty`))
+
+		environment["CNI_IFNAMES"] = "net1,,net2"
+		Expect(run().Msg).To(Equal(`invalid CNI_IFNAMES "net1,,net2": names must be unique and non-empty`))
+
+		environment["CNI_IFNAMES"] = "net1,averyveryverylongname"
+		Expect(run().Msg).To(HavePrefix(`invalid CNI_IFNAMES "averyveryverylongname"`))
+	})
+
+	It("ignores CNI_IFNAMES for commands that are not about an attachment", func() {
+		environment["CNI_COMMAND"] = "VERSION"
+		environment["CNI_IFNAMES"] = "bogus,bogus"
+		Expect(run()).To(BeNil())
+	})
+})
@@ -0,0 +1,135 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+
+	"github.com/containernetworking/cni/pkg/types"
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/cni/pkg/version"
+)
+
+// IPAMFuncs are the callbacks of an IPAM plugin, which is run by the
+// plugin whose configuration has an ipam section rather than by the
+// runtime. IPAM plugins allocate addresses in the host's namespace and
+// never enter the container's.
+type IPAMFuncs struct {
+	// Allocate allocates the attachment's addresses and returns them. The
+	// dispatcher prints the result converted to the version of the
+	// configuration, and fails ADD if it contains no IPs.
+	Allocate func(*CmdArgs) (types.Result, error)
+	// Check verifies that the attachment's addresses are still allocated
+	Check func(*CmdArgs) error
+	// Release releases the attachment's addresses. It may be called more
+	// than once, or for an attachment that was never allocated; a
+	// types.ErrUnknownContainer error it returns is treated as success.
+	Release func(*CmdArgs) error
+	Status  func(*CmdArgs) error
+}
+
+// PluginMainIPAMWithError is like PluginMainFuncsWithError, but for IPAM
+// plugins. CNI_NETNS is not required, since IPAM plugins do not use it.
+func PluginMainIPAMWithError(funcs IPAMFuncs, versionInfo version.PluginInfo, about string, opts ...Option) *types.Error {
+	return PluginMainFuncsWithError(ipamCmdFuncs(funcs), versionInfo, about, append([]Option{withIPAM()}, opts...)...)
+}
+
+// PluginMainIPAM is like PluginMainFuncs, but for IPAM plugins; see
+// PluginMainIPAMWithError.
+func PluginMainIPAM(funcs IPAMFuncs, versionInfo version.PluginInfo, about string, opts ...Option) {
+	if e := PluginMainIPAMWithError(funcs, versionInfo, about, opts...); e != nil {
+		if err := printError(e, os.Getenv, os.Stdout); err != nil {
+			log.Print("Error writing error JSON: ", err)
+		}
+		os.Exit(ExitCode(e))
+	}
+}
+
+// withIPAM makes CNI_NETNS optional for every command
+func withIPAM() Option {
+	return func(t *dispatcher) {
+		t.ipam = true
+	}
+}
+
+// ipamCmdFuncs returns the callbacks that enforce the IPAM delegation
+// contract around funcs
+func ipamCmdFuncs(funcs IPAMFuncs) CmdFuncs {
+	cmdFuncs := CmdFuncs{Check: funcs.Check, Status: funcs.Status}
+	if allocate := funcs.Allocate; allocate != nil {
+		cmdFuncs.AddResult = func(args *CmdArgs) (types.Result, error) {
+			result, err := allocate(args)
+			if err != nil || result == nil {
+				return result, err
+			}
+			converted, err := current.NewResultFromResult(result)
+			if err != nil {
+				return nil, types.NewError(types.ErrInternal, "failed to convert IPAM result", err.Error())
+			}
+			if len(converted.IPs) == 0 {
+				return nil, types.NewError(types.ErrInternal, "IPAM plugin allocated no IPs", "an IPAM result must contain at least one IP")
+			}
+			return result, nil
+		}
+	}
+	if release := funcs.Release; release != nil {
+		cmdFuncs.Del = func(args *CmdArgs) error {
+			err := release(args)
+			var typedErr *types.Error
+			if errors.As(err, &typedErr) && typedErr.Code == types.ErrUnknownContainer {
+				return nil
+			}
+			return err
+		}
+	}
+	return cmdFuncs
+}
+
+// ParseIPAMConfig validates the configuration of the plugin that
+// delegated to the IPAM plugin like ParseConfig, and unmarshals its ipam
+// section into ipamConf, which must be a pointer to the IPAM plugin's
+// configuration struct. It returns the enclosing configuration. A value
+// of the wrong type is named by its path from the root, such as
+// "ipam.ranges", in Details.
+func ParseIPAMConfig(args *CmdArgs, ipamConf interface{}) (*types.NetConf, error) {
+	netConf := &types.NetConf{}
+	if err := ParseConfig(args, netConf); err != nil {
+		return nil, err
+	}
+
+	var conf struct {
+		IPAM json.RawMessage `json:"ipam"`
+	}
+	if err := json.Unmarshal(args.StdinData, &conf); err != nil {
+		return nil, decodingError(err)
+	}
+	if len(conf.IPAM) == 0 || string(conf.IPAM) == "null" {
+		return nil, types.NewError(types.ErrInvalidNetworkConfig, "missing ipam section", `field "ipam"`)
+	}
+	if err := json.Unmarshal(conf.IPAM, ipamConf); err != nil {
+		if typeErr, ok := err.(*json.UnmarshalTypeError); ok {
+			if typeErr.Field == "" {
+				typeErr.Field = "ipam"
+			} else {
+				typeErr.Field = "ipam." + typeErr.Field
+			}
+		}
+		return nil, decodingError(err)
+	}
+	return netConf, nil
+}
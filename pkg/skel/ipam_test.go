@@ -0,0 +1,139 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/containernetworking/cni/pkg/types"
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/cni/pkg/version"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("IPAM plugins", func() {
+	const config = `{
+		"name": "skel-test",
+		"type": "bridge",
+		"cniVersion": "1.0.0",
+		"ipam": {"type": "host-local", "subnet": "10.1.2.0/24"}
+	}`
+
+	var (
+		environment map[string]string
+		stdout      *bytes.Buffer
+		allocated   *current.Result
+		releaseErr  error
+		funcs       IPAMFuncs
+	)
+
+	run := func(command string) *types.Error {
+		environment["CNI_COMMAND"] = command
+		d := &Dispatcher{
+			Getenv:  func(key string) string { return environment[key] },
+			Stdin:   strings.NewReader(config),
+			Stdout:  stdout,
+			Stderr:  &bytes.Buffer{},
+			Options: []Option{withIPAM()},
+		}
+		return d.Run(context.TODO(), ipamCmdFuncs(funcs), version.PluginSupports("1.0.0"), "")
+	}
+
+	BeforeEach(func() {
+		environment = map[string]string{
+			"CNI_CONTAINERID": "some-container-id",
+			"CNI_IFNAME":      "eth0",
+			"CNI_PATH":        "/some/cni/path",
+		}
+		stdout = &bytes.Buffer{}
+		address, err := types.ParseCIDR("10.1.2.3/24")
+		Expect(err).NotTo(HaveOccurred())
+		allocated = &current.Result{CNIVersion: "1.0.0", IPs: []*current.IPConfig{{Address: *address}}}
+		releaseErr = nil
+		funcs = IPAMFuncs{
+			Allocate: func(*CmdArgs) (types.Result, error) { return allocated, nil },
+			Release:  func(*CmdArgs) error { return releaseErr },
+		}
+	})
+
+	It("prints the allocated addresses without requiring CNI_NETNS", func() {
+		Expect(run("ADD")).To(BeNil())
+		Expect(stdout.String()).To(ContainSubstring(`"address": "10.1.2.3/24"`))
+	})
+
+	It("fails ADD when no IPs were allocated", func() {
+		allocated.IPs = nil
+		err := run("ADD")
+		Expect(err).NotTo(BeNil())
+		Expect(err.Msg).To(Equal("IPAM plugin allocated no IPs"))
+	})
+
+	It("treats releasing an unknown attachment as success", func() {
+		releaseErr = types.NewError(types.ErrUnknownContainer, "no allocation for some-container-id", "")
+		Expect(run("DEL")).To(BeNil())
+
+		releaseErr = errors.New("store is read-only")
+		Expect(run("DEL")).NotTo(BeNil())
+	})
+
+	It("still requires CNI_NETNS for other plugins", func() {
+		environment["CNI_COMMAND"] = "ADD"
+		err := (&Dispatcher{
+			Getenv: func(key string) string { return environment[key] },
+			Stdin:  strings.NewReader(config),
+			Stdout: stdout,
+			Stderr: &bytes.Buffer{},
+		}).Run(context.TODO(), ipamCmdFuncs(funcs), version.PluginSupports("1.0.0"), "")
+		Expect(err).NotTo(BeNil())
+		Expect(err.Msg).To(Equal("required env variables [CNI_NETNS] missing"))
+	})
+
+	Describe("ParseIPAMConfig", func() {
+		type hostLocal struct {
+			Type   string `json:"type"`
+			Subnet string `json:"subnet"`
+		}
+
+		It("returns the enclosing configuration and the ipam section", func() {
+			var ipamConf hostLocal
+			netConf, err := ParseIPAMConfig(&CmdArgs{StdinData: []byte(config)}, &ipamConf)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(netConf.Name).To(Equal("skel-test"))
+			Expect(netConf.CNIVersion).To(Equal("1.0.0"))
+			Expect(ipamConf).To(Equal(hostLocal{Type: "host-local", Subnet: "10.1.2.0/24"}))
+		})
+
+		It("fails without an ipam section", func() {
+			_, err := ParseIPAMConfig(&CmdArgs{StdinData: []byte(`{"name": "skel-test", "type": "bridge", "cniVersion": "1.0.0"}`)}, &hostLocal{})
+			Expect(err).To(MatchError("missing ipam section; field \"ipam\""))
+		})
+
+		It("names mistyped fields by their path from the root", func() {
+			var ipamConf struct {
+				Subnet int `json:"subnet"`
+			}
+			_, err := ParseIPAMConfig(&CmdArgs{StdinData: []byte(config)}, &ipamConf)
+			var typedErr *types.Error
+			Expect(errors.As(err, &typedErr)).To(BeTrue())
+			Expect(typedErr.Code).To(Equal(types.ErrDecodingFailure))
+			Expect(typedErr.Details).To(HavePrefix(`field "ipam.subnet"`))
+		})
+	})
+})
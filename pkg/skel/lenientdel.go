@@ -0,0 +1,71 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import "strings"
+
+// WithLenientDel makes DEL tolerant of missing input, as the specification
+// requires of plugins: a runtime that lost track of an attachment may
+// still call DEL without CNI_NETNS, CNI_IFNAME or a prevResult. Instead of
+// failing with missing-variable or decoding errors, the dispatcher calls
+// the DEL callback with the arguments it has and lists the absent ones in
+// CmdArgs.Missing, such as "CNI_NETNS" or "prevResult". The callback
+// should then release whatever it can still find. A malformed CNI_ARGS is
+// tolerated too: its invalid pairs are skipped and "CNI_ARGS" is listed in
+// Missing. Other invalid values, as opposed to missing ones, still fail.
+// Without CNI_CONTAINERID or CNI_IFNAME the attachment is neither locked
+// nor given a state directory.
+func WithLenientDel() Option {
+	return func(t *dispatcher) {
+		t.lenientDel = true
+	}
+}
+
+// prevResultMissing names the prevResult in CmdArgs.Missing
+const prevResultMissing = "prevResult"
+
+// isLenientDel returns true if missing input is tolerated for cmd
+func (t *dispatcher) isLenientDel(cmd string) bool {
+	return t.lenientDel && cmd == "DEL"
+}
+
+// parseValidArgs parses the KEY=VALUE pairs of args for a lenient DEL,
+// skipping the pairs parseArgs rejects and keeping the first value of a
+// duplicate key
+func parseValidArgs(args string) map[string]string {
+	parsed := map[string]string{}
+	for _, pair := range strings.Split(args, ";") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			continue
+		}
+		if _, ok := parsed[kv[0]]; !ok {
+			parsed[kv[0]] = kv[1]
+		}
+	}
+	return parsed
+}
+
+// decodeLenientPrevResult decodes the prevResult for a lenient DEL,
+// recording it in cmdArgs.Missing instead of failing when it is absent or
+// cannot be decoded
+func decodeLenientPrevResult(cmdArgs *CmdArgs) {
+	prevResult, err := decodePrevResult(cmdArgs.StdinData)
+	if err != nil || prevResult == nil {
+		cmdArgs.Missing = append(cmdArgs.Missing, prevResultMissing)
+		return
+	}
+	cmdArgs.PrevResult = prevResult
+}
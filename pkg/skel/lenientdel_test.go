@@ -0,0 +1,147 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/cni/pkg/version"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("lenient DEL", func() {
+	var (
+		environment map[string]string
+		stdin       string
+		cmdDel      *fakeCmd
+	)
+
+	dispatch := func() *dispatcher {
+		t := &dispatcher{
+			Getenv: func(key string) string { return environment[key] },
+			Stdin:  strings.NewReader(stdin),
+			Stdout: &bytes.Buffer{},
+			Stderr: &bytes.Buffer{},
+		}
+		WithPrevResult("DEL")(t)
+		return t
+	}
+
+	BeforeEach(func() {
+		environment = map[string]string{
+			"CNI_COMMAND":     "DEL",
+			"CNI_CONTAINERID": "some-container-id",
+		}
+		stdin = `{"cniVersion": "1.0.0", "name": "mynet", "type": "test"}`
+		cmdDel = &fakeCmd{}
+	})
+
+	It("fails on missing input by default", func() {
+		err := dispatch().pluginMain(nil, nil, cmdDel.Func, version.All, "")
+		Expect(err).To(HaveOccurred())
+		Expect(err.Code).To(Equal(uint(types.ErrInvalidEnvironmentVariables)))
+		Expect(cmdDel.CallCount).To(Equal(0))
+	})
+
+	It("calls DEL with the arguments it has, flagging the absent ones", func() {
+		t := dispatch()
+		WithLenientDel()(t)
+		err := t.pluginMain(nil, nil, cmdDel.Func, version.All, "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cmdDel.CallCount).To(Equal(1))
+
+		args := cmdDel.Received.CmdArgs
+		Expect(args.ContainerID).To(Equal("some-container-id"))
+		Expect(args.IfName).To(BeEmpty())
+		Expect(args.PrevResult).To(BeNil())
+		Expect(args.Missing).To(Equal([]string{"CNI_NETNS", "CNI_IFNAME", "CNI_PATH", "prevResult"}))
+	})
+
+	It("calls DEL without an interface name when state directories are used", func() {
+		root, err := ioutil.TempDir("", "skel-lenient")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(root)
+
+		t := dispatch()
+		WithLenientDel()(t)
+		WithStateDir(root)(t)
+		WithAttachmentLock(filepath.Join(root, "locks"))(t)
+		Expect(t.pluginMain(nil, nil, cmdDel.Func, version.All, "")).To(BeNil())
+		Expect(cmdDel.CallCount).To(Equal(1))
+		Expect(cmdDel.Received.CmdArgs.State).To(BeNil())
+	})
+
+	It("flags a prevResult that cannot be decoded", func() {
+		environment["CNI_NETNS"] = "/some/netns"
+		environment["CNI_IFNAME"] = "eth0"
+		environment["CNI_PATH"] = "/opt/cni/bin"
+		stdin = `{"cniVersion": "1.0.0", "name": "mynet", "type": "test", "prevResult": {"ips": [{"address": "bogus"}]}}`
+		t := dispatch()
+		WithLenientDel()(t)
+		err := t.pluginMain(nil, nil, cmdDel.Func, version.All, "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cmdDel.Received.CmdArgs.Missing).To(Equal([]string{"prevResult"}))
+	})
+
+	It("leaves Missing empty when nothing is absent", func() {
+		environment["CNI_NETNS"] = "/some/netns"
+		environment["CNI_IFNAME"] = "eth0"
+		environment["CNI_PATH"] = "/opt/cni/bin"
+		stdin = `{"cniVersion": "1.0.0", "name": "mynet", "type": "test", "prevResult": {"ips": [{"address": "10.0.0.2/24"}]}}`
+		t := dispatch()
+		WithLenientDel()(t)
+		err := t.pluginMain(nil, nil, cmdDel.Func, version.All, "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cmdDel.Received.CmdArgs.Missing).To(BeEmpty())
+		Expect(cmdDel.Received.CmdArgs.PrevResult).NotTo(BeNil())
+	})
+
+	It("still rejects invalid values", func() {
+		environment["CNI_IFNAME"] = "a/b"
+		t := dispatch()
+		WithLenientDel()(t)
+		err := t.pluginMain(nil, nil, cmdDel.Func, version.All, "")
+		Expect(err).To(HaveOccurred())
+		Expect(cmdDel.CallCount).To(Equal(0))
+	})
+
+	It("skips malformed CNI_ARGS pairs, flagging them", func() {
+		environment["CNI_ARGS"] = "K8S_POD_NAME=web-0;garbage;=empty;K8S_POD_NAME=again"
+		t := dispatch()
+		WithLenientDel()(t)
+		err := t.pluginMain(nil, nil, cmdDel.Func, version.All, "")
+		Expect(err).NotTo(HaveOccurred())
+		args := cmdDel.Received.CmdArgs
+		Expect(args.ParsedArgs).To(Equal(map[string]string{"K8S_POD_NAME": "web-0"}))
+		Expect(args.Missing).To(ContainElement("CNI_ARGS"))
+	})
+
+	It("does not change ADD", func() {
+		environment["CNI_COMMAND"] = "ADD"
+		cmdAdd := &fakeCmd{}
+		t := dispatch()
+		WithLenientDel()(t)
+		err := t.pluginMain(cmdAdd.Func, nil, cmdDel.Func, version.All, "")
+		Expect(err).To(HaveOccurred())
+		Expect(cmdAdd.CallCount).To(Equal(0))
+	})
+})
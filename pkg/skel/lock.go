@@ -0,0 +1,113 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/containernetworking/cni/pkg/types"
+)
+
+// lockPollInterval is how often a held attachment lock is retried
+const lockPollInterval = 10 * time.Millisecond
+
+// LockAttachment takes an exclusive file lock in dir for the attachment
+// identified by containerID and ifName, waiting until it is free or ctx
+// is done. It returns a function that releases the lock. Processes that
+// lock the same attachment in the same dir are serialized; the lock is
+// released by the kernel if the process exits without unlocking. Lock
+// files are left in dir, since removing them would race with processes
+// waiting for them.
+func LockAttachment(ctx context.Context, dir, containerID, ifName string) (func() error, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create lock directory: %v", err)
+	}
+	path := attachmentLockPath(dir, containerID, ifName)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %v", err)
+	}
+
+	for {
+		locked, err := tryLockFile(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to lock %s: %v", path, err)
+		}
+		if locked {
+			return func() error {
+				err := unlockFile(f)
+				if closeErr := f.Close(); err == nil {
+					err = closeErr
+				}
+				return err
+			}, nil
+		}
+		select {
+		case <-ctx.Done():
+			f.Close()
+			return nil, fmt.Errorf("waiting for lock on container %s interface %s: %v", containerID, ifName, ctx.Err())
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// attachmentLockPath returns the lock file for an attachment. The IDs
+// are hashed, since they may contain characters that are not valid in
+// file names.
+func attachmentLockPath(dir, containerID, ifName string) string {
+	sum := sha256.Sum256([]byte(containerID + "\x00" + ifName))
+	return filepath.Join(dir, hex.EncodeToString(sum[:16])+".lock")
+}
+
+// WithAttachmentLock serializes ADD, CHECK and DEL for the same container
+// and interface by holding a LockAttachment lock in dir, such as
+// /run/cni/locks/<plugin>, while the callback and hooks run. It is for
+// plugins that cannot tolerate concurrent commands for one attachment.
+// With WithTimeout, the time spent waiting for the lock counts towards
+// the timeout.
+func WithAttachmentLock(dir string) Option {
+	return func(t *dispatcher) {
+		t.lockDir = dir
+	}
+}
+
+// lockAttachment takes the attachment lock for cmd if WithAttachmentLock
+// was used, returning a function that releases it
+func (t *dispatcher) lockAttachment(ctx context.Context, cmd string, cmdArgs *CmdArgs) (func(), *types.Error) {
+	if t.lockDir == "" || cmdArgs.ContainerID == "" || cmdArgs.IfName == "" || cmdArgs.DryRun {
+		return func() {}, nil
+	}
+	switch cmd {
+	case "ADD", "CHECK", "DEL":
+	default:
+		return func() {}, nil
+	}
+	unlock, err := LockAttachment(ctx, t.lockDir, cmdArgs.ContainerID, cmdArgs.IfName)
+	if err != nil {
+		return nil, types.NewError(types.ErrTryAgainLater, err.Error(), "")
+	}
+	return func() {
+		if err := unlock(); err != nil {
+			_, _ = fmt.Fprintf(t.Stderr, "failed to release attachment lock: %v\n", err)
+		}
+	}, nil
+}
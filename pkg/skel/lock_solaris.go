@@ -0,0 +1,63 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build solaris && !illumos
+// +build solaris,!illumos
+
+package skel
+
+import (
+	"os"
+	"sync"
+	"syscall"
+)
+
+// Solaris has no flock, so files are locked with fcntl. fcntl locks are
+// held by the process rather than the file descriptor, so the files this
+// process has locked are also tracked here to exclude its own goroutines.
+// Closing any descriptor of a locked file drops its fcntl lock, so a
+// goroutine giving up on a lock held by another goroutine lets other
+// processes in until the holder unlocks.
+var (
+	lockedFilesMu sync.Mutex
+	lockedFiles   = map[string]bool{}
+)
+
+// tryLockFile takes an exclusive lock on f without blocking, returning
+// false if another process or goroutine holds it
+func tryLockFile(f *os.File) (bool, error) {
+	lockedFilesMu.Lock()
+	defer lockedFilesMu.Unlock()
+	if lockedFiles[f.Name()] {
+		return false, nil
+	}
+	lk := syscall.Flock_t{Type: syscall.F_WRLCK}
+	err := syscall.FcntlFlock(f.Fd(), syscall.F_SETLK, &lk)
+	if err == syscall.EAGAIN || err == syscall.EACCES {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	lockedFiles[f.Name()] = true
+	return true, nil
+}
+
+func unlockFile(f *os.File) error {
+	lockedFilesMu.Lock()
+	defer lockedFilesMu.Unlock()
+	delete(lockedFiles, f.Name())
+	lk := syscall.Flock_t{Type: syscall.F_UNLCK}
+	return syscall.FcntlFlock(f.Fd(), syscall.F_SETLK, &lk)
+}
@@ -0,0 +1,123 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/cni/pkg/version"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("attachment locks", func() {
+	var (
+		dir     string
+		cancels []context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "cni-lock")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+		cancels = nil
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	// shortly returns a context that expires soon, for waiting on locks
+	shortly := func() context.Context {
+		ctx, cancel := context.WithTimeout(context.TODO(), 20*time.Millisecond)
+		cancels = append(cancels, cancel)
+		return ctx
+	}
+
+	It("serializes lockers of the same attachment", func() {
+		unlock, err := LockAttachment(context.TODO(), dir, "some-container-id", "eth0")
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = LockAttachment(shortly(), dir, "some-container-id", "eth0")
+		Expect(err).To(MatchError(ContainSubstring("waiting for lock on container some-container-id interface eth0")))
+
+		other, err := LockAttachment(shortly(), dir, "some-container-id", "eth1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(other()).To(Succeed())
+
+		Expect(unlock()).To(Succeed())
+		again, err := LockAttachment(shortly(), dir, "some-container-id", "eth0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(again()).To(Succeed())
+	})
+
+	Context("with WithAttachmentLock", func() {
+		var dispatch *dispatcher
+
+		BeforeEach(func() {
+			environment := map[string]string{
+				"CNI_COMMAND":     "ADD",
+				"CNI_CONTAINERID": "some-container-id",
+				"CNI_NETNS":       "/some/netns/path",
+				"CNI_IFNAME":      "eth0",
+				"CNI_PATH":        "/some/cni/path",
+			}
+			dispatch = &dispatcher{
+				Getenv: func(key string) string { return environment[key] },
+				Stdin:  strings.NewReader(`{"name": "skel-test", "type": "test", "cniVersion": "1.0.0"}`),
+				Stdout: &bytes.Buffer{},
+				Stderr: &bytes.Buffer{},
+			}
+			WithAttachmentLock(dir)(dispatch)
+		})
+
+		It("holds the lock while the callback runs", func() {
+			var lockErr error
+			cmdAdd := func(_ context.Context, args *CmdArgs) error {
+				_, lockErr = LockAttachment(shortly(), dir, args.ContainerID, args.IfName)
+				return nil
+			}
+			err := dispatch.pluginMainContext(context.TODO(), cmdAdd, nil, nil, version.PluginSupports("1.0.0"), "")
+			Expect(err).To(BeNil())
+			Expect(lockErr).To(HaveOccurred())
+
+			unlock, err2 := LockAttachment(shortly(), dir, "some-container-id", "eth0")
+			Expect(err2).NotTo(HaveOccurred())
+			Expect(unlock()).To(Succeed())
+		})
+
+		It("fails with a retryable error when the lock is not released in time", func() {
+			unlock, lockErr := LockAttachment(context.TODO(), dir, "some-container-id", "eth0")
+			Expect(lockErr).NotTo(HaveOccurred())
+			defer unlock()
+
+			cmdAdd := &fakeCmd{}
+			err := dispatch.pluginMainContext(shortly(), cmdAdd.ContextFunc, nil, nil, version.PluginSupports("1.0.0"), "")
+			Expect(err).NotTo(BeNil())
+			Expect(err.Code).To(Equal(uint(types.ErrTryAgainLater)))
+			Expect(cmdAdd.CallCount).To(Equal(0))
+		})
+	})
+})
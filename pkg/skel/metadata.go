@@ -0,0 +1,105 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime/debug"
+
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/cni/pkg/version"
+)
+
+// PluginMetadata describes a plugin binary. The dispatcher prints it as
+// JSON to stdout when the plugin is run with --version or --help and no
+// CNI_COMMAND, so that installers and operators can inspect plugins
+// without writing a network configuration.
+type PluginMetadata struct {
+	Name string `json:"name"`
+	// Version is the version the plugin was built as; see
+	// WithBuildVersion
+	Version           string                `json:"version,omitempty"`
+	About             string                `json:"about,omitempty"`
+	SupportedVersions []string              `json:"supportedVersions"`
+	Capabilities      []string              `json:"capabilities,omitempty"`
+	Verbs             []string              `json:"verbs"`
+	Requires          *version.Requirements `json:"requires,omitempty"`
+}
+
+// WithBuildVersion sets the version reported in the plugin's metadata,
+// which otherwise is the version of the main module recorded in the
+// binary, if any
+func WithBuildVersion(v string) Option {
+	return func(t *dispatcher) {
+		t.buildVersion = v
+	}
+}
+
+// metadataFlag returns the metadata flag the plugin was run with, if any
+func (t *dispatcher) metadataFlag() string {
+	if t.Getenv("CNI_COMMAND") != "" || len(t.Args) == 0 {
+		return ""
+	}
+	switch t.Args[0] {
+	case "--version", "--help", "-h":
+		return t.Args[0]
+	}
+	return ""
+}
+
+// printMetadata prints the plugin's metadata to stdout, and for --help
+// also the about string and usage to stderr
+func (t *dispatcher) printMetadata(flag string, cmdAdd, cmdCheck, cmdDel func(context.Context, *CmdArgs) error, versionInfo version.PluginInfo, about string) *types.Error {
+	metadata := &PluginMetadata{
+		Name:              pluginName(t.Getenv, os.Args[0]),
+		Version:           t.buildVersion,
+		About:             about,
+		SupportedVersions: versionInfo.SupportedVersions(),
+		Capabilities:      t.capabilities,
+		Verbs:             t.verbs(cmdAdd, cmdCheck, cmdDel),
+		Requires:          t.requirements,
+	}
+	if metadata.Version == "" {
+		metadata.Version = mainModuleVersion()
+	}
+
+	if flag != "--version" {
+		if about != "" {
+			_, _ = fmt.Fprintln(t.Stderr, about)
+		}
+		_, _ = fmt.Fprintf(t.Stderr, "%s is a CNI plugin, run by container runtimes with CNI_COMMAND and the network configuration on stdin.\n", metadata.Name)
+	}
+	data, err := json.MarshalIndent(metadata, "", "    ")
+	if err != nil {
+		return types.NewError(types.ErrInternal, fmt.Sprintf("failed to encode plugin metadata: %v", err), "")
+	}
+	if _, err := fmt.Fprintln(t.Stdout, string(data)); err != nil {
+		return types.NewError(types.ErrIOFailure, fmt.Sprintf("failed to print plugin metadata: %v", err), "")
+	}
+	return nil
+}
+
+// mainModuleVersion returns the version of the main module the binary was
+// built from, or "" for development builds
+func mainModuleVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok || info.Main.Version == "(devel)" {
+		return ""
+	}
+	return info.Main.Version
+}
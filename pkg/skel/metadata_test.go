@@ -0,0 +1,84 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/containernetworking/cni/pkg/version"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("plugin metadata flags", func() {
+	var (
+		environment    map[string]string
+		stdout, stderr *bytes.Buffer
+		dispatch       *dispatcher
+		cmd            *fakeCmd
+	)
+
+	BeforeEach(func() {
+		environment = map[string]string{"CNI_PLUGIN_NAME": "bridge"}
+		stdout, stderr = &bytes.Buffer{}, &bytes.Buffer{}
+		dispatch = &dispatcher{
+			Getenv: func(key string) string { return environment[key] },
+			Stdin:  strings.NewReader(""),
+			Stdout: stdout,
+			Stderr: stderr,
+			Args:   []string{"--version"},
+		}
+		WithFeatureManifest("portMappings")(dispatch)
+		WithBuildVersion("v1.2.3")(dispatch)
+		cmd = &fakeCmd{}
+	})
+
+	It("prints the metadata as JSON for --version", func() {
+		err := dispatch.pluginMain(cmd.Func, nil, cmd.Func, version.PluginSupports("0.4.0", "1.0.0"), "CNI bridge plugin v1.2.3")
+		Expect(err).To(BeNil())
+		Expect(stderr.Len()).To(BeZero())
+
+		var metadata PluginMetadata
+		Expect(json.Unmarshal(stdout.Bytes(), &metadata)).To(Succeed())
+		Expect(metadata).To(Equal(PluginMetadata{
+			Name:              "bridge",
+			Version:           "v1.2.3",
+			About:             "CNI bridge plugin v1.2.3",
+			SupportedVersions: []string{"0.4.0", "1.0.0"},
+			Capabilities:      []string{"portMappings"},
+			Verbs:             []string{"ADD", "DEL", "VERSION"},
+		}))
+		Expect(cmd.CallCount).To(BeZero())
+	})
+
+	It("also prints the about string and usage for --help", func() {
+		dispatch.Args = []string{"--help"}
+		err := dispatch.pluginMain(cmd.Func, nil, cmd.Func, version.PluginSupports("1.0.0"), "CNI bridge plugin v1.2.3")
+		Expect(err).To(BeNil())
+		Expect(stderr.String()).To(HavePrefix("CNI bridge plugin v1.2.3\nbridge is a CNI plugin"))
+		Expect(stdout.String()).To(ContainSubstring(`"name": "bridge"`))
+	})
+
+	It("ignores the flags when CNI_COMMAND is set", func() {
+		environment["CNI_COMMAND"] = "VERSION"
+		err := dispatch.pluginMain(cmd.Func, nil, cmd.Func, version.PluginSupports("1.0.0"), "")
+		Expect(err).To(BeNil())
+		Expect(stdout.String()).To(ContainSubstring(`"supportedVersions"`))
+		Expect(stdout.String()).NotTo(ContainSubstring(`"name"`))
+	})
+})
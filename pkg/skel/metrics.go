@@ -0,0 +1,174 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/containernetworking/cni/pkg/types"
+)
+
+// fileLockTimeout bounds how long a plugin waits for other invocations
+// to finish updating a shared file
+const fileLockTimeout = time.Second
+
+// Metrics are the counters WithMetrics keeps for a plugin
+type Metrics struct {
+	// Invocations counts the invocations of each command
+	Invocations map[string]uint64 `json:"invocations"`
+	// Errors counts the invocations of each command that failed
+	Errors map[string]uint64 `json:"errors"`
+	// LastSuccess is the time of the last invocation that succeeded
+	LastSuccess *time.Time `json:"lastSuccess,omitempty"`
+}
+
+// WithMetrics makes the dispatcher count invocations and errors per
+// command in the file <dir>/<plugin name>.json, so that node agents can
+// monitor plugin health by reading the file; see ReadMetrics. The plugin
+// name is the name the binary was executed as, or CNI_PLUGIN_NAME if set.
+// Failures to update the file are logged to stderr and do not fail the
+// command.
+func WithMetrics(dir string) Option {
+	return func(t *dispatcher) {
+		t.metricsDir = dir
+	}
+}
+
+// ReadMetrics reads the metrics WithMetrics keeps for the named plugin
+// in dir
+func ReadMetrics(dir, pluginName string) (*Metrics, error) {
+	return readMetrics(metricsPath(dir, pluginName))
+}
+
+func metricsPath(dir, pluginName string) string {
+	return filepath.Join(dir, pluginName+".json")
+}
+
+func readMetrics(path string) (*Metrics, error) {
+	m := &Metrics{}
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, m); err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %v", path, err)
+		}
+	}
+	if m.Invocations == nil {
+		m.Invocations = map[string]uint64{}
+	}
+	if m.Errors == nil {
+		m.Errors = map[string]uint64{}
+	}
+	return m, nil
+}
+
+// recordMetrics counts an invocation of cmd that returned e
+func (t *dispatcher) recordMetrics(cmd string, e *types.Error) {
+	if t.metricsDir == "" || cmd == "" {
+		return
+	}
+	path := metricsPath(t.metricsDir, pluginName(t.Getenv, os.Args[0]))
+	err := updateMetrics(path, func(m *Metrics) {
+		m.Invocations[cmd]++
+		if e != nil {
+			m.Errors[cmd]++
+		} else {
+			now := time.Now().UTC()
+			m.LastSuccess = &now
+		}
+	})
+	if err != nil {
+		_, _ = fmt.Fprintf(t.Stderr, "failed to update metrics: %v\n", err)
+	}
+}
+
+// updateMetrics applies update to the metrics in path while holding a
+// lock against concurrent invocations of the plugin
+func updateMetrics(path string, update func(*Metrics)) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	unlock, err := lockFile(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	m, err := readMetrics(path)
+	if err != nil {
+		return err
+	}
+	update(m)
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	// Replace the file so that readers never see a partial write
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// lockFile takes an exclusive lock on the file path.lock, like
+// LockAttachment, and returns a function that releases it. The lock is
+// released by the kernel if the process exits while holding it, and the
+// lock file is left in place, since removing it would race with waiters.
+func lockFile(path string) (func(), error) {
+	lockPath := path + ".lock"
+	f, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(fileLockTimeout)
+	for {
+		locked, err := tryLockFile(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to lock %s: %v", lockPath, err)
+		}
+		if locked {
+			return func() {
+				_ = unlockFile(f)
+				f.Close()
+			}, nil
+		}
+		if time.Now().After(deadline) {
+			f.Close()
+			return nil, fmt.Errorf("timed out waiting for lock %s", lockPath)
+		}
+		time.Sleep(lockPollInterval)
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/cni/pkg/version"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("metrics", func() {
+	var (
+		dir    string
+		cmdAdd *fakeCmd
+		stderr *bytes.Buffer
+		env    map[string]string
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "skel-metrics")
+		Expect(err).NotTo(HaveOccurred())
+		cmdAdd = &fakeCmd{}
+		stderr = &bytes.Buffer{}
+		env = map[string]string{
+			"CNI_COMMAND":     "ADD",
+			"CNI_CONTAINERID": "some-container-id",
+			"CNI_NETNS":       "/some/netns/path",
+			"CNI_IFNAME":      "eth0",
+			"CNI_PATH":        "/some/cni/path",
+			"CNI_PLUGIN_NAME": "myplugin",
+		}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	run := func() *types.Error {
+		stdin := strings.NewReader(`{"cniVersion": "1.0.0", "name": "mynet", "type": "myplugin"}`)
+		return PluginMainFuncsWithError(CmdFuncs{Add: cmdAdd.Func}, version.PluginSupports("1.0.0"), "",
+			WithMetrics(dir), WithEnv(env), WithStreams(stdin, &bytes.Buffer{}, stderr))
+	}
+
+	It("counts invocations and errors per command", func() {
+		Expect(run()).To(BeNil())
+		cmdAdd.Returns.Error = errors.New("boom")
+		Expect(run()).NotTo(BeNil())
+		env["CNI_COMMAND"] = "DEL"
+		Expect(run()).NotTo(BeNil())
+
+		m, err := ReadMetrics(dir, "myplugin")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(m.Invocations).To(Equal(map[string]uint64{"ADD": 2, "DEL": 1}))
+		Expect(m.Errors).To(Equal(map[string]uint64{"ADD": 1, "DEL": 1}))
+		Expect(m.LastSuccess).NotTo(BeNil())
+		Expect(*m.LastSuccess).To(BeTemporally("~", time.Now(), time.Minute))
+		Expect(stderr.String()).To(BeEmpty())
+	})
+
+	It("returns empty metrics for plugins that were never invoked", func() {
+		m, err := ReadMetrics(dir, "other")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(m.Invocations).To(BeEmpty())
+		Expect(m.LastSuccess).To(BeNil())
+	})
+
+	It("is not blocked by a lock file left behind by a killed plugin", func() {
+		lockPath := filepath.Join(dir, "myplugin.json.lock")
+		Expect(ioutil.WriteFile(lockPath, nil, 0600)).To(Succeed())
+
+		Expect(run()).To(BeNil())
+		m, err := ReadMetrics(dir, "myplugin")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(m.Invocations).To(Equal(map[string]uint64{"ADD": 1}))
+	})
+
+	It("serializes concurrent updates", func() {
+		path := filepath.Join(dir, "concurrent.json")
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer GinkgoRecover()
+				Expect(updateMetrics(path, func(m *Metrics) { m.Invocations["ADD"]++ })).To(Succeed())
+			}()
+		}
+		wg.Wait()
+		m, err := readMetrics(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(m.Invocations).To(Equal(map[string]uint64{"ADD": 20}))
+	})
+
+	It("does not fail the command when the metrics cannot be written", func() {
+		blocker := filepath.Join(dir, "file")
+		Expect(ioutil.WriteFile(blocker, nil, 0600)).To(Succeed())
+		dir = filepath.Join(blocker, "metrics")
+
+		Expect(run()).To(BeNil())
+		Expect(stderr.String()).To(HavePrefix("failed to update metrics: "))
+		dir = filepath.Dir(blocker)
+	})
+})
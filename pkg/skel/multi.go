@@ -0,0 +1,88 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/cni/pkg/version"
+)
+
+// NamedPlugin is one of the plugins provided by a binary that uses
+// PluginMainMulti
+type NamedPlugin struct {
+	Funcs       CmdFuncs
+	VersionInfo version.PluginInfo
+	About       string
+	// Options are applied before the options passed to PluginMainMulti
+	Options []Option
+}
+
+// pluginName returns the name of the plugin a multi-plugin binary was
+// invoked as: CNI_PLUGIN_NAME if set, otherwise the base name of argv0
+func pluginName(getenv func(string) string, argv0 string) string {
+	if name := getenv("CNI_PLUGIN_NAME"); name != "" {
+		return name
+	}
+	return strings.TrimSuffix(filepath.Base(argv0), ".exe")
+}
+
+// selectPlugin returns the plugin registered under name
+func selectPlugin(plugins map[string]NamedPlugin, name string) (*NamedPlugin, *types.Error) {
+	p, ok := plugins[name]
+	if !ok {
+		names := make([]string, 0, len(plugins))
+		for n := range plugins {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, types.NewError(types.ErrInvalidEnvironmentVariables, fmt.Sprintf("unknown plugin %q", name), "this binary provides: "+strings.Join(names, ", "))
+	}
+	return &p, nil
+}
+
+// PluginMainMultiWithError is like PluginMainFuncsWithError for binaries
+// that provide several plugins, such as a plugin suite installed once and
+// linked or copied under each plugin's name. The plugin is chosen by the
+// name the binary was executed as, which the CNI_PLUGIN_NAME environment
+// variable overrides.
+func PluginMainMultiWithError(plugins map[string]NamedPlugin, opts ...Option) *types.Error {
+	t := &dispatcher{Getenv: os.Getenv}
+	for _, opt := range opts {
+		opt(t)
+	}
+	p, err := selectPlugin(plugins, pluginName(t.Getenv, os.Args[0]))
+	if err != nil {
+		return err
+	}
+	return PluginMainFuncsWithError(p.Funcs, p.VersionInfo, p.About, append(append([]Option{}, p.Options...), opts...)...)
+}
+
+// PluginMainMulti is like PluginMainFuncs for binaries that provide
+// several plugins; see PluginMainMultiWithError.
+func PluginMainMulti(plugins map[string]NamedPlugin, opts ...Option) {
+	if e := PluginMainMultiWithError(plugins, opts...); e != nil {
+		if err := printError(e, os.Getenv, os.Stdout); err != nil {
+			log.Print("Error writing error JSON: ", err)
+		}
+		os.Exit(ExitCode(e))
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/cni/pkg/version"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("multi-plugin binaries", func() {
+	var (
+		bridgeAdd, macvlanAdd *fakeCmd
+		plugins               map[string]NamedPlugin
+		env                   map[string]string
+	)
+
+	BeforeEach(func() {
+		bridgeAdd = &fakeCmd{}
+		macvlanAdd = &fakeCmd{}
+		plugins = map[string]NamedPlugin{
+			"bridge": {
+				Funcs:       CmdFuncs{Add: bridgeAdd.Func},
+				VersionInfo: version.PluginSupports("1.0.0"),
+			},
+			"macvlan": {
+				Funcs:       CmdFuncs{Add: macvlanAdd.Func},
+				VersionInfo: version.PluginSupports("1.0.0"),
+			},
+		}
+		env = map[string]string{
+			"CNI_COMMAND":     "ADD",
+			"CNI_CONTAINERID": "some-container-id",
+			"CNI_NETNS":       "/some/netns/path",
+			"CNI_IFNAME":      "eth0",
+			"CNI_PATH":        "/some/cni/path",
+		}
+	})
+
+	run := func() *types.Error {
+		stdin := strings.NewReader(`{"cniVersion": "1.0.0", "name": "mynet", "type": "macvlan"}`)
+		return PluginMainMultiWithError(plugins, WithEnv(env), WithStreams(stdin, &bytes.Buffer{}, &bytes.Buffer{}))
+	}
+
+	It("derives the plugin name from the executable", func() {
+		getenv := func(string) string { return "" }
+		Expect(pluginName(getenv, "/opt/cni/bin/bridge")).To(Equal("bridge"))
+		Expect(pluginName(getenv, "bridge.exe")).To(Equal("bridge"))
+	})
+
+	It("dispatches to the plugin named by CNI_PLUGIN_NAME", func() {
+		env["CNI_PLUGIN_NAME"] = "macvlan"
+		Expect(run()).To(BeNil())
+		Expect(macvlanAdd.CallCount).To(Equal(1))
+		Expect(bridgeAdd.CallCount).To(Equal(0))
+	})
+
+	It("rejects unknown plugin names", func() {
+		env["CNI_PLUGIN_NAME"] = "ipvlan"
+		Expect(run()).To(Equal(&types.Error{
+			Code:    types.ErrInvalidEnvironmentVariables,
+			Msg:     `unknown plugin "ipvlan"`,
+			Details: "this binary provides: bridge, macvlan",
+		}))
+		Expect(macvlanAdd.CallCount).To(Equal(0))
+		Expect(bridgeAdd.CallCount).To(Equal(0))
+	})
+})
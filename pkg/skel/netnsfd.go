@@ -0,0 +1,56 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/containernetworking/cni/pkg/types"
+)
+
+// netnsFDVar names the optional variable holding the number of a file
+// descriptor, inherited from the runtime, that refers to the container's
+// network namespace. Unlike CNI_NETNS it stays valid even if the
+// namespace's bind mount is removed while the plugin runs.
+const netnsFDVar = "CNI_NETNS_FD"
+
+// openNetnsFD validates the descriptor named by CNI_NETNS_FD and returns
+// it as a file, or nil if the variable is not set
+func openNetnsFD(value string) (*os.File, *types.Error) {
+	if value == "" {
+		return nil, nil
+	}
+	fd, err := strconv.Atoi(value)
+	if err != nil || fd < 0 {
+		return nil, types.NewError(types.ErrInvalidEnvironmentVariables, fmt.Sprintf("invalid %s: %q is not a file descriptor", netnsFDVar, value), "")
+	}
+	if err := checkNetnsFD(fd); err != nil {
+		return nil, types.NewError(types.ErrInvalidEnvironmentVariables, fmt.Sprintf("invalid %s: %v", netnsFDVar, err), "")
+	}
+	return os.NewFile(uintptr(fd), "netns"), nil
+}
+
+// NetnsPath returns a path to the container's network namespace. When
+// the runtime passed the namespace as CNI_NETNS_FD, the path refers to
+// that descriptor so that the namespace cannot be swapped or deleted
+// under the plugin; otherwise it is Netns.
+func (args *CmdArgs) NetnsPath() string {
+	if args.NetnsFile != nil {
+		return fmt.Sprintf("/proc/self/fd/%d", args.NetnsFile.Fd())
+	}
+	return args.Netns
+}
@@ -0,0 +1,36 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// checkNetnsFD checks that fd is open and refers to a network namespace
+func checkNetnsFD(fd int) error {
+	target, err := os.Readlink(fmt.Sprintf("/proc/self/fd/%d", fd))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("file descriptor %d is not open", fd)
+		}
+		return err
+	}
+	if !strings.HasPrefix(target, "net:[") {
+		return fmt.Errorf("file descriptor %d refers to %s, not a network namespace", fd, target)
+	}
+	return nil
+}
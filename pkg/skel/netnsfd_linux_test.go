@@ -0,0 +1,110 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/cni/pkg/version"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("network namespace file descriptors", func() {
+	var (
+		netnsFD     int
+		environment map[string]string
+		cmdAdd      *fakeCmd
+		dispatch    *dispatcher
+	)
+
+	BeforeEach(func() {
+		f, err := os.Open("/proc/self/ns/net")
+		Expect(err).NotTo(HaveOccurred())
+		defer f.Close()
+		// The dispatcher wraps the descriptor in a file of its own, which
+		// closes it when collected
+		netnsFD, err = syscall.Dup(int(f.Fd()))
+		Expect(err).NotTo(HaveOccurred())
+
+		environment = map[string]string{
+			"CNI_COMMAND":     "ADD",
+			"CNI_CONTAINERID": "some-container-id",
+			"CNI_IFNAME":      "eth0",
+			"CNI_PATH":        "/some/cni/path",
+			"CNI_NETNS_FD":    strconv.Itoa(netnsFD),
+		}
+		cmdAdd = &fakeCmd{}
+		dispatch = &dispatcher{
+			Getenv: func(key string) string { return environment[key] },
+			Stdin:  strings.NewReader(`{"name": "skel-test", "type": "test", "cniVersion": "1.0.0"}`),
+			Stdout: &bytes.Buffer{},
+			Stderr: &bytes.Buffer{},
+		}
+	})
+
+	It("attaches the namespace to CmdArgs and prefers it over CNI_NETNS", func() {
+		environment["CNI_NETNS"] = "/some/netns/path"
+		err := dispatch.pluginMain(cmdAdd.Func, nil, nil, version.PluginSupports("1.0.0"), "")
+		Expect(err).NotTo(HaveOccurred())
+
+		args := cmdAdd.Received.CmdArgs
+		Expect(args.Netns).To(Equal("/some/netns/path"))
+		Expect(args.NetnsFile).NotTo(BeNil())
+		Expect(args.NetnsFile.Fd()).To(Equal(uintptr(netnsFD)))
+		Expect(args.NetnsPath()).To(Equal(fmt.Sprintf("/proc/self/fd/%d", netnsFD)))
+	})
+
+	It("does not require CNI_NETNS", func() {
+		err := dispatch.pluginMain(cmdAdd.Func, nil, nil, version.PluginSupports("1.0.0"), "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cmdAdd.CallCount).To(Equal(1))
+	})
+
+	It("rejects a value that is not a file descriptor", func() {
+		syscall.Close(netnsFD)
+		environment["CNI_NETNS_FD"] = "three"
+		err := dispatch.pluginMain(cmdAdd.Func, nil, nil, version.PluginSupports("1.0.0"), "")
+		Expect(err).To(Equal(types.NewError(types.ErrInvalidEnvironmentVariables, `invalid CNI_NETNS_FD: "three" is not a file descriptor`, "")))
+		Expect(cmdAdd.CallCount).To(Equal(0))
+	})
+
+	It("rejects a descriptor that does not refer to a network namespace", func() {
+		f, err := ioutil.TempFile("", "not-a-netns")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.Remove(f.Name())
+		defer f.Close()
+
+		syscall.Close(netnsFD)
+		environment["CNI_NETNS_FD"] = strconv.Itoa(int(f.Fd()))
+		e := dispatch.pluginMain(cmdAdd.Func, nil, nil, version.PluginSupports("1.0.0"), "")
+		Expect(e.Code).To(Equal(types.ErrInvalidEnvironmentVariables))
+		Expect(e.Msg).To(ContainSubstring("not a network namespace"))
+	})
+
+	It("returns Netns as the path when no descriptor was passed", func() {
+		syscall.Close(netnsFD)
+		args := &CmdArgs{Netns: "/some/netns/path"}
+		Expect(args.NetnsPath()).To(Equal("/some/netns/path"))
+	})
+})
@@ -0,0 +1,63 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+
+	"github.com/containernetworking/cni/pkg/types"
+)
+
+// osErrorCodes maps errors from the operating system, which callbacks
+// often return wrapped, to the well-known code that tells the runtime
+// best whether to retry. The first match wins.
+var osErrorCodes = []struct {
+	err  error
+	code uint
+}{
+	{context.DeadlineExceeded, types.ErrTimeout},
+	{syscall.ETIMEDOUT, types.ErrTimeout},
+	{context.Canceled, types.ErrTryAgainLater},
+	{syscall.EAGAIN, types.ErrTryAgainLater},
+	{syscall.EBUSY, types.ErrTryAgainLater},
+	{syscall.EINTR, types.ErrTryAgainLater},
+	{syscall.ENOBUFS, types.ErrTryAgainLater},
+	{os.ErrPermission, types.ErrIOFailure},
+	{syscall.EIO, types.ErrIOFailure},
+	{syscall.ENOSPC, types.ErrIOFailure},
+	{syscall.EROFS, types.ErrIOFailure},
+	// A device the configuration names, such as a master interface, is
+	// missing
+	{syscall.ENODEV, types.ErrInvalidNetworkConfig},
+}
+
+// typedError returns the error a callback returned as a *types.Error. A
+// *types.Error is returned unchanged, errors from the operating system
+// get the code osErrorCodes maps them to, and others types.ErrInternal.
+func typedError(err error) *types.Error {
+	if e, ok := err.(*types.Error); ok {
+		// don't wrap Error in Error
+		return e
+	}
+	for _, m := range osErrorCodes {
+		if errors.Is(err, m.err) {
+			return types.NewError(m.code, err.Error(), "")
+		}
+	}
+	return types.NewError(types.ErrInternal, err.Error(), "")
+}
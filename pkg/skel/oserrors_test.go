@@ -0,0 +1,78 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/cni/pkg/version"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("mapping errors to codes", func() {
+	DescribeTable("typedError",
+		func(err error, code uint) {
+			typed := typedError(err)
+			Expect(typed.Code).To(Equal(code))
+			Expect(typed.Msg).To(Equal(err.Error()))
+		},
+		Entry("deadline", fmt.Errorf("waiting for DHCP lease: %w", context.DeadlineExceeded), types.ErrTimeout),
+		Entry("cancellation", context.Canceled, types.ErrTryAgainLater),
+		Entry("busy", &os.SyscallError{Syscall: "ioctl", Err: syscall.EBUSY}, types.ErrTryAgainLater),
+		Entry("permission", &os.PathError{Op: "open", Path: "/run/netns/x", Err: syscall.EACCES}, types.ErrIOFailure),
+		Entry("operation not permitted", fmt.Errorf("failed to create bridge: %w", syscall.EPERM), types.ErrIOFailure),
+		Entry("missing device", fmt.Errorf("failed to find master: %w", syscall.ENODEV), types.ErrInvalidNetworkConfig),
+		Entry("other errors", errors.New("something broke"), types.ErrInternal),
+	)
+
+	It("returns errors that already have a code unchanged", func() {
+		err := types.NewError(types.ErrUnknownContainer, "gone", "")
+		Expect(typedError(err)).To(BeIdenticalTo(err))
+	})
+
+	It("maps the errors callbacks return", func() {
+		dispatch := &dispatcher{
+			Getenv: func(key string) string {
+				return map[string]string{
+					"CNI_COMMAND":     "ADD",
+					"CNI_CONTAINERID": "some-container-id",
+					"CNI_NETNS":       "/some/netns/path",
+					"CNI_IFNAME":      "eth0",
+					"CNI_PATH":        "/some/cni/path",
+				}[key]
+			},
+			Stdin:  strings.NewReader(`{ "name":"skel-test", "type": "test", "cniVersion": "1.0.0" }`),
+			Stdout: &bytes.Buffer{},
+			Stderr: &bytes.Buffer{},
+		}
+		cmdAdd := func(*CmdArgs) error {
+			return fmt.Errorf("failed to set up veth: %w", syscall.EAGAIN)
+		}
+		err := dispatch.pluginMain(cmdAdd, nil, nil, version.PluginSupports("1.0.0"), "")
+		Expect(err).NotTo(BeNil())
+		Expect(err.Code).To(Equal(types.ErrTryAgainLater))
+		Expect(ExitCode(err)).NotTo(BeZero())
+	})
+})
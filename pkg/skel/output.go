@@ -0,0 +1,180 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/containernetworking/cni/pkg/types"
+)
+
+// outputVar names the optional variable holding the absolute path of a
+// file the runtime wants the result written to, in addition to stdout.
+// It helps wrapper scripts and runtimes that lose stdout through layers
+// of indirection.
+const outputVar = "CNI_OUTPUT"
+
+// outputModeVar names the optional variable choosing how CNI_OUTPUT is
+// used. By default, or when set to outputModeCopy, the result is written
+// to the file and to stdout, and errors only to stdout. When set to
+// outputModeExclusive, the result and errors are written to the file
+// instead of stdout, for exec environments where stdout is shared with
+// other processes or captured unreliably.
+const outputModeVar = "CNI_OUTPUT_MODE"
+
+const (
+	outputModeCopy      = "copy"
+	outputModeExclusive = "exclusive"
+)
+
+// outputCapture collects what a command prints, both through the
+// dispatcher's Stdout and os.Stdout, where types.PrintResult writes
+type outputCapture struct {
+	buf         bytes.Buffer
+	w           *os.File
+	copied      chan error
+	savedStdout *os.File
+	savedWriter io.Writer
+	stopped     bool
+}
+
+func validateOutputPath(path string) *types.Error {
+	if !filepath.IsAbs(path) {
+		return types.NewError(types.ErrInvalidEnvironmentVariables, fmt.Sprintf("invalid %s: %q is not an absolute path", outputVar, path), "")
+	}
+	return nil
+}
+
+// outputExclusive reports whether CNI_OUTPUT_MODE asks for output to be
+// written to CNI_OUTPUT instead of stdout
+func outputExclusive(mode string) (bool, *types.Error) {
+	switch mode {
+	case "", outputModeCopy:
+		return false, nil
+	case outputModeExclusive:
+		return true, nil
+	}
+	return false, types.NewError(types.ErrInvalidEnvironmentVariables, fmt.Sprintf("invalid %s: %q is neither %q nor %q", outputModeVar, mode, outputModeCopy, outputModeExclusive), "")
+}
+
+// captureOutput redirects the command's output until stop is called
+func (t *dispatcher) captureOutput() (*outputCapture, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	c := &outputCapture{
+		w:           w,
+		copied:      make(chan error, 1),
+		savedStdout: os.Stdout,
+		savedWriter: t.Stdout,
+	}
+	go func() {
+		_, err := io.Copy(&c.buf, r)
+		r.Close()
+		c.copied <- err
+	}()
+	os.Stdout = w
+	t.Stdout = w
+	return c, nil
+}
+
+// stop restores the output streams and returns what the command printed
+func (c *outputCapture) stop(t *dispatcher) ([]byte, error) {
+	if c.stopped {
+		return c.buf.Bytes(), nil
+	}
+	c.stopped = true
+	os.Stdout = c.savedStdout
+	t.Stdout = c.savedWriter
+	c.w.Close()
+	if err := <-c.copied; err != nil {
+		return nil, err
+	}
+	return c.buf.Bytes(), nil
+}
+
+// deliverOutput writes what a successful command printed to path, then,
+// unless exclusive is set, to stdout. The output is only printed once the
+// file is written, so that the runtime never receives a result that was
+// not also delivered to the file; a failure to write it fails the command
+// instead. With exclusive set, what a failed command printed is dropped;
+// the error is written to path by printError instead.
+func (t *dispatcher) deliverOutput(c *outputCapture, path string, exclusive bool, cmdErr error) error {
+	data, err := c.stop(t)
+	if err != nil {
+		return types.NewError(types.ErrIOFailure, fmt.Sprintf("failed to capture output: %v", err), "")
+	}
+	if cmdErr == nil && len(data) > 0 {
+		if err := writeFileAtomic(path, data); err != nil {
+			return types.NewError(types.ErrIOFailure, fmt.Sprintf("failed to write result to %s: %v", outputVar, err), "")
+		}
+	}
+	if exclusive {
+		return cmdErr
+	}
+	if _, err := t.Stdout.Write(data); err != nil && cmdErr == nil {
+		return types.NewError(types.ErrIOFailure, fmt.Sprintf("failed to print result: %v", err), "")
+	}
+	return cmdErr
+}
+
+// printError prints e as JSON to stdout, or, when CNI_OUTPUT_MODE is
+// exclusive, to the file named by CNI_OUTPUT. It falls back to stdout when
+// the file cannot be written, so that the runtime still learns why the
+// plugin failed.
+func printError(e *types.Error, getenv func(string) string, stdout io.Writer) error {
+	data, err := json.MarshalIndent(e, "", "    ")
+	if err != nil {
+		return err
+	}
+	path := getenv(outputVar)
+	if exclusive, _ := outputExclusive(getenv(outputModeVar)); exclusive && path != "" && validateOutputPath(path) == nil {
+		if err := writeFileAtomic(path, data); err == nil {
+			return nil
+		}
+	}
+	_, err = stdout.Write(data)
+	return err
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames
+// it, so that readers never see a partial result
+func writeFileAtomic(path string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+	}
+	return err
+}
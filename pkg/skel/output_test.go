@@ -0,0 +1,193 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/containernetworking/cni/pkg/types"
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/cni/pkg/version"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("writing results to CNI_OUTPUT", func() {
+	var (
+		dir         string
+		outputPath  string
+		environment map[string]string
+		stdout      *bytes.Buffer
+		dispatch    *dispatcher
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "cni-output")
+		Expect(err).NotTo(HaveOccurred())
+		outputPath = filepath.Join(dir, "result.json")
+
+		environment = map[string]string{
+			"CNI_COMMAND":     "ADD",
+			"CNI_CONTAINERID": "some-container-id",
+			"CNI_NETNS":       "/some/netns/path",
+			"CNI_IFNAME":      "eth0",
+			"CNI_PATH":        "/some/cni/path",
+			"CNI_OUTPUT":      outputPath,
+		}
+		stdout = &bytes.Buffer{}
+		dispatch = &dispatcher{
+			Getenv: func(key string) string { return environment[key] },
+			Stdin:  strings.NewReader(`{"name": "skel-test", "type": "test", "cniVersion": "1.0.0"}`),
+			Stdout: stdout,
+			Stderr: &bytes.Buffer{},
+		}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	It("writes a result printed with types.PrintResult to the file and stdout", func() {
+		savedStdout := os.Stdout
+		cmdAdd := func(*CmdArgs) error {
+			return types.PrintResult(&current.Result{CNIVersion: "1.0.0"}, "1.0.0")
+		}
+		err := dispatch.pluginMain(cmdAdd, nil, nil, version.PluginSupports("1.0.0"), "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.Stdout).To(BeIdenticalTo(savedStdout))
+
+		written, e := ioutil.ReadFile(outputPath)
+		Expect(e).NotTo(HaveOccurred())
+		Expect(written).To(MatchJSON(`{"cniVersion": "1.0.0", "dns": {}}`))
+		Expect(stdout.Bytes()).To(Equal(written))
+
+		files, e := ioutil.ReadDir(dir)
+		Expect(e).NotTo(HaveOccurred())
+		Expect(files).To(HaveLen(1))
+	})
+
+	It("writes results returned by AddResult", func() {
+		dispatch.addResult = func(*CmdArgs) (types.Result, error) {
+			return &current.Result{CNIVersion: "1.0.0"}, nil
+		}
+		err := dispatch.pluginMain(nil, nil, nil, version.PluginSupports("1.0.0"), "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ioutil.ReadFile(outputPath)).To(MatchJSON(`{"cniVersion": "1.0.0", "dns": {}}`))
+	})
+
+	It("does not write the file when the command fails", func() {
+		cmdAdd := func(*CmdArgs) error { return errors.New("boom") }
+		err := dispatch.pluginMain(cmdAdd, nil, nil, version.PluginSupports("1.0.0"), "")
+		Expect(err).To(HaveOccurred())
+		Expect(outputPath).NotTo(BeAnExistingFile())
+	})
+
+	It("fails without printing the result when the file cannot be written", func() {
+		environment["CNI_OUTPUT"] = filepath.Join(dir, "missing", "result.json")
+		cmdAdd := func(*CmdArgs) error {
+			return types.PrintResult(&current.Result{CNIVersion: "1.0.0"}, "1.0.0")
+		}
+		err := dispatch.pluginMain(cmdAdd, nil, nil, version.PluginSupports("1.0.0"), "")
+		Expect(err.Code).To(Equal(types.ErrIOFailure))
+		Expect(stdout.String()).To(BeEmpty())
+	})
+
+	It("rejects a relative path", func() {
+		environment["CNI_OUTPUT"] = "result.json"
+		err := dispatch.pluginMain(func(*CmdArgs) error { return nil }, nil, nil, version.PluginSupports("1.0.0"), "")
+		Expect(err).To(Equal(types.NewError(types.ErrInvalidEnvironmentVariables, `invalid CNI_OUTPUT: "result.json" is not an absolute path`, "")))
+	})
+
+	It("rejects an unknown CNI_OUTPUT_MODE", func() {
+		environment["CNI_OUTPUT_MODE"] = "tee"
+		err := dispatch.pluginMain(func(*CmdArgs) error { return nil }, nil, nil, version.PluginSupports("1.0.0"), "")
+		Expect(err).To(Equal(types.NewError(types.ErrInvalidEnvironmentVariables, `invalid CNI_OUTPUT_MODE: "tee" is neither "copy" nor "exclusive"`, "")))
+	})
+
+	It("prints errors to stdout only", func() {
+		typedErr := types.NewError(types.ErrTryAgainLater, "busy", "")
+		Expect(printError(typedErr, dispatch.Getenv, stdout)).To(Succeed())
+		Expect(stdout.String()).To(MatchJSON(`{"code": 11, "msg": "busy"}`))
+		Expect(outputPath).NotTo(BeAnExistingFile())
+	})
+
+	Describe("when CNI_OUTPUT_MODE is exclusive", func() {
+		BeforeEach(func() {
+			environment["CNI_OUTPUT_MODE"] = "exclusive"
+		})
+
+		It("writes the result to the file instead of stdout", func() {
+			cmdAdd := func(*CmdArgs) error {
+				return types.PrintResult(&current.Result{CNIVersion: "1.0.0"}, "1.0.0")
+			}
+			err := dispatch.pluginMain(cmdAdd, nil, nil, version.PluginSupports("1.0.0"), "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ioutil.ReadFile(outputPath)).To(MatchJSON(`{"cniVersion": "1.0.0", "dns": {}}`))
+			Expect(stdout.String()).To(BeEmpty())
+		})
+
+		It("drops what a failed command printed", func() {
+			cmdAdd := func(*CmdArgs) error {
+				_ = types.PrintResult(&current.Result{CNIVersion: "1.0.0"}, "1.0.0")
+				return errors.New("boom")
+			}
+			err := dispatch.pluginMain(cmdAdd, nil, nil, version.PluginSupports("1.0.0"), "")
+			Expect(err).To(HaveOccurred())
+			Expect(stdout.String()).To(BeEmpty())
+			Expect(outputPath).NotTo(BeAnExistingFile())
+		})
+	})
+
+	Describe("printing errors when CNI_OUTPUT_MODE is exclusive", func() {
+		var typedErr *types.Error
+
+		BeforeEach(func() {
+			environment["CNI_OUTPUT_MODE"] = "exclusive"
+			typedErr = types.NewError(types.ErrTryAgainLater, "busy", "")
+		})
+
+		It("writes the error JSON to the file instead of stdout", func() {
+			Expect(printError(typedErr, dispatch.Getenv, stdout)).To(Succeed())
+			Expect(stdout.String()).To(BeEmpty())
+			Expect(ioutil.ReadFile(outputPath)).To(MatchJSON(`{"code": 11, "msg": "busy"}`))
+		})
+
+		It("prints the error JSON to stdout without CNI_OUTPUT", func() {
+			delete(environment, "CNI_OUTPUT")
+			Expect(printError(typedErr, dispatch.Getenv, stdout)).To(Succeed())
+			Expect(stdout.String()).To(MatchJSON(`{"code": 11, "msg": "busy"}`))
+			Expect(outputPath).NotTo(BeAnExistingFile())
+		})
+
+		It("falls back to stdout when the file cannot be written", func() {
+			environment["CNI_OUTPUT"] = filepath.Join(dir, "missing", "result.json")
+			Expect(printError(typedErr, dispatch.Getenv, stdout)).To(Succeed())
+			Expect(stdout.String()).To(MatchJSON(`{"code": 11, "msg": "busy"}`))
+		})
+
+		It("prints to stdout when CNI_OUTPUT is not an absolute path", func() {
+			environment["CNI_OUTPUT"] = "result.json"
+			Expect(printError(typedErr, dispatch.Getenv, stdout)).To(Succeed())
+			Expect(stdout.String()).To(MatchJSON(`{"code": 11, "msg": "busy"}`))
+		})
+	})
+})
@@ -0,0 +1,69 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/cni/pkg/version"
+)
+
+// Plugin is implemented by plugins that keep their callbacks as methods,
+// so that they can carry state, such as clients or configuration, and be
+// tested as ordinary values. Plugins that also implement GCPlugin or
+// StatusPlugin handle those commands too.
+type Plugin interface {
+	Add(*CmdArgs) error
+	Check(*CmdArgs) error
+	Del(*CmdArgs) error
+}
+
+// GCPlugin is implemented by plugins that handle the GC command
+type GCPlugin interface {
+	GC(*CmdArgs) error
+}
+
+// StatusPlugin is implemented by plugins that handle the STATUS command
+type StatusPlugin interface {
+	Status(*CmdArgs) error
+}
+
+// RunWithError is like PluginMainWithError, but calls the methods of p.
+func RunWithError(p Plugin, versionInfo version.PluginInfo, about string, opts ...Option) *types.Error {
+	return PluginMainFuncsWithError(pluginFuncs(p), versionInfo, about, append(pluginOptions(p), opts...)...)
+}
+
+// Run is like PluginMain, but calls the methods of p.
+func Run(p Plugin, versionInfo version.PluginInfo, about string, opts ...Option) {
+	PluginMainFuncs(pluginFuncs(p), versionInfo, about, append(pluginOptions(p), opts...)...)
+}
+
+// pluginFuncs returns the callbacks for the commands p handles
+func pluginFuncs(p Plugin) CmdFuncs {
+	funcs := CmdFuncs{Add: p.Add, Check: p.Check, Del: p.Del}
+	if s, ok := p.(StatusPlugin); ok {
+		funcs.Status = s.Status
+	}
+	return funcs
+}
+
+// pluginOptions returns the options that register the commands p handles
+// that CmdFuncs has no field for
+func pluginOptions(p Plugin) []Option {
+	var opts []Option
+	if gc, ok := p.(GCPlugin); ok {
+		opts = append(opts, WithCommand("GC", gc.GC))
+	}
+	return opts
+}
@@ -0,0 +1,93 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"bytes"
+	"context"
+	"strings"
+
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/cni/pkg/version"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// statefulPlugin records the commands it handles
+type statefulPlugin struct {
+	handled []string
+}
+
+func (p *statefulPlugin) Add(*CmdArgs) error   { p.handled = append(p.handled, "ADD"); return nil }
+func (p *statefulPlugin) Check(*CmdArgs) error { p.handled = append(p.handled, "CHECK"); return nil }
+func (p *statefulPlugin) Del(*CmdArgs) error   { p.handled = append(p.handled, "DEL"); return nil }
+
+// fullPlugin also handles GC and STATUS
+type fullPlugin struct {
+	statefulPlugin
+}
+
+func (p *fullPlugin) GC(*CmdArgs) error     { p.handled = append(p.handled, "GC"); return nil }
+func (p *fullPlugin) Status(*CmdArgs) error { p.handled = append(p.handled, "STATUS"); return nil }
+
+var _ = Describe("Plugin", func() {
+	var environment map[string]string
+
+	run := func(p Plugin, command string) *types.Error {
+		environment["CNI_COMMAND"] = command
+		d := &Dispatcher{
+			Getenv:  func(key string) string { return environment[key] },
+			Stdin:   strings.NewReader(`{"name": "skel-test", "type": "test", "cniVersion": "1.1.0"}`),
+			Stdout:  &bytes.Buffer{},
+			Stderr:  &bytes.Buffer{},
+			Options: pluginOptions(p),
+		}
+		return d.Run(context.TODO(), pluginFuncs(p), version.PluginSupports("1.1.0"), "")
+	}
+
+	BeforeEach(func() {
+		environment = map[string]string{
+			"CNI_CONTAINERID": "some-container-id",
+			"CNI_NETNS":       "/some/netns/path",
+			"CNI_IFNAME":      "eth0",
+			"CNI_PATH":        "/some/cni/path",
+		}
+	})
+
+	It("dispatches the standard commands to the plugin's methods", func() {
+		p := &statefulPlugin{}
+		for _, command := range []string{"ADD", "CHECK", "DEL"} {
+			Expect(run(p, command)).To(BeNil())
+		}
+		Expect(p.handled).To(Equal([]string{"ADD", "CHECK", "DEL"}))
+	})
+
+	It("dispatches GC and STATUS to plugins that implement them", func() {
+		p := &fullPlugin{}
+		Expect(run(p, "GC")).To(BeNil())
+		Expect(run(p, "STATUS")).To(BeNil())
+		Expect(p.handled).To(Equal([]string{"GC", "STATUS"}))
+	})
+
+	It("rejects GC and STATUS for plugins that do not implement them", func() {
+		p := &statefulPlugin{}
+		err := run(p, "GC")
+		Expect(err).NotTo(BeNil())
+		Expect(err.Code).To(Equal(uint(types.ErrInvalidEnvironmentVariables)))
+		Expect(run(p, "STATUS")).NotTo(BeNil())
+		Expect(p.handled).To(BeEmpty())
+	})
+})
@@ -0,0 +1,99 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/containernetworking/cni/pkg/types"
+)
+
+// readinessDialTimeout bounds how long a socket readiness check waits for
+// the daemon to accept a connection
+const readinessDialTimeout = 2 * time.Second
+
+// ReadinessCheck is a dependency the plugin needs to service ADD. Set one
+// of its fields.
+type ReadinessCheck struct {
+	// File must exist, such as a configuration file written by a node
+	// agent
+	File string
+	// Socket is a unix socket a daemon must accept connections on
+	Socket string
+	// KernelModule must be loaded or built into the kernel. It is only
+	// checked on Linux.
+	KernelModule string
+}
+
+// WithReadiness declares the dependencies the plugin needs to service
+// ADD, so that STATUS reports whether they are met without the plugin
+// implementing it. STATUS fails with types.ErrPluginNotAvailable, naming
+// every check that failed, and otherwise calls the callback registered
+// with WithStatus, if any.
+func WithReadiness(checks ...ReadinessCheck) Option {
+	return func(t *dispatcher) {
+		t.readiness = append(t.readiness, checks...)
+	}
+}
+
+// statusFunc returns the callback for STATUS, or nil if the plugin does
+// not implement it
+func (t *dispatcher) statusFunc() func(context.Context, *CmdArgs) error {
+	if len(t.readiness) == 0 {
+		return t.cmdStatus
+	}
+	return func(ctx context.Context, args *CmdArgs) error {
+		if err := checkReadiness(ctx, t.readiness, host); err != nil {
+			return err
+		}
+		if t.cmdStatus != nil {
+			return t.cmdStatus(ctx, args)
+		}
+		return nil
+	}
+}
+
+// checkReadiness returns an error listing the checks that fail
+func checkReadiness(ctx context.Context, checks []ReadinessCheck, probe hostProbe) *types.Error {
+	var failed []string
+	for _, check := range checks {
+		switch {
+		case check.File != "":
+			if _, err := os.Stat(check.File); err != nil {
+				failed = append(failed, fmt.Sprintf("file %s: %v", check.File, err))
+			}
+		case check.Socket != "":
+			conn, err := (&net.Dialer{Timeout: readinessDialTimeout}).DialContext(ctx, "unix", check.Socket)
+			if err != nil {
+				failed = append(failed, fmt.Sprintf("socket %s: %v", check.Socket, err))
+				continue
+			}
+			_ = conn.Close()
+		case check.KernelModule != "":
+			if !probe.moduleLoaded(check.KernelModule) {
+				failed = append(failed, fmt.Sprintf("kernel module %s is not loaded", check.KernelModule))
+			}
+		}
+	}
+	if len(failed) > 0 {
+		return types.NewError(types.ErrPluginNotAvailable, "plugin is not ready", strings.Join(failed, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/cni/pkg/version"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("readiness checks", func() {
+	statusVersions := version.PluginSupports("1.0.0", "1.1.0")
+
+	var (
+		dir      string
+		dispatch *dispatcher
+		cmdAdd   *fakeCmd
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "skel-readiness")
+		Expect(err).NotTo(HaveOccurred())
+		dispatch = &dispatcher{
+			Getenv: func(key string) string { return map[string]string{"CNI_COMMAND": "STATUS"}[key] },
+			Stdin:  strings.NewReader(`{"name": "skel-test", "type": "test", "cniVersion": "1.1.0"}`),
+			Stdout: &bytes.Buffer{},
+			Stderr: &bytes.Buffer{},
+		}
+		cmdAdd = &fakeCmd{}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	It("implements STATUS from the declared checks", func() {
+		file := filepath.Join(dir, "ready")
+		Expect(ioutil.WriteFile(file, nil, 0600)).To(Succeed())
+		listener, err := net.Listen("unix", filepath.Join(dir, "daemon.sock"))
+		Expect(err).NotTo(HaveOccurred())
+		defer listener.Close()
+
+		WithReadiness(ReadinessCheck{File: file}, ReadinessCheck{Socket: filepath.Join(dir, "daemon.sock")})(dispatch)
+		Expect(dispatch.pluginMain(cmdAdd.Func, nil, nil, statusVersions, "")).To(BeNil())
+	})
+
+	It("fails STATUS naming every unmet dependency", func() {
+		WithReadiness(ReadinessCheck{File: filepath.Join(dir, "ready")}, ReadinessCheck{Socket: filepath.Join(dir, "daemon.sock")})(dispatch)
+		err := dispatch.pluginMain(cmdAdd.Func, nil, nil, statusVersions, "")
+		Expect(err).NotTo(BeNil())
+		Expect(err.Code).To(Equal(types.ErrPluginNotAvailable))
+		Expect(err.Msg).To(Equal("plugin is not ready"))
+		Expect(err.Details).To(ContainSubstring("file " + filepath.Join(dir, "ready")))
+		Expect(err.Details).To(ContainSubstring("; socket " + filepath.Join(dir, "daemon.sock")))
+	})
+
+	It("calls the STATUS callback once the checks pass", func() {
+		cmdStatus := &fakeCmd{}
+		WithStatus(cmdStatus.Func)(dispatch)
+		WithReadiness(ReadinessCheck{File: dir})(dispatch)
+		Expect(dispatch.pluginMain(cmdAdd.Func, nil, nil, statusVersions, "")).To(BeNil())
+		Expect(cmdStatus.CallCount).To(Equal(1))
+
+		dispatch.Stdin = strings.NewReader(`{"name": "skel-test", "type": "test", "cniVersion": "1.1.0"}`)
+		WithReadiness(ReadinessCheck{File: filepath.Join(dir, "missing")})(dispatch)
+		Expect(dispatch.pluginMain(cmdAdd.Func, nil, nil, statusVersions, "")).NotTo(BeNil())
+		Expect(cmdStatus.CallCount).To(Equal(1))
+	})
+
+	It("checks kernel modules with the host probe", func() {
+		probe := hostProbe{moduleLoaded: func(module string) bool { return module == "bridge" }}
+		Expect(checkReadiness(context.TODO(), []ReadinessCheck{{KernelModule: "bridge"}}, probe)).To(BeNil())
+		err := checkReadiness(context.TODO(), []ReadinessCheck{{KernelModule: "vxlan"}}, probe)
+		Expect(err.Details).To(Equal("kernel module vxlan is not loaded"))
+	})
+})
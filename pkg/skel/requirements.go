@@ -0,0 +1,125 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/cni/pkg/version"
+)
+
+// linuxCapabilities maps capability names to their bit in the
+// capability sets of /proc/<pid>/status
+var linuxCapabilities = map[string]uint{
+	"CAP_CHOWN":              0,
+	"CAP_DAC_OVERRIDE":       1,
+	"CAP_DAC_READ_SEARCH":    2,
+	"CAP_FOWNER":             3,
+	"CAP_FSETID":             4,
+	"CAP_KILL":               5,
+	"CAP_SETGID":             6,
+	"CAP_SETUID":             7,
+	"CAP_SETPCAP":            8,
+	"CAP_LINUX_IMMUTABLE":    9,
+	"CAP_NET_BIND_SERVICE":   10,
+	"CAP_NET_BROADCAST":      11,
+	"CAP_NET_ADMIN":          12,
+	"CAP_NET_RAW":            13,
+	"CAP_IPC_LOCK":           14,
+	"CAP_IPC_OWNER":          15,
+	"CAP_SYS_MODULE":         16,
+	"CAP_SYS_RAWIO":          17,
+	"CAP_SYS_CHROOT":         18,
+	"CAP_SYS_PTRACE":         19,
+	"CAP_SYS_PACCT":          20,
+	"CAP_SYS_ADMIN":          21,
+	"CAP_SYS_BOOT":           22,
+	"CAP_SYS_NICE":           23,
+	"CAP_SYS_RESOURCE":       24,
+	"CAP_SYS_TIME":           25,
+	"CAP_SYS_TTY_CONFIG":     26,
+	"CAP_MKNOD":              27,
+	"CAP_LEASE":              28,
+	"CAP_AUDIT_WRITE":        29,
+	"CAP_AUDIT_CONTROL":      30,
+	"CAP_SETFCAP":            31,
+	"CAP_MAC_OVERRIDE":       32,
+	"CAP_MAC_ADMIN":          33,
+	"CAP_SYSLOG":             34,
+	"CAP_WAKE_ALARM":         35,
+	"CAP_BLOCK_SUSPEND":      36,
+	"CAP_AUDIT_READ":         37,
+	"CAP_PERFMON":            38,
+	"CAP_BPF":                39,
+	"CAP_CHECKPOINT_RESTORE": 40,
+}
+
+// hostProbe reports what the host provides to the plugin
+type hostProbe struct {
+	// effectiveCapabilities returns the effective capability set of the
+	// process
+	effectiveCapabilities func() (uint64, error)
+	// moduleLoaded returns true if the kernel module is loaded or built in
+	moduleLoaded func(string) bool
+}
+
+// WithRequirements declares the Linux capabilities and kernel modules the
+// plugin needs for ADD. VERSION reports them, so that runtimes and
+// installers can read them with version.PluginRequirements, and ADD fails
+// with a types.ErrInternal error naming everything that is missing before
+// the callback runs, instead of the plugin failing deep inside a netlink
+// call. Requirements are only checked on Linux.
+func WithRequirements(requirements version.Requirements) Option {
+	return func(t *dispatcher) {
+		t.requirements = &requirements
+	}
+}
+
+// checkRequirements returns an error listing the requirements the host
+// does not meet
+func checkRequirements(requirements *version.Requirements, probe hostProbe) *types.Error {
+	if requirements == nil {
+		return nil
+	}
+
+	var missing []string
+	if len(requirements.LinuxCapabilities) > 0 {
+		effective, err := probe.effectiveCapabilities()
+		if err != nil {
+			return types.NewError(types.ErrInternal, "failed to read process capabilities", err.Error())
+		}
+		for _, name := range requirements.LinuxCapabilities {
+			bit, ok := linuxCapabilities[strings.ToUpper(name)]
+			if !ok {
+				return types.NewError(types.ErrInternal, fmt.Sprintf("unknown Linux capability %q", name), "")
+			}
+			if effective&(1<<bit) == 0 {
+				missing = append(missing, "capability "+strings.ToUpper(name))
+			}
+		}
+	}
+	for _, module := range requirements.KernelModules {
+		if !probe.moduleLoaded(module) {
+			missing = append(missing, "kernel module "+module)
+		}
+	}
+
+	if len(missing) > 0 {
+		return types.NewError(types.ErrInternal, "missing "+strings.Join(missing, ", "), "grant the plugin the capabilities and load the kernel modules it requires")
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// host probes the process and kernel through /proc and /sys
+var host = hostProbe{
+	effectiveCapabilities: effectiveCapabilities,
+	moduleLoaded:          moduleLoaded,
+}
+
+// effectiveCapabilities reads CapEff from /proc/self/status
+func effectiveCapabilities() (uint64, error) {
+	f, err := os.Open("/proc/self/status")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, "CapEff:") {
+			return strconv.ParseUint(strings.TrimSpace(strings.TrimPrefix(line, "CapEff:")), 16, 64)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("CapEff not found in /proc/self/status")
+}
+
+// moduleLoaded returns true if the module is loaded, or built into the
+// running kernel
+func moduleLoaded(module string) bool {
+	name := strings.Replace(module, "-", "_", -1)
+	if _, err := os.Stat(filepath.Join("/sys/module", name)); err == nil {
+		return true
+	}
+
+	// Built-in modules without parameters do not appear in /sys/module
+	var uts syscall.Utsname
+	if err := syscall.Uname(&uts); err != nil {
+		return false
+	}
+	release := make([]byte, 0, len(uts.Release))
+	for _, c := range uts.Release {
+		if c == 0 {
+			break
+		}
+		release = append(release, byte(c))
+	}
+	builtin, err := ioutil.ReadFile(filepath.Join("/lib/modules", string(release), "modules.builtin"))
+	if err != nil {
+		return false
+	}
+	for _, line := range bytes.Split(builtin, []byte("\n")) {
+		base := strings.TrimSuffix(filepath.Base(string(line)), ".ko")
+		if strings.Replace(base, "-", "_", -1) == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,122 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"bytes"
+	"errors"
+	"runtime"
+	"strings"
+
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/cni/pkg/version"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("plugin requirements", func() {
+	var (
+		loaded map[string]bool
+		probe  hostProbe
+	)
+
+	BeforeEach(func() {
+		loaded = map[string]bool{"bridge": true}
+		probe = hostProbe{
+			effectiveCapabilities: func() (uint64, error) { return 1 << 12, nil },
+			moduleLoaded:          func(module string) bool { return loaded[module] },
+		}
+	})
+
+	It("succeeds when the host meets every requirement", func() {
+		Expect(checkRequirements(&version.Requirements{
+			LinuxCapabilities: []string{"CAP_NET_ADMIN"},
+			KernelModules:     []string{"bridge"},
+		}, probe)).To(BeNil())
+		Expect(checkRequirements(nil, probe)).To(BeNil())
+	})
+
+	It("names every missing capability and module", func() {
+		err := checkRequirements(&version.Requirements{
+			LinuxCapabilities: []string{"cap_net_admin", "CAP_NET_RAW", "CAP_SYS_ADMIN"},
+			KernelModules:     []string{"bridge", "vxlan"},
+		}, probe)
+		Expect(err).NotTo(BeNil())
+		Expect(err.Code).To(BeEquivalentTo(types.ErrInternal))
+		Expect(err.Msg).To(Equal("missing capability CAP_NET_RAW, capability CAP_SYS_ADMIN, kernel module vxlan"))
+	})
+
+	It("rejects unknown capabilities", func() {
+		err := checkRequirements(&version.Requirements{LinuxCapabilities: []string{"CAP_FLY"}}, probe)
+		Expect(err).NotTo(BeNil())
+		Expect(err.Msg).To(Equal(`unknown Linux capability "CAP_FLY"`))
+	})
+
+	It("reports a failure to read the capabilities", func() {
+		probe.effectiveCapabilities = func() (uint64, error) { return 0, errors.New("no procfs") }
+		err := checkRequirements(&version.Requirements{LinuxCapabilities: []string{"CAP_NET_ADMIN"}}, probe)
+		Expect(err).NotTo(BeNil())
+		Expect(err.Details).To(Equal("no procfs"))
+	})
+
+	Describe("in the dispatcher", func() {
+		var (
+			environment map[string]string
+			stdout      *bytes.Buffer
+			dispatch    *dispatcher
+			cmdAdd      *fakeCmd
+		)
+
+		BeforeEach(func() {
+			environment = map[string]string{
+				"CNI_COMMAND":     "ADD",
+				"CNI_CONTAINERID": "some-container-id",
+				"CNI_NETNS":       "/some/netns/path",
+				"CNI_IFNAME":      "eth0",
+				"CNI_PATH":        "/some/cni/path",
+			}
+			stdout = &bytes.Buffer{}
+			dispatch = &dispatcher{
+				Getenv: func(key string) string { return environment[key] },
+				Stdin:  strings.NewReader(`{ "name":"skel-test", "type": "test", "cniVersion": "1.0.0" }`),
+				Stdout: stdout,
+				Stderr: &bytes.Buffer{},
+			}
+			cmdAdd = &fakeCmd{}
+			WithRequirements(version.Requirements{KernelModules: []string{"no-such-module-for-cni-tests"}})(dispatch)
+		})
+
+		It("advertises the requirements in VERSION", func() {
+			environment["CNI_COMMAND"] = "VERSION"
+			err := dispatch.pluginMain(cmdAdd.Func, nil, nil, version.PluginSupports("1.0.0"), "")
+			Expect(err).NotTo(HaveOccurred())
+
+			info, decodeErr := (&version.PluginDecoder{}).Decode(stdout.Bytes())
+			Expect(decodeErr).NotTo(HaveOccurred())
+			Expect(info.(version.PluginRequirements).Requires().KernelModules).To(Equal([]string{"no-such-module-for-cni-tests"}))
+		})
+
+		It("fails ADD before calling the plugin when a module is missing", func() {
+			if runtime.GOOS != "linux" {
+				Skip("requirements are only checked on Linux")
+			}
+			err := dispatch.pluginMain(cmdAdd.Func, nil, nil, version.PluginSupports("1.0.0"), "")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("missing kernel module no-such-module-for-cni-tests; grant the plugin the capabilities and load the kernel modules it requires"))
+			Expect(cmdAdd.CallCount).To(Equal(0))
+		})
+	})
+})
@@ -18,13 +18,18 @@ package skel
 
 import (
 	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"os"
+	"os/signal"
+	"runtime/debug"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/containernetworking/cni/pkg/types"
 	"github.com/containernetworking/cni/pkg/utils"
@@ -37,9 +42,44 @@ type CmdArgs struct {
 	ContainerID string
 	Netns       string
 	IfName      string
-	Args        string
-	Path        string
-	StdinData   []byte
+	// IfNames lists the interfaces of the attachment when the runtime
+	// sets CNI_IFNAMES to several comma-separated names, or holds just
+	// IfName. The first name is always IfName.
+	IfNames []string `json:"-"`
+	Args    string
+	// NetnsFile is the network namespace the runtime passed as an open
+	// file descriptor in CNI_NETNS_FD, or nil. Use NetnsPath to prefer
+	// it over Netns.
+	NetnsFile *os.File `json:"-"`
+	// ParsedArgs holds the KEY=VALUE pairs of Args
+	ParsedArgs map[string]string `json:"-"`
+	Path       string
+	StdinData  []byte
+	// DryRun is set when the plugin was invoked with CNI_DRYRUN=1. The
+	// command's callback is not called; see WithValidate.
+	DryRun bool `json:"-"`
+	// CorrelationID identifies the request across the plugins of a chain,
+	// read from CNI_ARGS; see DefaultCorrelationIDKeys. It is included in
+	// the Details of errors and in log messages.
+	CorrelationID string `json:"-"`
+	// PrevResult is the decoded prevResult of the configuration when
+	// WithPrevResult is used, or nil if the configuration has none
+	PrevResult types.Result `json:"-"`
+	// Warnings holds the warnings recorded with Warn. They are written to
+	// stderr when the callback returns.
+	Warnings []string `json:"-"`
+	// Env is the snapshot of the CNI_* environment the fields above
+	// were read from. Callbacks should use it instead of os.Getenv.
+	Env Environment `json:"-"`
+	// Missing lists the input absent from a DEL dispatched with
+	// WithLenientDel, such as "CNI_IFNAME" or "prevResult"
+	Missing []string `json:"-"`
+	// State is the attachment's state directory when WithStateDir is
+	// used, or nil
+	State *StateDir `json:"-"`
+
+	// timeout is the dispatcher's timeout, or CNI_TIMEOUT if set
+	timeout time.Duration
 }
 
 type dispatcher struct {
@@ -48,12 +88,263 @@ type dispatcher struct {
 	Stdout io.Writer
 	Stderr io.Writer
 
+	// Args are the command-line arguments without the program name
+	Args []string
+
+	// Environ, if set, lists the environment so that all CNI_* variables
+	// can be captured in CmdArgs.Env
+	Environ func() []string
+
 	ConfVersionDecoder version.ConfigDecoder
 	VersionReconciler  version.Reconciler
+
+	delOnAddFailure bool
+	cmdStatus       func(context.Context, *CmdArgs) error
+	beforeHooks     []func(cmd string, args *CmdArgs)
+	afterHooks      []func(cmd string, args *CmdArgs, err error)
+	logger          Logger
+	onError         func(cmd string, err *types.Error) *types.Error
+	timeout         time.Duration
+	cmdValidate     func(context.Context, *CmdArgs) error
+	metricsDir      string
+	prevResult      bool
+	prevResultReq   map[string]bool
+	addResult       func(*CmdArgs) (types.Result, error)
+	maxStdinSize    int64
+	stdinTimeout    time.Duration
+	confDecoder     ConfVersionDecoder
+	reconciler      VersionReconciler
+	correlationKeys []string
+	readiness       []ReadinessCheck
+	windows         bool
+	onCancel        func(cmd string, args *CmdArgs)
+	customCmds      map[string]func(context.Context, *CmdArgs) error
+	tracer          Tracer
+	featureManifest bool
+	capabilities    []string
+	lockDir         string
+	debugDir        string
+	requirements    *version.Requirements
+	ipam            bool
+	buildVersion    string
+	stateDir        bool
+	stateRoot       string
+	unknownCmd      UnknownCommandHandler
+	lenientDel      bool
+}
+
+// DefaultMaxStdinSize is the largest network configuration, in bytes, that
+// the dispatcher reads from stdin unless WithMaxStdinSize is used.
+const DefaultMaxStdinSize = 4 << 20
+
+// Logger receives structured messages from the dispatcher. keysAndValues
+// are alternating field names and values, such as "command", "ADD".
+type Logger interface {
+	Info(msg string, keysAndValues ...interface{})
+	Error(err error, msg string, keysAndValues ...interface{})
+}
+
+// Option customizes the behavior of the dispatcher run by PluginMain,
+// PluginMainWithError and Dispatcher.
+type Option func(*dispatcher)
+
+// WithDelOnAddFailure makes the dispatcher invoke cmdDel with the same
+// arguments when cmdAdd returns an error, so that partially-configured
+// state is cleaned up before the error is reported to the runtime.
+// The cleanup is best-effort: a failing cmdDel is logged to stderr and
+// the original ADD error is returned. cmdDel is given a context that is
+// not cancelled with the ADD's, so that it also runs when ADD failed
+// because it timed out, bounded by cleanupDelTimeout instead.
+func WithDelOnAddFailure() Option {
+	return func(t *dispatcher) {
+		t.delOnAddFailure = true
+	}
+}
+
+// WithStatus registers a callback for the STATUS command, which runtimes
+// use to probe whether the plugin is ready to service ADD requests. STATUS
+// is only dispatched for configurations of version 1.1.0 or later.
+func WithStatus(cmdStatus func(*CmdArgs) error) Option {
+	return WithStatusContext(withoutContext(cmdStatus))
+}
+
+// WithStatusContext is like WithStatus for context-aware callbacks
+func WithStatusContext(cmdStatus func(context.Context, *CmdArgs) error) Option {
+	return func(t *dispatcher) {
+		t.cmdStatus = cmdStatus
+	}
+}
+
+// WithHooks registers functions that are called before and after the
+// callback for a command runs, for example to add logging, metrics or
+// locking to every command. after receives the error returned by the
+// callback. Either function may be nil. When WithHooks is passed more than
+// once, before hooks run in the order given and after hooks in reverse.
+func WithHooks(before func(cmd string, args *CmdArgs), after func(cmd string, args *CmdArgs, err error)) Option {
+	return func(t *dispatcher) {
+		if before != nil {
+			t.beforeHooks = append(t.beforeHooks, before)
+		}
+		if after != nil {
+			t.afterHooks = append([]func(string, *CmdArgs, error){after}, t.afterHooks...)
+		}
+	}
+}
+
+// WithLogger makes the dispatcher log argument parsing failures, version
+// mismatches and the outcome of every command to logger, with the command,
+// container ID and interface name as fields. Errors are still reported to
+// the runtime on stdout.
+func WithLogger(logger Logger) Option {
+	return func(t *dispatcher) {
+		t.logger = logger
+	}
+}
+
+// WithOnError registers a function that is called with every error before
+// it is reported to the runtime, for example to add remediation hints to
+// Details or to map internal errors to stable codes. The error it returns
+// is reported instead; returning nil reports the original error.
+func WithOnError(onError func(cmd string, err *types.Error) *types.Error) Option {
+	return func(t *dispatcher) {
+		t.onError = onError
+	}
+}
+
+// WithTimeout bounds how long the callback for a command may run. When
+// the timeout expires, the callback's context is cancelled and the
+// dispatcher waits up to timeoutGracePeriod for the callback to return
+// before reporting a types.ErrTimeout error. A callback ignoring its
+// context past that is left running, still holding the attachment lock
+// of WithAttachmentLock and the state directory of WithStateDir until it
+// returns. That is only safe when the process exits afterwards, as with
+// PluginMain; callbacks served by ServeDaemon or a Dispatcher must honour
+// cancellation, or later commands for the attachment wait for them. The
+// CNI_TIMEOUT environment variable, a duration such as "30s" or a number
+// of seconds, overrides the timeout set here for a single invocation.
+// Plugins delegated to with the callback's context, such as IPAM plugins,
+// receive the time left in CNI_TIMEOUT; see invoke.DelegateContext.
+func WithTimeout(timeout time.Duration) Option {
+	return func(t *dispatcher) {
+		t.timeout = timeout
+	}
+}
+
+// WithValidate registers a callback that is called instead of the
+// command's callback when the plugin is invoked with CNI_DRYRUN=1. It
+// should check the configuration and arguments as thoroughly as possible
+// without changing the system, so that operators can safely test network
+// configurations. Without it, a dry run only checks the environment,
+// configuration and versions. A dry run takes no attachment lock, opens no
+// state directory, does not capture the callback's output into CNI_OUTPUT
+// and is not counted in the metrics. Hooks, tracing and logging still run,
+// and an error is reported as for any other command.
+func WithValidate(cmdValidate func(*CmdArgs) error) Option {
+	return func(t *dispatcher) {
+		t.cmdValidate = withoutContext(cmdValidate)
+	}
+}
+
+// WithPrevResult makes the dispatcher decode the prevResult of the
+// configuration into CmdArgs.PrevResult, as the version of the
+// configuration, before the callback is called. Commands listed in
+// requiredFor, such as "CHECK", fail with types.ErrInvalidNetworkConfig
+// when the configuration has no prevResult.
+func WithPrevResult(requiredFor ...string) Option {
+	return func(t *dispatcher) {
+		t.prevResult = true
+		t.prevResultReq = map[string]bool{}
+		for _, cmd := range requiredFor {
+			t.prevResultReq[cmd] = true
+		}
+	}
+}
+
+// WithMaxStdinSize limits the size of the network configuration read
+// from stdin, or from the file in CNI_NETCONF_PATH, to size bytes,
+// instead of DefaultMaxStdinSize. Larger configurations fail with
+// types.ErrInvalidNetworkConfig. A size of zero or less removes the limit.
+func WithMaxStdinSize(size int64) Option {
+	return func(t *dispatcher) {
+		if size <= 0 {
+			size = -1
+		}
+		t.maxStdinSize = size
+	}
+}
+
+// WithCommand registers cmd as the callback for an extension command
+// that is not defined by the specification, such as CNI_COMMAND=VENDOR_X,
+// so that vendors can ship experimental commands. The callback is called
+// like the callbacks for the standard commands, after the configuration
+// and versions are checked; only CNI_COMMAND is required in the
+// environment. Commands that are not registered are still rejected as
+// unknown. Registering a command defined by the specification, such as
+// ADD, has no effect.
+func WithCommand(verb string, cmd func(*CmdArgs) error) Option {
+	return WithCommandContext(verb, withoutContext(cmd))
+}
+
+// WithCommandContext is like WithCommand, but the callback receives a
+// context; see PluginMainContext.
+func WithCommandContext(verb string, cmd func(context.Context, *CmdArgs) error) Option {
+	return func(t *dispatcher) {
+		if t.customCmds == nil {
+			t.customCmds = map[string]func(context.Context, *CmdArgs) error{}
+		}
+		t.customCmds[verb] = cmd
+	}
+}
+
+// WithCancelHandler registers a function that is called when the context
+// of a command is cancelled while its callback is running: when the plugin
+// process receives SIGTERM or SIGINT, or when the timeout set with
+// WithTimeout expires. It lets plugins whose callbacks do not take a
+// context abort their work and clean up partial state. The handler runs
+// concurrently with the callback, and the dispatcher still waits for the
+// callback to return.
+//
+// Callbacks passed to PluginMainContext always have their context
+// cancelled on these signals. With the other entry points, the signal
+// handlers are only installed when a cancel handler is registered.
+func WithCancelHandler(onCancel func(cmd string, args *CmdArgs)) Option {
+	return func(t *dispatcher) {
+		t.onCancel = onCancel
+	}
+}
+
+// WithEnv makes the dispatcher read the CNI_* variables from env instead
+// of the process environment. It is meant for testing plugins in-process;
+// see the skeltest package.
+func WithEnv(env map[string]string) Option {
+	return func(t *dispatcher) {
+		t.Getenv = func(key string) string { return env[key] }
+		t.Environ = func() []string {
+			vars := make([]string, 0, len(env))
+			for k, v := range env {
+				vars = append(vars, k+"="+v)
+			}
+			return vars
+		}
+	}
+}
+
+// WithStreams makes the dispatcher use the given streams instead of
+// os.Stdin, os.Stdout and os.Stderr. Results printed by callbacks with
+// types.PrintResult still go to os.Stdout.
+func WithStreams(stdin io.Reader, stdout, stderr io.Writer) Option {
+	return func(t *dispatcher) {
+		t.Stdin = stdin
+		t.Stdout = stdout
+		t.Stderr = stderr
+	}
 }
 
 type reqForCmdEntry map[string]bool
 
+// getCmdArgsFromEnv parses the plugin's environment. The command is
+// returned even when the arguments are invalid, so that error hooks and
+// metrics see what the runtime asked for
 func (t *dispatcher) getCmdArgsFromEnv() (string, *CmdArgs, *types.Error) {
 	var cmd, contID, netns, ifName, args, path string
 
@@ -118,10 +409,29 @@ func (t *dispatcher) getCmdArgsFromEnv() (string, *CmdArgs, *types.Error) {
 		},
 	}
 
+	env, envErr := t.snapshotEnv()
+	if envErr != nil {
+		return "", nil, envErr
+	}
 	argsMissing := make([]string, 0)
+	var lenientMissing []string
 	for _, v := range vars {
-		*v.val = t.Getenv(v.name)
+		*v.val = env.Get(v.name)
 		if *v.val == "" {
+			// The namespace may be passed only as a file descriptor
+			if v.name == "CNI_NETNS" && env.Get(netnsFDVar) != "" {
+				continue
+			}
+			// IPAM plugins do not enter the container's namespace
+			if v.name == "CNI_NETNS" && t.ipam {
+				continue
+			}
+			if t.isLenientDel(cmd) && v.name != "CNI_COMMAND" {
+				if v.name != "CNI_ARGS" {
+					lenientMissing = append(lenientMissing, v.name)
+				}
+				continue
+			}
 			if v.reqForCmd[cmd] || v.name == "CNI_COMMAND" {
 				argsMissing = append(argsMissing, v.name)
 			}
@@ -130,122 +440,564 @@ func (t *dispatcher) getCmdArgsFromEnv() (string, *CmdArgs, *types.Error) {
 
 	if len(argsMissing) > 0 {
 		joined := strings.Join(argsMissing, ",")
-		return "", nil, types.NewError(types.ErrInvalidEnvironmentVariables, fmt.Sprintf("required env variables [%s] missing", joined), "")
+		return cmd, nil, types.NewError(types.ErrInvalidEnvironmentVariables, fmt.Sprintf("required env variables [%s] missing", joined), "")
 	}
 
 	if cmd == "VERSION" {
 		t.Stdin = bytes.NewReader(nil)
 	}
 
-	stdinData, err := ioutil.ReadAll(t.Stdin)
-	if err != nil {
-		return "", nil, types.NewError(types.ErrIOFailure, fmt.Sprintf("error reading from stdin: %v", err), "")
+	// STATUS and VERSION are not specific to an attachment
+	var ifNames []string
+	if cmd != "VERSION" && cmd != "STATUS" {
+		if err := validateEnvValue("CNI_CONTAINERID", contID, utils.ValidateContainerID); err != nil {
+			return cmd, nil, err
+		}
+		if err := validateEnvValue("CNI_IFNAME", ifName, utils.ValidateInterfaceName); err != nil {
+			return cmd, nil, err
+		}
+		names, err := parseIfNames(ifName, env.Get(ifNamesVar))
+		if err != nil {
+			return cmd, nil, err
+		}
+		ifNames = names
+	}
+
+	parsedArgs, err := parseArgs(args)
+	if err != nil && t.isLenientDel(cmd) {
+		parsedArgs = parseValidArgs(args)
+		lenientMissing = append(lenientMissing, "CNI_ARGS")
+	} else if err != nil {
+		return cmd, nil, types.NewError(types.ErrInvalidEnvironmentVariables, fmt.Sprintf("invalid CNI_ARGS: %v", err), "")
+	}
+
+	timeout := t.timeout
+	if v := env.Get("CNI_TIMEOUT"); v != "" {
+		if timeout, err = parseTimeout(v); err != nil {
+			return cmd, nil, types.NewError(types.ErrInvalidEnvironmentVariables, fmt.Sprintf("invalid CNI_TIMEOUT: %v", err), "")
+		}
+	}
+
+	var dryRun bool
+	if v := env.Get("CNI_DRYRUN"); v != "" {
+		if dryRun, err = strconv.ParseBool(v); err != nil {
+			return cmd, nil, types.NewError(types.ErrInvalidEnvironmentVariables, fmt.Sprintf("invalid CNI_DRYRUN: %q is not a boolean", v), "")
+		}
+	}
+
+	var netnsFile *os.File
+	if cmd != "VERSION" && cmd != "STATUS" {
+		var e *types.Error
+		if netnsFile, e = openNetnsFD(env.Get(netnsFDVar)); e != nil {
+			return cmd, nil, e
+		}
+	}
+
+	var stdinData []byte
+	var e *types.Error
+	if path := env.Get(netconfPathVar); path != "" && cmd != "VERSION" {
+		stdinData, e = t.readNetconfFile(path)
+	} else {
+		stdinData, e = t.readStdin()
+	}
+	if e != nil {
+		return cmd, nil, e
 	}
 
 	cmdArgs := &CmdArgs{
 		ContainerID: contID,
 		Netns:       netns,
 		IfName:      ifName,
+		IfNames:     ifNames,
 		Args:        args,
+		NetnsFile:   netnsFile,
+		ParsedArgs:  parsedArgs,
 		Path:        path,
 		StdinData:   stdinData,
+		DryRun:      dryRun,
+		Env:         env,
+		Missing:     lenientMissing,
+		timeout:     timeout,
 	}
+	cmdArgs.CorrelationID = t.correlationID(parsedArgs)
 	return cmd, cmdArgs, nil
 }
 
-func (t *dispatcher) checkVersionAndCall(cmdArgs *CmdArgs, pluginVersionInfo version.PluginInfo, toCall func(*CmdArgs) error) *types.Error {
-	configVersion, err := t.ConfVersionDecoder.Decode(cmdArgs.StdinData)
+// readStdin reads the network configuration from stdin, failing if it is
+// larger than the configured maximum size
+func (t *dispatcher) readStdin() ([]byte, *types.Error) {
+	data, tooLarge, err := t.readStdinLimited()
+	if err != nil {
+		return nil, types.NewError(types.ErrIOFailure, fmt.Sprintf("error reading from stdin: %v", err), "")
+	}
+	if tooLarge {
+		return nil, types.NewError(types.ErrInvalidNetworkConfig, fmt.Sprintf("network configuration on stdin exceeds the maximum size of %d bytes", t.maxConfigSize()), "")
+	}
+	return data, nil
+}
+
+// netconfPathVar names the optional variable holding the path of a file
+// to read the network configuration from instead of stdin, which helps
+// debugging and exec environments where stdin is awkward to provide
+const netconfPathVar = "CNI_NETCONF_PATH"
+
+// readNetconfFile reads the network configuration from the file at path,
+// with the same size limit as stdin
+func (t *dispatcher) readNetconfFile(path string) ([]byte, *types.Error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, types.NewError(types.ErrIOFailure, fmt.Sprintf("error reading %s: %v", netconfPathVar, err), "")
+	}
+	defer f.Close()
+	data, tooLarge, err := t.readLimited(f)
+	if err != nil {
+		return nil, types.NewError(types.ErrIOFailure, fmt.Sprintf("error reading %s: %v", netconfPathVar, err), "")
+	}
+	if tooLarge {
+		return nil, types.NewError(types.ErrInvalidNetworkConfig, fmt.Sprintf("network configuration in %s exceeds the maximum size of %d bytes", path, t.maxConfigSize()), "")
+	}
+	return data, nil
+}
+
+// maxConfigSize returns the largest configuration to read, or -1 for no
+// limit
+func (t *dispatcher) maxConfigSize() int64 {
+	if t.maxStdinSize == 0 {
+		return DefaultMaxStdinSize
+	}
+	return t.maxStdinSize
+}
+
+// readLimited reads r, reporting whether it holds more than the maximum
+// configuration size
+func (t *dispatcher) readLimited(r io.Reader) ([]byte, bool, error) {
+	max := t.maxConfigSize()
+	if max > 0 {
+		// Read one byte more than allowed to tell a configuration of
+		// exactly the maximum size from a larger one
+		r = io.LimitReader(r, max+1)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, false, err
+	}
+	return data, max > 0 && int64(len(data)) > max, nil
+}
+
+// validateEnvValue checks the value of an environment variable with
+// validate, naming the variable and value in the error. Empty values are
+// left to the required variable checks.
+func validateEnvValue(name, value string, validate func(string) *types.Error) *types.Error {
+	if value == "" {
+		return nil
+	}
+	if err := validate(value); err != nil {
+		return types.NewError(types.ErrInvalidEnvironmentVariables, fmt.Sprintf("invalid %s %q: %s", name, value, err.Msg), err.Details)
+	}
+	return nil
+}
+
+// parseArgs splits CNI_ARGS into its semicolon-separated KEY=VALUE pairs.
+// Empty pairs, such as one left by a trailing semicolon, are ignored.
+func parseArgs(args string) (map[string]string, error) {
+	parsed := map[string]string{}
+	if args == "" {
+		return parsed, nil
+	}
+	for _, pair := range strings.Split(args, ";") {
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("%q is not a KEY=VALUE pair", pair)
+		}
+		if kv[0] == "" {
+			return nil, fmt.Errorf("%q has an empty key", pair)
+		}
+		if _, ok := parsed[kv[0]]; ok {
+			return nil, fmt.Errorf("duplicate key %q", kv[0])
+		}
+		parsed[kv[0]] = kv[1]
+	}
+	return parsed, nil
+}
+
+// parseTimeout parses a duration such as "1m30s" or a number of seconds
+func parseTimeout(s string) (time.Duration, error) {
+	if secs, err := strconv.Atoi(s); err == nil {
+		if secs <= 0 {
+			return 0, fmt.Errorf("%q is not positive", s)
+		}
+		return time.Duration(secs) * time.Second, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("%q is not positive", s)
+	}
+	return d, nil
+}
+
+func (t *dispatcher) checkVersionAndCall(ctx context.Context, cmd string, cmdArgs *CmdArgs, pluginVersionInfo version.PluginInfo, toCall func(context.Context, *CmdArgs) error) *types.Error {
+	configVersion, err := t.decodeConfVersion(cmdArgs.StdinData)
 	if err != nil {
 		return types.NewError(types.ErrDecodingFailure, err.Error(), "")
 	}
-	verErr := t.VersionReconciler.Check(configVersion, pluginVersionInfo)
+	verErr := t.checkConfVersion(configVersion, pluginVersionInfo)
 	if verErr != nil {
 		return types.NewError(types.ErrIncompatibleCNIVersion, "incompatible CNI versions", verErr.Details())
 	}
 
-	if err = toCall(cmdArgs); err != nil {
-		if e, ok := err.(*types.Error); ok {
-			// don't wrap Error in Error
+	if t.prevResult && t.isLenientDel(cmd) {
+		decodeLenientPrevResult(cmdArgs)
+	} else if t.prevResult {
+		var e *types.Error
+		if cmdArgs.PrevResult, e = decodePrevResult(cmdArgs.StdinData); e != nil {
 			return e
 		}
-		return types.NewError(types.ErrInternal, err.Error(), "")
+		if cmdArgs.PrevResult == nil && t.prevResultReq[cmd] {
+			return types.NewError(types.ErrInvalidNetworkConfig, fmt.Sprintf("%s requires a prevResult", cmd), "the plugin must be chained after a plugin that returns a result")
+		}
+	}
+
+	if cmdArgs.DryRun {
+		toCall = t.cmdValidate
+		if toCall == nil {
+			return nil
+		}
+	}
+
+	if err = t.callWithTimeout(ctx, cmd, cmdArgs, toCall); err != nil {
+		return typedError(err)
 	}
 
 	return nil
 }
 
-func validateConfig(jsonBytes []byte) *types.Error {
-	var conf struct {
-		Name string `json:"name"`
+// call runs a command's callback surrounded by the registered hooks
+func (t *dispatcher) call(ctx context.Context, cmd string, cmdArgs *CmdArgs, toCall func(context.Context, *CmdArgs) error) (err error) {
+	defer t.printWarnings(cmd, cmdArgs)
+	ctx, span := t.startSpan(ctx, cmd, cmdArgs)
+	if span != nil {
+		defer func() { span.End(err) }()
+	}
+	if t.onCancel != nil {
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			select {
+			case <-ctx.Done():
+				t.onCancel(cmd, cmdArgs)
+			case <-done:
+			}
+		}()
 	}
-	if err := json.Unmarshal(jsonBytes, &conf); err != nil {
-		return types.NewError(types.ErrDecodingFailure, fmt.Sprintf("error unmarshall network config: %v", err), "")
+	unlock, e := t.lockAttachment(ctx, cmd, cmdArgs)
+	if e != nil {
+		return e
 	}
-	if conf.Name == "" {
-		return types.NewError(types.ErrInvalidNetworkConfig, "missing network name", "")
+	defer unlock()
+	closeState, e := t.openStateDir(ctx, cmd, cmdArgs)
+	if e != nil {
+		return e
 	}
-	if err := utils.ValidateNetworkName(conf.Name); err != nil {
+	defer func() { closeState(err) }()
+	var output *outputCapture
+	outputPath := cmdArgs.Env.Get(outputVar)
+	exclusive, e := outputExclusive(cmdArgs.Env.Get(outputModeVar))
+	if e != nil {
+		return e
+	}
+	if outputPath != "" && !cmdArgs.DryRun {
+		if e := validateOutputPath(outputPath); e != nil {
+			return e
+		}
+		if output, err = t.captureOutput(); err != nil {
+			return types.NewError(types.ErrIOFailure, fmt.Sprintf("failed to capture output: %v", err), "")
+		}
+		// Restore the streams if the callback panics
+		defer func() { _, _ = output.stop(t) }()
+	}
+	for _, before := range t.beforeHooks {
+		before(cmd, cmdArgs)
+	}
+	err = toCall(ctx, cmdArgs)
+	for _, after := range t.afterHooks {
+		after(cmd, cmdArgs, err)
+	}
+	if output != nil {
+		err = t.deliverOutput(output, outputPath, exclusive, err)
+	}
+	return err
+}
+
+// timeoutGracePeriod bounds how long callWithTimeout waits for a callback
+// to return once its context has been cancelled by the timeout
+var timeoutGracePeriod = 5 * time.Second
+
+// callWithTimeout runs call, returning a types.ErrTimeout error if it does not
+// finish within the invocation's timeout
+func (t *dispatcher) callWithTimeout(ctx context.Context, cmd string, cmdArgs *CmdArgs, toCall func(context.Context, *CmdArgs) error) error {
+	if cmdArgs.timeout <= 0 {
+		return t.call(ctx, cmd, cmdArgs, toCall)
+	}
+
+	parent := ctx
+	ctx, cancel := context.WithTimeout(ctx, cmdArgs.timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		// dispatchRecover cannot see panics on this goroutine
+		defer func() {
+			if r := recover(); r != nil {
+				done <- panicError(r)
+			}
+		}()
+		done <- t.call(ctx, cmd, cmdArgs, toCall)
+	}()
+
+	select {
+	case err := <-done:
 		return err
+	case <-ctx.Done():
+		if ctx.Err() != context.DeadlineExceeded || parent.Err() != nil {
+			// cancelled by the caller, or the caller's own deadline
+			// came first; let the callback handle it
+			return <-done
+		}
+		// Give the callback a chance to clean up and restore the
+		// streams before the dispatcher carries on
+		cancel()
+		grace := time.NewTimer(timeoutGracePeriod)
+		defer grace.Stop()
+		select {
+		case <-done:
+		case <-grace.C:
+		}
+		return types.NewError(types.ErrTimeout, fmt.Sprintf("%s timed out after %v", cmd, cmdArgs.timeout), "")
+	}
+}
+
+// cleanupDelTimeout bounds the DEL run by WithDelOnAddFailure
+const cleanupDelTimeout = 30 * time.Second
+
+// detachedContext keeps the values of its parent, such as the trace span,
+// but not its deadline or cancellation
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+// addWithCleanup wraps cmdAdd so that cmdDel is called when it fails
+func (t *dispatcher) addWithCleanup(cmdAdd, cmdDel func(context.Context, *CmdArgs) error) func(context.Context, *CmdArgs) error {
+	return func(ctx context.Context, cmdArgs *CmdArgs) error {
+		err := cmdAdd(ctx, cmdArgs)
+		if err == nil {
+			return nil
+		}
+		delCtx, cancel := context.WithTimeout(detachedContext{ctx}, cleanupDelTimeout)
+		defer cancel()
+		if delErr := cmdDel(delCtx, cmdArgs); delErr != nil {
+			_, _ = fmt.Fprintf(t.Stderr, "cleanup DEL after failed ADD failed: %v\n", delErr)
+		}
+		return err
+	}
+}
+
+// checkVerbVersion ensures that both the configuration and the plugin use
+// a spec version that includes verb, which was introduced in minVersion
+func (t *dispatcher) checkVerbVersion(cmdArgs *CmdArgs, versionInfo version.PluginInfo, verb, minVersion string) *types.Error {
+	configVersion, err := t.decodeConfVersion(cmdArgs.StdinData)
+	if err != nil {
+		return types.NewError(types.ErrDecodingFailure, err.Error(), "")
+	}
+	if gtet, err := version.GreaterThanOrEqualTo(configVersion, minVersion); err != nil {
+		return types.NewError(types.ErrDecodingFailure, err.Error(), "")
+	} else if !gtet {
+		return types.NewError(types.ErrIncompatibleCNIVersion, fmt.Sprintf("config version does not allow %s", verb), "")
+	}
+	for _, pluginVersion := range versionInfo.SupportedVersions() {
+		gtet, err := version.GreaterThanOrEqualTo(pluginVersion, configVersion)
+		if err != nil {
+			return types.NewError(types.ErrDecodingFailure, err.Error(), "")
+		} else if gtet {
+			return nil
+		}
+	}
+	return types.NewError(types.ErrIncompatibleCNIVersion, fmt.Sprintf("plugin version does not allow %s", verb), "")
+}
+
+// withResult adapts a callback that returns a result, printing the result
+// converted to the version of the configuration
+func (t *dispatcher) withResult(f func(*CmdArgs) (types.Result, error)) func(context.Context, *CmdArgs) error {
+	return func(_ context.Context, args *CmdArgs) error {
+		result, err := f(args)
+		if err != nil {
+			return err
+		}
+		if result == nil {
+			return types.NewError(types.ErrInternal, "plugin returned no result", "")
+		}
+		configVersion, err := t.decodeConfVersion(args.StdinData)
+		if err != nil {
+			return types.NewError(types.ErrDecodingFailure, err.Error(), "")
+		}
+		converted, err := result.GetAsVersion(configVersion)
+		if err != nil {
+			return types.NewError(types.ErrIncompatibleCNIVersion, fmt.Sprintf("failed to convert result to version %s", configVersion), err.Error())
+		}
+		if err := converted.PrintTo(t.Stdout); err != nil {
+			return types.NewError(types.ErrIOFailure, fmt.Sprintf("failed to print result: %v", err), "")
+		}
+		return nil
+	}
+}
+
+// withoutContext adapts a callback that does not take a context
+func withoutContext(f func(*CmdArgs) error) func(context.Context, *CmdArgs) error {
+	if f == nil {
+		return nil
+	}
+	return func(_ context.Context, args *CmdArgs) error {
+		return f(args)
 	}
-	return nil
 }
 
 func (t *dispatcher) pluginMain(cmdAdd, cmdCheck, cmdDel func(_ *CmdArgs) error, versionInfo version.PluginInfo, about string) *types.Error {
+	return t.pluginMainContext(context.Background(), withoutContext(cmdAdd), withoutContext(cmdCheck), withoutContext(cmdDel), versionInfo, about)
+}
+
+func (t *dispatcher) pluginMainContext(ctx context.Context, cmdAdd, cmdCheck, cmdDel func(context.Context, *CmdArgs) error, versionInfo version.PluginInfo, about string) *types.Error {
+	cmd, dryRun, err := t.runCommand(ctx, cmdAdd, cmdCheck, cmdDel, versionInfo, about)
+	if err != nil && t.onError != nil {
+		if mapped := t.onError(cmd, err); mapped != nil {
+			err = mapped
+		}
+	}
+	if !dryRun {
+		t.recordMetrics(cmd, err)
+	}
+	return err
+}
+
+// runCommand dispatches the command, also returning the command read from
+// the environment and whether it was a dry run
+func (t *dispatcher) runCommand(ctx context.Context, cmdAdd, cmdCheck, cmdDel func(context.Context, *CmdArgs) error, versionInfo version.PluginInfo, about string) (string, bool, *types.Error) {
+	if flag := t.metadataFlag(); flag != "" {
+		return "", false, t.printMetadata(flag, cmdAdd, cmdCheck, cmdDel, versionInfo, about)
+	}
+	t.captureDebug()
 	cmd, cmdArgs, err := t.getCmdArgsFromEnv()
 	if err != nil {
 		// Print the about string to stderr when no command is set
-		if err.Code == types.ErrInvalidEnvironmentVariables && t.Getenv("CNI_COMMAND") == "" && about != "" {
+		if err.Code == types.ErrInvalidEnvironmentVariables && cmd == "" && about != "" {
 			_, _ = fmt.Fprintln(t.Stderr, about)
-			return nil
+			return "", false, nil
 		}
-		return err
+		if t.logger != nil {
+			t.logger.Error(err, "failed to parse plugin arguments", "command", cmd, "code", err.Code)
+		}
+		return cmd, false, err
 	}
 
-	if cmd != "VERSION" {
-		if err = validateConfig(cmdArgs.StdinData); err != nil {
-			return err
+	var fields []interface{}
+	if t.logger != nil {
+		fields = []interface{}{"command", cmd, "containerID", cmdArgs.ContainerID, "ifName", cmdArgs.IfName}
+		if cmdArgs.CorrelationID != "" {
+			fields = append(fields, "correlationID", cmdArgs.CorrelationID)
 		}
-		if err = utils.ValidateContainerID(cmdArgs.ContainerID); err != nil {
-			return err
+		t.logger.Info("dispatching command", fields...)
+	}
+	if err = t.dispatchRecover(ctx, cmd, cmdArgs, cmdAdd, cmdCheck, cmdDel, versionInfo); err != nil {
+		err = withCorrelationID(err, cmdArgs.CorrelationID)
+		if t.logger != nil {
+			t.logger.Error(err, "command failed", append(fields, "code", err.Code)...)
 		}
-		if err = utils.ValidateInterfaceName(cmdArgs.IfName); err != nil {
+		return cmd, cmdArgs.DryRun, err
+	}
+	if t.logger != nil {
+		t.logger.Info("command succeeded", fields...)
+	}
+	return cmd, cmdArgs.DryRun, nil
+}
+
+// dispatchRecover calls dispatch, converting a panic in a callback into
+// an error so that the runtime still receives a well-formed result
+func (t *dispatcher) dispatchRecover(ctx context.Context, cmd string, cmdArgs *CmdArgs, cmdAdd, cmdCheck, cmdDel func(context.Context, *CmdArgs) error, versionInfo version.PluginInfo) (err *types.Error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = panicError(r)
+		}
+	}()
+	return t.dispatch(ctx, cmd, cmdArgs, cmdAdd, cmdCheck, cmdDel, versionInfo)
+}
+
+// panicError converts a recovered panic into an error with the stack trace
+func panicError(r interface{}) *types.Error {
+	return types.NewError(types.ErrInternal, fmt.Sprintf("plugin panicked: %v", r), string(debug.Stack()))
+}
+
+func (t *dispatcher) dispatch(ctx context.Context, cmd string, cmdArgs *CmdArgs, cmdAdd, cmdCheck, cmdDel func(context.Context, *CmdArgs) error, versionInfo version.PluginInfo) *types.Error {
+	var err *types.Error
+	if cmd != "VERSION" {
+		if err = validateConfig(cmdArgs.StdinData, t.confDecoder == nil); err != nil {
 			return err
 		}
 	}
 
 	switch cmd {
 	case "ADD":
-		err = t.checkVersionAndCall(cmdArgs, versionInfo, cmdAdd)
+		if cmdAdd == nil && t.addResult != nil {
+			cmdAdd = t.withResult(t.addResult)
+		}
+		if cmdAdd == nil {
+			return t.unknownCommand(cmd, cmdArgs, cmdAdd, cmdCheck, cmdDel)
+		}
+		if t.delOnAddFailure && cmdDel != nil {
+			cmdAdd = t.addWithCleanup(cmdAdd, cmdDel)
+		}
+		if err = checkRequirements(t.requirements, host); err != nil {
+			return err
+		}
+		err = t.checkVersionAndCall(ctx, cmd, cmdArgs, versionInfo, cmdAdd)
 	case "CHECK":
-		configVersion, err := t.ConfVersionDecoder.Decode(cmdArgs.StdinData)
-		if err != nil {
-			return types.NewError(types.ErrDecodingFailure, err.Error(), "")
+		if cmdCheck == nil {
+			return t.unknownCommand(cmd, cmdArgs, cmdAdd, cmdCheck, cmdDel)
 		}
-		if gtet, err := version.GreaterThanOrEqualTo(configVersion, "0.4.0"); err != nil {
-			return types.NewError(types.ErrDecodingFailure, err.Error(), "")
-		} else if !gtet {
-			return types.NewError(types.ErrIncompatibleCNIVersion, "config version does not allow CHECK", "")
-		}
-		for _, pluginVersion := range versionInfo.SupportedVersions() {
-			gtet, err := version.GreaterThanOrEqualTo(pluginVersion, configVersion)
-			if err != nil {
-				return types.NewError(types.ErrDecodingFailure, err.Error(), "")
-			} else if gtet {
-				if err := t.checkVersionAndCall(cmdArgs, versionInfo, cmdCheck); err != nil {
-					return err
-				}
-				return nil
-			}
+		if err = t.checkVerbVersion(cmdArgs, versionInfo, "CHECK", "0.4.0"); err != nil {
+			return err
 		}
-		return types.NewError(types.ErrIncompatibleCNIVersion, "plugin version does not allow CHECK", "")
+		err = t.checkVersionAndCall(ctx, cmd, cmdArgs, versionInfo, cmdCheck)
+	case "STATUS":
+		cmdStatus := t.statusFunc()
+		if cmdStatus == nil {
+			return t.unknownCommand(cmd, cmdArgs, cmdAdd, cmdCheck, cmdDel)
+		}
+		if err = t.checkVerbVersion(cmdArgs, versionInfo, "STATUS", "1.1.0"); err != nil {
+			return err
+		}
+		err = t.checkVersionAndCall(ctx, cmd, cmdArgs, versionInfo, cmdStatus)
 	case "DEL":
-		err = t.checkVersionAndCall(cmdArgs, versionInfo, cmdDel)
+		if cmdDel == nil {
+			return t.unknownCommand(cmd, cmdArgs, cmdAdd, cmdCheck, cmdDel)
+		}
+		err = t.checkVersionAndCall(ctx, cmd, cmdArgs, versionInfo, cmdDel)
 	case "VERSION":
-		if err := versionInfo.Encode(t.Stdout); err != nil {
+		if err := t.versionInfo(versionInfo, cmdAdd, cmdCheck, cmdDel).Encode(t.Stdout); err != nil {
 			return types.NewError(types.ErrIOFailure, err.Error(), "")
 		}
 	default:
-		return types.NewError(types.ErrInvalidEnvironmentVariables, fmt.Sprintf("unknown CNI_COMMAND: %v", cmd), "")
+		customCmd, ok := t.customCmds[cmd]
+		if !ok || customCmd == nil {
+			return t.unknownCommand(cmd, cmdArgs, cmdAdd, cmdCheck, cmdDel)
+		}
+		err = t.checkVersionAndCall(ctx, cmd, cmdArgs, versionInfo, customCmd)
 	}
 
 	if err != nil {
@@ -254,6 +1006,51 @@ func (t *dispatcher) pluginMain(cmdAdd, cmdCheck, cmdDel func(_ *CmdArgs) error,
 	return nil
 }
 
+// Exit codes used by PluginMain. Well-known CNI error codes map to distinct
+// exit codes so that callers can tell failures apart without parsing the
+// JSON error printed on stdout. All other errors exit with ExitCodeFailure.
+const (
+	ExitCodeSuccess                     = 0
+	ExitCodeFailure                     = 1
+	ExitCodeIncompatibleCNIVersion      = 2
+	ExitCodeUnsupportedField            = 3
+	ExitCodeUnknownContainer            = 4
+	ExitCodeInvalidEnvironmentVariables = 5
+	ExitCodeIOFailure                   = 6
+	ExitCodeDecodingFailure             = 7
+	ExitCodeInvalidNetworkConfig        = 8
+	ExitCodeTryAgainLater               = 9
+	ExitCodeTimeout                     = 10
+)
+
+// ExitCode returns the process exit code PluginMain uses for the given error
+func ExitCode(e *types.Error) int {
+	if e == nil {
+		return ExitCodeSuccess
+	}
+	switch e.Code {
+	case types.ErrIncompatibleCNIVersion:
+		return ExitCodeIncompatibleCNIVersion
+	case types.ErrUnsupportedField:
+		return ExitCodeUnsupportedField
+	case types.ErrUnknownContainer:
+		return ExitCodeUnknownContainer
+	case types.ErrInvalidEnvironmentVariables:
+		return ExitCodeInvalidEnvironmentVariables
+	case types.ErrIOFailure:
+		return ExitCodeIOFailure
+	case types.ErrDecodingFailure:
+		return ExitCodeDecodingFailure
+	case types.ErrInvalidNetworkConfig:
+		return ExitCodeInvalidNetworkConfig
+	case types.ErrTryAgainLater:
+		return ExitCodeTryAgainLater
+	case types.ErrTimeout:
+		return ExitCodeTimeout
+	}
+	return ExitCodeFailure
+}
+
 // PluginMainWithError is the core "main" for a plugin. It accepts
 // callback functions for add, check, and del CNI commands and returns an error.
 //
@@ -264,15 +1061,30 @@ func (t *dispatcher) pluginMain(cmdAdd, cmdCheck, cmdDel func(_ *CmdArgs) error,
 // For a plugin to comply with the CNI spec, it must print any error to stdout
 // as JSON and then exit with nonzero status code.
 //
-// To let this package automatically handle errors and call os.Exit(1) for you,
+// To let this package automatically handle errors and exit for you,
 // use PluginMain() instead.
-func PluginMainWithError(cmdAdd, cmdCheck, cmdDel func(_ *CmdArgs) error, versionInfo version.PluginInfo, about string) *types.Error {
-	return (&dispatcher{
-		Getenv: os.Getenv,
-		Stdin:  os.Stdin,
-		Stdout: os.Stdout,
-		Stderr: os.Stderr,
-	}).pluginMain(cmdAdd, cmdCheck, cmdDel, versionInfo, about)
+//
+// Optional behavior of the dispatcher can be enabled by passing Options.
+func PluginMainWithError(cmdAdd, cmdCheck, cmdDel func(_ *CmdArgs) error, versionInfo version.PluginInfo, about string, opts ...Option) *types.Error {
+	t := &dispatcher{
+		Getenv:  os.Getenv,
+		Environ: os.Environ,
+		Stdin:   os.Stdin,
+		Stdout:  os.Stdout,
+		Stderr:  os.Stderr,
+		Args:    os.Args[1:],
+		windows: isWindows,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	if t.onCancel == nil {
+		return t.pluginMain(cmdAdd, cmdCheck, cmdDel, versionInfo, about)
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+	return t.pluginMainContext(ctx, withoutContext(cmdAdd), withoutContext(cmdCheck), withoutContext(cmdDel), versionInfo, about)
 }
 
 // PluginMain is the core "main" for a plugin which includes automatic error handling.
@@ -281,16 +1093,129 @@ func PluginMainWithError(cmdAdd, cmdCheck, cmdDel func(_ *CmdArgs) error, versio
 //
 // The caller can specify an "about" string, which is printed on stderr
 // when no CNI_COMMAND is specified. The recommended output is "CNI plugin <foo> v<version>"
+// When the plugin is run with --version or --help and no CNI_COMMAND, its
+// PluginMetadata is printed to stdout as JSON instead.
 //
 // When an error occurs in either cmdAdd, cmdCheck, or cmdDel, PluginMain will print the error
-// as JSON to stdout and call os.Exit(1).
+// as JSON to stdout, or to the file named by CNI_OUTPUT if CNI_OUTPUT_MODE is "exclusive", and exit with the code returned by ExitCode().
 //
 // To have more control over error handling, use PluginMainWithError() instead.
-func PluginMain(cmdAdd, cmdCheck, cmdDel func(_ *CmdArgs) error, versionInfo version.PluginInfo, about string) {
-	if e := PluginMainWithError(cmdAdd, cmdCheck, cmdDel, versionInfo, about); e != nil {
-		if err := e.Print(); err != nil {
-			log.Print("Error writing error JSON to stdout: ", err)
+func PluginMain(cmdAdd, cmdCheck, cmdDel func(_ *CmdArgs) error, versionInfo version.PluginInfo, about string, opts ...Option) {
+	if e := PluginMainWithError(cmdAdd, cmdCheck, cmdDel, versionInfo, about, opts...); e != nil {
+		if err := printError(e, os.Getenv, os.Stdout); err != nil {
+			log.Print("Error writing error JSON: ", err)
+		}
+		os.Exit(ExitCode(e))
+	}
+}
+
+// cancelSignals are the signals that cancel the context of a command
+var cancelSignals = []os.Signal{syscall.SIGTERM, os.Interrupt}
+
+// signalContext returns a context that is cancelled when the process
+// receives one of cancelSignals, and a function that stops handling them
+func signalContext() (context.Context, func()) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, cancelSignals...)
+	ctx, cancel := cancelOnSignal(context.Background(), sigs)
+	return ctx, func() {
+		signal.Stop(sigs)
+		cancel()
+	}
+}
+
+// cancelOnSignal returns a context that is cancelled when a signal is
+// received on sigs
+func cancelOnSignal(parent context.Context, sigs <-chan os.Signal) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	go func() {
+		select {
+		case <-sigs:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// PluginMainContextWithError is like PluginMainWithError, but the callbacks
+// receive a context. The context is cancelled when the plugin process
+// receives SIGTERM or SIGINT, so that callbacks can abandon long-running work such as
+// delegating to IPAM plugins.
+func PluginMainContextWithError(cmdAdd, cmdCheck, cmdDel func(context.Context, *CmdArgs) error, versionInfo version.PluginInfo, about string, opts ...Option) *types.Error {
+	t := &dispatcher{
+		Getenv:  os.Getenv,
+		Environ: os.Environ,
+		Stdin:   os.Stdin,
+		Stdout:  os.Stdout,
+		Stderr:  os.Stderr,
+		Args:    os.Args[1:],
+		windows: isWindows,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	return t.pluginMainContext(ctx, cmdAdd, cmdCheck, cmdDel, versionInfo, about)
+}
+
+// PluginMainContext is like PluginMain, but the callbacks receive a
+// context that is cancelled when the plugin process receives SIGTERM or
+// SIGINT.
+func PluginMainContext(cmdAdd, cmdCheck, cmdDel func(context.Context, *CmdArgs) error, versionInfo version.PluginInfo, about string, opts ...Option) {
+	if e := PluginMainContextWithError(cmdAdd, cmdCheck, cmdDel, versionInfo, about, opts...); e != nil {
+		if err := printError(e, os.Getenv, os.Stdout); err != nil {
+			log.Print("Error writing error JSON: ", err)
+		}
+		os.Exit(ExitCode(e))
+	}
+}
+
+// CmdFuncs holds the callbacks for the CNI commands a plugin implements.
+// Commands whose callback is nil are rejected as unknown. New commands are
+// added as fields, so plugins using PluginMainFuncs keep compiling as the
+// specification grows.
+type CmdFuncs struct {
+	Add    func(*CmdArgs) error
+	Check  func(*CmdArgs) error
+	Del    func(*CmdArgs) error
+	Status func(*CmdArgs) error
+
+	// AddResult is used for ADD when Add is nil. Instead of printing the
+	// result itself, it returns it, and the dispatcher prints it converted
+	// to the version of the configuration.
+	AddResult func(*CmdArgs) (types.Result, error)
+}
+
+// PluginMainFuncsWithError is like PluginMainWithError, but takes the
+// callbacks as a CmdFuncs.
+func PluginMainFuncsWithError(funcs CmdFuncs, versionInfo version.PluginInfo, about string, opts ...Option) *types.Error {
+	return PluginMainWithError(funcs.Add, funcs.Check, funcs.Del, versionInfo, about, append(funcsOptions(funcs), opts...)...)
+}
+
+// funcsOptions returns the options that register the callbacks of funcs
+// that are not passed to the dispatcher directly
+func funcsOptions(funcs CmdFuncs) []Option {
+	var opts []Option
+	if funcs.AddResult != nil {
+		opts = append(opts, func(t *dispatcher) { t.addResult = funcs.AddResult })
+	}
+	if funcs.Status != nil {
+		opts = append(opts, WithStatus(funcs.Status))
+	}
+	return opts
+}
+
+// PluginMainFuncs is like PluginMain, but takes the callbacks as a
+// CmdFuncs.
+func PluginMainFuncs(funcs CmdFuncs, versionInfo version.PluginInfo, about string, opts ...Option) {
+	if e := PluginMainFuncsWithError(funcs, versionInfo, about, opts...); e != nil {
+		if err := printError(e, os.Getenv, os.Stdout); err != nil {
+			log.Print("Error writing error JSON: ", err)
 		}
-		os.Exit(1)
+		os.Exit(ExitCode(e))
 	}
 }
@@ -16,9 +16,18 @@ package skel
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/containernetworking/cni/pkg/types"
 	current "github.com/containernetworking/cni/pkg/types/100"
@@ -36,6 +45,7 @@ type fakeCmd struct {
 	}
 	Received struct {
 		CmdArgs *CmdArgs
+		Context context.Context
 	}
 }
 
@@ -45,6 +55,29 @@ func (c *fakeCmd) Func(args *CmdArgs) error {
 	return c.Returns.Error
 }
 
+func (c *fakeCmd) ContextFunc(ctx context.Context, args *CmdArgs) error {
+	c.Received.Context = ctx
+	return c.Func(args)
+}
+
+type logEntry struct {
+	Msg    string
+	Err    error
+	Fields []interface{}
+}
+
+type fakeLogger struct {
+	Entries []logEntry
+}
+
+func (l *fakeLogger) Info(msg string, keysAndValues ...interface{}) {
+	l.Entries = append(l.Entries, logEntry{Msg: msg, Fields: keysAndValues})
+}
+
+func (l *fakeLogger) Error(err error, msg string, keysAndValues ...interface{}) {
+	l.Entries = append(l.Entries, logEntry{Msg: msg, Err: err, Fields: keysAndValues})
+}
+
 var _ = Describe("dispatching to the correct callback", func() {
 	var (
 		environment              map[string]string
@@ -62,11 +95,11 @@ var _ = Describe("dispatching to the correct callback", func() {
 			"CNI_CONTAINERID": "some-container-id",
 			"CNI_NETNS":       "/some/netns/path",
 			"CNI_IFNAME":      "eth0",
-			"CNI_ARGS":        "some;extra;args",
+			"CNI_ARGS":        "some=extra;args=here",
 			"CNI_PATH":        "/some/cni/path",
 		}
 
-		stdinData = `{ "name":"skel-test", "some": "config", "cniVersion": "9.8.7" }`
+		stdinData = `{ "name":"skel-test", "type": "test", "some": "config", "cniVersion": "9.8.7" }`
 		stdout = &bytes.Buffer{}
 		stderr = &bytes.Buffer{}
 		versionInfo = version.PluginSupports("9.8.7")
@@ -83,12 +116,18 @@ var _ = Describe("dispatching to the correct callback", func() {
 			ContainerID: "some-container-id",
 			Netns:       "/some/netns/path",
 			IfName:      "eth0",
-			Args:        "some;extra;args",
+			IfNames:     []string{"eth0"},
+			Args:        "some=extra;args=here",
+			ParsedArgs:  map[string]string{"some": "extra", "args": "here"},
 			Path:        "/some/cni/path",
 			StdinData:   []byte(stdinData),
 		}
 	})
 
+	JustBeforeEach(func() {
+		expectedCmdArgs.Env = NewEnvironment(environment)
+	})
+
 	var envVarChecker = func(envVar string, isRequired bool) {
 		delete(environment, envVar)
 
@@ -120,7 +159,7 @@ var _ = Describe("dispatching to the correct callback", func() {
 			Expect(err).To(HaveOccurred())
 			Expect(err).To(Equal(&types.Error{
 				Code:    types.ErrInvalidEnvironmentVariables,
-				Msg:     "invalid characters in containerID",
+				Msg:     `invalid CNI_CONTAINERID "some-%%container-id": invalid characters in containerID`,
 				Details: "some-%%container-id",
 			}))
 		})
@@ -133,7 +172,7 @@ var _ = Describe("dispatching to the correct callback", func() {
 				Expect(err).To(HaveOccurred())
 				Expect(err).To(Equal(&types.Error{
 					Code:    types.ErrInvalidEnvironmentVariables,
-					Msg:     "interface name is too long",
+					Msg:     `invalid CNI_IFNAME "1234567890123456": interface name is too long`,
 					Details: "interface name should be less than 16 characters",
 				}))
 			})
@@ -145,7 +184,7 @@ var _ = Describe("dispatching to the correct callback", func() {
 				Expect(err).To(HaveOccurred())
 				Expect(err).To(Equal(&types.Error{
 					Code:    types.ErrInvalidEnvironmentVariables,
-					Msg:     "interface name is . or ..",
+					Msg:     `invalid CNI_IFNAME ".": interface name is . or ..`,
 					Details: "",
 				}))
 			})
@@ -157,7 +196,7 @@ var _ = Describe("dispatching to the correct callback", func() {
 				Expect(err).To(HaveOccurred())
 				Expect(err).To(Equal(&types.Error{
 					Code:    types.ErrInvalidEnvironmentVariables,
-					Msg:     "interface name is . or ..",
+					Msg:     `invalid CNI_IFNAME "..": interface name is . or ..`,
 					Details: "",
 				}))
 			})
@@ -169,7 +208,7 @@ var _ = Describe("dispatching to the correct callback", func() {
 				Expect(err).To(HaveOccurred())
 				Expect(err).To(Equal(&types.Error{
 					Code:    types.ErrInvalidEnvironmentVariables,
-					Msg:     "interface name contains / or : or whitespace characters",
+					Msg:     `invalid CNI_IFNAME "test/test": interface name contains / or : or whitespace characters`,
 					Details: "",
 				}))
 			})
@@ -181,7 +220,7 @@ var _ = Describe("dispatching to the correct callback", func() {
 				Expect(err).To(HaveOccurred())
 				Expect(err).To(Equal(&types.Error{
 					Code:    types.ErrInvalidEnvironmentVariables,
-					Msg:     "interface name contains / or : or whitespace characters",
+					Msg:     `invalid CNI_IFNAME "test:test": interface name contains / or : or whitespace characters`,
 					Details: "",
 				}))
 			})
@@ -193,7 +232,7 @@ var _ = Describe("dispatching to the correct callback", func() {
 				Expect(err).To(HaveOccurred())
 				Expect(err).To(Equal(&types.Error{
 					Code:    types.ErrInvalidEnvironmentVariables,
-					Msg:     "interface name contains / or : or whitespace characters",
+					Msg:     `invalid CNI_IFNAME "test test": interface name contains / or : or whitespace characters`,
 					Details: "",
 				}))
 			})
@@ -236,13 +275,13 @@ var _ = Describe("dispatching to the correct callback", func() {
 
 		Context("when the stdin data is missing the required cniVersion config", func() {
 			BeforeEach(func() {
-				dispatch.Stdin = strings.NewReader(`{ "name": "skel-test", "some": "config" }`)
+				dispatch.Stdin = strings.NewReader(`{ "name": "skel-test", "type": "test", "some": "config" }`)
 			})
 
 			Context("when the plugin supports version 0.1.0", func() {
 				BeforeEach(func() {
 					versionInfo = version.PluginSupports("0.1.0")
-					expectedCmdArgs.StdinData = []byte(`{ "name": "skel-test", "some": "config" }`)
+					expectedCmdArgs.StdinData = []byte(`{ "name": "skel-test", "type": "test", "some": "config" }`)
 				})
 
 				It("infers the config is 0.1.0 and calls the cmdAdd callback", func() {
@@ -277,6 +316,35 @@ var _ = Describe("dispatching to the correct callback", func() {
 		})
 	})
 
+	Context("when CNI_ARGS is malformed", func() {
+		DescribeTable("rejects the command without calling the callback",
+			func(args, expectedMsg string) {
+				environment["CNI_ARGS"] = args
+				err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+				Expect(err).To(Equal(types.NewError(types.ErrInvalidEnvironmentVariables, expectedMsg, "")))
+				Expect(cmdAdd.CallCount).To(Equal(0))
+			},
+			Entry("missing value", "FOO=BAR;BAZ", `invalid CNI_ARGS: "BAZ" is not a KEY=VALUE pair`),
+			Entry("empty key", "=BAR", `invalid CNI_ARGS: "=BAR" has an empty key`),
+			Entry("duplicate key", "FOO=BAR;FOO=BAZ", `invalid CNI_ARGS: duplicate key "FOO"`),
+		)
+
+		It("ignores empty pairs and keeps = in values", func() {
+			environment["CNI_ARGS"] = "FOO=a=b;;BAR=;"
+			err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cmdAdd.Received.CmdArgs.Args).To(Equal("FOO=a=b;;BAR=;"))
+			Expect(cmdAdd.Received.CmdArgs.ParsedArgs).To(Equal(map[string]string{"FOO": "a=b", "BAR": ""}))
+		})
+
+		It("provides an empty map when CNI_ARGS is unset", func() {
+			delete(environment, "CNI_ARGS")
+			err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cmdAdd.Received.CmdArgs.ParsedArgs).To(BeEmpty())
+		})
+	})
+
 	Context("when the CNI_COMMAND is CHECK", func() {
 		BeforeEach(func() {
 			environment["CNI_COMMAND"] = "CHECK"
@@ -329,7 +397,7 @@ var _ = Describe("dispatching to the correct callback", func() {
 
 		Context("when cniVersion is less than 0.4.0", func() {
 			It("immediately returns a useful error", func() {
-				dispatch.Stdin = strings.NewReader(`{ "name": "skel-test", "cniVersion": "0.3.0", "some": "config" }`)
+				dispatch.Stdin = strings.NewReader(`{ "name": "skel-test", "type": "test", "cniVersion": "0.3.0", "some": "config" }`)
 				err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
 				Expect(err.Code).To(Equal(types.ErrIncompatibleCNIVersion)) // see https://github.com/containernetworking/cni/blob/master/SPEC.md#well-known-error-codes
 				Expect(err.Msg).To(Equal("config version does not allow CHECK"))
@@ -341,7 +409,7 @@ var _ = Describe("dispatching to the correct callback", func() {
 
 		Context("when plugin does not support 0.4.0", func() {
 			It("immediately returns a useful error", func() {
-				dispatch.Stdin = strings.NewReader(`{ "name": "skel-test", "cniVersion": "0.4.0", "some": "config" }`)
+				dispatch.Stdin = strings.NewReader(`{ "name": "skel-test", "type": "test", "cniVersion": "0.4.0", "some": "config" }`)
 				versionInfo = version.PluginSupports("0.1.0", "0.2.0", "0.3.0")
 				err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
 				Expect(err.Code).To(Equal(types.ErrIncompatibleCNIVersion)) // see https://github.com/containernetworking/cni/blob/master/SPEC.md#well-known-error-codes
@@ -354,10 +422,11 @@ var _ = Describe("dispatching to the correct callback", func() {
 
 		Context("when the config has a bad version", func() {
 			It("immediately returns a useful error", func() {
-				dispatch.Stdin = strings.NewReader(`{ "cniVersion": "adsfsadf", "some": "config", "name": "test" }`)
+				dispatch.Stdin = strings.NewReader(`{ "cniVersion": "adsfsadf", "some": "config", "name": "test", "type": "test" }`)
 				versionInfo = version.PluginSupports("0.1.0", "0.2.0", "0.3.0")
 				err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
-				Expect(err.Code).To(Equal(uint(types.ErrDecodingFailure)))
+				Expect(err.Code).To(Equal(uint(types.ErrInvalidNetworkConfig)))
+				Expect(err.Msg).To(Equal(`invalid cniVersion "adsfsadf"`))
 				Expect(cmdAdd.CallCount).To(Equal(0))
 				Expect(cmdCheck.CallCount).To(Equal(0))
 				Expect(cmdDel.CallCount).To(Equal(0))
@@ -366,7 +435,7 @@ var _ = Describe("dispatching to the correct callback", func() {
 
 		Context("when the config has a bad name", func() {
 			It("immediately returns invalid network config", func() {
-				dispatch.Stdin = strings.NewReader(`{ "cniVersion": "0.4.0", "some": "config", "name": "te%%st" }`)
+				dispatch.Stdin = strings.NewReader(`{ "cniVersion": "0.4.0", "some": "config", "name": "te%%st", "type": "test" }`)
 				versionInfo = version.PluginSupports("0.1.0", "0.2.0", "0.3.0", "0.4.0")
 				err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
 				Expect(err.Code).To(Equal(uint(types.ErrInvalidNetworkConfig)))
@@ -378,7 +447,7 @@ var _ = Describe("dispatching to the correct callback", func() {
 
 		Context("when the plugin has a bad version", func() {
 			It("immediately returns a useful error", func() {
-				dispatch.Stdin = strings.NewReader(`{ "cniVersion": "0.4.0", "some": "config", "name": "test" }`)
+				dispatch.Stdin = strings.NewReader(`{ "cniVersion": "0.4.0", "some": "config", "name": "test", "type": "test" }`)
 				versionInfo = version.PluginSupports("0.1.0", "0.2.0", "adsfasdf")
 				err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
 				Expect(err.Code).To(Equal(uint(types.ErrDecodingFailure)))
@@ -389,6 +458,54 @@ var _ = Describe("dispatching to the correct callback", func() {
 		})
 	})
 
+	Context("when the CNI_COMMAND is STATUS", func() {
+		var cmdStatus *fakeCmd
+
+		BeforeEach(func() {
+			environment = map[string]string{"CNI_COMMAND": "STATUS"}
+			dispatch.Stdin = strings.NewReader(`{ "name": "skel-test", "type": "test", "cniVersion": "1.1.0" }`)
+			versionInfo = version.PluginSupports("1.0.0", "1.1.0")
+			cmdStatus = &fakeCmd{}
+			WithStatus(cmdStatus.Func)(dispatch)
+		})
+
+		It("calls cmdStatus without requiring attachment env vars", func() {
+			err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cmdStatus.CallCount).To(Equal(1))
+			Expect(cmdAdd.CallCount).To(Equal(0))
+			Expect(cmdCheck.CallCount).To(Equal(0))
+			Expect(cmdDel.CallCount).To(Equal(0))
+		})
+
+		It("returns the error from cmdStatus", func() {
+			cmdStatus.Returns.Error = types.NewError(types.ErrTryAgainLater, "not ready", "")
+			err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err).To(Equal(types.NewError(types.ErrTryAgainLater, "not ready", "")))
+		})
+
+		It("rejects configurations older than 1.1.0", func() {
+			dispatch.Stdin = strings.NewReader(`{ "name": "skel-test", "type": "test", "cniVersion": "1.0.0" }`)
+			err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err).To(Equal(types.NewError(types.ErrIncompatibleCNIVersion, "config version does not allow STATUS", "")))
+			Expect(cmdStatus.CallCount).To(Equal(0))
+		})
+
+		It("rejects plugins that do not support 1.1.0", func() {
+			versionInfo = version.PluginSupports("1.0.0")
+			err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err).To(Equal(types.NewError(types.ErrIncompatibleCNIVersion, "plugin version does not allow STATUS", "")))
+			Expect(cmdStatus.CallCount).To(Equal(0))
+		})
+
+		It("reports an unknown command when no STATUS callback is registered", func() {
+			dispatch.cmdStatus = nil
+			err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err).To(Equal(types.NewError(types.ErrInvalidEnvironmentVariables, "unknown CNI_COMMAND: STATUS", "")))
+		})
+	})
+
 	Context("when the CNI_COMMAND is DEL", func() {
 		BeforeEach(func() {
 			environment["CNI_COMMAND"] = "DEL"
@@ -409,6 +526,18 @@ var _ = Describe("dispatching to the correct callback", func() {
 			Expect(cmdAdd.CallCount).To(Equal(0))
 		})
 
+		It("validates the interface name before reading the configuration", func() {
+			environment["CNI_IFNAME"] = "eth 0"
+			dispatch.Stdin = strings.NewReader("not json")
+
+			err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err).To(Equal(&types.Error{
+				Code: types.ErrInvalidEnvironmentVariables,
+				Msg:  `invalid CNI_IFNAME "eth 0": interface name contains / or : or whitespace characters`,
+			}))
+			Expect(cmdDel.CallCount).To(Equal(0))
+		})
+
 		DescribeTable("required / optional env vars", envVarChecker,
 			Entry("command", "CNI_COMMAND", true),
 			Entry("container id", "CNI_CONTAINERID", true),
@@ -542,6 +671,75 @@ var _ = Describe("dispatching to the correct callback", func() {
 		})
 	})
 
+	Context("when stdin is larger than the maximum size", func() {
+		BeforeEach(func() {
+			WithMaxStdinSize(int64(len(stdinData) - 1))(dispatch)
+		})
+
+		It("returns an error without calling any cmd callback", func() {
+			err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err).To(Equal(&types.Error{
+				Code: types.ErrInvalidNetworkConfig,
+				Msg:  fmt.Sprintf("network configuration on stdin exceeds the maximum size of %d bytes", len(stdinData)-1),
+			}))
+			Expect(cmdAdd.CallCount).To(Equal(0))
+		})
+
+		It("accepts a configuration of exactly the maximum size", func() {
+			WithMaxStdinSize(int64(len(stdinData)))(dispatch)
+			err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cmdAdd.Received.CmdArgs.StdinData).To(Equal([]byte(stdinData)))
+		})
+
+		It("accepts any size when the limit is removed", func() {
+			WithMaxStdinSize(0)(dispatch)
+			err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cmdAdd.CallCount).To(Equal(1))
+		})
+	})
+
+	Context("when CNI_NETCONF_PATH is set", func() {
+		var dir, fileData string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "cni-netconf")
+			Expect(err).NotTo(HaveOccurred())
+			fileData = `{ "name":"skel-test", "type": "test", "from": "file", "cniVersion": "9.8.7" }`
+			path := filepath.Join(dir, "net.conf")
+			Expect(ioutil.WriteFile(path, []byte(fileData), 0600)).To(Succeed())
+			environment["CNI_NETCONF_PATH"] = path
+			expectedCmdArgs.StdinData = []byte(fileData)
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(dir)).To(Succeed())
+		})
+
+		It("reads the configuration from the file instead of stdin", func() {
+			err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cmdAdd.Received.CmdArgs).To(Equal(expectedCmdArgs))
+		})
+
+		It("fails when the file cannot be read", func() {
+			environment["CNI_NETCONF_PATH"] = filepath.Join(dir, "missing.conf")
+			err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err.Code).To(Equal(types.ErrIOFailure))
+			Expect(err.Msg).To(HavePrefix("error reading CNI_NETCONF_PATH: "))
+			Expect(cmdAdd.CallCount).To(Equal(0))
+		})
+
+		It("applies the maximum size to the file", func() {
+			WithMaxStdinSize(int64(len(fileData) - 1))(dispatch)
+			err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err.Code).To(Equal(types.ErrInvalidNetworkConfig))
+			Expect(err.Msg).To(ContainSubstring("exceeds the maximum size"))
+		})
+	})
+
 	Context("when the callback returns an error", func() {
 		Context("when it is a typed Error", func() {
 			BeforeEach(func() {
@@ -575,7 +773,726 @@ var _ = Describe("dispatching to the correct callback", func() {
 				}))
 			})
 		})
+
+		Context("when DEL on ADD failure is enabled", func() {
+			BeforeEach(func() {
+				WithDelOnAddFailure()(dispatch)
+				cmdAdd.Returns.Error = errors.New("potato")
+			})
+
+			It("calls cmdDel with the same args and returns the ADD error", func() {
+				err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+
+				Expect(err).To(Equal(&types.Error{
+					Code: types.ErrInternal,
+					Msg:  "potato",
+				}))
+				Expect(cmdAdd.CallCount).To(Equal(1))
+				Expect(cmdDel.CallCount).To(Equal(1))
+				Expect(cmdDel.Received.CmdArgs).To(BeIdenticalTo(cmdAdd.Received.CmdArgs))
+			})
+
+			It("runs cmdDel with a fresh, bounded context when ADD was cancelled", func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				var delErr error
+				var delDeadline bool
+				add := func(ctx context.Context, _ *CmdArgs) error { return ctx.Err() }
+				del := func(ctx context.Context, _ *CmdArgs) error {
+					delErr = ctx.Err()
+					_, delDeadline = ctx.Deadline()
+					return nil
+				}
+				err := dispatch.pluginMainContext(ctx, add, nil, del, versionInfo, "")
+				Expect(err).To(HaveOccurred())
+				Expect(delErr).NotTo(HaveOccurred())
+				Expect(delDeadline).To(BeTrue())
+			})
+
+			It("logs a failing cleanup DEL and still returns the ADD error", func() {
+				cmdDel.Returns.Error = errors.New("tomato")
+				err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+
+				Expect(err).To(Equal(&types.Error{
+					Code: types.ErrInternal,
+					Msg:  "potato",
+				}))
+				Expect(stderr.String()).To(ContainSubstring("cleanup DEL after failed ADD failed: tomato"))
+			})
+
+			It("does not call cmdDel when ADD succeeds", func() {
+				cmdAdd.Returns.Error = nil
+				err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(cmdDel.CallCount).To(Equal(0))
+			})
+		})
+	})
+
+	Context("when the callback panics", func() {
+		panicking := func(_ *CmdArgs) error {
+			panic("potato")
+		}
+
+		It("returns an internal error with the stack trace", func() {
+			err := dispatch.pluginMain(panicking, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+
+			Expect(err.Code).To(Equal(types.ErrInternal))
+			Expect(err.Msg).To(Equal("plugin panicked: potato"))
+			Expect(err.Details).To(ContainSubstring("goroutine"))
+			Expect(err.Details).To(ContainSubstring("skel_test.go"))
+		})
+	})
+
+	Context("when hooks are registered", func() {
+		var calls []string
+
+		BeforeEach(func() {
+			calls = nil
+			WithHooks(func(cmd string, args *CmdArgs) {
+				calls = append(calls, "before1 "+cmd+" "+args.ContainerID)
+			}, func(cmd string, args *CmdArgs, err error) {
+				calls = append(calls, fmt.Sprintf("after1 %s %v", cmd, err))
+			})(dispatch)
+			WithHooks(func(cmd string, args *CmdArgs) {
+				calls = append(calls, "before2 "+cmd)
+			}, func(cmd string, args *CmdArgs, err error) {
+				calls = append(calls, fmt.Sprintf("after2 %s %v", cmd, err))
+			})(dispatch)
+		})
+
+		It("calls them around the callback in order", func() {
+			cmdAdd.Returns.Error = errors.New("potato")
+			err := dispatch.pluginMain(func(args *CmdArgs) error {
+				calls = append(calls, "add")
+				return cmdAdd.Func(args)
+			}, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err).To(HaveOccurred())
+
+			Expect(calls).To(Equal([]string{
+				"before1 ADD some-container-id",
+				"before2 ADD",
+				"add",
+				"after2 ADD potato",
+				"after1 ADD potato",
+			}))
+		})
+
+		It("does not call them for VERSION", func() {
+			environment["CNI_COMMAND"] = "VERSION"
+			err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(calls).To(BeEmpty())
+		})
+	})
+
+	Context("when a logger is set", func() {
+		var logger *fakeLogger
+
+		BeforeEach(func() {
+			logger = &fakeLogger{}
+			WithLogger(logger)(dispatch)
+		})
+
+		It("logs the dispatched command and its outcome", func() {
+			err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err).NotTo(HaveOccurred())
+
+			fields := []interface{}{"command", "ADD", "containerID", "some-container-id", "ifName", "eth0"}
+			Expect(logger.Entries).To(Equal([]logEntry{
+				{Msg: "dispatching command", Fields: fields},
+				{Msg: "command succeeded", Fields: fields},
+			}))
+		})
+
+		It("logs version mismatches with the error code", func() {
+			versionInfo = version.PluginSupports("1.2.3")
+			err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err).To(HaveOccurred())
+
+			Expect(logger.Entries).To(HaveLen(2))
+			Expect(logger.Entries[1].Msg).To(Equal("command failed"))
+			Expect(logger.Entries[1].Err).To(Equal(err))
+			Expect(logger.Entries[1].Fields).To(ContainElement(types.ErrIncompatibleCNIVersion))
+		})
+
+		It("logs argument parsing failures", func() {
+			delete(environment, "CNI_IFNAME")
+			err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err).To(HaveOccurred())
+
+			Expect(logger.Entries).To(Equal([]logEntry{{
+				Msg:    "failed to parse plugin arguments",
+				Err:    err,
+				Fields: []interface{}{"command", "ADD", "code", types.ErrInvalidEnvironmentVariables},
+			}}))
+		})
+	})
+
+	Context("when CNI_DRYRUN is set", func() {
+		BeforeEach(func() {
+			environment["CNI_DRYRUN"] = "1"
+			expectedCmdArgs.DryRun = true
+		})
+
+		It("does not call the command's callback", func() {
+			err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cmdAdd.CallCount).To(Equal(0))
+			Expect(stdout.String()).To(BeEmpty())
+		})
+
+		It("calls the validate callback instead", func() {
+			cmdValidate := &fakeCmd{}
+			WithValidate(cmdValidate.Func)(dispatch)
+			err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cmdAdd.CallCount).To(Equal(0))
+			Expect(cmdValidate.CallCount).To(Equal(1))
+			Expect(cmdValidate.Received.CmdArgs).To(Equal(expectedCmdArgs))
+		})
+
+		It("takes no locks and writes no output or metrics", func() {
+			dir, err := ioutil.TempDir("", "skel-dryrun")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(dir)
+			environment["CNI_OUTPUT"] = filepath.Join(dir, "result.json")
+			WithAttachmentLock(filepath.Join(dir, "locks"))(dispatch)
+			WithMetrics(filepath.Join(dir, "metrics"))(dispatch)
+			WithValidate(func(*CmdArgs) error { return nil })(dispatch)
+
+			Expect(dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")).To(BeNil())
+			entries, err := ioutil.ReadDir(dir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(BeEmpty())
+		})
+
+		It("returns the validate callback's error", func() {
+			WithValidate(func(_ *CmdArgs) error { return errors.New("bad bridge name") })(dispatch)
+			err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err).To(Equal(types.NewError(types.ErrInternal, "bad bridge name", "")))
+		})
+
+		It("still checks the versions", func() {
+			versionInfo = version.PluginSupports("1.0.0")
+			err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err.Code).To(Equal(types.ErrIncompatibleCNIVersion))
+		})
+
+		It("rejects a value that is not a boolean", func() {
+			environment["CNI_DRYRUN"] = "maybe"
+			err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err).To(Equal(types.NewError(types.ErrInvalidEnvironmentVariables, `invalid CNI_DRYRUN: "maybe" is not a boolean`, "")))
+		})
+
+		It("is off for false values", func() {
+			environment["CNI_DRYRUN"] = "0"
+			err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cmdAdd.CallCount).To(Equal(1))
+			Expect(cmdAdd.Received.CmdArgs.DryRun).To(BeFalse())
+		})
+	})
+
+	Context("when prevResult decoding is enabled", func() {
+		BeforeEach(func() {
+			environment["CNI_COMMAND"] = "CHECK"
+			versionInfo = version.PluginSupports("1.0.0")
+			WithPrevResult("CHECK")(dispatch)
+		})
+
+		It("decodes the prevResult as the configuration's version", func() {
+			dispatch.Stdin = strings.NewReader(`{"cniVersion": "1.0.0", "name": "mynet", "type": "test", "prevResult": {"interfaces": [{"name": "eth0"}], "ips": [{"address": "10.0.0.2/24", "interface": 0}]}}`)
+			err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err).NotTo(HaveOccurred())
+
+			result, ok := cmdCheck.Received.CmdArgs.PrevResult.(*current.Result)
+			Expect(ok).To(BeTrue())
+			Expect(result.CNIVersion).To(Equal("1.0.0"))
+			Expect(result.Interfaces).To(HaveLen(1))
+			Expect(result.IPs[0].Address.String()).To(Equal("10.0.0.2/24"))
+		})
+
+		It("fails when a required prevResult is missing", func() {
+			dispatch.Stdin = strings.NewReader(`{"cniVersion": "1.0.0", "name": "mynet", "type": "test"}`)
+			err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err).To(Equal(types.NewError(types.ErrInvalidNetworkConfig, "CHECK requires a prevResult", "the plugin must be chained after a plugin that returns a result")))
+			Expect(cmdCheck.CallCount).To(Equal(0))
+		})
+
+		It("leaves PrevResult nil when an optional prevResult is missing", func() {
+			environment["CNI_COMMAND"] = "DEL"
+			dispatch.Stdin = strings.NewReader(`{"cniVersion": "1.0.0", "name": "mynet", "type": "test"}`)
+			err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cmdDel.CallCount).To(Equal(1))
+			Expect(cmdDel.Received.CmdArgs.PrevResult).To(BeNil())
+		})
+
+		It("fails when the prevResult is malformed", func() {
+			dispatch.Stdin = strings.NewReader(`{"cniVersion": "1.0.0", "name": "mynet", "type": "test", "prevResult": {"ips": [{"address": "bogus"}]}}`)
+			err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err.Code).To(Equal(types.ErrDecodingFailure))
+			Expect(err.Msg).To(Equal("failed to decode prevResult"))
+			Expect(cmdCheck.CallCount).To(Equal(0))
+		})
+	})
+
+	Context("when a timeout is set", func() {
+		var (
+			release  chan struct{}
+			blocking func(*CmdArgs) error
+			grace    time.Duration
+		)
+
+		BeforeEach(func() {
+			grace = timeoutGracePeriod
+			timeoutGracePeriod = 10 * time.Millisecond
+			// callbacks outlive the test, so they must not read release
+			ch := make(chan struct{})
+			release = ch
+			blocking = func(_ *CmdArgs) error {
+				<-ch
+				return nil
+			}
+		})
+
+		AfterEach(func() {
+			close(release)
+			timeoutGracePeriod = grace
+		})
+
+		It("returns a timeout error when the callback does not finish", func() {
+			WithTimeout(10 * time.Millisecond)(dispatch)
+			err := dispatch.pluginMain(blocking, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err).To(Equal(types.NewError(types.ErrTimeout, "ADD timed out after 10ms", "")))
+		})
+
+		It("cancels the callback's context", func() {
+			WithTimeout(10 * time.Millisecond)(dispatch)
+			cancelled := make(chan error, 1)
+			block := blocking
+			err := dispatch.pluginMainContext(context.Background(), func(ctx context.Context, args *CmdArgs) error {
+				<-ctx.Done()
+				cancelled <- ctx.Err()
+				return block(args)
+			}, nil, nil, versionInfo, "")
+			Expect(err.Code).To(Equal(types.ErrTimeout))
+			Eventually(cancelled).Should(Receive(Equal(context.DeadlineExceeded)))
+		})
+
+		It("waits for a cancelled callback to return", func() {
+			timeoutGracePeriod = time.Minute
+			WithTimeout(10 * time.Millisecond)(dispatch)
+			var returned int32
+			err := dispatch.pluginMainContext(context.Background(), func(ctx context.Context, _ *CmdArgs) error {
+				<-ctx.Done()
+				time.Sleep(10 * time.Millisecond)
+				atomic.StoreInt32(&returned, 1)
+				return ctx.Err()
+			}, nil, nil, versionInfo, "")
+			Expect(err.Code).To(Equal(types.ErrTimeout))
+			Expect(atomic.LoadInt32(&returned)).To(Equal(int32(1)))
+		})
+
+		It("does not blame the timeout for the caller's earlier deadline", func() {
+			WithTimeout(time.Minute)(dispatch)
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			err := dispatch.pluginMainContext(ctx, func(ctx context.Context, _ *CmdArgs) error {
+				<-ctx.Done()
+				return ctx.Err()
+			}, nil, nil, versionInfo, "")
+			Expect(err.Code).To(Equal(types.ErrTimeout))
+			Expect(err.Msg).NotTo(ContainSubstring("timed out after 1m0s"))
+		})
+
+		It("returns the callback's result when it finishes in time", func() {
+			WithTimeout(time.Minute)(dispatch)
+			cmdAdd.Returns.Error = errors.New("potato")
+			err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err).To(Equal(types.NewError(types.ErrInternal, "potato", "")))
+		})
+
+		It("recovers panics in the callback", func() {
+			WithTimeout(time.Minute)(dispatch)
+			err := dispatch.pluginMain(func(_ *CmdArgs) error { panic("potato") }, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err.Msg).To(Equal("plugin panicked: potato"))
+		})
+
+		It("reads the timeout from CNI_TIMEOUT", func() {
+			WithTimeout(time.Minute)(dispatch)
+			environment["CNI_TIMEOUT"] = "0.01s"
+			err := dispatch.pluginMain(blocking, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err).To(Equal(types.NewError(types.ErrTimeout, "ADD timed out after 10ms", "")))
+		})
+
+		It("does not keep CNI_TIMEOUT for later invocations", func() {
+			WithTimeout(time.Minute)(dispatch)
+			environment["CNI_TIMEOUT"] = "0.01s"
+			Expect(dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")).To(BeNil())
+			Expect(dispatch.timeout).To(Equal(time.Minute))
+		})
+
+		DescribeTable("rejects an invalid CNI_TIMEOUT",
+			func(timeout, expectedMsg string) {
+				environment["CNI_TIMEOUT"] = timeout
+				err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+				Expect(err.Code).To(Equal(types.ErrInvalidEnvironmentVariables))
+				Expect(err.Msg).To(HavePrefix(expectedMsg))
+				Expect(cmdAdd.CallCount).To(Equal(0))
+			},
+			Entry("garbage", "soon", `invalid CNI_TIMEOUT: time: invalid duration`),
+			Entry("zero", "0", `invalid CNI_TIMEOUT: "0" is not positive`),
+			Entry("negative", "-5s", `invalid CNI_TIMEOUT: "-5s" is not positive`),
+		)
+	})
+
+	Context("when an error hook is set", func() {
+		var seen []string
+
+		BeforeEach(func() {
+			seen = nil
+			WithOnError(func(cmd string, err *types.Error) *types.Error {
+				seen = append(seen, cmd)
+				if err.Code == types.ErrInternal {
+					return types.NewError(100, err.Msg, "see the plugin documentation")
+				}
+				return nil
+			})(dispatch)
+		})
+
+		It("reports the error the hook returns", func() {
+			cmdAdd.Returns.Error = errors.New("potato")
+			err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err).To(Equal(types.NewError(100, "potato", "see the plugin documentation")))
+			Expect(seen).To(Equal([]string{"ADD"}))
+		})
+
+		It("reports the original error when the hook returns nil", func() {
+			delete(environment, "CNI_CONTAINERID")
+			err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err.Code).To(Equal(types.ErrInvalidEnvironmentVariables))
+			Expect(seen).To(Equal([]string{"ADD"}))
+		})
+
+		It("is not called when the command succeeds", func() {
+			err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(seen).To(BeEmpty())
+		})
+	})
+
+	Context("when a callback is nil", func() {
+		It("rejects the command as unknown", func() {
+			environment["CNI_COMMAND"] = "CHECK"
+			err := dispatch.pluginMain(cmdAdd.Func, nil, cmdDel.Func, versionInfo, "")
+			Expect(err).To(Equal(types.NewError(types.ErrInvalidEnvironmentVariables, "unknown CNI_COMMAND: CHECK", "")))
+			Expect(cmdAdd.CallCount).To(Equal(0))
+			Expect(cmdDel.CallCount).To(Equal(0))
+		})
+
+		It("dispatches the commands that have a callback", func() {
+			err := dispatch.pluginMain(cmdAdd.Func, nil, nil, versionInfo, "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cmdAdd.CallCount).To(Equal(1))
+		})
+	})
+
+	Context("when an extension command is registered", func() {
+		var cmdVendor *fakeCmd
+
+		BeforeEach(func() {
+			cmdVendor = &fakeCmd{}
+			WithCommand("VENDOR_X", cmdVendor.Func)(dispatch)
+		})
+
+		It("calls the registered callback", func() {
+			environment["CNI_COMMAND"] = "VENDOR_X"
+			err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cmdVendor.CallCount).To(Equal(1))
+			Expect(cmdVendor.Received.CmdArgs.ContainerID).To(Equal("some-container-id"))
+			Expect(cmdVendor.Received.CmdArgs.StdinData).To(Equal([]byte(stdinData)))
+			Expect(cmdAdd.CallCount).To(Equal(0))
+		})
+
+		It("does not require the attachment variables", func() {
+			environment = map[string]string{"CNI_COMMAND": "VENDOR_X"}
+			err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cmdVendor.CallCount).To(Equal(1))
+		})
+
+		It("still rejects commands that are not registered", func() {
+			environment["CNI_COMMAND"] = "VENDOR_Y"
+			err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err).To(Equal(types.NewError(types.ErrInvalidEnvironmentVariables, "unknown CNI_COMMAND: VENDOR_Y", "")))
+			Expect(cmdVendor.CallCount).To(Equal(0))
+		})
+
+		It("does not override the standard commands", func() {
+			WithCommand("ADD", cmdVendor.Func)(dispatch)
+			err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cmdAdd.CallCount).To(Equal(1))
+			Expect(cmdVendor.CallCount).To(Equal(0))
+		})
+	})
+
+	Context("when the ADD callback returns a result", func() {
+		var result *current.Result
+
+		BeforeEach(func() {
+			dispatch.Stdin = strings.NewReader(`{"cniVersion": "0.4.0", "name": "mynet", "type": "test"}`)
+			versionInfo = version.PluginSupports("0.4.0", "1.0.0")
+			result = &current.Result{
+				CNIVersion: "1.0.0",
+				Interfaces: []*current.Interface{{Name: "eth0"}},
+			}
+			dispatch.addResult = func(_ *CmdArgs) (types.Result, error) {
+				return result, nil
+			}
+		})
+
+		It("prints the result as the version of the configuration", func() {
+			err := dispatch.pluginMain(nil, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stdout.String()).To(ContainSubstring(`"cniVersion": "0.4.0"`))
+			Expect(stdout.String()).To(ContainSubstring(`"name": "eth0"`))
+		})
+
+		It("fails when the callback returns no result", func() {
+			dispatch.addResult = func(_ *CmdArgs) (types.Result, error) {
+				return nil, nil
+			}
+			err := dispatch.pluginMain(nil, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err).To(Equal(types.NewError(types.ErrInternal, "plugin returned no result", "")))
+			Expect(stdout.String()).To(BeEmpty())
+		})
+
+		It("fails when the result cannot be converted", func() {
+			route := 5
+			result.Routes = []*types.Route{{Dst: net.IPNet{IP: net.IPv4zero, Mask: net.CIDRMask(0, 32)}, Table: &route}}
+			err := dispatch.pluginMain(nil, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err.Code).To(Equal(types.ErrIncompatibleCNIVersion))
+			Expect(err.Msg).To(Equal("failed to convert result to version 0.4.0"))
+			Expect(stdout.String()).To(BeEmpty())
+		})
+
+		It("prefers a plain ADD callback", func() {
+			err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cmdAdd.CallCount).To(Equal(1))
+			Expect(stdout.String()).To(BeEmpty())
+		})
+	})
+
+	Context("when the callback emits warnings", func() {
+		It("writes each warning to stderr as a line of JSON", func() {
+			add := func(args *CmdArgs) error {
+				args.Warn("field %q is deprecated", "ipMasq")
+				args.Warn("mtu is ignored")
+				return nil
+			}
+			err := dispatch.pluginMain(add, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stdout.String()).To(BeEmpty())
+
+			lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+			Expect(lines).To(HaveLen(2))
+			var warning Warning
+			Expect(json.Unmarshal([]byte(lines[0]), &warning)).To(Succeed())
+			Expect(warning).To(Equal(Warning{
+				Command:     "ADD",
+				ContainerID: "some-container-id",
+				Message:     `field "ipMasq" is deprecated`,
+			}))
+			Expect(lines[1]).To(MatchJSON(`{"command":"ADD","containerID":"some-container-id","warning":"mtu is ignored"}`))
+		})
+
+		It("still reports the warnings when the callback fails", func() {
+			add := func(args *CmdArgs) error {
+				args.Warn("mtu is ignored")
+				return errors.New("boom")
+			}
+			err := dispatch.pluginMain(add, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err).To(HaveOccurred())
+			Expect(stderr.String()).To(ContainSubstring(`"warning":"mtu is ignored"`))
+		})
+	})
+
+	Describe("environment snapshot", func() {
+		It("captures all CNI_* variables when the environment can be listed", func() {
+			dispatch.Environ = func() []string {
+				env := []string{"HOME=/root", "CNI_VENDOR_KNOB=on"}
+				for k, v := range environment {
+					env = append(env, k+"="+v)
+				}
+				return env
+			}
+			err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err).NotTo(HaveOccurred())
+
+			env := cmdAdd.Received.CmdArgs.Env
+			Expect(env.Get("CNI_VENDOR_KNOB")).To(Equal("on"))
+			Expect(env.Get("CNI_IFNAME")).To(Equal("eth0"))
+			_, ok := env.Lookup("HOME")
+			Expect(ok).To(BeFalse())
+			Expect(env.Names()).To(ContainElement("CNI_COMMAND"))
+		})
+
+		It("is not affected by later changes to the environment", func() {
+			err := dispatch.pluginMain(func(args *CmdArgs) error {
+				environment["CNI_IFNAME"] = "eth1"
+				return cmdAdd.Func(args)
+			}, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cmdAdd.Received.CmdArgs.Env.Get("CNI_IFNAME")).To(Equal("eth0"))
+		})
+
+		Context("when variables were moved to an environment file", func() {
+			var envFile string
+
+			BeforeEach(func() {
+				f, err := ioutil.TempFile("", "skel-env")
+				Expect(err).NotTo(HaveOccurred())
+				_, err = f.WriteString(`{"CNI_ARGS": "some=extra;args=here", "HOME": "/root"}`)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(f.Close()).To(Succeed())
+				envFile = f.Name()
+
+				delete(environment, "CNI_ARGS")
+				environment["CNI_ENV_FILE"] = envFile
+			})
+
+			AfterEach(func() {
+				Expect(os.Remove(envFile)).To(Succeed())
+			})
+
+			It("reads the CNI_* variables from the file", func() {
+				err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+				Expect(err).NotTo(HaveOccurred())
+
+				args := cmdAdd.Received.CmdArgs
+				Expect(args.Args).To(Equal("some=extra;args=here"))
+				Expect(args.ParsedArgs).To(Equal(map[string]string{"some": "extra", "args": "here"}))
+				_, ok := args.Env.Lookup("HOME")
+				Expect(ok).To(BeFalse())
+			})
+
+			It("fails when the file cannot be read", func() {
+				environment["CNI_ENV_FILE"] = envFile + ".missing"
+				err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+				Expect(err.Code).To(Equal(types.ErrIOFailure))
+				Expect(err.Msg).To(HavePrefix("failed to read CNI_ENV_FILE: "))
+				Expect(cmdAdd.CallCount).To(Equal(0))
+			})
+
+			It("passes the command from the file to the error hook", func() {
+				Expect(ioutil.WriteFile(envFile, []byte(`{"CNI_COMMAND": "ADD", "CNI_ARGS": "some=extra;args=here"}`), 0600)).To(Succeed())
+				delete(environment, "CNI_COMMAND")
+				var seen []string
+				WithOnError(func(cmd string, err *types.Error) *types.Error {
+					seen = append(seen, cmd)
+					return nil
+				})(dispatch)
+
+				cmdAdd.Returns.Error = errors.New("potato")
+				err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+				Expect(err).To(HaveOccurred())
+				Expect(seen).To(Equal([]string{"ADD"}))
+			})
+		})
+	})
+
+	Describe("context-aware callbacks", func() {
+		It("passes the context to the callback", func() {
+			ctx := context.WithValue(context.Background(), fakeCmd{}, "potato")
+			err := dispatch.pluginMainContext(ctx, cmdAdd.ContextFunc, cmdCheck.ContextFunc, cmdDel.ContextFunc, versionInfo, "")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(cmdAdd.CallCount).To(Equal(1))
+			Expect(cmdAdd.Received.CmdArgs).To(Equal(expectedCmdArgs))
+			Expect(cmdAdd.Received.Context.Value(fakeCmd{})).To(Equal("potato"))
+		})
+
+		It("cancels the context when a signal is received", func() {
+			sigs := make(chan os.Signal, 1)
+			ctx, cancel := cancelOnSignal(context.Background(), sigs)
+			defer cancel()
+			Expect(ctx.Err()).NotTo(HaveOccurred())
+
+			sigs <- syscall.SIGTERM
+			Eventually(ctx.Done()).Should(BeClosed())
+			Expect(ctx.Err()).To(Equal(context.Canceled))
+		})
+	})
+
+	Context("when a cancel handler is registered", func() {
+		var cancelled chan *CmdArgs
+
+		BeforeEach(func() {
+			c := make(chan *CmdArgs, 1)
+			cancelled = c
+			WithCancelHandler(func(_ string, args *CmdArgs) {
+				c <- args
+			})(dispatch)
+		})
+
+		It("calls the handler when the context is cancelled during the callback", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			add := func(_ context.Context, args *CmdArgs) error {
+				cancel()
+				Eventually(cancelled).Should(Receive(BeIdenticalTo(args)))
+				return errors.New("aborted")
+			}
+			err := dispatch.pluginMainContext(ctx, add, cmdCheck.ContextFunc, cmdDel.ContextFunc, versionInfo, "")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Msg).To(Equal("aborted"))
+		})
+
+		It("calls the handler when the timeout expires", func() {
+			dispatch.timeout = 10 * time.Millisecond
+			grace := timeoutGracePeriod
+			timeoutGracePeriod = 10 * time.Millisecond
+			defer func() { timeoutGracePeriod = grace }()
+			release := make(chan struct{})
+			add := func(_ context.Context, _ *CmdArgs) error {
+				<-release
+				return nil
+			}
+			err := dispatch.pluginMainContext(context.Background(), add, cmdCheck.ContextFunc, cmdDel.ContextFunc, versionInfo, "")
+			Expect(err.Code).To(Equal(types.ErrTimeout))
+			Eventually(cancelled).Should(Receive())
+			close(release)
+		})
+
+		It("does not call the handler when the callback finishes", func() {
+			err := dispatch.pluginMain(cmdAdd.Func, cmdCheck.Func, cmdDel.Func, versionInfo, "")
+			Expect(err).NotTo(HaveOccurred())
+			Consistently(cancelled, "50ms").ShouldNot(Receive())
+		})
 	})
+
+	DescribeTable("ExitCode",
+		func(err *types.Error, expected int) {
+			Expect(ExitCode(err)).To(Equal(expected))
+		},
+		Entry("no error", nil, ExitCodeSuccess),
+		Entry("incompatible version", types.NewError(types.ErrIncompatibleCNIVersion, "", ""), ExitCodeIncompatibleCNIVersion),
+		Entry("unsupported field", types.NewError(types.ErrUnsupportedField, "", ""), ExitCodeUnsupportedField),
+		Entry("unknown container", types.NewError(types.ErrUnknownContainer, "", ""), ExitCodeUnknownContainer),
+		Entry("invalid env vars", types.NewError(types.ErrInvalidEnvironmentVariables, "", ""), ExitCodeInvalidEnvironmentVariables),
+		Entry("io failure", types.NewError(types.ErrIOFailure, "", ""), ExitCodeIOFailure),
+		Entry("decoding failure", types.NewError(types.ErrDecodingFailure, "", ""), ExitCodeDecodingFailure),
+		Entry("invalid network config", types.NewError(types.ErrInvalidNetworkConfig, "", ""), ExitCodeInvalidNetworkConfig),
+		Entry("try again later", types.NewError(types.ErrTryAgainLater, "", ""), ExitCodeTryAgainLater),
+		Entry("timeout", types.NewError(types.ErrTimeout, "", ""), ExitCodeTimeout),
+		Entry("internal error", types.NewError(types.ErrInternal, "", ""), ExitCodeFailure),
+		Entry("plugin-specific error", types.NewError(100, "", ""), ExitCodeFailure),
+	)
 })
 
 // BadReader is an io.Reader which always errors
@@ -0,0 +1,150 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package skeltest runs plugin callbacks through the skel dispatcher
+// in-process, so that plugins can be unit tested without building and
+// executing a binary.
+package skeltest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/cni/pkg/version"
+)
+
+// Plugin describes the plugin under test, as it would be passed to
+// skel.PluginMainFuncs
+type Plugin struct {
+	Funcs       skel.CmdFuncs
+	VersionInfo version.PluginInfo
+	Options     []skel.Option
+}
+
+// Request describes a single invocation of the plugin. Empty fields other
+// than Args are given defaults suitable for tests.
+type Request struct {
+	Command     string
+	ContainerID string
+	Netns       string
+	IfName      string
+	Args        string
+	Path        string
+	// Env holds additional environment variables, such as CNI_TIMEOUT
+	Env map[string]string
+	// Config is the network configuration passed on stdin
+	Config []byte
+}
+
+// Response is what the plugin emitted for a Request
+type Response struct {
+	// Stdout holds the result, or the error JSON if the command failed,
+	// exactly as the runtime would read it
+	Stdout []byte
+	Stderr []byte
+	// Err is the error returned by the dispatcher, if any
+	Err *types.Error
+}
+
+// Run invokes the plugin with req through the skel dispatcher. Since
+// plugins print results to os.Stdout, Run temporarily replaces it, so
+// calls to Run must not happen in parallel with each other or with code
+// that writes to os.Stdout.
+func (p *Plugin) Run(req Request) (*Response, error) {
+	env := map[string]string{
+		"CNI_COMMAND":     valueOr(req.Command, "ADD"),
+		"CNI_CONTAINERID": valueOr(req.ContainerID, "skeltest"),
+		"CNI_NETNS":       valueOr(req.Netns, "/var/run/netns/skeltest"),
+		"CNI_IFNAME":      valueOr(req.IfName, "eth0"),
+		"CNI_ARGS":        req.Args,
+		"CNI_PATH":        valueOr(req.Path, "/opt/cni/bin"),
+	}
+	for k, v := range req.Env {
+		env[k] = v
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to capture stdout: %v", err)
+	}
+	stdout := &bytes.Buffer{}
+	copied := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(stdout, r)
+		copied <- err
+	}()
+
+	savedStdout := os.Stdout
+	os.Stdout = w
+	stderr := &bytes.Buffer{}
+	opts := append([]skel.Option{
+		skel.WithEnv(env),
+		skel.WithStreams(bytes.NewReader(req.Config), w, stderr),
+	}, p.Options...)
+	e := skel.PluginMainFuncsWithError(p.Funcs, p.VersionInfo, "", opts...)
+	os.Stdout = savedStdout
+
+	// Print the error as PluginMainFuncs would
+	if e != nil {
+		data, err := json.MarshalIndent(e, "", "    ")
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+	}
+	w.Close()
+	if err := <-copied; err != nil {
+		return nil, fmt.Errorf("failed to capture stdout: %v", err)
+	}
+	r.Close()
+
+	return &Response{
+		Stdout: stdout.Bytes(),
+		Stderr: stderr.Bytes(),
+		Err:    e,
+	}, nil
+}
+
+// Result parses the result the plugin printed
+func (r *Response) Result() (types.Result, error) {
+	if r.Err != nil {
+		return nil, fmt.Errorf("plugin returned an error: %v", r.Err)
+	}
+	var res struct {
+		CNIVersion string `json:"cniVersion"`
+	}
+	if err := json.Unmarshal(r.Stdout, &res); err != nil {
+		return nil, fmt.Errorf("failed to decode result: %v", err)
+	}
+	return version.NewResult(res.CNIVersion, r.Stdout)
+}
+
+// ExitCode returns the exit code the plugin process would have exited with
+func (r *Response) ExitCode() int {
+	return skel.ExitCode(r.Err)
+}
+
+func valueOr(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
@@ -0,0 +1,115 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skeltest_test
+
+import (
+	"errors"
+	"net"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/cni/pkg/skel/skeltest"
+	"github.com/containernetworking/cni/pkg/types"
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/cni/pkg/version"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Plugin", func() {
+	var (
+		plugin   *skeltest.Plugin
+		received *skel.CmdArgs
+		config   = []byte(`{"cniVersion": "1.0.0", "name": "mynet", "type": "test"}`)
+	)
+
+	BeforeEach(func() {
+		received = nil
+		plugin = &skeltest.Plugin{
+			Funcs: skel.CmdFuncs{
+				Add: func(args *skel.CmdArgs) error {
+					received = args
+					_, ipnet, _ := net.ParseCIDR("10.1.2.3/24")
+					result := &current.Result{
+						CNIVersion: current.ImplementedSpecVersion,
+						IPs:        []*current.IPConfig{{Address: *ipnet}},
+					}
+					return types.PrintResult(result, "1.0.0")
+				},
+				Del: func(args *skel.CmdArgs) error {
+					return types.NewError(types.ErrTryAgainLater, "busy", "")
+				},
+			},
+			VersionInfo: version.PluginSupports("1.0.0"),
+		}
+	})
+
+	It("captures the result printed by the callback", func() {
+		resp, err := plugin.Run(skeltest.Request{Config: config, Args: "K8S_POD_NAME=pod"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Err).To(BeNil())
+		Expect(resp.ExitCode()).To(Equal(0))
+
+		Expect(received.ContainerID).To(Equal("skeltest"))
+		Expect(received.IfName).To(Equal("eth0"))
+		Expect(received.ParsedArgs).To(Equal(map[string]string{"K8S_POD_NAME": "pod"}))
+		Expect(received.StdinData).To(Equal(config))
+
+		r, err := resp.Result()
+		Expect(err).NotTo(HaveOccurred())
+		result, err := current.GetResult(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.IPs[0].Address.String()).To(Equal("10.1.2.0/24"))
+	})
+
+	It("captures the error JSON", func() {
+		resp, err := plugin.Run(skeltest.Request{Command: "DEL", Config: config})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Err).To(Equal(types.NewError(types.ErrTryAgainLater, "busy", "")))
+		Expect(resp.Stdout).To(MatchJSON(`{"code": 11, "msg": "busy"}`))
+		Expect(resp.ExitCode()).To(Equal(skel.ExitCodeTryAgainLater))
+
+		_, err = resp.Result()
+		Expect(err).To(MatchError("plugin returned an error: busy"))
+	})
+
+	It("passes additional environment variables and options", func() {
+		plugin.Options = []skel.Option{skel.WithOnError(func(_ string, err *types.Error) *types.Error {
+			return types.NewError(err.Code, err.Msg, "check the configuration")
+		})}
+		resp, err := plugin.Run(skeltest.Request{Config: config, Env: map[string]string{"CNI_DRYRUN": "1"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Err).To(BeNil())
+		Expect(resp.Stdout).To(BeEmpty())
+		Expect(received).To(BeNil())
+
+		resp, err = plugin.Run(skeltest.Request{Config: []byte(`{"cniVersion": "1.0.0"}`)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Err).To(Equal(types.NewError(types.ErrInvalidNetworkConfig, "missing network name", "check the configuration")))
+	})
+
+	It("reports VERSION", func() {
+		resp, err := plugin.Run(skeltest.Request{Command: "VERSION"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Stdout).To(MatchJSON(`{"cniVersion": "1.0.0", "supportedVersions": ["1.0.0"]}`))
+	})
+
+	It("returns errors from callbacks that do not print", func() {
+		plugin.Funcs.Check = func(_ *skel.CmdArgs) error { return errors.New("potato") }
+		resp, err := plugin.Run(skeltest.Request{Command: "CHECK", Config: config})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Err).To(Equal(types.NewError(types.ErrInternal, "potato", "")))
+	})
+})
@@ -0,0 +1,162 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/cni/pkg/utils"
+)
+
+// DefaultStateRoot is the directory under which state directories are
+// created unless another root is given
+const DefaultStateRoot = "/var/lib/cni/state"
+
+// StateDir is the directory where a plugin keeps its state for one
+// attachment, <root>/<network>/<container ID>/<interface>. Plugins that
+// keep state in a StateDir share one layout, so that operators and tools
+// can find and clean it up. The directory is locked while it is open.
+type StateDir struct {
+	// Path is the directory. It exists while the StateDir is open.
+	Path string
+
+	unlock func() error
+}
+
+// OpenStateDir creates and locks the state directory under root, or
+// DefaultStateRoot if root is empty, for the attachment of containerID
+// to network on ifName. It waits for other processes holding the lock
+// until ctx is done. Call Close to release the lock.
+func OpenStateDir(ctx context.Context, root, network, containerID, ifName string) (*StateDir, error) {
+	if root == "" {
+		root = DefaultStateRoot
+	}
+	if err := utils.ValidateNetworkName(network); err != nil {
+		return nil, err
+	}
+	if err := utils.ValidateContainerID(containerID); err != nil {
+		return nil, err
+	}
+	if err := utils.ValidateInterfaceName(ifName); err != nil {
+		return nil, err
+	}
+
+	unlock, err := LockAttachment(ctx, filepath.Join(root, network, ".locks"), containerID, ifName)
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(root, network, containerID, ifName)
+	if err := os.MkdirAll(path, 0700); err != nil {
+		_ = unlock()
+		return nil, fmt.Errorf("failed to create state directory: %v", err)
+	}
+	return &StateDir{Path: path, unlock: unlock}, nil
+}
+
+// ReadFile returns the contents of the file name in the directory. Use
+// os.IsNotExist to tell whether it was never written.
+func (s *StateDir) ReadFile(name string) ([]byte, error) {
+	if err := validateStateFileName(name); err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(filepath.Join(s.Path, name))
+}
+
+// WriteFile replaces the file name in the directory with data. The file
+// is replaced atomically, so readers see the old or the new contents even
+// if the plugin is killed while writing.
+func (s *StateDir) WriteFile(name string, data []byte) error {
+	if err := validateStateFileName(name); err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(s.Path, name), data)
+}
+
+// Remove deletes the directory and everything in it, and the directory of
+// the container if no other attachment of it has state
+func (s *StateDir) Remove() error {
+	if err := os.RemoveAll(s.Path); err != nil {
+		return err
+	}
+	// Fails harmlessly when the container has other attachments
+	_ = os.Remove(filepath.Dir(s.Path))
+	return nil
+}
+
+// Close releases the lock on the directory
+func (s *StateDir) Close() error {
+	return s.unlock()
+}
+
+func validateStateFileName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid state file name %q", name)
+	}
+	return nil
+}
+
+// WithStateDir opens the StateDir of the attachment under root, or
+// DefaultStateRoot if root is empty, for ADD, CHECK and DEL, and passes it
+// to the callback in CmdArgs.State. It is locked while the callback runs,
+// and removed when DEL succeeds. Dry runs are not given a state directory,
+// so they cannot change or remove it.
+func WithStateDir(root string) Option {
+	return func(t *dispatcher) {
+		t.stateDir = true
+		t.stateRoot = root
+	}
+}
+
+// openStateDir opens the state directory for cmd if WithStateDir was
+// used, returning a function that closes it once the command returned err
+func (t *dispatcher) openStateDir(ctx context.Context, cmd string, cmdArgs *CmdArgs) (func(err error), *types.Error) {
+	if !t.stateDir || cmdArgs.ContainerID == "" || cmdArgs.IfName == "" || cmdArgs.DryRun {
+		return func(error) {}, nil
+	}
+	switch cmd {
+	case "ADD", "CHECK", "DEL":
+	default:
+		return func(error) {}, nil
+	}
+	var conf struct {
+		Name string `json:"name"`
+	}
+	_ = json.Unmarshal(cmdArgs.StdinData, &conf)
+	state, err := OpenStateDir(ctx, t.stateRoot, conf.Name, cmdArgs.ContainerID, cmdArgs.IfName)
+	if err != nil {
+		if e, ok := err.(*types.Error); ok {
+			return nil, e
+		}
+		return nil, types.NewError(types.ErrTryAgainLater, err.Error(), "")
+	}
+	cmdArgs.State = state
+	return func(err error) {
+		if cmd == "DEL" && err == nil {
+			if err := state.Remove(); err != nil {
+				_, _ = fmt.Fprintf(t.Stderr, "failed to remove state directory: %v\n", err)
+			}
+		}
+		if err := state.Close(); err != nil {
+			_, _ = fmt.Fprintf(t.Stderr, "failed to release state directory lock: %v\n", err)
+		}
+	}, nil
+}
@@ -0,0 +1,187 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/cni/pkg/version"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("state directories", func() {
+	var root string
+
+	BeforeEach(func() {
+		var err error
+		root, err = ioutil.TempDir("", "cni-state")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(root)).To(Succeed())
+	})
+
+	It("creates a locked directory per network, container and interface", func() {
+		state, err := OpenStateDir(context.TODO(), root, "some-net", "some-container-id", "eth0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.Path).To(Equal(filepath.Join(root, "some-net", "some-container-id", "eth0")))
+		Expect(state.Path).To(BeADirectory())
+
+		ctx, cancel := context.WithTimeout(context.TODO(), 20*time.Millisecond)
+		defer cancel()
+		_, err = OpenStateDir(ctx, root, "some-net", "some-container-id", "eth0")
+		Expect(err).To(MatchError(ContainSubstring("waiting for lock")))
+
+		Expect(state.Close()).To(Succeed())
+		again, err := OpenStateDir(context.TODO(), root, "some-net", "some-container-id", "eth0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(again.Close()).To(Succeed())
+	})
+
+	It("writes and reads files", func() {
+		state, err := OpenStateDir(context.TODO(), root, "some-net", "some-container-id", "eth0")
+		Expect(err).NotTo(HaveOccurred())
+		defer state.Close()
+
+		_, err = state.ReadFile("lease.json")
+		Expect(os.IsNotExist(err)).To(BeTrue())
+
+		Expect(state.WriteFile("lease.json", []byte("{}"))).To(Succeed())
+		Expect(state.WriteFile("lease.json", []byte(`{"ip": "10.1.2.3"}`))).To(Succeed())
+		Expect(state.ReadFile("lease.json")).To(MatchJSON(`{"ip": "10.1.2.3"}`))
+
+		files, err := ioutil.ReadDir(state.Path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(files).To(HaveLen(1))
+
+		Expect(state.WriteFile("../escape", nil)).To(MatchError(`invalid state file name "../escape"`))
+		_, err = state.ReadFile("..")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("removes the container's directory with its last attachment", func() {
+		eth0, err := OpenStateDir(context.TODO(), root, "some-net", "some-container-id", "eth0")
+		Expect(err).NotTo(HaveOccurred())
+		defer eth0.Close()
+		eth1, err := OpenStateDir(context.TODO(), root, "some-net", "some-container-id", "eth1")
+		Expect(err).NotTo(HaveOccurred())
+		defer eth1.Close()
+		Expect(eth0.WriteFile("state", []byte("x"))).To(Succeed())
+
+		Expect(eth0.Remove()).To(Succeed())
+		Expect(eth0.Path).NotTo(BeADirectory())
+		Expect(eth1.Path).To(BeADirectory())
+
+		Expect(eth1.Remove()).To(Succeed())
+		Expect(filepath.Join(root, "some-net", "some-container-id")).NotTo(BeADirectory())
+	})
+
+	It("rejects names that are not valid in a path", func() {
+		_, err := OpenStateDir(context.TODO(), root, "../net", "some-container-id", "eth0")
+		Expect(err).To(HaveOccurred())
+		_, err = OpenStateDir(context.TODO(), root, "some-net", "some/container", "eth0")
+		Expect(err).To(HaveOccurred())
+		_, err = OpenStateDir(context.TODO(), root, "some-net", "some-container-id", "..")
+		Expect(err).To(HaveOccurred())
+	})
+
+	Context("with WithStateDir", func() {
+		var (
+			environment map[string]string
+			dispatch    *dispatcher
+		)
+
+		BeforeEach(func() {
+			environment = map[string]string{
+				"CNI_COMMAND":     "ADD",
+				"CNI_CONTAINERID": "some-container-id",
+				"CNI_NETNS":       "/some/netns/path",
+				"CNI_IFNAME":      "eth0",
+				"CNI_PATH":        "/some/cni/path",
+			}
+			dispatch = &dispatcher{
+				Getenv: func(key string) string { return environment[key] },
+				Stdin:  strings.NewReader(`{"name": "some-net", "type": "test", "cniVersion": "1.0.0"}`),
+				Stdout: &bytes.Buffer{},
+				Stderr: &bytes.Buffer{},
+			}
+			WithStateDir(root)(dispatch)
+		})
+
+		run := func(cmd func(*CmdArgs) error) *types.Error {
+			dispatch.Stdin = strings.NewReader(`{"name": "some-net", "type": "test", "cniVersion": "1.0.0"}`)
+			return dispatch.pluginMain(cmd, cmd, cmd, version.PluginSupports("1.0.0"), "")
+		}
+
+		It("passes the state directory to the callbacks and removes it on DEL", func() {
+			statePath := filepath.Join(root, "some-net", "some-container-id", "eth0")
+			Expect(run(func(args *CmdArgs) error {
+				Expect(args.State.Path).To(Equal(statePath))
+				return args.State.WriteFile("state", []byte("added"))
+			})).To(BeNil())
+
+			environment["CNI_COMMAND"] = "CHECK"
+			Expect(run(func(args *CmdArgs) error {
+				data, err := args.State.ReadFile("state")
+				Expect(string(data)).To(Equal("added"))
+				return err
+			})).To(BeNil())
+
+			environment["CNI_COMMAND"] = "DEL"
+			Expect(run(func(args *CmdArgs) error { return errors.New("busy") })).NotTo(BeNil())
+			Expect(statePath).To(BeADirectory())
+
+			Expect(run(func(args *CmdArgs) error { return nil })).To(BeNil())
+			Expect(statePath).NotTo(BeADirectory())
+		})
+
+		It("neither opens nor removes the state directory on a dry run", func() {
+			statePath := filepath.Join(root, "some-net", "some-container-id", "eth0")
+			Expect(run(func(args *CmdArgs) error {
+				return args.State.WriteFile("state", []byte("added"))
+			})).To(BeNil())
+
+			environment["CNI_COMMAND"] = "DEL"
+			environment["CNI_DRYRUN"] = "true"
+			validated := false
+			WithValidate(func(args *CmdArgs) error {
+				validated = true
+				Expect(args.State).To(BeNil())
+				return nil
+			})(dispatch)
+			Expect(run(func(args *CmdArgs) error { return nil })).To(BeNil())
+			Expect(validated).To(BeTrue())
+			Expect(filepath.Join(statePath, "state")).To(BeARegularFile())
+		})
+
+		It("reports an invalid network name", func() {
+			dispatch.Stdin = strings.NewReader(`{"name": "some net", "type": "test", "cniVersion": "1.0.0"}`)
+			err := dispatch.pluginMain(func(*CmdArgs) error { return nil }, nil, nil, version.PluginSupports("1.0.0"), "")
+			Expect(err).NotTo(BeNil())
+			Expect(err.Code).To(Equal(types.ErrInvalidNetworkConfig))
+		})
+	})
+})
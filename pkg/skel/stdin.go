@@ -0,0 +1,83 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"fmt"
+	"time"
+)
+
+// WithStdinTimeout fails the command with types.ErrIOFailure if the
+// network configuration has not been read from stdin within timeout,
+// because the runtime neither wrote it nor closed stdin. Without a timeout
+// such a plugin waits forever, and the stuck processes accumulate on the
+// node. A timeout of zero or less, the default, waits forever.
+func WithStdinTimeout(timeout time.Duration) Option {
+	return func(t *dispatcher) {
+		t.stdinTimeout = timeout
+	}
+}
+
+// stdinTimeoutError is returned when stdin is not read within the
+// timeout set with WithStdinTimeout
+type stdinTimeoutError struct {
+	timeout time.Duration
+}
+
+func (e *stdinTimeoutError) Error() string {
+	return fmt.Sprintf("no network configuration received within %v", e.timeout)
+}
+
+// failedReader fails every read with err
+type failedReader struct {
+	err error
+}
+
+func (r *failedReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+// readStdinLimited reads stdin like readLimited, giving up after the stdin
+// timeout. The read is left running in the background when it times out,
+// so stdin is replaced with a reader failing with the timeout error,
+// leaving the process to exit.
+func (t *dispatcher) readStdinLimited() ([]byte, bool, error) {
+	if t.stdinTimeout <= 0 {
+		return t.readLimited(t.Stdin)
+	}
+
+	type read struct {
+		data     []byte
+		tooLarge bool
+		err      error
+	}
+	done := make(chan read, 1)
+	stdin := t.Stdin
+	go func() {
+		data, tooLarge, err := t.readLimited(stdin)
+		done <- read{data, tooLarge, err}
+	}()
+
+	timer := time.NewTimer(t.stdinTimeout)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		return r.data, r.tooLarge, r.err
+	case <-timer.C:
+		err := &stdinTimeoutError{timeout: t.stdinTimeout}
+		t.Stdin = &failedReader{err: err}
+		return nil, false, err
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/cni/pkg/version"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("stdin timeout", func() {
+	var (
+		environment map[string]string
+		cmdAdd      *fakeCmd
+	)
+
+	dispatch := func(stdin io.Reader) *dispatcher {
+		t := &dispatcher{
+			Getenv: func(key string) string { return environment[key] },
+			Stdin:  stdin,
+			Stdout: &bytes.Buffer{},
+			Stderr: &bytes.Buffer{},
+		}
+		WithStdinTimeout(50 * time.Millisecond)(t)
+		return t
+	}
+
+	BeforeEach(func() {
+		environment = map[string]string{
+			"CNI_COMMAND":     "ADD",
+			"CNI_CONTAINERID": "some-container-id",
+			"CNI_NETNS":       "/some/netns",
+			"CNI_IFNAME":      "eth0",
+			"CNI_PATH":        "/opt/cni/bin",
+		}
+		cmdAdd = &fakeCmd{}
+	})
+
+	It("fails with an I/O error when stdin is never closed", func() {
+		r, w := io.Pipe()
+		defer w.Close()
+		err := dispatch(r).pluginMain(cmdAdd.Func, nil, nil, version.All, "")
+		Expect(err).To(Equal(types.NewError(types.ErrIOFailure, "error reading from stdin: no network configuration received within 50ms", "")))
+		Expect(cmdAdd.CallCount).To(Equal(0))
+	})
+
+	It("reads a configuration that arrives in time", func() {
+		stdin := `{"cniVersion": "1.0.0", "name": "mynet", "type": "test"}`
+		err := dispatch(strings.NewReader(stdin)).pluginMain(cmdAdd.Func, nil, nil, version.All, "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(cmdAdd.Received.CmdArgs.StdinData)).To(Equal(stdin))
+	})
+
+	It("times out once when debug capture reads stdin first", func() {
+		r, w := io.Pipe()
+		defer w.Close()
+		t := dispatch(r)
+		_, _, err := t.readStdinLimited()
+		Expect(err).To(HaveOccurred())
+
+		start := time.Now()
+		_, e := t.readStdin()
+		Expect(e.Code).To(Equal(uint(types.ErrIOFailure)))
+		Expect(time.Since(start)).To(BeNumerically("<", 50*time.Millisecond))
+	})
+})
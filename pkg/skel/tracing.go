@@ -0,0 +1,138 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"github.com/containernetworking/cni/pkg/invoke"
+)
+
+// traceParentVar names the variable holding the W3C traceparent of the
+// runtime's span, so that plugin spans join the runtime's trace
+const traceParentVar = invoke.TraceParentEnv
+
+// Span attributes set by the dispatcher
+const (
+	SpanAttrCommand     = "cni.command"
+	SpanAttrContainerID = "cni.container_id"
+	SpanAttrIfName      = "cni.ifname"
+	SpanAttrNetwork     = "cni.network"
+)
+
+// Tracer starts a span around each command the dispatcher runs. It is
+// implemented by plugins on top of their tracing library, such as
+// OpenTelemetry, so that skel does not depend on one.
+type Tracer interface {
+	// Start starts a span named name with the given attributes. parent is
+	// the trace context propagated by the runtime, or nil. The returned
+	// context is passed to the command's callback.
+	Start(ctx context.Context, name string, parent *TraceParent, attrs map[string]string) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer
+type Span interface {
+	// End ends the span, recording err if the command failed
+	End(err error)
+}
+
+// PropagatedSpan is implemented by Spans that can be continued by other
+// processes. The dispatcher adds the span's trace context to the context
+// passed to the callback, so that plugins delegated to with that context
+// through the invoke package start their spans as its children.
+type PropagatedSpan interface {
+	Span
+	// TraceParent returns the W3C trace context of the span
+	TraceParent() *TraceParent
+}
+
+// WithTracer makes the dispatcher start a span with tracer around each
+// command, named after the command, such as "CNI ADD". The span is a
+// child of the trace context in CNI_TRACEPARENT, or in TRACEPARENT as set
+// by OpenTelemetry's environment carrier, if the runtime set one.
+func WithTracer(tracer Tracer) Option {
+	return func(t *dispatcher) {
+		t.tracer = tracer
+	}
+}
+
+// TraceParent is a W3C trace context, as carried by a traceparent header
+type TraceParent struct {
+	Version  string
+	TraceID  string
+	ParentID string
+	Flags    string
+}
+
+var traceParentRegexp = regexp.MustCompile(`^([0-9a-f]{2})-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})$`)
+
+// ParseTraceParent parses a W3C traceparent such as
+// "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+func ParseTraceParent(s string) (*TraceParent, error) {
+	m := traceParentRegexp.FindStringSubmatch(s)
+	if m == nil || m[1] == "ff" || m[2] == "00000000000000000000000000000000" || m[3] == "0000000000000000" {
+		return nil, fmt.Errorf("invalid traceparent %q", s)
+	}
+	return &TraceParent{Version: m[1], TraceID: m[2], ParentID: m[3], Flags: m[4]}, nil
+}
+
+func (p *TraceParent) String() string {
+	return fmt.Sprintf("%s-%s-%s-%s", p.Version, p.TraceID, p.ParentID, p.Flags)
+}
+
+// Sampled returns true if the runtime recorded its span
+func (p *TraceParent) Sampled() bool {
+	var flags byte
+	_, _ = fmt.Sscanf(p.Flags, "%02x", &flags)
+	return flags&1 == 1
+}
+
+// startSpan starts the span around cmd, if the dispatcher has a tracer.
+// An invalid CNI_TRACEPARENT is ignored, as tracing must not fail the
+// command.
+func (t *dispatcher) startSpan(ctx context.Context, cmd string, cmdArgs *CmdArgs) (context.Context, Span) {
+	if t.tracer == nil {
+		return ctx, nil
+	}
+	traceparent := cmdArgs.Env.Get(traceParentVar)
+	if traceparent == "" {
+		traceparent = t.Getenv(invoke.OTelTraceParentEnv)
+	}
+	parent, _ := ParseTraceParent(traceparent)
+
+	attrs := map[string]string{SpanAttrCommand: cmd}
+	if cmdArgs.ContainerID != "" {
+		attrs[SpanAttrContainerID] = cmdArgs.ContainerID
+	}
+	if cmdArgs.IfName != "" {
+		attrs[SpanAttrIfName] = cmdArgs.IfName
+	}
+	var conf struct {
+		Name string `json:"name"`
+	}
+	if json.Unmarshal(cmdArgs.StdinData, &conf) == nil && conf.Name != "" {
+		attrs[SpanAttrNetwork] = conf.Name
+	}
+	ctx, span := t.tracer.Start(ctx, "CNI "+cmd, parent, attrs)
+	if propagated, ok := span.(PropagatedSpan); ok {
+		if child := propagated.TraceParent(); child != nil {
+			ctx = invoke.ContextWithTraceParent(ctx, child.String())
+		}
+	}
+	return ctx, span
+}
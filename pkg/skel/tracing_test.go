@@ -0,0 +1,160 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/containernetworking/cni/pkg/invoke"
+	"github.com/containernetworking/cni/pkg/version"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type spanKey struct{}
+
+type fakeSpan struct {
+	name   string
+	parent *TraceParent
+	attrs  map[string]string
+	ended  bool
+	err    error
+}
+
+func (s *fakeSpan) End(err error) {
+	s.ended = true
+	s.err = err
+}
+
+type fakePropagatedSpan struct {
+	*fakeSpan
+	traceParent *TraceParent
+}
+
+func (s *fakePropagatedSpan) TraceParent() *TraceParent {
+	return s.traceParent
+}
+
+type fakeTracer struct {
+	spans []*fakeSpan
+	// spanID, if set, makes the tracer start PropagatedSpans with this ID
+	spanID string
+}
+
+func (t *fakeTracer) Start(ctx context.Context, name string, parent *TraceParent, attrs map[string]string) (context.Context, Span) {
+	span := &fakeSpan{name: name, parent: parent, attrs: attrs}
+	t.spans = append(t.spans, span)
+	ctx = context.WithValue(ctx, spanKey{}, span)
+	if t.spanID != "" && parent != nil {
+		return ctx, &fakePropagatedSpan{span, &TraceParent{Version: parent.Version, TraceID: parent.TraceID, ParentID: t.spanID, Flags: parent.Flags}}
+	}
+	return ctx, span
+}
+
+var _ = Describe("tracing", func() {
+	var (
+		environment map[string]string
+		tracer      *fakeTracer
+		cmdAdd      *fakeCmd
+		dispatch    *dispatcher
+	)
+
+	BeforeEach(func() {
+		environment = map[string]string{
+			"CNI_COMMAND":     "ADD",
+			"CNI_CONTAINERID": "some-container-id",
+			"CNI_NETNS":       "/some/netns/path",
+			"CNI_IFNAME":      "eth0",
+			"CNI_PATH":        "/some/cni/path",
+			"CNI_TRACEPARENT": "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+		}
+		tracer = &fakeTracer{}
+		cmdAdd = &fakeCmd{}
+		dispatch = &dispatcher{
+			Getenv: func(key string) string { return environment[key] },
+			Stdin:  strings.NewReader(`{"name": "skel-test", "type": "test", "cniVersion": "1.0.0"}`),
+			Stdout: &bytes.Buffer{},
+			Stderr: &bytes.Buffer{},
+		}
+		WithTracer(tracer)(dispatch)
+	})
+
+	It("starts a span around the command, as a child of CNI_TRACEPARENT", func() {
+		err := dispatch.pluginMainContext(context.TODO(), cmdAdd.ContextFunc, nil, nil, version.PluginSupports("1.0.0"), "")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(tracer.spans).To(HaveLen(1))
+		span := tracer.spans[0]
+		Expect(span.name).To(Equal("CNI ADD"))
+		Expect(span.parent.String()).To(Equal("00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"))
+		Expect(span.parent.Sampled()).To(BeTrue())
+		Expect(span.attrs).To(Equal(map[string]string{
+			SpanAttrCommand:     "ADD",
+			SpanAttrContainerID: "some-container-id",
+			SpanAttrIfName:      "eth0",
+			SpanAttrNetwork:     "skel-test",
+		}))
+		Expect(span.ended).To(BeTrue())
+		Expect(cmdAdd.Received.Context.Value(spanKey{})).To(BeIdenticalTo(span))
+	})
+
+	It("records the command's error", func() {
+		cmdAdd.Returns.Error = errors.New("boom")
+		_ = dispatch.pluginMain(cmdAdd.Func, nil, nil, version.PluginSupports("1.0.0"), "")
+		Expect(tracer.spans[0].err).To(MatchError("boom"))
+	})
+
+	It("starts a root span when the traceparent is missing or invalid", func() {
+		environment["CNI_TRACEPARENT"] = "not-a-traceparent"
+		err := dispatch.pluginMain(cmdAdd.Func, nil, nil, version.PluginSupports("1.0.0"), "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tracer.spans[0].parent).To(BeNil())
+	})
+
+	It("falls back to the TRACEPARENT of OpenTelemetry's environment carrier", func() {
+		delete(environment, "CNI_TRACEPARENT")
+		environment["TRACEPARENT"] = "00-0af7651916cd43dd8448eb211c80319c-00f067aa0ba902b7-01"
+		err := dispatch.pluginMain(cmdAdd.Func, nil, nil, version.PluginSupports("1.0.0"), "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tracer.spans[0].parent.ParentID).To(Equal("00f067aa0ba902b7"))
+	})
+
+	It("passes the span's trace context to delegated plugins", func() {
+		tracer.spanID = "53995c3f42cd8ad8"
+		err := dispatch.pluginMainContext(context.TODO(), cmdAdd.ContextFunc, nil, nil, version.PluginSupports("1.0.0"), "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(invoke.TraceParentFromContext(cmdAdd.Received.Context)).To(Equal("00-0af7651916cd43dd8448eb211c80319c-53995c3f42cd8ad8-01"))
+	})
+
+	It("does not propagate spans that do not expose their trace context", func() {
+		err := dispatch.pluginMainContext(context.TODO(), cmdAdd.ContextFunc, nil, nil, version.PluginSupports("1.0.0"), "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(invoke.TraceParentFromContext(cmdAdd.Received.Context)).To(BeEmpty())
+	})
+
+	It("parses only valid traceparents", func() {
+		_, err := ParseTraceParent("00-00000000000000000000000000000000-b7ad6b7169203331-01")
+		Expect(err).To(HaveOccurred())
+		_, err = ParseTraceParent("ff-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+		Expect(err).To(HaveOccurred())
+		p, err := ParseTraceParent("00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-00")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(p.Sampled()).To(BeFalse())
+	})
+})
@@ -0,0 +1,64 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/containernetworking/cni/pkg/types"
+)
+
+// UnknownCommandHandler handles a CNI_COMMAND that the plugin has no
+// callback for, such as a verb added by a newer version of the
+// specification. supported lists the verbs the plugin does handle, as in
+// its PluginMetadata. Returning nil reports success to the runtime.
+type UnknownCommandHandler func(verb string, supported []string, cmdArgs *CmdArgs) error
+
+// WithUnknownCommand makes the dispatcher call handler for commands it has
+// no callback for, instead of rejecting them with a bare "unknown
+// CNI_COMMAND" error. The handler is called once the configuration is
+// checked to be valid JSON, without checking versions, since a newer
+// runtime may use a version the plugin does not know. If handler is nil,
+// UnsupportedVerb is used.
+func WithUnknownCommand(handler UnknownCommandHandler) Option {
+	if handler == nil {
+		handler = UnsupportedVerb
+	}
+	return func(t *dispatcher) {
+		t.unknownCmd = handler
+	}
+}
+
+// UnsupportedVerb is an UnknownCommandHandler that fails with a
+// types.ErrInvalidEnvironmentVariables error naming the verb, whose details
+// list the supported verbs, so that runtimes can tell an older plugin from
+// a broken one
+func UnsupportedVerb(verb string, supported []string, _ *CmdArgs) error {
+	return types.NewError(types.ErrInvalidEnvironmentVariables, fmt.Sprintf("unsupported CNI_COMMAND: %s", verb), "supported verbs: "+strings.Join(supported, ", "))
+}
+
+// unknownCommand returns the error for a command that has no callback,
+// or calls the handler registered with WithUnknownCommand
+func (t *dispatcher) unknownCommand(cmd string, cmdArgs *CmdArgs, cmdAdd, cmdCheck, cmdDel func(context.Context, *CmdArgs) error) *types.Error {
+	if t.unknownCmd == nil {
+		return types.NewError(types.ErrInvalidEnvironmentVariables, fmt.Sprintf("unknown CNI_COMMAND: %v", cmd), "")
+	}
+	if err := t.unknownCmd(cmd, t.verbs(cmdAdd, cmdCheck, cmdDel), cmdArgs); err != nil {
+		return typedError(err)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/cni/pkg/version"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("unknown commands", func() {
+	var (
+		environment map[string]string
+		cmdAdd      *fakeCmd
+		cmdDel      *fakeCmd
+		dispatch    *dispatcher
+	)
+
+	BeforeEach(func() {
+		environment = map[string]string{
+			"CNI_COMMAND":     "GC",
+			"CNI_CONTAINERID": "some-container-id",
+			"CNI_NETNS":       "/some/netns/path",
+			"CNI_IFNAME":      "eth0",
+			"CNI_PATH":        "/some/cni/path",
+		}
+		cmdAdd = &fakeCmd{}
+		cmdDel = &fakeCmd{}
+		dispatch = &dispatcher{
+			Getenv: func(key string) string { return environment[key] },
+			Stdin:  strings.NewReader(`{"name": "skel-test", "type": "test", "cniVersion": "9.9.9"}`),
+			Stdout: &bytes.Buffer{},
+			Stderr: &bytes.Buffer{},
+		}
+	})
+
+	It("reports the supported verbs with UnsupportedVerb", func() {
+		WithUnknownCommand(nil)(dispatch)
+		err := dispatch.pluginMain(cmdAdd.Func, nil, cmdDel.Func, version.PluginSupports("1.0.0"), "")
+		Expect(err).To(Equal(types.NewError(types.ErrInvalidEnvironmentVariables, "unsupported CNI_COMMAND: GC", "supported verbs: ADD, DEL, VERSION")))
+	})
+
+	It("handles standard commands the plugin has no callback for", func() {
+		environment["CNI_COMMAND"] = "CHECK"
+		WithUnknownCommand(nil)(dispatch)
+		err := dispatch.pluginMain(cmdAdd.Func, nil, cmdDel.Func, version.PluginSupports("1.0.0"), "")
+		Expect(err.Msg).To(Equal("unsupported CNI_COMMAND: CHECK"))
+	})
+
+	It("passes the command to a custom handler", func() {
+		var received []string
+		WithUnknownCommand(func(verb string, supported []string, cmdArgs *CmdArgs) error {
+			received = append([]string{verb, cmdArgs.ContainerID}, supported...)
+			return nil
+		})(dispatch)
+		err := dispatch.pluginMain(cmdAdd.Func, nil, cmdDel.Func, version.PluginSupports("1.0.0"), "")
+		Expect(err).To(BeNil())
+		Expect(received).To(Equal([]string{"GC", "some-container-id", "ADD", "DEL", "VERSION"}))
+		Expect(cmdAdd.CallCount).To(Equal(0))
+	})
+
+	It("converts errors of a custom handler", func() {
+		WithUnknownCommand(func(string, []string, *CmdArgs) error {
+			return errors.New("not yet")
+		})(dispatch)
+		err := dispatch.pluginMain(cmdAdd.Func, nil, cmdDel.Func, version.PluginSupports("1.0.0"), "")
+		Expect(err).To(Equal(types.NewError(types.ErrInternal, "not yet", "")))
+	})
+
+	It("keeps the default error without a handler", func() {
+		err := dispatch.pluginMain(cmdAdd.Func, nil, cmdDel.Func, version.PluginSupports("1.0.0"), "")
+		Expect(err).To(Equal(types.NewError(types.ErrInvalidEnvironmentVariables, "unknown CNI_COMMAND: GC", "")))
+	})
+})
@@ -0,0 +1,68 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"github.com/containernetworking/cni/pkg/version"
+)
+
+// ConfVersionDecoder reads the CNI version of a network configuration.
+// *version.ConfigDecoder is the default implementation.
+type ConfVersionDecoder interface {
+	Decode(jsonBytes []byte) (string, error)
+}
+
+// VersionReconciler checks that the plugin supports the version of the
+// network configuration. *version.Reconciler, which requires an exact
+// match, is the default implementation.
+type VersionReconciler interface {
+	Check(configVersion string, pluginInfo version.PluginInfo) *version.ErrorIncompatible
+}
+
+// WithConfVersionDecoder makes the dispatcher read the version of the
+// network configuration with decoder, for plugins that understand
+// versions the spec does not define, such as pre-release versions. The
+// version is used to check compatibility and to convert results.
+func WithConfVersionDecoder(decoder ConfVersionDecoder) Option {
+	return func(t *dispatcher) {
+		t.confDecoder = decoder
+	}
+}
+
+// WithVersionReconciler makes the dispatcher check that the plugin
+// supports the version of the network configuration with reconciler,
+// for example to accept a pre-release version as its release.
+func WithVersionReconciler(reconciler VersionReconciler) Option {
+	return func(t *dispatcher) {
+		t.reconciler = reconciler
+	}
+}
+
+// decodeConfVersion reads the version of the network configuration in
+// stdinData
+func (t *dispatcher) decodeConfVersion(stdinData []byte) (string, error) {
+	if t.confDecoder != nil {
+		return t.confDecoder.Decode(stdinData)
+	}
+	return t.ConfVersionDecoder.Decode(stdinData)
+}
+
+// checkConfVersion checks that the plugin supports configVersion
+func (t *dispatcher) checkConfVersion(configVersion string, pluginInfo version.PluginInfo) *version.ErrorIncompatible {
+	if t.reconciler != nil {
+		return t.reconciler.Check(configVersion, pluginInfo)
+	}
+	return t.VersionReconciler.Check(configVersion, pluginInfo)
+}
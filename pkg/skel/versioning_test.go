@@ -0,0 +1,100 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/cni/pkg/version"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// releaseDecoder reads pre-release versions such as "1.1.0-rc1" as
+// their release
+type releaseDecoder struct{}
+
+func (releaseDecoder) Decode(jsonBytes []byte) (string, error) {
+	v, err := (&version.ConfigDecoder{}).Decode(jsonBytes)
+	if err != nil {
+		return "", err
+	}
+	return strings.SplitN(v, "-", 2)[0], nil
+}
+
+// permissiveReconciler accepts every version
+type permissiveReconciler struct {
+	checked string
+}
+
+func (r *permissiveReconciler) Check(configVersion string, _ version.PluginInfo) *version.ErrorIncompatible {
+	r.checked = configVersion
+	return nil
+}
+
+var _ = Describe("custom version negotiation", func() {
+	var (
+		dispatch *dispatcher
+		cmdAdd   *fakeCmd
+	)
+
+	BeforeEach(func() {
+		environment := map[string]string{
+			"CNI_COMMAND":     "ADD",
+			"CNI_CONTAINERID": "some-container-id",
+			"CNI_NETNS":       "/some/netns",
+			"CNI_IFNAME":      "eth0",
+			"CNI_PATH":        "/opt/cni/bin",
+		}
+		dispatch = &dispatcher{
+			Getenv: func(key string) string { return environment[key] },
+			Stdin:  strings.NewReader(`{"cniVersion": "1.1.0-rc1", "name": "mynet", "type": "test"}`),
+			Stdout: &bytes.Buffer{},
+			Stderr: &bytes.Buffer{},
+		}
+		cmdAdd = &fakeCmd{}
+	})
+
+	It("rejects versions the spec does not define by default", func() {
+		err := dispatch.pluginMain(cmdAdd.Func, nil, nil, version.PluginSupports("1.0.0", "1.1.0"), "")
+		Expect(err).To(HaveOccurred())
+		Expect(err.Code).To(Equal(uint(types.ErrInvalidNetworkConfig)))
+		Expect(cmdAdd.CallCount).To(Equal(0))
+	})
+
+	It("uses a custom configuration version decoder", func() {
+		WithConfVersionDecoder(releaseDecoder{})(dispatch)
+		err := dispatch.pluginMain(cmdAdd.Func, nil, nil, version.PluginSupports("1.0.0", "1.1.0"), "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cmdAdd.CallCount).To(Equal(1))
+	})
+
+	It("uses a custom version reconciler", func() {
+		dispatch.Stdin = strings.NewReader(`{"cniVersion": "1.1.0", "name": "mynet", "type": "test"}`)
+		err := dispatch.pluginMain(cmdAdd.Func, nil, nil, version.PluginSupports("1.0.0"), "")
+		Expect(err.Code).To(Equal(uint(types.ErrIncompatibleCNIVersion)))
+
+		reconciler := &permissiveReconciler{}
+		WithVersionReconciler(reconciler)(dispatch)
+		dispatch.Stdin = strings.NewReader(`{"cniVersion": "1.1.0", "name": "mynet", "type": "test"}`)
+		err = dispatch.pluginMain(cmdAdd.Func, nil, nil, version.PluginSupports("1.0.0"), "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reconciler.checked).To(Equal("1.1.0"))
+		Expect(cmdAdd.CallCount).To(Equal(1))
+	})
+})
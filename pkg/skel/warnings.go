@@ -0,0 +1,47 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Warning is a non-fatal problem reported by a plugin. The dispatcher
+// writes each warning to stderr as a single line of JSON, so that runtimes
+// can tell warnings apart from other diagnostic output.
+type Warning struct {
+	Command     string `json:"command"`
+	ContainerID string `json:"containerID,omitempty"`
+	Message     string `json:"warning"`
+}
+
+// Warn records a non-fatal problem, such as the use of a deprecated
+// configuration field, to be reported when the callback returns. Warnings
+// do not affect the result or the exit code.
+func (args *CmdArgs) Warn(format string, a ...interface{}) {
+	args.Warnings = append(args.Warnings, fmt.Sprintf(format, a...))
+}
+
+// printWarnings writes the warnings recorded in cmdArgs to stderr
+func (t *dispatcher) printWarnings(cmd string, cmdArgs *CmdArgs) {
+	for _, msg := range cmdArgs.Warnings {
+		data, err := json.Marshal(&Warning{Command: cmd, ContainerID: cmdArgs.ContainerID, Message: msg})
+		if err != nil {
+			continue
+		}
+		_, _ = fmt.Fprintf(t.Stderr, "%s\n", data)
+	}
+}
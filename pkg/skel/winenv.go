@@ -0,0 +1,72 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// isWindows is true when the plugin runs on Windows, where environment
+// variable names are case-insensitive, CNI_PATH is separated by ';' and
+// CNI_NETNS is usually the GUID of an HNS namespace
+var isWindows = runtime.GOOS == "windows"
+
+// envName returns the name under which a variable is captured. Windows
+// preserves the case a variable was set with but ignores it on lookup, so
+// CNI_* variables are captured in upper case.
+func envName(name string, windows bool) string {
+	if windows && strings.HasPrefix(strings.ToUpper(name), cniEnvPrefix) {
+		return strings.ToUpper(name)
+	}
+	return name
+}
+
+// PathList returns the directories in Path, which are separated by ';' on
+// Windows and ':' elsewhere
+func (args *CmdArgs) PathList() []string {
+	return splitPathList(args.Path, isWindows)
+}
+
+func splitPathList(path string, windows bool) []string {
+	sep := ":"
+	if windows {
+		sep = ";"
+	}
+	dirs := []string{}
+	for _, dir := range strings.Split(path, sep) {
+		if windows {
+			// Directories containing ';' are quoted
+			dir = strings.Trim(dir, `"`)
+		}
+		if dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+var guidRegexp = regexp.MustCompile(`^\{?([0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12})\}?$`)
+
+// NetnsGUID returns the namespace GUID when Netns is the GUID of a Windows
+// HNS namespace rather than a path, in lower case and without braces
+func (args *CmdArgs) NetnsGUID() (string, bool) {
+	m := guidRegexp.FindStringSubmatch(args.Netns)
+	if m == nil || strings.HasPrefix(args.Netns, "{") != strings.HasSuffix(args.Netns, "}") {
+		return "", false
+	}
+	return strings.ToLower(m[1]), true
+}
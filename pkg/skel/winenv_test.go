@@ -0,0 +1,88 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skel
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/containernetworking/cni/pkg/version"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Windows environment handling", func() {
+	It("captures CNI_* variables regardless of case on Windows", func() {
+		cmdAdd := &fakeCmd{}
+		environ := []string{
+			"Cni_Command=ADD",
+			"cni_containerid=some-container-id",
+			"CNI_NETNS={6A1F2C3D-4B5E-4F60-8A7B-9C0D1E2F3A4B}",
+			"CNI_IfName=eth0",
+			`CNI_PATH=C:\k\cni;"C:\Program Files\cni"`,
+			"Path=C:\\Windows",
+		}
+		dispatch := &dispatcher{
+			Getenv:  func(string) string { return "" },
+			Environ: func() []string { return environ },
+			Stdin:   strings.NewReader(`{ "name":"skel-test", "type": "test", "cniVersion": "1.0.0" }`),
+			Stdout:  &bytes.Buffer{},
+			Stderr:  &bytes.Buffer{},
+			windows: true,
+		}
+		err := dispatch.pluginMain(cmdAdd.Func, nil, nil, version.PluginSupports("1.0.0"), "")
+		Expect(err).NotTo(HaveOccurred())
+
+		args := cmdAdd.Received.CmdArgs
+		Expect(args.ContainerID).To(Equal("some-container-id"))
+		Expect(args.IfName).To(Equal("eth0"))
+		Expect(args.Env.Names()).To(Equal([]string{"CNI_COMMAND", "CNI_CONTAINERID", "CNI_IFNAME", "CNI_NETNS", "CNI_PATH"}))
+		Expect(splitPathList(args.Path, true)).To(Equal([]string{`C:\k\cni`, `C:\Program Files\cni`}))
+
+		guid, ok := args.NetnsGUID()
+		Expect(ok).To(BeTrue())
+		Expect(guid).To(Equal("6a1f2c3d-4b5e-4f60-8a7b-9c0d1e2f3a4b"))
+	})
+
+	It("keeps names case-sensitive elsewhere", func() {
+		Expect(envName("Cni_Command", false)).To(Equal("Cni_Command"))
+		Expect(envName("Cni_Command", true)).To(Equal("CNI_COMMAND"))
+		Expect(envName("Path", true)).To(Equal("Path"))
+	})
+
+	DescribeTable("splitting CNI_PATH",
+		func(path string, windows bool, expected []string) {
+			Expect(splitPathList(path, windows)).To(Equal(expected))
+		},
+		Entry("unix", "/opt/cni/bin::/usr/lib/cni", false, []string{"/opt/cni/bin", "/usr/lib/cni"}),
+		Entry("windows", `C:\k\cni;D:\cni;`, true, []string{`C:\k\cni`, `D:\cni`}),
+		Entry("empty", "", false, []string{}),
+	)
+
+	DescribeTable("recognizing HNS namespace GUIDs",
+		func(netns string, expected string, ok bool) {
+			guid, isGUID := (&CmdArgs{Netns: netns}).NetnsGUID()
+			Expect(isGUID).To(Equal(ok))
+			Expect(guid).To(Equal(expected))
+		},
+		Entry("bare", "6a1f2c3d-4b5e-4f60-8a7b-9c0d1e2f3a4b", "6a1f2c3d-4b5e-4f60-8a7b-9c0d1e2f3a4b", true),
+		Entry("braced", "{6A1F2C3D-4B5E-4F60-8A7B-9C0D1E2F3A4B}", "6a1f2c3d-4b5e-4f60-8a7b-9c0d1e2f3a4b", true),
+		Entry("unbalanced braces", "{6a1f2c3d-4b5e-4f60-8a7b-9c0d1e2f3a4b", "", false),
+		Entry("path", "/var/run/netns/test", "", false),
+		Entry("empty", "", "", false),
+	)
+})
@@ -0,0 +1,138 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types100
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/containernetworking/cni/pkg/types"
+)
+
+// CheckState compares the state a plugin observed for an attachment,
+// described as a Result, with r, the prevResult it was given in CHECK. It
+// returns nil if every interface, address and route of r was observed,
+// and otherwise a *types.Error with the code types.ErrInternal that lists
+// each mismatch in its details and carries a types.Verification of the
+// interfaces and addresses. Observed state that r does not describe, such
+// as addresses added by other plugins, is not a mismatch.
+func (r *Result) CheckState(observed *Result) error {
+	if observed == nil {
+		observed = &Result{}
+	}
+	v := &types.Verification{}
+	var mismatches []string
+	drift := func(format string, a ...interface{}) string {
+		msg := fmt.Sprintf(format, a...)
+		mismatches = append(mismatches, msg)
+		return msg
+	}
+
+	for _, iface := range r.Interfaces {
+		found := observed.findInterface(iface.Name, iface.Sandbox)
+		var msg string
+		switch {
+		case found == nil:
+			msg = drift("interface %s not found", interfaceName(iface))
+		case iface.Mac != "" && !types.SameMAC(iface.Mac, found.Mac):
+			msg = drift("interface %s has MAC %q, expected %q", interfaceName(iface), found.Mac, iface.Mac)
+		default:
+			if err := iface.CheckAlias(found.Alias); err != nil {
+				msg = drift("%v", err)
+			}
+		}
+		if msg != "" {
+			v.SetInterface(iface.Name, iface.Sandbox, types.VerificationDrifted, msg)
+		} else {
+			v.SetInterface(iface.Name, iface.Sandbox, types.VerificationVerified, "")
+		}
+	}
+
+	for _, ip := range r.IPs {
+		address := ip.Address.String()
+		found := observed.findIP(address)
+		var msg string
+		switch {
+		case found == nil:
+			msg = drift("address %s not found", address)
+		case ip.Gateway != nil && !ip.Gateway.Equal(found.Gateway):
+			msg = drift("address %s has gateway %v, expected %v", address, found.Gateway, ip.Gateway)
+		default:
+			expected, actual := r.interfaceOf(ip), observed.interfaceOf(found)
+			if expected != nil && actual != nil && (expected.Name != actual.Name || expected.Sandbox != actual.Sandbox) {
+				msg = drift("address %s is on interface %s, expected %s", address, interfaceName(actual), interfaceName(expected))
+			}
+		}
+		if msg != "" {
+			v.SetIP(address, types.VerificationDrifted, msg)
+		} else {
+			v.SetIP(address, types.VerificationVerified, "")
+		}
+	}
+
+	observedRoutes := map[string]bool{}
+	for _, route := range observed.Routes {
+		observedRoutes[routeKey(route)] = true
+	}
+	for _, route := range r.Routes {
+		if !observedRoutes[routeKey(route)] {
+			drift("route %s not found", route)
+		}
+	}
+
+	if len(mismatches) == 0 {
+		return nil
+	}
+	noun := "mismatches"
+	if len(mismatches) == 1 {
+		noun = "mismatch"
+	}
+	err := types.NewError(types.ErrInternal, fmt.Sprintf("state has %d %s with prevResult", len(mismatches), noun), strings.Join(mismatches, "; "))
+	err.Verification = v
+	return err
+}
+
+func (r *Result) findInterface(name, sandbox string) *Interface {
+	for _, iface := range r.Interfaces {
+		if iface.Name == name && iface.Sandbox == sandbox {
+			return iface
+		}
+	}
+	return nil
+}
+
+func (r *Result) findIP(address string) *IPConfig {
+	for _, ip := range r.IPs {
+		if ip.Address.String() == address {
+			return ip
+		}
+	}
+	return nil
+}
+
+// interfaceOf returns the interface ip refers to, if any
+func (r *Result) interfaceOf(ip *IPConfig) *Interface {
+	if ip.Interface == nil || *ip.Interface < 0 || *ip.Interface >= len(r.Interfaces) {
+		return nil
+	}
+	return r.Interfaces[*ip.Interface]
+}
+
+func interfaceName(iface *Interface) string {
+	if iface.Sandbox == "" {
+		return iface.Name
+	}
+	return fmt.Sprintf("%s in %s", iface.Name, iface.Sandbox)
+}
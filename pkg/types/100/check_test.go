@@ -0,0 +1,96 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types100_test
+
+import (
+	"errors"
+	"net"
+
+	"github.com/containernetworking/cni/pkg/types"
+	current "github.com/containernetworking/cni/pkg/types/100"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("checking observed state against a prevResult", func() {
+	var (
+		prevResult *current.Result
+		observed   *current.Result
+	)
+
+	BeforeEach(func() {
+		prevResult = testResult()
+		observed = testResult()
+		// State the prevResult does not describe is not a mismatch
+		observed.Interfaces = append(observed.Interfaces, &current.Interface{Name: "lo", Sandbox: "/proc/3553/ns/net"})
+	})
+
+	It("succeeds when the state matches", func() {
+		Expect(prevResult.CheckState(observed)).To(Succeed())
+	})
+
+	It("ignores the case and format of MAC addresses", func() {
+		prevResult.Interfaces[0].Mac = "0A:1B:22:33:44:55"
+		observed.Interfaces[0].Mac = "0a:1b:22:33:44:55"
+		Expect(prevResult.CheckState(observed)).To(Succeed())
+
+		observed.Interfaces[0].Mac = "0a1b.2233.4455"
+		Expect(prevResult.CheckState(observed)).To(Succeed())
+	})
+
+	It("lists every mismatch and reports a verification", func() {
+		observed.Interfaces[0].Mac = "66:77:88:99:aa:bb"
+		observed.IPs = observed.IPs[:1]
+		observed.IPs[0].Gateway = net.ParseIP("1.2.3.254")
+		observed.Routes = observed.Routes[1:]
+
+		err := prevResult.CheckState(observed)
+		var typedErr *types.Error
+		Expect(errors.As(err, &typedErr)).To(BeTrue())
+		Expect(typedErr.Code).To(Equal(types.ErrInternal))
+		Expect(typedErr.Msg).To(Equal("state has 4 mismatches with prevResult"))
+		Expect(typedErr.Details).To(Equal(
+			`interface eth0 in /proc/3553/ns/net has MAC "66:77:88:99:aa:bb", expected "00:11:22:33:44:55"; ` +
+				"address 1.2.3.30/24 has gateway 1.2.3.254, expected 1.2.3.1; " +
+				"address abcd:1234:ffff::cdde/64 not found; " +
+				"route " + prevResult.Routes[0].String() + " not found",
+		))
+
+		Expect(typedErr.Verification.Status()).To(Equal(types.VerificationDrifted))
+		Expect(typedErr.Verification.Interfaces).To(HaveLen(1))
+		Expect(typedErr.Verification.Interfaces[0].Status).To(Equal(types.VerificationDrifted))
+		Expect(typedErr.Verification.IPs).To(HaveLen(2))
+		Expect(typedErr.Verification.IPs[0].Status).To(Equal(types.VerificationDrifted))
+		Expect(typedErr.Verification.IPs[1].Message).To(Equal("address abcd:1234:ffff::cdde/64 not found"))
+	})
+
+	It("reports missing interfaces and addresses on the wrong interface", func() {
+		observed.Interfaces = []*current.Interface{{Name: "net1", Sandbox: "/proc/3553/ns/net"}}
+
+		err := prevResult.CheckState(observed)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(HavePrefix("state has 3 mismatches with prevResult; interface eth0 in /proc/3553/ns/net not found; " +
+			"address 1.2.3.30/24 is on interface net1 in /proc/3553/ns/net, expected eth0 in /proc/3553/ns/net"))
+	})
+
+	It("checks interface aliases", func() {
+		prevResult.Interfaces[0].Alias = "pod-a"
+		observed.Interfaces[0].Alias = "pod-b"
+
+		err := prevResult.CheckState(observed)
+		Expect(err).To(MatchError(`state has 1 mismatch with prevResult; interface eth0 has alias "pod-b", expected "pod-a"`))
+	})
+})
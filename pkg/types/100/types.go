@@ -73,6 +73,17 @@ func GetResult(r types.Result) (*Result, error) {
 	return result, nil
 }
 
+// ParseResult parses a result of the given CNI version and converts it to
+// this package's Result type, so that callers do not need to assert and
+// convert a types.Result themselves.
+func ParseResult(data []byte, version string) (*Result, error) {
+	result, err := convert.Create(version, data)
+	if err != nil {
+		return nil, err
+	}
+	return NewResultFromResult(result)
+}
+
 func NewResultFromResult(result types.Result) (*Result, error) {
 	newResult, err := convert.Convert(result, ImplementedSpecVersion)
 	if err != nil {
@@ -180,7 +191,15 @@ func convertTo04x(from types.Result, toVersion string) (types.Result, error) {
 		toResult.IPs = append(toResult.IPs, convertIPConfigTo040(fromIPC))
 	}
 	for _, fromRoute := range fromResult.Routes {
-		toResult.Routes = append(toResult.Routes, fromRoute.Copy())
+		// Dropping the selectors would turn a source-based route into
+		// an ordinary one, so refuse to convert instead
+		if fromRoute.HasPolicySelectors() {
+			return nil, fmt.Errorf("cannot convert: route to %s uses from or table, which require version 1.0.0 or later", fromRoute.Dst.String())
+		}
+		// Producers are not part of earlier versions
+		toRoute := fromRoute.Copy()
+		toRoute.Plugin = ""
+		toResult.Routes = append(toResult.Routes, toRoute)
 	}
 	return toResult, nil
 }
@@ -224,11 +243,137 @@ func (r *Result) PrintTo(writer io.Writer) error {
 	return err
 }
 
+// AttributeTo records plugin as the producer of the interfaces, IPs and
+// routes in r that have no producer recorded. Entries that also appear in
+// prev, the result the plugin received, take the producer recorded there,
+// so that a plugin passing its prevResult through is not credited with
+// its contents. prev may be nil.
+func (r *Result) AttributeTo(plugin string, prev *Result) {
+	intfs := map[string]string{}
+	ips := map[string]string{}
+	routes := map[string]string{}
+	if prev != nil {
+		for _, intf := range prev.Interfaces {
+			intfs[intf.Name+"/"+intf.Sandbox] = intf.Plugin
+		}
+		for _, ip := range prev.IPs {
+			ips[ip.Address.String()] = ip.Plugin
+		}
+		for _, route := range prev.Routes {
+			routes[routeKey(route)] = route.Plugin
+		}
+	}
+
+	producer := func(known map[string]string, key string) string {
+		if p, ok := known[key]; ok && p != "" {
+			return p
+		}
+		return plugin
+	}
+	for _, intf := range r.Interfaces {
+		if intf.Plugin == "" {
+			intf.Plugin = producer(intfs, intf.Name+"/"+intf.Sandbox)
+		}
+	}
+	for _, ip := range r.IPs {
+		if ip.Plugin == "" {
+			ip.Plugin = producer(ips, ip.Address.String())
+		}
+	}
+	for _, route := range r.Routes {
+		if route.Plugin == "" {
+			route.Plugin = producer(routes, routeKey(route))
+		}
+	}
+}
+
+// WithoutAttribution returns a copy of r without the producers recorded
+// by AttributeTo. Producers are kept out of the prevResult passed to
+// plugins, as they are not part of the spec.
+func (r *Result) WithoutAttribution() *Result {
+	res := *r
+	res.Interfaces = nil
+	for _, intf := range r.Interfaces {
+		c := intf.Copy()
+		c.Plugin = ""
+		res.Interfaces = append(res.Interfaces, c)
+	}
+	res.IPs = nil
+	for _, ip := range r.IPs {
+		c := ip.Copy()
+		c.Plugin = ""
+		res.IPs = append(res.IPs, c)
+	}
+	res.Routes = nil
+	for _, route := range r.Routes {
+		c := route.Copy()
+		c.Plugin = ""
+		res.Routes = append(res.Routes, c)
+	}
+	return &res
+}
+
+// routeKey identifies a route regardless of its producer
+func routeKey(r *types.Route) string {
+	key := *r.Copy()
+	key.Plugin = ""
+	return key.String()
+}
+
 // Interface contains values about the created interfaces
 type Interface struct {
 	Name    string `json:"name"`
 	Mac     string `json:"mac,omitempty"`
 	Sandbox string `json:"sandbox,omitempty"`
+	// Plugin, if set, is the type of the plugin in the chain that
+	// created the interface
+	Plugin string `json:"plugin,omitempty"`
+	// Alias, if set, is a free-form label for the interface, such as the
+	// name of the pod it belongs to. Plugins may also set it as the
+	// interface's alias on the host, so that CHECK can verify it with
+	// CheckAlias. It is dropped when converting to versions before 1.0.0.
+	Alias string `json:"alias,omitempty"`
+}
+
+// interfaceJSON has the fields of Interface without its JSON methods
+type interfaceJSON Interface
+
+// MarshalJSON encodes the interface with its MAC address in canonical
+// form; see types.NormalizeMAC
+func (i *Interface) MarshalJSON() ([]byte, error) {
+	v := interfaceJSON(*i)
+	mac, err := types.NormalizeMAC(v.Mac)
+	if err != nil {
+		return nil, err
+	}
+	v.Mac = mac
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON decodes the interface, normalizing its MAC address, so
+// that addresses printed in other formats compare equal. An invalid MAC
+// address is a types.InvalidMACError.
+func (i *Interface) UnmarshalJSON(data []byte) error {
+	var v interfaceJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	mac, err := types.NormalizeMAC(v.Mac)
+	if err != nil {
+		return err
+	}
+	v.Mac = mac
+	*i = Interface(v)
+	return nil
+}
+
+// CheckAlias returns an error if the interface has an alias and actual,
+// the alias found on the interface, differs from it
+func (i *Interface) CheckAlias(actual string) error {
+	if i.Alias != "" && i.Alias != actual {
+		return fmt.Errorf("interface %s has alias %q, expected %q", i.Name, actual, i.Alias)
+	}
+	return nil
 }
 
 func (i *Interface) String() string {
@@ -255,6 +400,9 @@ type IPConfig struct {
 	Interface *int
 	Address   net.IPNet
 	Gateway   net.IP
+	// Plugin, if set, is the type of the plugin in the chain that
+	// assigned the address
+	Plugin string
 }
 
 func (i *IPConfig) String() string {
@@ -269,6 +417,7 @@ func (i *IPConfig) Copy() *IPConfig {
 	ipc := &IPConfig{
 		Address: i.Address,
 		Gateway: i.Gateway,
+		Plugin:  i.Plugin,
 	}
 	if i.Interface != nil {
 		intf := *i.Interface
@@ -282,6 +431,7 @@ type ipConfig struct {
 	Interface *int        `json:"interface,omitempty"`
 	Address   types.IPNet `json:"address"`
 	Gateway   net.IP      `json:"gateway,omitempty"`
+	Plugin    string      `json:"plugin,omitempty"`
 }
 
 func (c *IPConfig) MarshalJSON() ([]byte, error) {
@@ -289,6 +439,7 @@ func (c *IPConfig) MarshalJSON() ([]byte, error) {
 		Interface: c.Interface,
 		Address:   types.IPNet(c.Address),
 		Gateway:   c.Gateway,
+		Plugin:    c.Plugin,
 	}
 
 	return json.Marshal(ipc)
@@ -303,5 +454,6 @@ func (c *IPConfig) UnmarshalJSON(data []byte) error {
 	c.Interface = ipc.Interface
 	c.Address = net.IPNet(ipc.Address)
 	c.Gateway = ipc.Gateway
+	c.Plugin = ipc.Plugin
 	return nil
 }
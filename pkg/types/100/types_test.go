@@ -16,6 +16,7 @@ package types100_test
 
 import (
 	"encoding/json"
+	"errors"
 	"io/ioutil"
 	"net"
 	"os"
@@ -278,6 +279,125 @@ var _ = Describe("Current types operations", func() {
 }`))
 	})
 
+	Context("when a route has policy selectors", func() {
+		var res *current.Result
+
+		BeforeEach(func() {
+			res = testResult()
+			from, err := types.ParseCIDR("1.2.3.0/24")
+			Expect(err).NotTo(HaveOccurred())
+			res.Routes[0].From = from
+			res.Routes[0].Table = current.Int(100)
+		})
+
+		It("keeps them in a 1.0.0 result", func() {
+			data, err := json.Marshal(res)
+			Expect(err).NotTo(HaveOccurred())
+			parsed, err := current.ParseResult(data, "1.0.0")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(parsed.Routes[0].From.String()).To(Equal("1.2.3.0/24"))
+			Expect(*parsed.Routes[0].Table).To(Equal(100))
+		})
+
+		It("refuses to convert to an older version", func() {
+			for _, ver := range []string{"0.4.0", "0.3.1", "0.2.0"} {
+				_, err := res.GetAsVersion(ver)
+				Expect(err).To(MatchError("cannot convert: route to 15.5.6.0/24 uses from or table, which require version 1.0.0 or later"))
+			}
+		})
+	})
+
+	Context("when interfaces have aliases", func() {
+		var res *current.Result
+
+		BeforeEach(func() {
+			res = testResult()
+			res.Interfaces[0].Alias = "default/web-0"
+		})
+
+		It("keeps them in a 1.0.0 result", func() {
+			data, err := json.Marshal(res)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(ContainSubstring(`"alias":"default/web-0"`))
+			parsed, err := current.ParseResult(data, "1.0.0")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(parsed.Interfaces[0].Alias).To(Equal("default/web-0"))
+			Expect(parsed.Interfaces[0].Copy().Alias).To(Equal("default/web-0"))
+		})
+
+		It("strips them when converting to an older version", func() {
+			converted, err := res.GetAsVersion("0.4.0")
+			Expect(err).NotTo(HaveOccurred())
+			data, err := json.Marshal(converted)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).NotTo(ContainSubstring("alias"))
+		})
+
+		It("checks the alias found on the interface", func() {
+			intf := res.Interfaces[0]
+			Expect(intf.CheckAlias("default/web-0")).To(Succeed())
+			Expect(intf.CheckAlias("default/web-1")).To(MatchError(`interface eth0 has alias "default/web-1", expected "default/web-0"`))
+			Expect(res.Interfaces[0].Copy()).To(Equal(intf))
+
+			intf.Alias = ""
+			Expect(intf.CheckAlias("anything")).To(Succeed())
+		})
+	})
+
+	Context("when producers are recorded", func() {
+		var prev, res *current.Result
+
+		BeforeEach(func() {
+			prev = testResult()
+			prev.AttributeTo("bridge", nil)
+
+			// A chained plugin passes prevResult through and adds a route
+			res = testResult()
+			extra := *res.Routes[0]
+			extra.GW = net.ParseIP("15.5.6.9")
+			res.Routes = append(res.Routes, &extra)
+			res.AttributeTo("tuning", prev)
+		})
+
+		It("credits each entry to the plugin that added it", func() {
+			Expect(res.Interfaces[0].Plugin).To(Equal("bridge"))
+			Expect(res.IPs[0].Plugin).To(Equal("bridge"))
+			Expect(res.IPs[1].Plugin).To(Equal("bridge"))
+			Expect(res.Routes[0].Plugin).To(Equal("bridge"))
+			Expect(res.Routes[1].Plugin).To(Equal("bridge"))
+			Expect(res.Routes[2].Plugin).To(Equal("tuning"))
+		})
+
+		It("keeps them in a 1.0.0 result", func() {
+			data, err := json.Marshal(res)
+			Expect(err).NotTo(HaveOccurred())
+			parsed, err := current.ParseResult(data, "1.0.0")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(parsed.Interfaces[0].Plugin).To(Equal("bridge"))
+			Expect(parsed.IPs[0].Plugin).To(Equal("bridge"))
+			Expect(parsed.Routes[2].Plugin).To(Equal("tuning"))
+		})
+
+		It("strips them when converting to an older version", func() {
+			for _, ver := range []string{"0.4.0", "0.3.1", "0.2.0"} {
+				converted, err := res.GetAsVersion(ver)
+				Expect(err).NotTo(HaveOccurred())
+				data, err := json.Marshal(converted)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(data)).NotTo(ContainSubstring("plugin"))
+			}
+		})
+
+		It("strips them from a copy", func() {
+			stripped := res.WithoutAttribution()
+			data, err := json.Marshal(stripped)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).NotTo(ContainSubstring("plugin"))
+			Expect(stripped.Routes).To(HaveLen(3))
+			Expect(res.Routes[2].Plugin).To(Equal("tuning"))
+		})
+	})
+
 	It("correctly marshals and unmarshals interface index 0", func() {
 		ipc := &current.IPConfig{
 			Interface: current.Int(0),
@@ -321,4 +441,66 @@ var _ = Describe("Current types operations", func() {
     "address": "10.1.2.3/24"
 }`))
 	})
+
+	Context("when parsing a result with ParseResult", func() {
+		It("returns a typed result for the current version", func() {
+			data, err := json.Marshal(testResult())
+			Expect(err).NotTo(HaveOccurred())
+
+			result, err := current.ParseResult(data, "1.0.0")
+			Expect(err).NotTo(HaveOccurred())
+			parsed, err := json.Marshal(result)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(parsed).To(MatchJSON(data))
+		})
+
+		It("converts a result of an older version", func() {
+			result, err := current.ParseResult([]byte(`{
+    "cniVersion": "0.4.0",
+    "ips": [{"version": "4", "address": "10.1.2.3/24"}]
+}`), "0.4.0")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.CNIVersion).To(Equal("1.0.0"))
+			Expect(result.IPs).To(HaveLen(1))
+			Expect(result.IPs[0].Address.String()).To(Equal("10.1.2.3/24"))
+		})
+
+		It("returns an error for an unknown version", func() {
+			_, err := current.ParseResult([]byte(`{"cniVersion": "5.0.0"}`), "5.0.0")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("Interface MAC addresses", func() {
+		It("normalizes MAC addresses when decoding and encoding", func() {
+			iface := &current.Interface{}
+			Expect(json.Unmarshal([]byte(`{"name": "eth0", "mac": "0A-58-0A-01-02-03"}`), iface)).To(Succeed())
+			Expect(iface.Mac).To(Equal("0a:58:0a:01:02:03"))
+
+			iface.Mac = "0A58.0A01.0203"
+			data, err := json.Marshal(iface)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(data).To(MatchJSON(`{"name": "eth0", "mac": "0a:58:0a:01:02:03"}`))
+
+			result, err := current.NewResult([]byte(`{"cniVersion": "1.0.0", "interfaces": [{"name": "eth0", "mac": "0A:58:0A:01:02:03"}]}`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.(*current.Result).Interfaces[0].Mac).To(Equal("0a:58:0a:01:02:03"))
+		})
+
+		It("keeps interfaces without a MAC address", func() {
+			data, err := json.Marshal(&current.Interface{Name: "lo"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(data).To(MatchJSON(`{"name": "lo"}`))
+		})
+
+		It("rejects invalid MAC addresses", func() {
+			err := json.Unmarshal([]byte(`{"name": "eth0", "mac": "not-a-mac"}`), &current.Interface{})
+			var macErr *types.InvalidMACError
+			Expect(errors.As(err, &macErr)).To(BeTrue())
+			Expect(macErr.MAC).To(Equal("not-a-mac"))
+
+			_, err = json.Marshal(&current.Interface{Name: "eth0", Mac: "00:11"})
+			Expect(errors.As(err, &macErr)).To(BeTrue())
+		})
+	})
 })
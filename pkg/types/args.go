@@ -18,6 +18,7 @@ import (
 	"encoding"
 	"fmt"
 	"reflect"
+	"strconv"
 	"strings"
 )
 
@@ -69,16 +70,125 @@ type UnmarshalableArgsError struct {
 	error
 }
 
-// LoadArgs parses args from a string in the form "K=V;K2=V2;..."
+// MaxArgsLength is the longest args string LoadArgs accepts
+const MaxArgsLength = 64 << 10
+
+// argOptions are the options of a field's cniarg struct tag, a comma
+// separated list of:
+//
+//	required       the arg must be passed
+//	ignoreinvalid  a value that cannot be unmarshalled leaves the field unset
+//	ignoreunknown  unknown args are ignored, as with IgnoreUnknown=true;
+//	               usually set on the embedded CommonArgs
+//	maxlen=N       values longer than N bytes are rejected
+//	default=V      V is unmarshalled into the field when the arg is not
+//	               passed; it must be the last option, and V may contain
+//	               commas
+type argOptions struct {
+	required      bool
+	ignoreInvalid bool
+	ignoreUnknown bool
+	maxLen        int
+	def           *string
+}
+
+func parseArgOptions(field, tag string) (argOptions, error) {
+	var opts argOptions
+	for tag != "" {
+		opt := tag
+		if strings.HasPrefix(opt, "default=") {
+			def := strings.TrimPrefix(opt, "default=")
+			opts.def = &def
+			break
+		}
+		if i := strings.Index(tag, ","); i >= 0 {
+			opt, tag = tag[:i], tag[i+1:]
+		} else {
+			tag = ""
+		}
+		switch {
+		case opt == "required":
+			opts.required = true
+		case opt == "ignoreinvalid":
+			opts.ignoreInvalid = true
+		case opt == "ignoreunknown":
+			opts.ignoreUnknown = true
+		case strings.HasPrefix(opt, "maxlen="):
+			n, err := strconv.Atoi(strings.TrimPrefix(opt, "maxlen="))
+			if err != nil || n < 0 {
+				return opts, fmt.Errorf("ARGS: invalid maxlen in cniarg tag of field '%s'", field)
+			}
+			opts.maxLen = n
+		default:
+			return opts, fmt.Errorf("ARGS: unknown option %q in cniarg tag of field '%s'", opt, field)
+		}
+	}
+	if opts.required && opts.def != nil {
+		return opts, fmt.Errorf("ARGS: field '%s' cannot be both required and have a default", field)
+	}
+	return opts, nil
+}
+
+// argFieldOptions returns the options of the tagged fields of t, a struct
+// type, including those of embedded structs, by field name
+func argFieldOptions(t reflect.Type) (map[string]argOptions, []string, error) {
+	options := map[string]argOptions{}
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if tag, ok := f.Tag.Lookup("cniarg"); ok {
+			opts, err := parseArgOptions(f.Name, tag)
+			if err != nil {
+				return nil, nil, err
+			}
+			options[f.Name] = opts
+			names = append(names, f.Name)
+		}
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			embedded, embeddedNames, err := argFieldOptions(f.Type)
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, name := range embeddedNames {
+				if _, ok := options[name]; !ok {
+					options[name] = embedded[name]
+					names = append(names, name)
+				}
+			}
+		}
+	}
+	return options, names, nil
+}
+
+// LoadArgs parses args from a string in the form "K=V;K2=V2;..." into
+// container, a pointer to a struct whose fields, which must implement
+// encoding.TextUnmarshaler, are named by the keys. Fields may declare
+// defaults, limits and whether they are required with a cniarg struct
+// tag; see argOptions. args may be at most MaxArgsLength bytes.
 func LoadArgs(args string, container interface{}) error {
-	if args == "" {
-		return nil
+	if len(args) > MaxArgsLength {
+		return fmt.Errorf("ARGS: longer than %d bytes", MaxArgsLength)
 	}
 
 	containerValue := reflect.ValueOf(container)
+	var options map[string]argOptions
+	var names []string
+	if containerValue.Kind() == reflect.Ptr && containerValue.Elem().Kind() == reflect.Struct {
+		var err error
+		if options, names, err = argFieldOptions(containerValue.Elem().Type()); err != nil {
+			return err
+		}
+	}
+	if args == "" && len(options) == 0 {
+		return nil
+	}
 
-	pairs := strings.Split(args, ";")
+	passed := map[string]bool{}
 	unknownArgs := []string{}
+	var pairs []string
+	if args != "" {
+		pairs = strings.Split(args, ";")
+	}
 	for _, pair := range pairs {
 		kv := strings.Split(pair, "=")
 		if len(kv) != 2 {
@@ -91,22 +201,64 @@ func LoadArgs(args string, container interface{}) error {
 			unknownArgs = append(unknownArgs, pair)
 			continue
 		}
-		keyFieldIface := keyField.Addr().Interface()
-		u, ok := keyFieldIface.(encoding.TextUnmarshaler)
-		if !ok {
-			return UnmarshalableArgsError{fmt.Errorf(
-				"ARGS: cannot unmarshal into field '%s' - type '%s' does not implement encoding.TextUnmarshaler",
-				keyString, reflect.TypeOf(keyFieldIface))}
+		opts := options[keyString]
+		if opts.maxLen > 0 && len(valueString) > opts.maxLen {
+			return fmt.Errorf("ARGS: value of %q is longer than %d bytes", keyString, opts.maxLen)
 		}
-		err := u.UnmarshalText([]byte(valueString))
-		if err != nil {
-			return fmt.Errorf("ARGS: error parsing value of pair %q: %v)", pair, err)
+		if err := unmarshalArg(keyString, valueString, keyField); err != nil {
+			if _, ok := err.(UnmarshalableArgsError); !ok && opts.ignoreInvalid {
+				continue
+			}
+			return err
 		}
+		passed[keyString] = true
 	}
 
-	isIgnoreUnknown := GetKeyField("IgnoreUnknown", containerValue).Bool()
-	if len(unknownArgs) > 0 && !isIgnoreUnknown {
+	missing := []string{}
+	for _, name := range names {
+		opts := options[name]
+		switch {
+		case passed[name]:
+		case opts.def != nil:
+			if err := unmarshalArg(name, *opts.def, GetKeyField(name, containerValue)); err != nil {
+				return fmt.Errorf("ARGS: invalid default for %q: %v", name, err)
+			}
+		case opts.required:
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("ARGS: missing required args %q", missing)
+	}
+
+	if len(unknownArgs) > 0 && !ignoreUnknown(containerValue, options) {
 		return fmt.Errorf("ARGS: unknown args %q", unknownArgs)
 	}
 	return nil
 }
+
+// unmarshalArg unmarshals value into the field named key
+func unmarshalArg(key, value string, field reflect.Value) error {
+	fieldIface := field.Addr().Interface()
+	u, ok := fieldIface.(encoding.TextUnmarshaler)
+	if !ok {
+		return UnmarshalableArgsError{fmt.Errorf(
+			"ARGS: cannot unmarshal into field '%s' - type '%s' does not implement encoding.TextUnmarshaler",
+			key, reflect.TypeOf(fieldIface))}
+	}
+	if err := u.UnmarshalText([]byte(value)); err != nil {
+		return fmt.Errorf("ARGS: error parsing value of pair %q: %v)", key+"="+value, err)
+	}
+	return nil
+}
+
+// ignoreUnknown returns true if unknown args should be ignored, because
+// IgnoreUnknown was passed or a field is tagged ignoreunknown
+func ignoreUnknown(containerValue reflect.Value, options map[string]argOptions) bool {
+	for _, opts := range options {
+		if opts.ignoreUnknown {
+			return true
+		}
+	}
+	return GetKeyField("IgnoreUnknown", containerValue).Bool()
+}
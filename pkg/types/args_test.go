@@ -129,4 +129,65 @@ var _ = Describe("LoadArgs", func() {
 
 		})
 	})
+
+	Context("When fields have cniarg tags", func() {
+		type podArgs struct {
+			CommonArgs
+			K8S_POD_NAME      UnmarshallableString `cniarg:"required,maxlen=8"`
+			K8S_POD_NAMESPACE UnmarshallableString `cniarg:"default=default"`
+			MAC               UnmarshallableString `cniarg:"default=aa:bb,cc"`
+			Debug             UnmarshallableBool   `cniarg:"ignoreinvalid"`
+		}
+
+		It("applies defaults for args that are not passed", func() {
+			args := podArgs{}
+			Expect(LoadArgs("K8S_POD_NAME=web", &args)).To(Succeed())
+			Expect(args.K8S_POD_NAME).To(BeEquivalentTo("web"))
+			Expect(args.K8S_POD_NAMESPACE).To(BeEquivalentTo("default"))
+			Expect(args.MAC).To(BeEquivalentTo("aa:bb,cc"))
+
+			Expect(LoadArgs("K8S_POD_NAME=web;K8S_POD_NAMESPACE=kube-system", &args)).To(Succeed())
+			Expect(args.K8S_POD_NAMESPACE).To(BeEquivalentTo("kube-system"))
+		})
+
+		It("fails when required args are missing, even without args", func() {
+			Expect(LoadArgs("", &podArgs{})).To(MatchError(`ARGS: missing required args ["K8S_POD_NAME"]`))
+		})
+
+		It("rejects values longer than their limit", func() {
+			Expect(LoadArgs("K8S_POD_NAME=much-too-long", &podArgs{})).To(MatchError(`ARGS: value of "K8S_POD_NAME" is longer than 8 bytes`))
+		})
+
+		It("ignores invalid values of fields that allow it", func() {
+			args := podArgs{}
+			Expect(LoadArgs("K8S_POD_NAME=web;Debug=maybe", &args)).To(Succeed())
+			Expect(args.Debug).To(BeEquivalentTo(false))
+		})
+
+		It("ignores unknown args when a field is tagged ignoreunknown", func() {
+			args := struct {
+				CommonArgs `cniarg:"ignoreunknown"`
+				IP         UnmarshallableString
+			}{}
+			Expect(LoadArgs("IP=10.0.0.2;K8S_POD_UID=1234", &args)).To(Succeed())
+			Expect(args.IP).To(BeEquivalentTo("10.0.0.2"))
+		})
+
+		It("rejects invalid tags", func() {
+			args := struct {
+				IP UnmarshallableString `cniarg:"optional"`
+			}{}
+			Expect(LoadArgs("IP=10.0.0.2", &args)).To(MatchError(`ARGS: unknown option "optional" in cniarg tag of field 'IP'`))
+		})
+	})
+
+	Context("When the args are too long", func() {
+		It("LoadArgs should fail", func() {
+			args := make([]byte, MaxArgsLength+1)
+			for i := range args {
+				args[i] = 'a'
+			}
+			Expect(LoadArgs(string(args), &CommonArgs{})).To(MatchError(ContainSubstring("longer than")))
+		})
+	})
 })
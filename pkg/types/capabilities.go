@@ -0,0 +1,98 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Capability is the name of a capability a plugin can declare in its
+// network configuration to receive runtime arguments. See CONVENTIONS.md.
+type Capability string
+
+// Conventional capability names
+const (
+	CapabilityPortMappings   Capability = "portMappings"
+	CapabilityIPRanges       Capability = "ipRanges"
+	CapabilityBandwidth      Capability = "bandwidth"
+	CapabilityDNS            Capability = "dns"
+	CapabilityIPs            Capability = "ips"
+	CapabilityMAC            Capability = "mac"
+	CapabilityInfinibandGUID Capability = "infinibandGUID"
+	CapabilityDeviceID       Capability = "deviceID"
+	CapabilityAliases        Capability = "aliases"
+	CapabilityCgroupPath     Capability = "cgroupPath"
+	CapabilityPodAnnotations Capability = "podAnnotations"
+)
+
+var knownCapabilities = []Capability{
+	CapabilityPortMappings,
+	CapabilityIPRanges,
+	CapabilityBandwidth,
+	CapabilityDNS,
+	CapabilityIPs,
+	CapabilityMAC,
+	CapabilityInfinibandGUID,
+	CapabilityDeviceID,
+	CapabilityAliases,
+	CapabilityCgroupPath,
+	CapabilityPodAnnotations,
+}
+
+// KnownCapabilities returns the conventional capability names. The order
+// is stable and new names are only ever appended.
+func KnownCapabilities() []Capability {
+	return append([]Capability(nil), knownCapabilities...)
+}
+
+// IsKnown returns true if c is a conventional capability name
+func (c Capability) IsKnown() bool {
+	for _, k := range knownCapabilities {
+		if c == k {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateCapabilities returns an error naming every key of caps that is
+// not a conventional capability. Since capability names are matched
+// exactly, a misspelled name silently disables the capability; when a
+// name differs from a known one only in case, the error suggests it.
+// Plugins and runtimes that define their own capabilities should not
+// use this check.
+func ValidateCapabilities(caps map[string]bool) error {
+	var problems []string
+	for name := range caps {
+		if Capability(name).IsKnown() {
+			continue
+		}
+		problem := fmt.Sprintf("%q", name)
+		for _, k := range knownCapabilities {
+			if strings.EqualFold(name, string(k)) {
+				problem = fmt.Sprintf("%q (did you mean %q?)", name, k)
+				break
+			}
+		}
+		problems = append(problems, problem)
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+	return fmt.Errorf("unknown capabilities: %s", strings.Join(problems, ", "))
+}
@@ -0,0 +1,49 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types_test
+
+import (
+	"github.com/containernetworking/cni/pkg/types"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Capabilities", func() {
+	It("enumerates the conventional capabilities", func() {
+		caps := types.KnownCapabilities()
+		Expect(caps).To(ContainElement(types.CapabilityPortMappings))
+		Expect(caps).To(ContainElement(types.CapabilityPodAnnotations))
+		Expect(caps[0]).To(Equal(types.CapabilityPortMappings))
+
+		// the returned slice is a copy
+		caps[0] = "banana"
+		Expect(types.KnownCapabilities()[0]).To(Equal(types.CapabilityPortMappings))
+	})
+
+	It("recognizes known names exactly", func() {
+		Expect(types.CapabilityBandwidth.IsKnown()).To(BeTrue())
+		Expect(types.Capability("Bandwidth").IsKnown()).To(BeFalse())
+	})
+
+	It("accepts known capabilities", func() {
+		Expect(types.ValidateCapabilities(map[string]bool{"portMappings": true, "dns": false})).To(Succeed())
+	})
+
+	It("reports unknown capabilities and suggests corrections", func() {
+		err := types.ValidateCapabilities(map[string]bool{"portmappings": true, "frobnicate": true})
+		Expect(err).To(MatchError(`unknown capabilities: "frobnicate", "portmappings" (did you mean "portMappings"?)`))
+	})
+})
@@ -0,0 +1,152 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ErrPluginSpecificMin is the lowest error code a plugin may define. The
+// specification reserves lower codes for well-known errors.
+const ErrPluginSpecificMin uint = 100
+
+// ErrorCode describes an error code: its name, such as
+// "DHCP_LEASE_EXHAUSTED", and whether the command may succeed if retried
+type ErrorCode struct {
+	Code        uint
+	Name        string
+	Retryable   bool
+	Description string
+}
+
+// New returns an error with the code
+func (c *ErrorCode) New(msg, details string) *Error {
+	return NewError(c.Code, msg, details)
+}
+
+// Newf returns an error with the code and a formatted message
+func (c *ErrorCode) Newf(format string, a ...interface{}) *Error {
+	return NewError(c.Code, fmt.Sprintf(format, a...), "")
+}
+
+// Is returns true if err is an *Error with the code
+func (c *ErrorCode) Is(err error) bool {
+	var e *Error
+	return errors.As(err, &e) && e.Code == c.Code
+}
+
+// ErrorRegistry holds the error codes a plugin may return. Plugins
+// register their own codes with it, and runtimes that import the
+// registry use it to classify the errors the plugin prints.
+type ErrorRegistry struct {
+	mu    sync.RWMutex
+	codes map[uint]*ErrorCode
+}
+
+// NewErrorRegistry returns a registry holding the well-known error codes
+func NewErrorRegistry() *ErrorRegistry {
+	r := &ErrorRegistry{codes: map[uint]*ErrorCode{}}
+	for _, c := range []ErrorCode{
+		{Code: ErrUnknown, Name: "UNKNOWN"},
+		{Code: ErrIncompatibleCNIVersion, Name: "INCOMPATIBLE_CNI_VERSION"},
+		{Code: ErrUnsupportedField, Name: "UNSUPPORTED_FIELD"},
+		{Code: ErrUnknownContainer, Name: "UNKNOWN_CONTAINER"},
+		{Code: ErrInvalidEnvironmentVariables, Name: "INVALID_ENVIRONMENT_VARIABLES"},
+		{Code: ErrIOFailure, Name: "IO_FAILURE"},
+		{Code: ErrDecodingFailure, Name: "DECODING_FAILURE"},
+		{Code: ErrInvalidNetworkConfig, Name: "INVALID_NETWORK_CONFIG"},
+		{Code: ErrTryAgainLater, Name: "TRY_AGAIN_LATER", Retryable: true},
+		{Code: ErrTimeout, Name: "TIMEOUT", Retryable: true},
+		{Code: ErrInternal, Name: "INTERNAL"},
+	} {
+		c := c
+		r.codes[c.Code] = &c
+	}
+	return r
+}
+
+// Register adds a plugin-specific error code. The code must be at least
+// ErrPluginSpecificMin, and neither the code nor the name may already be
+// registered.
+func (r *ErrorRegistry) Register(code uint, name string, retryable bool, description string) (*ErrorCode, error) {
+	if code < ErrPluginSpecificMin || code == ErrTimeout || code == ErrInternal {
+		return nil, fmt.Errorf("error code %d is reserved; plugin-specific codes start at %d", code, ErrPluginSpecificMin)
+	}
+	if name == "" {
+		return nil, fmt.Errorf("error code %d has no name", code)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.codes[code]; ok {
+		return nil, fmt.Errorf("error code %d is already registered as %s", code, existing.Name)
+	}
+	for _, existing := range r.codes {
+		if existing.Name == name {
+			return nil, fmt.Errorf("error name %s is already registered for code %d", name, existing.Code)
+		}
+	}
+	c := &ErrorCode{Code: code, Name: name, Retryable: retryable, Description: description}
+	r.codes[code] = c
+	return c, nil
+}
+
+// MustRegister is like Register, but panics on error. It is meant for
+// declaring codes in package-level variables.
+func (r *ErrorRegistry) MustRegister(code uint, name string, retryable bool, description string) *ErrorCode {
+	c, err := r.Register(code, name, retryable, description)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// Lookup returns the registered error code
+func (r *ErrorRegistry) Lookup(code uint) (*ErrorCode, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c, ok := r.codes[code]
+	return c, ok
+}
+
+// Classify returns the registered code of err, which must be an *Error
+func (r *ErrorRegistry) Classify(err error) (*ErrorCode, bool) {
+	var e *Error
+	if !errors.As(err, &e) {
+		return nil, false
+	}
+	return r.Lookup(e.Code)
+}
+
+// IsRetryable returns true if err has a registered code that is retryable
+func (r *ErrorRegistry) IsRetryable(err error) bool {
+	c, ok := r.Classify(err)
+	return ok && c.Retryable
+}
+
+// Codes returns the registered error codes, sorted by code
+func (r *ErrorRegistry) Codes() []*ErrorCode {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	codes := make([]*ErrorCode, 0, len(r.codes))
+	for _, c := range r.codes {
+		codes = append(codes, c)
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i].Code < codes[j].Code })
+	return codes
+}
@@ -0,0 +1,78 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types_test
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/containernetworking/cni/pkg/types"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ErrorRegistry", func() {
+	var registry *types.ErrorRegistry
+
+	BeforeEach(func() {
+		registry = types.NewErrorRegistry()
+	})
+
+	It("holds the well-known codes", func() {
+		c, ok := registry.Lookup(types.ErrTryAgainLater)
+		Expect(ok).To(BeTrue())
+		Expect(c.Name).To(Equal("TRY_AGAIN_LATER"))
+		Expect(c.Retryable).To(BeTrue())
+		Expect(registry.IsRetryable(types.NewError(types.ErrInvalidNetworkConfig, "bad", ""))).To(BeFalse())
+	})
+
+	It("constructs and classifies plugin-specific errors", func() {
+		exhausted := registry.MustRegister(120, "LEASE_EXHAUSTED", true, "no addresses are left in the pool")
+		e := exhausted.Newf("no lease for %s", "eth0")
+		Expect(e).To(Equal(types.NewError(120, "no lease for eth0", "")))
+
+		wrapped := fmt.Errorf("ADD failed: %w", e)
+		Expect(exhausted.Is(wrapped)).To(BeTrue())
+		c, ok := registry.Classify(wrapped)
+		Expect(ok).To(BeTrue())
+		Expect(c.Name).To(Equal("LEASE_EXHAUSTED"))
+		Expect(registry.IsRetryable(wrapped)).To(BeTrue())
+
+		_, ok = registry.Classify(errors.New("plain"))
+		Expect(ok).To(BeFalse())
+	})
+
+	It("rejects reserved and duplicate codes", func() {
+		_, err := registry.Register(42, "MINE", false, "")
+		Expect(err).To(MatchError("error code 42 is reserved; plugin-specific codes start at 100"))
+		_, err = registry.Register(types.ErrInternal, "MINE", false, "")
+		Expect(err).To(HaveOccurred())
+
+		registry.MustRegister(120, "LEASE_EXHAUSTED", true, "")
+		_, err = registry.Register(120, "OTHER", false, "")
+		Expect(err).To(MatchError("error code 120 is already registered as LEASE_EXHAUSTED"))
+		_, err = registry.Register(121, "LEASE_EXHAUSTED", false, "")
+		Expect(err).To(MatchError("error name LEASE_EXHAUSTED is already registered for code 120"))
+		Expect(func() { registry.MustRegister(121, "", false, "") }).To(Panic())
+	})
+
+	It("lists the codes in order", func() {
+		registry.MustRegister(101, "FIRST", false, "")
+		codes := registry.Codes()
+		Expect(codes[0].Code).To(Equal(types.ErrUnknown))
+		Expect(codes[len(codes)-1].Code).To(Equal(types.ErrInternal))
+	})
+})
@@ -0,0 +1,62 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// InvalidMACError is returned for a MAC address that cannot be parsed
+type InvalidMACError struct {
+	MAC string
+	Err error
+}
+
+func (e *InvalidMACError) Error() string {
+	return fmt.Sprintf("invalid MAC address %q: %v", e.MAC, e.Err)
+}
+
+func (e *InvalidMACError) Unwrap() error {
+	return e.Err
+}
+
+// NormalizeMAC returns mac in canonical form, lowercase and colon
+// separated, such as "0a:58:0a:01:02:03". It accepts the formats of
+// net.ParseMAC, such as "0A-58-0A-01-02-03" and "0a58.0a01.0203", and
+// returns an InvalidMACError for other values. An empty mac is returned
+// unchanged.
+func NormalizeMAC(mac string) (string, error) {
+	if mac == "" {
+		return "", nil
+	}
+	hw, err := net.ParseMAC(mac)
+	if err != nil {
+		return "", &InvalidMACError{MAC: mac, Err: err}
+	}
+	return hw.String(), nil
+}
+
+// SameMAC returns true if a and b are the same MAC address, regardless of
+// their format. Values that cannot be parsed are compared ignoring case.
+func SameMAC(a, b string) bool {
+	na, errA := NormalizeMAC(a)
+	nb, errB := NormalizeMAC(b)
+	if errA != nil || errB != nil {
+		return strings.EqualFold(a, b)
+	}
+	return na == nb
+}
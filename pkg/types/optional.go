@@ -0,0 +1,118 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+var jsonNull = []byte("null")
+
+// OptionalBool is a tri-state boolean for use in configuration structs.
+// It records whether the field was present in the JSON at all, so plugins
+// can tell an absent field from one explicitly set to false. An absent or
+// null field unmarshals to the zero value, which has IsSet() == false.
+// An unset OptionalBool marshals to null.
+type OptionalBool struct {
+	value bool
+	set   bool
+}
+
+// NewOptionalBool returns an OptionalBool that is set to v
+func NewOptionalBool(v bool) OptionalBool {
+	return OptionalBool{value: v, set: true}
+}
+
+// IsSet returns true if the value was explicitly provided
+func (b OptionalBool) IsSet() bool {
+	return b.set
+}
+
+// Get returns the value, or def if the value was not provided
+func (b OptionalBool) Get(def bool) bool {
+	if !b.set {
+		return def
+	}
+	return b.value
+}
+
+func (b OptionalBool) MarshalJSON() ([]byte, error) {
+	if !b.set {
+		return jsonNull, nil
+	}
+	return json.Marshal(b.value)
+}
+
+func (b *OptionalBool) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, jsonNull) {
+		*b = OptionalBool{}
+		return nil
+	}
+	var v bool
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*b = NewOptionalBool(v)
+	return nil
+}
+
+// OptionalInt is a tri-state integer for use in configuration structs.
+// It records whether the field was present in the JSON at all, so plugins
+// can tell an absent field from one explicitly set to zero. An absent or
+// null field unmarshals to the zero value, which has IsSet() == false.
+// An unset OptionalInt marshals to null.
+type OptionalInt struct {
+	value int
+	set   bool
+}
+
+// NewOptionalInt returns an OptionalInt that is set to v
+func NewOptionalInt(v int) OptionalInt {
+	return OptionalInt{value: v, set: true}
+}
+
+// IsSet returns true if the value was explicitly provided
+func (i OptionalInt) IsSet() bool {
+	return i.set
+}
+
+// Get returns the value, or def if the value was not provided
+func (i OptionalInt) Get(def int) int {
+	if !i.set {
+		return def
+	}
+	return i.value
+}
+
+func (i OptionalInt) MarshalJSON() ([]byte, error) {
+	if !i.set {
+		return jsonNull, nil
+	}
+	return json.Marshal(i.value)
+}
+
+func (i *OptionalInt) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, jsonNull) {
+		*i = OptionalInt{}
+		return nil
+	}
+	var v int
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*i = NewOptionalInt(v)
+	return nil
+}
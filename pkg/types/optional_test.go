@@ -0,0 +1,70 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types_test
+
+import (
+	"encoding/json"
+
+	"github.com/containernetworking/cni/pkg/types"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Optional types", func() {
+	type conf struct {
+		Enabled types.OptionalBool `json:"enabled"`
+		MTU     types.OptionalInt  `json:"mtu"`
+	}
+
+	It("distinguishes absent fields from zero values", func() {
+		c := conf{}
+		Expect(json.Unmarshal([]byte(`{}`), &c)).To(Succeed())
+		Expect(c.Enabled.IsSet()).To(BeFalse())
+		Expect(c.Enabled.Get(true)).To(BeTrue())
+		Expect(c.MTU.IsSet()).To(BeFalse())
+		Expect(c.MTU.Get(1500)).To(Equal(1500))
+
+		c = conf{}
+		Expect(json.Unmarshal([]byte(`{"enabled": false, "mtu": 0}`), &c)).To(Succeed())
+		Expect(c.Enabled.IsSet()).To(BeTrue())
+		Expect(c.Enabled.Get(true)).To(BeFalse())
+		Expect(c.MTU.IsSet()).To(BeTrue())
+		Expect(c.MTU.Get(1500)).To(Equal(0))
+	})
+
+	It("treats null as absent", func() {
+		c := conf{Enabled: types.NewOptionalBool(true), MTU: types.NewOptionalInt(9000)}
+		Expect(json.Unmarshal([]byte(`{"enabled": null, "mtu": null}`), &c)).To(Succeed())
+		Expect(c.Enabled.IsSet()).To(BeFalse())
+		Expect(c.MTU.IsSet()).To(BeFalse())
+	})
+
+	It("round-trips through JSON", func() {
+		data, err := json.Marshal(conf{Enabled: types.NewOptionalBool(false), MTU: types.NewOptionalInt(1400)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(MatchJSON(`{"enabled": false, "mtu": 1400}`))
+
+		data, err = json.Marshal(conf{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(MatchJSON(`{"enabled": null, "mtu": null}`))
+	})
+
+	It("rejects values of the wrong type", func() {
+		c := conf{}
+		Expect(json.Unmarshal([]byte(`{"enabled": "yes"}`), &c)).NotTo(Succeed())
+		Expect(json.Unmarshal([]byte(`{"mtu": 1.5}`), &c)).NotTo(Succeed())
+	})
+})
@@ -137,10 +137,36 @@ func (d *DNS) Copy() *DNS {
 type Route struct {
 	Dst net.IPNet
 	GW  net.IP
+	// From, if set, limits the route to packets with a source address in
+	// this prefix, like the "from" selector of an ip rule
+	From *net.IPNet
+	// Table, if set, is the routing table the route is added to, like
+	// the "table" action of an ip rule
+	Table *int
+	// Plugin, if set, is the type of the plugin in the chain that added
+	// the route. It is only recorded in results of version 1.0.0 and later.
+	Plugin string
 }
 
 func (r *Route) String() string {
-	return fmt.Sprintf("%+v", *r)
+	s := fmt.Sprintf("{Dst:%+v GW:%v", r.Dst, r.GW)
+	if r.From != nil {
+		s += fmt.Sprintf(" From:%v", r.From)
+	}
+	if r.Table != nil {
+		s += fmt.Sprintf(" Table:%d", *r.Table)
+	}
+	if r.Plugin != "" {
+		s += fmt.Sprintf(" Plugin:%s", r.Plugin)
+	}
+	return s + "}"
+}
+
+// HasPolicySelectors returns true if the route uses the From or Table
+// fields. Such routes can only be represented in results of version 1.0.0
+// and later.
+func (r *Route) HasPolicySelectors() bool {
+	return r.From != nil || r.Table != nil
 }
 
 func (r *Route) Copy() *Route {
@@ -148,10 +174,20 @@ func (r *Route) Copy() *Route {
 		return nil
 	}
 
-	return &Route{
-		Dst: r.Dst,
-		GW:  r.GW,
+	route := &Route{
+		Dst:    r.Dst,
+		GW:     r.GW,
+		Plugin: r.Plugin,
 	}
+	if r.From != nil {
+		from := *r.From
+		route.From = &from
+	}
+	if r.Table != nil {
+		table := *r.Table
+		route.Table = &table
+	}
+	return route
 }
 
 // Well known error codes
@@ -166,6 +202,8 @@ const (
 	ErrDecodingFailure                         // 6
 	ErrInvalidNetworkConfig                    // 7
 	ErrTryAgainLater               uint = 11
+	ErrPluginNotAvailable          uint = 50  // STATUS: the plugin cannot service ADD requests
+	ErrTimeout                     uint = 998 // not in the spec; see skel.WithTimeout
 	ErrInternal                    uint = 999
 )
 
@@ -173,6 +211,8 @@ type Error struct {
 	Code    uint   `json:"code"`
 	Msg     string `json:"msg"`
 	Details string `json:"details,omitempty"`
+	// Verification optionally details the outcome of a failed CHECK
+	Verification *Verification `json:"verification,omitempty"`
 }
 
 func NewError(code uint, msg, details string) *Error {
@@ -200,8 +240,11 @@ func (e *Error) Print() error {
 
 // JSON (un)marshallable types
 type route struct {
-	Dst IPNet  `json:"dst"`
-	GW  net.IP `json:"gw,omitempty"`
+	Dst    IPNet  `json:"dst"`
+	GW     net.IP `json:"gw,omitempty"`
+	From   *IPNet `json:"from,omitempty"`
+	Table  *int   `json:"table,omitempty"`
+	Plugin string `json:"plugin,omitempty"`
 }
 
 func (r *Route) UnmarshalJSON(data []byte) error {
@@ -212,13 +255,25 @@ func (r *Route) UnmarshalJSON(data []byte) error {
 
 	r.Dst = net.IPNet(rt.Dst)
 	r.GW = rt.GW
+	if rt.From != nil {
+		from := net.IPNet(*rt.From)
+		r.From = &from
+	}
+	r.Table = rt.Table
+	r.Plugin = rt.Plugin
 	return nil
 }
 
 func (r Route) MarshalJSON() ([]byte, error) {
 	rt := route{
-		Dst: IPNet(r.Dst),
-		GW:  r.GW,
+		Dst:    IPNet(r.Dst),
+		GW:     r.GW,
+		Table:  r.Table,
+		Plugin: r.Plugin,
+	}
+	if r.From != nil {
+		from := IPNet(*r.From)
+		rt.From = &from
 	}
 
 	return json.Marshal(rt)
@@ -112,6 +112,42 @@ var _ = Describe("Types", func() {
 		It("formats as a string with a hex mask", func() {
 			Expect(example.String()).To(Equal(`{Dst:{IP:1.2.3.0 Mask:ffffff00} GW:1.2.3.1}`))
 		})
+
+		Context("when the route has policy selectors", func() {
+			BeforeEach(func() {
+				example.From = &net.IPNet{
+					IP:   net.ParseIP("10.0.0.0").To4(),
+					Mask: net.CIDRMask(16, 32),
+				}
+				table := 100
+				example.Table = &table
+			})
+
+			It("marshals and unmarshals to JSON", func() {
+				jsonBytes, err := json.Marshal(example)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(jsonBytes).To(MatchJSON(`{ "dst": "1.2.3.0/24", "gw": "1.2.3.1", "from": "10.0.0.0/16", "table": 100 }`))
+
+				var unmarshaled types.Route
+				Expect(json.Unmarshal(jsonBytes, &unmarshaled)).To(Succeed())
+				Expect(unmarshaled.From.String()).To(Equal("10.0.0.0/16"))
+				Expect(*unmarshaled.Table).To(Equal(100))
+				Expect(unmarshaled.HasPolicySelectors()).To(BeTrue())
+			})
+
+			It("copies the selectors", func() {
+				copied := example.Copy()
+				Expect(copied).To(Equal(&example))
+				*copied.Table = 200
+				copied.From.Mask = net.CIDRMask(8, 32)
+				Expect(*example.Table).To(Equal(100))
+				Expect(example.From.String()).To(Equal("10.0.0.0/16"))
+			})
+
+			It("includes the selectors in the string", func() {
+				Expect(example.String()).To(Equal(`{Dst:{IP:1.2.3.0 Mask:ffffff00} GW:1.2.3.1 From:10.0.0.0/16 Table:100}`))
+			})
+		})
 	})
 
 	Describe("Error type", func() {
@@ -143,4 +179,32 @@ var _ = Describe("Types", func() {
 			Expect(err).To(Equal(example))
 		})
 	})
+
+	Describe("MAC addresses", func() {
+		DescribeTable("normalizing",
+			func(input, expected string) {
+				mac, err := types.NormalizeMAC(input)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(mac).To(Equal(expected))
+			},
+			Entry("canonical", "0a:58:0a:01:02:03", "0a:58:0a:01:02:03"),
+			Entry("upper case", "0A:58:0A:01:02:03", "0a:58:0a:01:02:03"),
+			Entry("hyphens", "0a-58-0a-01-02-03", "0a:58:0a:01:02:03"),
+			Entry("dots", "0a58.0a01.0203", "0a:58:0a:01:02:03"),
+			Entry("empty", "", ""),
+		)
+
+		It("returns an InvalidMACError for invalid values", func() {
+			_, err := types.NormalizeMAC("0a:58:0a:01:02")
+			Expect(err).To(MatchError(`invalid MAC address "0a:58:0a:01:02": address 0a:58:0a:01:02: invalid MAC address`))
+			_, ok := err.(*types.InvalidMACError)
+			Expect(ok).To(BeTrue())
+		})
+
+		It("compares MAC addresses regardless of format", func() {
+			Expect(types.SameMAC("0A-58-0A-01-02-03", "0a58.0a01.0203")).To(BeTrue())
+			Expect(types.SameMAC("0a:58:0a:01:02:03", "0a:58:0a:01:02:04")).To(BeFalse())
+			Expect(types.SameMAC("BOGUS", "bogus")).To(BeTrue())
+		})
+	})
 })
@@ -0,0 +1,148 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+// VerificationStatus is the outcome of CHECK for one part of an attachment
+type VerificationStatus string
+
+const (
+	// VerificationVerified means the state matches the result
+	VerificationVerified VerificationStatus = "verified"
+	// VerificationDrifted means the state no longer matches the result
+	VerificationDrifted VerificationStatus = "drifted"
+	// VerificationUnknown means no plugin could vouch for the state
+	VerificationUnknown VerificationStatus = "unknown"
+)
+
+// InterfaceVerification is the CHECK outcome for an interface of a result
+type InterfaceVerification struct {
+	Name    string             `json:"name"`
+	Sandbox string             `json:"sandbox,omitempty"`
+	Status  VerificationStatus `json:"status"`
+	Message string             `json:"message,omitempty"`
+}
+
+// IPVerification is the CHECK outcome for an address of a result, in CIDR
+// notation
+type IPVerification struct {
+	Address string             `json:"address"`
+	Status  VerificationStatus `json:"status"`
+	Message string             `json:"message,omitempty"`
+}
+
+// Verification holds the CHECK outcomes for the interfaces and addresses
+// of an attachment. A plugin that finds drift can attach one to the
+// *Error it fails CHECK with, so that the runtime learns what drifted
+// rather than only that CHECK failed.
+type Verification struct {
+	Interfaces []*InterfaceVerification `json:"interfaces,omitempty"`
+	IPs        []*IPVerification        `json:"ips,omitempty"`
+}
+
+// SetInterface records the status of the interface with the given name
+// and sandbox, adding it if it is not yet present
+func (v *Verification) SetInterface(name, sandbox string, status VerificationStatus, message string) {
+	for _, iface := range v.Interfaces {
+		if iface.Name == name && iface.Sandbox == sandbox {
+			iface.Status, iface.Message = status, message
+			return
+		}
+	}
+	v.Interfaces = append(v.Interfaces, &InterfaceVerification{Name: name, Sandbox: sandbox, Status: status, Message: message})
+}
+
+// SetIP records the status of the address, adding it if it is not yet
+// present
+func (v *Verification) SetIP(address string, status VerificationStatus, message string) {
+	for _, ip := range v.IPs {
+		if ip.Address == address {
+			ip.Status, ip.Message = status, message
+			return
+		}
+	}
+	v.IPs = append(v.IPs, &IPVerification{Address: address, Status: status, Message: message})
+}
+
+// Merge records the outcomes of other. An entry that is already drifted
+// stays drifted, and unknown outcomes in other do not overwrite known ones.
+func (v *Verification) Merge(other *Verification) {
+	if other == nil {
+		return
+	}
+	for _, iface := range other.Interfaces {
+		if mergeStatus(v.interfaceStatus(iface.Name, iface.Sandbox), iface.Status) {
+			v.SetInterface(iface.Name, iface.Sandbox, iface.Status, iface.Message)
+		}
+	}
+	for _, ip := range other.IPs {
+		if mergeStatus(v.ipStatus(ip.Address), ip.Status) {
+			v.SetIP(ip.Address, ip.Status, ip.Message)
+		}
+	}
+}
+
+// mergeStatus returns true if next should replace the current status
+func mergeStatus(current, next VerificationStatus) bool {
+	switch {
+	case current == "":
+		return true
+	case current == VerificationDrifted:
+		return false
+	case next == VerificationUnknown:
+		return false
+	}
+	return true
+}
+
+func (v *Verification) interfaceStatus(name, sandbox string) VerificationStatus {
+	for _, iface := range v.Interfaces {
+		if iface.Name == name && iface.Sandbox == sandbox {
+			return iface.Status
+		}
+	}
+	return ""
+}
+
+func (v *Verification) ipStatus(address string) VerificationStatus {
+	for _, ip := range v.IPs {
+		if ip.Address == address {
+			return ip.Status
+		}
+	}
+	return ""
+}
+
+// Status summarizes the verification: drifted if any entry drifted,
+// otherwise unknown if any entry is unknown, otherwise verified
+func (v *Verification) Status() VerificationStatus {
+	status := VerificationVerified
+	for _, iface := range v.Interfaces {
+		status = worseStatus(status, iface.Status)
+	}
+	for _, ip := range v.IPs {
+		status = worseStatus(status, ip.Status)
+	}
+	return status
+}
+
+func worseStatus(a, b VerificationStatus) VerificationStatus {
+	if a == VerificationDrifted || b == VerificationDrifted {
+		return VerificationDrifted
+	}
+	if a == VerificationUnknown || b == VerificationUnknown {
+		return VerificationUnknown
+	}
+	return a
+}
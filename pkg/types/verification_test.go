@@ -0,0 +1,73 @@
+// Copyright 2021 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types_test
+
+import (
+	"encoding/json"
+
+	"github.com/containernetworking/cni/pkg/types"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Verification", func() {
+	var v *types.Verification
+
+	BeforeEach(func() {
+		v = &types.Verification{}
+		v.SetInterface("eth0", "/some/netns", types.VerificationUnknown, "")
+		v.SetIP("10.0.0.2/24", types.VerificationUnknown, "")
+	})
+
+	It("summarizes the worst status", func() {
+		Expect(v.Status()).To(Equal(types.VerificationUnknown))
+		v.SetInterface("eth0", "/some/netns", types.VerificationVerified, "")
+		v.SetIP("10.0.0.2/24", types.VerificationVerified, "")
+		Expect(v.Status()).To(Equal(types.VerificationVerified))
+		v.SetIP("10.0.0.2/24", types.VerificationDrifted, "address missing")
+		Expect(v.Status()).To(Equal(types.VerificationDrifted))
+		Expect(v.IPs).To(HaveLen(1))
+	})
+
+	It("merges reports without losing drift", func() {
+		v.Merge(&types.Verification{
+			Interfaces: []*types.InterfaceVerification{{Name: "eth0", Sandbox: "/some/netns", Status: types.VerificationDrifted, Message: "MTU changed"}},
+			IPs:        []*types.IPVerification{{Address: "10.0.0.2/24", Status: types.VerificationVerified}},
+		})
+		v.Merge(&types.Verification{
+			Interfaces: []*types.InterfaceVerification{{Name: "eth0", Sandbox: "/some/netns", Status: types.VerificationVerified}},
+			IPs:        []*types.IPVerification{{Address: "10.0.0.2/24", Status: types.VerificationUnknown}},
+		})
+		Expect(v.Interfaces[0].Status).To(Equal(types.VerificationDrifted))
+		Expect(v.Interfaces[0].Message).To(Equal("MTU changed"))
+		Expect(v.IPs[0].Status).To(Equal(types.VerificationVerified))
+	})
+
+	It("is carried by an error", func() {
+		e := types.NewError(types.ErrInternal, "eth0 drifted", "")
+		e.Verification = v
+		data, err := json.Marshal(e)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(MatchJSON(`{
+			"code": 999,
+			"msg": "eth0 drifted",
+			"verification": {
+				"interfaces": [{"name": "eth0", "sandbox": "/some/netns", "status": "unknown"}],
+				"ips": [{"address": "10.0.0.2/24", "status": "unknown"}]
+			}
+		}`))
+	})
+})
@@ -33,13 +33,45 @@ type PluginInfo interface {
 	Encode(io.Writer) error
 }
 
+// PluginFeatures is implemented by a PluginInfo that also reports the
+// runtime capabilities, such as "portMappings", and the verbs, such as
+// "CHECK", that the plugin supports. Runtimes can check for it with a type
+// assertion on the PluginInfo returned by the VERSION command.
+type PluginFeatures interface {
+	Capabilities() []string
+	Verbs() []string
+}
+
+// Requirements are what a plugin needs from the host to run ADD
+type Requirements struct {
+	// LinuxCapabilities are the capabilities the plugin needs, such as
+	// "CAP_NET_ADMIN"
+	LinuxCapabilities []string `json:"linuxCapabilities,omitempty"`
+	// KernelModules are the kernel modules that must be loaded, such as
+	// "vxlan"
+	KernelModules []string `json:"kernelModules,omitempty"`
+}
+
+// PluginRequirements is implemented by a PluginInfo that also reports
+// the plugin's Requirements, so that runtimes and installers can check
+// the host before using the plugin
+type PluginRequirements interface {
+	Requires() *Requirements
+}
+
 type pluginInfo struct {
-	CNIVersion_        string   `json:"cniVersion"`
-	SupportedVersions_ []string `json:"supportedVersions,omitempty"`
+	CNIVersion_        string        `json:"cniVersion"`
+	SupportedVersions_ []string      `json:"supportedVersions,omitempty"`
+	Capabilities_      []string      `json:"capabilities,omitempty"`
+	Verbs_             []string      `json:"verbs,omitempty"`
+	Requires_          *Requirements `json:"requires,omitempty"`
 }
 
-// pluginInfo implements the PluginInfo interface
+// pluginInfo implements the PluginInfo, PluginFeatures and
+// PluginRequirements interfaces
 var _ PluginInfo = &pluginInfo{}
+var _ PluginFeatures = &pluginInfo{}
+var _ PluginRequirements = &pluginInfo{}
 
 func (p *pluginInfo) Encode(w io.Writer) error {
 	return json.NewEncoder(w).Encode(p)
@@ -49,6 +81,44 @@ func (p *pluginInfo) SupportedVersions() []string {
 	return p.SupportedVersions_
 }
 
+func (p *pluginInfo) Capabilities() []string {
+	return p.Capabilities_
+}
+
+func (p *pluginInfo) Verbs() []string {
+	return p.Verbs_
+}
+
+func (p *pluginInfo) Requires() *Requirements {
+	return p.Requires_
+}
+
+// PluginSupportsFeatures returns a PluginInfo that reports the versions
+// of info as supported, along with the given capabilities and verbs
+func PluginSupportsFeatures(info PluginInfo, capabilities, verbs []string) PluginInfo {
+	return &pluginInfo{
+		CNIVersion_:        Current(),
+		SupportedVersions_: info.SupportedVersions(),
+		Capabilities_:      capabilities,
+		Verbs_:             verbs,
+	}
+}
+
+// PluginWithRequirements returns a PluginInfo that reports the versions
+// and features of info along with requirements
+func PluginWithRequirements(info PluginInfo, requirements Requirements) PluginInfo {
+	p := &pluginInfo{
+		CNIVersion_:        Current(),
+		SupportedVersions_: info.SupportedVersions(),
+		Requires_:          &requirements,
+	}
+	if features, ok := info.(PluginFeatures); ok {
+		p.Capabilities_ = features.Capabilities()
+		p.Verbs_ = features.Verbs()
+	}
+	return p
+}
+
 // PluginSupports returns a new PluginInfo that will report the given versions
 // as supported
 func PluginSupports(supportedVersions ...string) PluginInfo {
@@ -15,6 +15,8 @@
 package version_test
 
 import (
+	"bytes"
+
 	"github.com/containernetworking/cni/pkg/version"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -44,6 +46,51 @@ var _ = Describe("Decoding versions reported by a plugin", func() {
 		}))
 	})
 
+	It("decodes the capabilities and verbs the plugin reports", func() {
+		pluginInfo, err := decoder.Decode([]byte(`{
+			"cniVersion": "1.0.0",
+			"supportedVersions": ["1.0.0"],
+			"capabilities": ["portMappings"],
+			"verbs": ["ADD", "DEL", "VERSION"]
+		}`))
+		Expect(err).NotTo(HaveOccurred())
+		features, ok := pluginInfo.(version.PluginFeatures)
+		Expect(ok).To(BeTrue())
+		Expect(features.Capabilities()).To(Equal([]string{"portMappings"}))
+		Expect(features.Verbs()).To(Equal([]string{"ADD", "DEL", "VERSION"}))
+	})
+
+	It("encodes the features of a PluginInfo", func() {
+		info := version.PluginSupportsFeatures(version.PluginSupports("0.4.0", "1.0.0"), []string{"bandwidth"}, []string{"ADD"})
+		var buf bytes.Buffer
+		Expect(info.Encode(&buf)).To(Succeed())
+		Expect(buf.String()).To(MatchJSON(`{
+			"cniVersion": "` + version.Current() + `",
+			"supportedVersions": ["0.4.0", "1.0.0"],
+			"capabilities": ["bandwidth"],
+			"verbs": ["ADD"]
+		}`))
+	})
+
+	It("round-trips the requirements of a PluginInfo", func() {
+		info := version.PluginWithRequirements(
+			version.PluginSupportsFeatures(version.PluginSupports("1.0.0"), []string{"bandwidth"}, []string{"ADD"}),
+			version.Requirements{LinuxCapabilities: []string{"CAP_NET_ADMIN"}, KernelModules: []string{"vxlan"}},
+		)
+		var buf bytes.Buffer
+		Expect(info.Encode(&buf)).To(Succeed())
+
+		pluginInfo, err := decoder.Decode(buf.Bytes())
+		Expect(err).NotTo(HaveOccurred())
+		requirements, ok := pluginInfo.(version.PluginRequirements)
+		Expect(ok).To(BeTrue())
+		Expect(requirements.Requires()).To(Equal(&version.Requirements{
+			LinuxCapabilities: []string{"CAP_NET_ADMIN"},
+			KernelModules:     []string{"vxlan"},
+		}))
+		Expect(pluginInfo.(version.PluginFeatures).Capabilities()).To(Equal([]string{"bandwidth"}))
+	})
+
 	Context("when the bytes cannot be decoded as json", func() {
 		BeforeEach(func() {
 			versionStdout = []byte(`{{{`)
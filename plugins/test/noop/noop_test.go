@@ -65,7 +65,7 @@ var _ = Describe("No-op plugin", func() {
 			// Keep this last
 			"CNI_ARGS=" + args,
 		}
-		stdinData := `{"name": "noop-test", "some":"stdin-json", "cniVersion": "0.3.1"}`
+		stdinData := `{"name": "noop-test", "type": "noop", "some":"stdin-json", "cniVersion": "0.3.1"}`
 		cmd.Stdin = strings.NewReader(stdinData)
 		expectedCmdArgs = skel.CmdArgs{
 			ContainerID: "some-container-id",
@@ -104,6 +104,7 @@ var _ = Describe("No-op plugin", func() {
 
 		cmd.Stdin = strings.NewReader(`{
 	"name":"noop-test",
+	"type":"noop",
 	"some":"stdin-json",
 	"cniVersion": "0.3.1",
 	"prevResult": {
@@ -123,6 +124,7 @@ var _ = Describe("No-op plugin", func() {
 
 		cmd.Stdin = strings.NewReader(`{
 	"name":"noop-test",
+	"type":"noop",
 	"some":"stdin-json",
 	"cniVersion": "0.4.0",
 	"prevResult": {
@@ -142,6 +144,7 @@ var _ = Describe("No-op plugin", func() {
 
 		cmd.Stdin = strings.NewReader(`{
 	"name":"noop-test",
+	"type":"noop",
 	"some":"stdin-json",
 	"cniVersion": "0.4.0",
 	"prevResult": {
@@ -165,7 +168,7 @@ var _ = Describe("No-op plugin", func() {
 		// Remove the DEBUG option from CNI_ARGS and regular args
 		newArgs := "FOO=BAR"
 		cmd.Env[len(cmd.Env)-1] = "CNI_ARGS=" + newArgs
-		newStdin := fmt.Sprintf(`{"name":"noop-test", "some": "stdin-json", "cniVersion": "0.4.0", "debugFile": %q}`, debugFileName)
+		newStdin := fmt.Sprintf(`{"name":"noop-test", "type":"noop", "some": "stdin-json", "cniVersion": "0.4.0", "debugFile": %q}`, debugFileName)
 		cmd.Stdin = strings.NewReader(newStdin)
 		expectedCmdArgs.Args = newArgs
 		expectedCmdArgs.StdinData = []byte(newStdin)